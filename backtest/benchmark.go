@@ -0,0 +1,359 @@
+package backtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/mcwarner5/BlockBot8000/exchanges"
+	"github.com/mcwarner5/BlockBot8000/strategies"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+type Benchmark int16
+
+const (
+	BuyAndHold  Benchmark = iota
+	EqualWeight Benchmark = iota
+	StaticCoin  Benchmark = iota
+	Bitcoin     Benchmark = iota
+)
+
+func (w Benchmark) String() string {
+	return [...]string{"buy_and_hold", "equal_weight", "static_coin", "btc"}[w]
+}
+
+func (w Benchmark) EnumIndex() int {
+	return int(w)
+}
+
+// Benchmarks are all the benchmarks, in report order.
+var Benchmarks = []Benchmark{BuyAndHold, EqualWeight, StaticCoin, Bitcoin}
+
+// ParseBenchmark gets the benchmark with the specified name.
+func ParseBenchmark(name string) (Benchmark, error) {
+	for _, benchmark := range Benchmarks {
+		if benchmark.String() == name {
+			return benchmark, nil
+		}
+	}
+	return BuyAndHold, errors.New("unknown benchmark " + name + ": expected buy_and_hold, equal_weight, static_coin or btc")
+}
+
+// Limits of the trades of the benchmark portfolios.
+const (
+	benchmarkMinTrade    = 0.001 // smallest trade, as a fraction of the portfolio value, so that rounding errors are not traded.
+	benchmarkSpendMargin = 0.005 // share of the static coin left when buying with all of it, for the slippage of the fills.
+)
+
+// BenchmarkResult represents a benchmark portfolio simulated alongside a run, compared to the strategies of the run.
+type BenchmarkResult struct {
+	Benchmark     Benchmark
+	Metrics       Metrics
+	Equity        EquityCurve
+	ExcessReturn  decimal.Decimal // Return of the strategies minus the return of the benchmark, as a fraction.
+	ExcessAPR     decimal.Decimal // APR of the strategies minus the APR of the benchmark, in percent.
+	TrackingError decimal.Decimal // Yearly standard deviation of the step returns of the strategies minus the benchmark, in percent.
+	Err           error           // Why the benchmark could not be simulated, if it could not.
+}
+
+// benchmarkStrategy trades a sub-account to a fixed allocation, once at the start or every month.
+type benchmarkStrategy struct {
+	benchmark  Benchmark
+	staticCoin string                     // coin the other coins are traded against.
+	weights    map[string]decimal.Decimal // target share of the value of each coin, the initial balances are held if nil.
+	rebalanced time.Time                  // time of the last rebalance, zero before the first one.
+}
+
+// newBenchmarkStrategy creates the strategy of a benchmark of the configured strategies. The static coin and the weights
+// come from the first strategy spec defining them, the coins are traded on the markets quoted in the static coin.
+func newBenchmarkStrategy(benchmark Benchmark, configs []environment.StrategyConfig, markets []*environment.Market) (*benchmarkStrategy, error) {
+	strategy := &benchmarkStrategy{benchmark: benchmark, staticCoin: specStaticCoin(configs)}
+	if strategy.staticCoin == "" {
+		return nil, errors.New("benchmarks need the static_coin of a strategy spec")
+	}
+	specWeights := specPortfolioWeights(configs)
+	coinMarkets := staticMarkets(markets, strategy.staticCoin)
+
+	switch benchmark {
+	case BuyAndHold:
+		strategy.weights = specWeights
+	case EqualWeight:
+		coins := []string{strategy.staticCoin}
+		for coin := range coinMarkets {
+			coins = append(coins, coin)
+		}
+		if specWeights != nil {
+			coins = coins[:0]
+			for coin := range specWeights {
+				coins = append(coins, coin)
+			}
+		}
+		strategy.weights = make(map[string]decimal.Decimal, len(coins))
+		for _, coin := range coins {
+			strategy.weights[coin] = decimal.NewFromInt(1).Div(decimal.NewFromInt(int64(len(coins))))
+		}
+	case StaticCoin:
+		strategy.weights = map[string]decimal.Decimal{strategy.staticCoin: decimal.NewFromInt(1)}
+	case Bitcoin:
+		strategy.weights = map[string]decimal.Decimal{"btc": decimal.NewFromInt(1)}
+	}
+
+	for coin := range strategy.weights {
+		if _, exists := coinMarkets[coin]; coin != strategy.staticCoin && !exists {
+			return nil, fmt.Errorf("the %s benchmark needs a %s-%s market in the strategy markets", benchmark, coin, strategy.staticCoin)
+		}
+	}
+	return strategy, nil
+}
+
+// GetName returns the name of the benchmark.
+func (strategy benchmarkStrategy) GetName() string {
+	return "benchmark " + strategy.benchmark.String()
+}
+
+func (strategy benchmarkStrategy) Setup(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) (strategies.Strategy, error) {
+	return strategy, nil
+}
+
+func (strategy benchmarkStrategy) TearDown(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) (strategies.Strategy, error) {
+	return strategy, nil
+}
+
+func (strategy benchmarkStrategy) OnError(err error) {
+	logrus.Error(strategy.GetName(), ": ", err)
+}
+
+// OnUpdate trades to the allocation of the benchmark at the first step, and at the first step of every month for the
+// equal weight benchmark.
+func (strategy benchmarkStrategy) OnUpdate(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) (strategies.Strategy, error) {
+	now := exchanges.ClockOf(wrappers...).Now()
+	due := strategy.rebalanced.IsZero() ||
+		(strategy.benchmark == EqualWeight && (now.Month() != strategy.rebalanced.Month() || now.Year() != strategy.rebalanced.Year()))
+	if !due || strategy.weights == nil {
+		return strategy, nil
+	}
+
+	if err := strategy.rebalance(wrappers[0], markets); err != nil {
+		return strategy, err
+	}
+	strategy.rebalanced = now
+	return strategy, nil
+}
+
+// Checkpoint saves the time of the last rebalance, to resume a simulation.
+func (strategy benchmarkStrategy) Checkpoint() (json.RawMessage, error) {
+	return json.Marshal(strategy.rebalanced)
+}
+
+// Restore restores the time of the last rebalance saved by Checkpoint.
+func (strategy benchmarkStrategy) Restore(state json.RawMessage, wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) (strategies.Strategy, error) {
+	if err := json.Unmarshal(state, &strategy.rebalanced); err != nil {
+		return strategy, err
+	}
+	return strategy, nil
+}
+
+// rebalance sells the coins above their weight to the static coin, then buys the coins below their weight with it.
+func (strategy benchmarkStrategy) rebalance(wrapper exchanges.ExchangeWrapper, markets []*environment.Market) error {
+	coinMarkets := staticMarkets(markets, strategy.staticCoin)
+	coins := make([]string, 0, len(coinMarkets))
+	for coin := range coinMarkets {
+		coins = append(coins, coin)
+	}
+	sort.Strings(coins)
+
+	tradeMarkets := make([]*environment.Market, len(coins))
+	for i, coin := range coins {
+		tradeMarkets[i] = coinMarkets[coin]
+	}
+	summaries, err := wrapper.GetMarketSummaries(tradeMarkets)
+	if err != nil {
+		return err
+	}
+
+	prices := make(map[string]decimal.Decimal, len(coins))
+	values := make(map[string]decimal.Decimal, len(coins))
+	total, err := balanceOf(wrapper, strategy.staticCoin)
+	if err != nil {
+		return err
+	}
+	for i, coin := range coins {
+		if summaries[i] == nil || !summaries[i].Last.IsPositive() {
+			return errors.New("no price to rebalance " + coin)
+		}
+		balance, err := balanceOf(wrapper, coin)
+		if err != nil {
+			return err
+		}
+		prices[coin] = summaries[i].Last
+		values[coin] = balance.Mul(prices[coin])
+		total = total.Add(values[coin])
+	}
+	minTrade := total.Mul(decimal.NewFromFloat(benchmarkMinTrade))
+
+	for _, coin := range coins {
+		excess := values[coin].Sub(strategy.weights[coin].Mul(total))
+		if excess.LessThanOrEqual(minTrade) {
+			continue
+		}
+		balance, _ := balanceOf(wrapper, coin)
+		amount := decimal.Min(excess.DivRound(prices[coin], 8), balance)
+		if _, err := wrapper.SellMarket(coinMarkets[coin], amount); err != nil {
+			return err
+		}
+	}
+
+	available, err := balanceOf(wrapper, strategy.staticCoin)
+	if err != nil {
+		return err
+	}
+	available = available.Mul(decimal.NewFromFloat(1 - benchmarkSpendMargin))
+	for _, coin := range coins {
+		missing := strategy.weights[coin].Mul(total).Sub(values[coin])
+		if missing.LessThanOrEqual(minTrade) || !available.IsPositive() {
+			continue
+		}
+		spend := decimal.Min(missing, available)
+		fees := wrapper.CalculateTradingFees(coinMarkets[coin], spend.Div(prices[coin]), prices[coin], environment.Buy)
+		amount := spend.Sub(fees).DivRound(prices[coin], 8)
+		if !amount.IsPositive() {
+			continue
+		}
+		if _, err := wrapper.BuyMarket(coinMarkets[coin], amount); err != nil {
+			return err
+		}
+		available = available.Sub(spend)
+	}
+	return nil
+}
+
+// balanceOf gets the available balance of a coin, zero if the account never held it.
+func balanceOf(wrapper exchanges.ExchangeWrapper, coin string) (decimal.Decimal, error) {
+	balance, err := wrapper.GetBalance(coin)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if balance == nil {
+		return decimal.Zero, nil
+	}
+	return *balance, nil
+}
+
+// staticMarkets returns the markets quoted in the static coin, by base coin.
+func staticMarkets(markets []*environment.Market, staticCoin string) map[string]*environment.Market {
+	ret := make(map[string]*environment.Market)
+	for _, market := range markets {
+		if market.MarketCurrency == staticCoin && market.BaseCurrency != staticCoin {
+			ret[market.BaseCurrency] = market
+		}
+	}
+	return ret
+}
+
+// compareBenchmark compares the equity of the strategies to the equity of the benchmark.
+func compareBenchmark(strategy Result, benchmark *BenchmarkResult) {
+	benchmark.ExcessReturn = strategy.Metrics.Return.Sub(benchmark.Metrics.Return)
+	benchmark.ExcessAPR = strategy.Metrics.APR.Sub(benchmark.Metrics.APR)
+
+	returns := stepReturns(benchmark.Equity)
+	var diffs []float64
+	for t, ret := range stepReturns(strategy.Equity) {
+		if other, exists := returns[t]; exists {
+			diffs = append(diffs, ret-other)
+		}
+	}
+	if len(diffs) < 2 || len(strategy.Equity) < 2 {
+		return
+	}
+
+	mean := 0.0
+	for _, diff := range diffs {
+		mean += diff
+	}
+	mean /= float64(len(diffs))
+	variance := 0.0
+	for _, diff := range diffs {
+		variance += (diff - mean) * (diff - mean)
+	}
+	variance /= float64(len(diffs) - 1)
+
+	first, last := strategy.Equity[0].Time, strategy.Equity[len(strategy.Equity)-1].Time
+	step := last.Sub(first).Hours() / float64(len(strategy.Equity)-1)
+	if step <= 0 {
+		return
+	}
+	stepsPerYear := 365 * 24 / step
+	benchmark.TrackingError = decimal.NewFromFloat(math.Sqrt(variance*stepsPerYear) * 100).Round(4)
+}
+
+// stepReturns returns the return of each step of the curve with its previous one, cash flows left out, by step time.
+func stepReturns(curve EquityCurve) map[time.Time]float64 {
+	ret := make(map[time.Time]float64, len(curve))
+	for i := 1; i < len(curve); i++ {
+		previous := curve[i-1].Value
+		if previous.IsPositive() {
+			ret[curve[i].Time] = curve[i].Value.Sub(curve[i].Flow).Div(previous).InexactFloat64() - 1
+		}
+	}
+	return ret
+}
+
+// WriteBenchmarks writes the metrics of the benchmarks of a run next to the metrics of its strategies.
+func WriteBenchmarks(w io.Writer, result Result) error {
+	if len(result.Benchmarks) == 0 {
+		return nil
+	}
+
+	hundo := decimal.NewFromInt(100)
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "benchmark\tfinal_value\treturn_%\tapr_%\tmax_drawdown_%\texcess_return_%\texcess_apr_%\ttracking_error_%\terror")
+	fmt.Fprintf(table, "strategy\t%s\t%s\t%s\t%s\t\t\t\t\n", result.Metrics.FinalValue.Round(4), result.Metrics.Return.Mul(hundo).Round(2),
+		result.Metrics.APR.Round(2), result.Metrics.MaxDrawdown.Mul(hundo).Round(2))
+	for _, benchmark := range result.Benchmarks {
+		if benchmark.Err != nil {
+			fmt.Fprintf(table, "%s\t\t\t\t\t\t\t\t%s\n", benchmark.Benchmark, benchmark.Err)
+			continue
+		}
+		metrics := benchmark.Metrics
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", benchmark.Benchmark, metrics.FinalValue.Round(4),
+			metrics.Return.Mul(hundo).Round(2), metrics.APR.Round(2), metrics.MaxDrawdown.Mul(hundo).Round(2),
+			benchmark.ExcessReturn.Mul(hundo).Round(2), benchmark.ExcessAPR.Round(2), benchmark.TrackingError.Round(2))
+	}
+	return table.Flush()
+}
+
+// specStaticCoin returns the static_coin of the first strategy spec defining one.
+func specStaticCoin(configs []environment.StrategyConfig) string {
+	for _, config := range configs {
+		if coin, ok := config.Spec["static_coin"].(string); ok && coin != "" {
+			return coin
+		}
+	}
+	return ""
+}
+
+// specPortfolioWeights returns the portfolio weights of the first strategy spec defining them, nil if none does.
+func specPortfolioWeights(configs []environment.StrategyConfig) map[string]decimal.Decimal {
+	for _, config := range configs {
+		weights, ok := config.Spec[portfolioWeightsKey].(map[string]interface{})
+		if !ok || len(weights) == 0 {
+			continue
+		}
+		ret := make(map[string]decimal.Decimal, len(weights))
+		for coin, weight := range weights {
+			if value, ok := weight.(float64); ok {
+				ret[coin] = decimal.NewFromFloat(value)
+			}
+		}
+		return ret
+	}
+	return nil
+}
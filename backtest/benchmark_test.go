@@ -0,0 +1,187 @@
+package backtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+func TestNewBenchmarkStrategy(t *testing.T) {
+	markets := []*environment.Market{
+		{Name: "btc-usdt", BaseCurrency: "btc", MarketCurrency: "usdt"},
+		{Name: "eth-usdt", BaseCurrency: "eth", MarketCurrency: "usdt"},
+		{Name: "eth-btc", BaseCurrency: "eth", MarketCurrency: "btc"},
+	}
+	spec := func(weights map[string]interface{}) []environment.StrategyConfig {
+		ret := map[string]interface{}{"static_coin": "usdt"}
+		if weights != nil {
+			ret[portfolioWeightsKey] = weights
+		}
+		return []environment.StrategyConfig{{Spec: map[string]interface{}{}}, {Spec: ret}}
+	}
+	third := decimal.NewFromInt(1).Div(decimal.NewFromInt(3))
+
+	tests := []struct {
+		name      string
+		benchmark Benchmark
+		configs   []environment.StrategyConfig
+		markets   []*environment.Market
+		want      map[string]decimal.Decimal
+		wantErr   string
+	}{
+		{
+			name:      "buy and hold the weights of the spec",
+			benchmark: BuyAndHold,
+			configs:   spec(map[string]interface{}{"btc": 0.6, "usdt": 0.4}),
+			want:      map[string]decimal.Decimal{"btc": decimal.RequireFromString("0.6"), "usdt": decimal.RequireFromString("0.4")},
+		},
+		{
+			name:      "buy and hold the initial balances",
+			benchmark: BuyAndHold,
+			configs:   spec(nil),
+		},
+		{
+			name:      "equal weight of the coins of the spec",
+			benchmark: EqualWeight,
+			configs:   spec(map[string]interface{}{"btc": 0.6, "usdt": 0.4}),
+			want:      map[string]decimal.Decimal{"btc": decimal.RequireFromString("0.5"), "usdt": decimal.RequireFromString("0.5")},
+		},
+		{
+			name:      "equal weight of the coins traded against the static coin",
+			benchmark: EqualWeight,
+			configs:   spec(nil),
+			want:      map[string]decimal.Decimal{"btc": third, "eth": third, "usdt": third},
+		},
+		{
+			name:      "static coin",
+			benchmark: StaticCoin,
+			configs:   spec(nil),
+			want:      map[string]decimal.Decimal{"usdt": decimal.NewFromInt(1)},
+		},
+		{
+			name:      "bitcoin",
+			benchmark: Bitcoin,
+			configs:   spec(nil),
+			want:      map[string]decimal.Decimal{"btc": decimal.NewFromInt(1)},
+		},
+		{
+			name:      "bitcoin without a bitcoin market",
+			benchmark: Bitcoin,
+			configs:   spec(nil),
+			markets:   markets[1:],
+			wantErr:   "the btc benchmark needs a btc-usdt market",
+		},
+		{
+			name:      "weights of coins without a market",
+			benchmark: BuyAndHold,
+			configs:   spec(map[string]interface{}{"sol": 0.5, "usdt": 0.5}),
+			wantErr:   "the buy_and_hold benchmark needs a sol-usdt market",
+		},
+		{
+			name:      "no static coin",
+			benchmark: StaticCoin,
+			configs:   []environment.StrategyConfig{{Spec: map[string]interface{}{}}},
+			wantErr:   "benchmarks need the static_coin",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.markets == nil {
+				test.markets = markets
+			}
+			strategy, err := newBenchmarkStrategy(test.benchmark, test.configs, test.markets)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strategy.staticCoin != "usdt" {
+				t.Errorf("trades against %s, want usdt", strategy.staticCoin)
+			}
+			if len(strategy.weights) != len(test.want) {
+				t.Fatalf("got weights %v, want %v", strategy.weights, test.want)
+			}
+			for coin, weight := range test.want {
+				if !strategy.weights[coin].Equal(weight) {
+					t.Errorf("got weights %v, want %v", strategy.weights, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareBenchmark(t *testing.T) {
+	strategyEquity := curve([]string{"100", "110", "99"}, nil)
+	// the deposit of the benchmark is not a gain: its step returns are both 0.
+	benchmarkEquity := curve([]string{"100", "150", "150"}, []string{"", "50", ""})
+
+	strategy := Result{Equity: strategyEquity, Metrics: NewMetrics(strategyEquity)}
+	benchmark := &BenchmarkResult{Benchmark: StaticCoin, Equity: benchmarkEquity, Metrics: NewMetrics(benchmarkEquity)}
+	compareBenchmark(strategy, benchmark)
+
+	checks := []struct {
+		name string
+		got  decimal.Decimal
+		want string
+	}{
+		{name: "benchmark return", got: benchmark.Metrics.Return, want: "0"},
+		{name: "excess return", got: benchmark.ExcessReturn, want: "-0.01"},
+		{name: "excess apr", got: benchmark.ExcessAPR, want: "-182.5"},
+		// daily excess returns of 10% and -10%: a daily variance of 0.02, sqrt(0.02 * 365) yearly.
+		{name: "tracking error", got: benchmark.TrackingError, want: "270.1851"},
+	}
+	for _, check := range checks {
+		if !check.got.Equal(decimal.RequireFromString(check.want)) {
+			t.Errorf("%s is %s, want %s", check.name, check.got, check.want)
+		}
+	}
+}
+
+func TestBenchmarkPortfolios(t *testing.T) {
+	bot := syntheticBot()
+	bot.SimulationConfigs.SimEndDate = "2024-01-03"
+	result := newSyntheticRunner(t, bot, StaticCoin, BuyAndHold).RunOnce(nil)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if len(result.Benchmarks) != 2 {
+		t.Fatalf("got %d benchmarks, want 2", len(result.Benchmarks))
+	}
+
+	// holding the 10000 usdt deposited neither gains nor loses anything in usdt, the neutral coin.
+	static := result.Benchmarks[0]
+	if static.Err != nil {
+		t.Fatal(static.Err)
+	}
+	for _, point := range static.Equity {
+		if !point.NeutralValue.Equal(decimal.NewFromInt(10000)) {
+			t.Fatalf("the static coin benchmark is worth %s usdt at %s, want 10000", point.NeutralValue, point.Time)
+		}
+	}
+	if !static.Metrics.APR.IsZero() || !static.ExcessAPR.Equal(result.Metrics.APR) {
+		t.Errorf("the static coin benchmark has an apr of %s, %s less than the strategy, want 0 and %s", static.Metrics.APR, static.ExcessAPR, result.Metrics.APR)
+	}
+
+	// buy and hold starts at the weights of the spec, less the fees and the margin left for the slippage.
+	hold := result.Benchmarks[1]
+	if hold.Err != nil {
+		t.Fatal(hold.Err)
+	}
+	first := hold.Equity[0]
+	for coin, weight := range map[string]float64{"btc": 0.3, "eth": 0.25, "sol": 0.25, "usdt": 0.2} {
+		share := first.Holdings[coin].Div(first.Value).InexactFloat64()
+		if share < weight-0.01 || share > weight+0.01 {
+			t.Errorf("buy and hold starts with %.4f of %s, want %.2f", share, coin, weight)
+		}
+	}
+	if !hold.ExcessReturn.Equal(result.Metrics.Return.Sub(hold.Metrics.Return)) {
+		t.Errorf("buy and hold returned %s less than the strategy, want %s", hold.ExcessReturn, result.Metrics.Return.Sub(hold.Metrics.Return))
+	}
+}
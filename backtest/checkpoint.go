@@ -0,0 +1,66 @@
+package backtest
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/strategies"
+)
+
+// CheckpointConfig represents when the checkpoints of a run are saved.
+type CheckpointConfig struct {
+	Path  string        // File the checkpoints are written to, none are saved if empty.
+	Every time.Duration // Simulated time between two checkpoints.
+}
+
+// Checkpoint represents a run saved at the end of a step, from which it can be resumed with identical results.
+type Checkpoint struct {
+	Params     ParamSet                         `json:"params"`
+	Window     Window                           `json:"window"`
+	Equity     EquityCurve                      `json:"equity"`
+	Benchmarks []EquityCurve                    `json:"benchmarks"` // Equity of each benchmark, in configuration order.
+	Simulation *strategies.SimulationCheckpoint `json:"simulation"`
+}
+
+// LoadCheckpoint reads a checkpoint saved by a run.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(content, &checkpoint); err != nil {
+		return nil, err
+	}
+	if checkpoint.Simulation == nil {
+		return nil, errors.New(path + " holds no simulation state")
+	}
+	return &checkpoint, nil
+}
+
+// Save writes the checkpoint to the specified file, replacing it at once so that a crash never leaves half of it.
+func (checkpoint *Checkpoint) Save(path string) error {
+	content, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,42 @@
+package backtest
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResumeMatchesStraightRun(t *testing.T) {
+	runner := newSyntheticRunner(t, syntheticBot())
+	straight := runner.RunOnce(nil)
+	if straight.Err != nil {
+		t.Fatal(straight.Err)
+	}
+
+	path := filepath.Join(t.TempDir(), "run.json")
+	checkpointed := runner.RunCheckpointed(nil, CheckpointConfig{Path: path, Every: 7 * 24 * time.Hour}, nil)
+	if checkpointed.Err != nil {
+		t.Fatal(checkpointed.Err)
+	}
+	assertSameEquity(t, "checkpointed", checkpointed.Equity, straight.Equity)
+
+	from, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !from.Simulation.Time.Before(runner.Window().End) || len(from.Equity) == 0 {
+		t.Fatalf("the checkpoint was saved at %s, not during the run", from.Simulation.Time)
+	}
+
+	resumed := runner.RunCheckpointed(nil, CheckpointConfig{}, from)
+	if resumed.Err != nil {
+		t.Fatal(resumed.Err)
+	}
+	assertSameEquity(t, "resumed", resumed.Equity, straight.Equity)
+	for i := range straight.Benchmarks {
+		assertSameEquity(t, straight.Benchmarks[i].Benchmark.String(), resumed.Benchmarks[i].Equity, straight.Benchmarks[i].Equity)
+	}
+	if len(resumed.Trades) != len(straight.Trades) {
+		t.Fatalf("%d trades after resuming, want %d", len(resumed.Trades), len(straight.Trades))
+	}
+}
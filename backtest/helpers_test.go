@@ -0,0 +1,118 @@
+package backtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	logrus.SetLevel(logrus.WarnLevel)
+}
+
+// syntheticBot returns a configuration rebalancing four coins every hour of January 2024 on the synthetic exchange,
+// with thresholds tight enough to trade often.
+func syntheticBot() environment.BotConfig {
+	binding := func(name string, marketName string) environment.MarketConfig {
+		return environment.MarketConfig{Name: name, Exchanges: []environment.ExchangeBindingsConfig{{Name: "synthetic", MarketName: marketName}}}
+	}
+
+	return environment.BotConfig{
+		SimulationConfigs: environment.SimulationConfig{
+			SimModeOn:       true,
+			SimStartDate:    "2024-01-01",
+			SimEndDate:      "2024-01-31",
+			SimInterval:     60,
+			SimFakeBalances: map[string]decimal.Decimal{"usdt": decimal.NewFromInt(10000)},
+			SimFillModel:    environment.FillModelConfig{Model: "candle", SpreadBps: decimal.NewFromInt(10)},
+		},
+		ExchangeConfigs: []environment.ExchangeConfig{{
+			ExchangeName: "synthetic",
+			Synthetic: environment.SyntheticConfig{
+				Seed:      7,
+				StartDate: "2024-01-01",
+				Interval:  60,
+				SpreadBps: 10,
+				Markets: []environment.SyntheticMarketConfig{
+					{Name: "BTC-USDT", Process: "jump_diffusion", Price: 40000, Drift: 0.2, Volatility: 0.9, Volume: 5, JumpIntensity: 12, JumpMean: -0.03, JumpStdDev: 0.05},
+					{Name: "ETH-USDT", Price: 2200, Drift: 0.2, Volatility: 1.2, Volume: 60},
+					{Name: "SOL-USDT", Price: 100, Drift: 0.1, Volatility: 1.5, Volume: 500},
+					{Name: "USDT-USD", Process: "mean_reverting", Price: 1, Volatility: 0.01, Volume: 1000000, Reversion: 200},
+				},
+				Correlations: []environment.SyntheticCorrelationConfig{{Markets: []string{"BTC-USDT", "ETH-USDT"}, Value: 0.8}},
+			},
+		}},
+		Strategies: []environment.StrategyConfig{{
+			Strategy: "RebalancerStrategy",
+			Spec: map[string]interface{}{
+				"name":                    "rebalancer",
+				"interval":                60,
+				"allowance_threshold":     0.05,
+				"market_cap_multiplier":   1.0,
+				"min_trade_size":          0.005,
+				"static_coin":             "usdt",
+				"nuetral_coin":            "usdt",
+				"portfolio_ratio_percent": map[string]interface{}{"btc": 0.3, "eth": 0.25, "sol": 0.25, "usdt": 0.2},
+			},
+			Markets: []environment.MarketConfig{
+				binding("btc-usdt", "BTC-USDT"),
+				binding("eth-usdt", "ETH-USDT"),
+				binding("sol-usdt", "SOL-USDT"),
+				binding("usdt-usd", "USDT-USD"),
+			},
+		}},
+	}
+}
+
+// newSyntheticRunner creates a runner of the configuration with the benchmarks (buy and hold and equal weight if none),
+// removed at the end of the test.
+func newSyntheticRunner(t *testing.T, bot environment.BotConfig, benchmarks ...Benchmark) *Runner {
+	t.Helper()
+	if len(benchmarks) == 0 {
+		benchmarks = []Benchmark{BuyAndHold, EqualWeight}
+	}
+	runner, err := NewRunner(Config{Bot: bot, Workers: 1, Benchmarks: benchmarks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { runner.Close() })
+	return runner
+}
+
+// assertSameEquity fails the test at the first point where the curves differ.
+func assertSameEquity(t *testing.T, name string, got EquityCurve, want EquityCurve) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: %d equity points, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || !got[i].Value.Equal(want[i].Value) || !got[i].NeutralValue.Equal(want[i].NeutralValue) {
+			t.Fatalf("%s: point %d is %s %s, want %s %s", name, i, got[i].Time, got[i].Value, want[i].Time, want[i].Value)
+		}
+	}
+}
+
+// curve builds an equity curve of daily values, flows holding the cash flow received at each point.
+func curve(values []string, flows []string) EquityCurve {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ret := make(EquityCurve, len(values))
+	for i, value := range values {
+		ret[i] = EquityPoint{Time: start.AddDate(0, 0, i), Value: decimal.RequireFromString(value)}
+		if i < len(flows) && flows[i] != "" {
+			ret[i].Flow = decimal.RequireFromString(flows[i])
+		}
+	}
+	return ret
+}
+
+// decimals parses the values of a test case.
+func decimals(values ...string) []decimal.Decimal {
+	ret := make([]decimal.Decimal, len(values))
+	for i, value := range values {
+		ret[i] = decimal.RequireFromString(value)
+	}
+	return ret
+}
@@ -0,0 +1,285 @@
+package backtest
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/mcwarner5/BlockBot8000/exchanges"
+	"github.com/mcwarner5/BlockBot8000/strategies"
+	"github.com/shopspring/decimal"
+)
+
+type RankMetric int16
+
+const (
+	FinalValue  RankMetric = iota
+	APR         RankMetric = iota
+	MaxDrawdown RankMetric = iota
+)
+
+func (w RankMetric) String() string {
+	return [...]string{"final_value", "apr", "max_drawdown"}[w]
+}
+
+func (w RankMetric) EnumIndex() int {
+	return int(w)
+}
+
+// ParseRankMetric gets the metric with the specified name.
+func ParseRankMetric(name string) (RankMetric, error) {
+	for _, metric := range []RankMetric{FinalValue, APR, MaxDrawdown} {
+		if metric.String() == name {
+			return metric, nil
+		}
+	}
+	return FinalValue, errors.New("unknown metric " + name + ": expected final_value, apr or max_drawdown")
+}
+
+// EquityPoint represents the value of the simulated portfolios at a step of a run.
+type EquityPoint struct {
+	Time         time.Time
+	Value        decimal.Decimal            // Value in the coin quoting the markets.
+	NeutralValue decimal.Decimal            // Value in the neutral coin, zero if its price is unknown.
+	Flow         decimal.Decimal            // Value of the cash flows received since the previous step, part of Value.
+	NeutralFlow  decimal.Decimal            // Value of the cash flows in the neutral coin.
+	Holdings     map[string]decimal.Decimal // Value of each coin held, in the coin quoting the markets.
+}
+
+// EquityCurve represents the values of the simulated portfolios over a run.
+type EquityCurve []EquityPoint
+
+// valuePoints returns the values of the curve with their cash flows, in the neutral coin if neutral is set.
+func (curve EquityCurve) valuePoints(neutral bool) []strategies.ValuePoint {
+	ret := make([]strategies.ValuePoint, len(curve))
+	for i, point := range curve {
+		ret[i] = strategies.ValuePoint{Time: point.Time, Value: point.Value, Flow: point.Flow}
+		if neutral {
+			ret[i].Value, ret[i].Flow = point.NeutralValue, point.NeutralFlow
+		}
+	}
+	return ret
+}
+
+// MaxDrawdown returns the largest drop of the value from a previous peak, as a fraction of the peak. The cash flows are
+// left out, so that withdrawals are not drops.
+func (curve EquityCurve) MaxDrawdown() decimal.Decimal {
+	ret := decimal.Zero
+	for _, drawdown := range curve.Drawdowns() {
+		ret = decimal.Max(ret, drawdown)
+	}
+	return ret
+}
+
+// Drawdowns returns the drop of the value from its previous peak at each point, as a fraction of the peak, the cash
+// flows being left out like in MaxDrawdown.
+func (curve EquityCurve) Drawdowns() []decimal.Decimal {
+	ret := make([]decimal.Decimal, len(curve))
+	peak := decimal.Zero
+	index := decimal.Zero // value growing by the returns only, starting at the first value.
+	for i, point := range curve {
+		switch {
+		case i == 0 || !curve[i-1].Value.IsPositive():
+			index = point.Value
+		default:
+			index = index.Mul(point.Value.Sub(point.Flow)).Div(curve[i-1].Value)
+		}
+
+		if index.GreaterThan(peak) {
+			peak = index
+		}
+		if peak.IsPositive() {
+			ret[i] = peak.Sub(index).Div(peak)
+		}
+	}
+	return ret
+}
+
+// Metrics represents the performance of a run.
+type Metrics struct {
+	InitialValue decimal.Decimal
+	FinalValue   decimal.Decimal
+	NetFlows     decimal.Decimal // Value of the deposits minus the withdrawals over the run.
+	Return       decimal.Decimal // Time weighted change of the value over the run, cash flows left out, as a fraction.
+	APR          decimal.Decimal // Yearly time weighted return in the neutral coin (in the quote coin if unknown), in percent.
+	IRR          decimal.Decimal // Yearly money weighted return in the neutral coin (in the quote coin if unknown), in percent.
+	MaxDrawdown  decimal.Decimal // Largest drop from a peak, as a fraction.
+	Days         decimal.Decimal
+}
+
+// NewMetrics computes the metrics of a run from its equity curve.
+func NewMetrics(curve EquityCurve) Metrics {
+	if len(curve) == 0 {
+		return Metrics{}
+	}
+	first, last := curve[0], curve[len(curve)-1]
+
+	ret := Metrics{
+		InitialValue: first.Value,
+		FinalValue:   last.Value,
+		MaxDrawdown:  curve.MaxDrawdown(),
+		Days:         decimal.NewFromFloat(last.Time.Sub(first.Time).Hours()).Div(decimal.NewFromInt(24)),
+	}
+	for _, point := range curve[1:] {
+		ret.NetFlows = ret.NetFlows.Add(point.Flow)
+	}
+	if first.Value.IsPositive() {
+		ret.Return = strategies.TimeWeightedReturn(curve.valuePoints(false))
+	}
+
+	neutral := first.NeutralValue.IsPositive() && last.NeutralValue.IsPositive()
+	growth := ret.Return
+	if neutral {
+		growth = strategies.TimeWeightedReturn(curve.valuePoints(true))
+	}
+	days := decimal.Max(ret.Days, decimal.NewFromInt(1))
+	ret.APR = growth.Div(days).Mul(decimal.NewFromInt(365)).Mul(decimal.NewFromInt(100)).Round(4)
+
+	if irr, err := strategies.MoneyWeightedReturn(curve.valuePoints(neutral)); err == nil {
+		ret.IRR = irr.Mul(decimal.NewFromInt(100)).Round(4)
+	}
+	return ret
+}
+
+// Better returns whether the metrics rank before the other metrics for the specified metric.
+func (metrics Metrics) Better(other Metrics, metric RankMetric) bool {
+	switch metric {
+	case APR:
+		return metrics.APR.GreaterThan(other.APR)
+	case MaxDrawdown:
+		return metrics.MaxDrawdown.LessThan(other.MaxDrawdown)
+	default:
+		return metrics.FinalValue.GreaterThan(other.FinalValue)
+	}
+}
+
+// PortfolioValue values the balances of the coins of the markets held on the wrappers, in the coin quoting the markets
+// and in the neutral coin. Coins are valued through their chain of markets (e.g. eth-usdt then usdt-usd), so the quote
+// coin is the one ending the chains.
+func PortfolioValue(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market, neutralCoin string) (decimal.Decimal, decimal.Decimal, error) {
+	_, value, neutralValue, err := portfolioHoldings(wrappers, markets, neutralCoin)
+	return value, neutralValue, err
+}
+
+// portfolioHoldings values the balances like PortfolioValue, along with the value of each coin in the quote coin.
+func portfolioHoldings(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market, neutralCoin string) (map[string]decimal.Decimal, decimal.Decimal, decimal.Decimal, error) {
+	holdings := make(map[string]decimal.Decimal)
+	value, neutralValue := decimal.Zero, decimal.Zero
+	for _, wrapper := range wrappers {
+		summaries, err := wrapper.GetMarketSummaries(markets)
+		if err != nil {
+			return nil, decimal.Zero, decimal.Zero, err
+		}
+		prices := newPriceChain(markets, summaries)
+
+		snapshot, err := exchanges.AccountSnapshotFor(wrapper, prices.coins())
+		if err != nil {
+			return nil, decimal.Zero, decimal.Zero, err
+		}
+
+		walletValue := decimal.Zero
+		for _, coin := range prices.coins() {
+			coinValue := snapshot.Balance(coin).Total.Mul(prices.price(coin))
+			if !coinValue.IsZero() {
+				holdings[coin] = holdings[coin].Add(coinValue)
+			}
+			walletValue = walletValue.Add(coinValue)
+		}
+		value = value.Add(walletValue)
+
+		if neutralPrice := prices.price(neutralCoin); neutralCoin != "" && neutralPrice.IsPositive() {
+			neutralValue = neutralValue.Add(walletValue.Div(neutralPrice))
+		}
+	}
+	return holdings, value, neutralValue, nil
+}
+
+// CashFlowValue values the cash flows received on the wrappers after since and until the specified time, in the coin
+// quoting the markets and in the neutral coin, like PortfolioValue. Cash flows of coins out of the markets are left out.
+func CashFlowValue(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market, neutralCoin string, since time.Time, until time.Time) (decimal.Decimal, decimal.Decimal, error) {
+	value, neutralValue := decimal.Zero, decimal.Zero
+	for _, wrapper := range wrappers {
+		provider, ok := wrapper.(exchanges.CashFlowProvider)
+		if !ok {
+			continue
+		}
+		var flows []environment.CashFlow
+		for _, flow := range provider.CashFlows() {
+			if flow.Time.After(since) && !flow.Time.After(until) {
+				flows = append(flows, flow)
+			}
+		}
+		if len(flows) == 0 {
+			continue
+		}
+
+		summaries, err := wrapper.GetMarketSummaries(markets)
+		if err != nil {
+			return decimal.Zero, decimal.Zero, err
+		}
+		prices := newPriceChain(markets, summaries)
+
+		flowValue := decimal.Zero
+		for _, flow := range flows {
+			for _, coin := range prices.coins() {
+				if coin == flow.Coin {
+					flowValue = flowValue.Add(flow.Amount.Mul(prices.price(coin)))
+				}
+			}
+		}
+		value = value.Add(flowValue)
+
+		if neutralPrice := prices.price(neutralCoin); neutralCoin != "" && neutralPrice.IsPositive() {
+			neutralValue = neutralValue.Add(flowValue.Div(neutralPrice))
+		}
+	}
+	return value, neutralValue, nil
+}
+
+// priceChain values coins through the last prices of the markets they are the base coin of.
+type priceChain struct {
+	markets map[string]*environment.Market // market of each base coin.
+	last    map[string]decimal.Decimal     // last price of each base coin in its quote coin.
+	order   []string
+}
+
+// newPriceChain creates the price chain of the markets, summaries holding the summary of each market in the same order.
+func newPriceChain(markets []*environment.Market, summaries []*environment.MarketSummary) priceChain {
+	chain := priceChain{
+		markets: make(map[string]*environment.Market, len(markets)),
+		last:    make(map[string]decimal.Decimal, len(markets)),
+	}
+	seen := make(map[string]bool)
+	for i, market := range markets {
+		if i < len(summaries) && summaries[i] != nil {
+			chain.markets[market.BaseCurrency] = market
+			chain.last[market.BaseCurrency] = summaries[i].Last
+		}
+		for _, coin := range []string{market.BaseCurrency, market.MarketCurrency} {
+			if !seen[coin] {
+				seen[coin] = true
+				chain.order = append(chain.order, coin)
+			}
+		}
+	}
+	return chain
+}
+
+// coins returns the base and quote coins of the markets.
+func (chain priceChain) coins() []string {
+	return chain.order
+}
+
+// price returns the price of a coin in the quote coin ending its chain, zero if a price is missing.
+func (chain priceChain) price(coin string) decimal.Decimal {
+	price := decimal.NewFromInt(1)
+	for visited := 0; visited <= len(chain.markets); visited++ {
+		market, exists := chain.markets[coin]
+		if !exists {
+			return price
+		}
+		price = price.Mul(chain.last[coin])
+		coin = market.MarketCurrency
+	}
+	return decimal.Zero
+}
@@ -0,0 +1,75 @@
+package backtest
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestDrawdowns(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		flows  []string
+		want   []string
+	}{
+		{name: "no drop", values: []string{"100", "110", "120"}, want: []string{"0", "0", "0"}},
+		{name: "drop and recovery", values: []string{"100", "120", "90", "135"}, want: []string{"0", "0", "0.25", "0"}},
+		{name: "drop below a previous peak", values: []string{"100", "80", "90", "60"}, want: []string{"0", "0.2", "0.1", "0.4"}},
+		{name: "deposit is not a gain", values: []string{"100", "150", "120"}, flows: []string{"", "50", ""}, want: []string{"0", "0", "0.2"}},
+		{name: "withdrawal is not a drop", values: []string{"100", "50", "55"}, flows: []string{"", "-50", ""}, want: []string{"0", "0", "0"}},
+		{name: "empty portfolio", values: []string{"0", "100", "50"}, flows: []string{"", "100", ""}, want: []string{"0", "0", "0.5"}},
+	}
+	for _, test := range tests {
+		drawdowns := curve(test.values, test.flows).Drawdowns()
+		for i, want := range decimals(test.want...) {
+			if !drawdowns[i].Equal(want) {
+				t.Errorf("%s: drawdowns are %v, want %v", test.name, drawdowns, test.want)
+				break
+			}
+		}
+	}
+
+	if max := curve([]string{"100", "80", "90", "60", "120"}, nil).MaxDrawdown(); !max.Equal(decimal.RequireFromString("0.4")) {
+		t.Errorf("max drawdown is %s, want 0.4", max)
+	}
+}
+
+func TestNewMetrics(t *testing.T) {
+	if metrics := NewMetrics(nil); !metrics.FinalValue.IsZero() || !metrics.APR.IsZero() {
+		t.Errorf("the metrics of an empty curve are %+v", metrics)
+	}
+
+	// a year growing by 10%, with a deposit counted in the value but not in the return.
+	values := make([]string, 366)
+	flows := make([]string, 366)
+	for i := range values {
+		values[i] = "200"
+	}
+	values[0], values[365], flows[1] = "100", "220", "100"
+	metrics := NewMetrics(curve(values, flows))
+
+	checks := []struct {
+		name string
+		got  decimal.Decimal
+		want string
+	}{
+		{name: "initial value", got: metrics.InitialValue, want: "100"},
+		{name: "final value", got: metrics.FinalValue, want: "220"},
+		{name: "net flows", got: metrics.NetFlows, want: "100"},
+		{name: "return", got: metrics.Return, want: "0.1"},
+		{name: "days", got: metrics.Days, want: "365"},
+		{name: "apr", got: metrics.APR, want: "10"},
+		{name: "max drawdown", got: metrics.MaxDrawdown, want: "0"},
+	}
+	for _, check := range checks {
+		if !check.got.Equal(decimal.RequireFromString(check.want)) {
+			t.Errorf("%s is %s, want %s", check.name, check.got, check.want)
+		}
+	}
+
+	// the deposit was invested for a year less a day, the money weighted return is close to the time weighted one.
+	if irr := metrics.IRR.InexactFloat64(); irr < 9.9 || irr > 10.1 {
+		t.Errorf("irr is %f%%, want about 10%%", irr)
+	}
+}
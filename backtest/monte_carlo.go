@@ -0,0 +1,322 @@
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	helpers "github.com/mcwarner5/BlockBot8000/bot_helpers"
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/mcwarner5/BlockBot8000/exchanges"
+	"github.com/shopspring/decimal"
+)
+
+// MonteCarloPercentiles are the percentiles reported for the metrics of the synthetic paths.
+var MonteCarloPercentiles = []int{5, 25, 50, 75, 95}
+
+// MonteCarloConfig represents the synthetic price paths of a Monte Carlo analysis.
+type MonteCarloConfig struct {
+	Paths     int   // Number of synthetic paths simulated.
+	BlockSize int   // Number of consecutive candles drawn at once, a day of candles if <= 0.
+	Seed      int64 // Seed of the first path, path i being drawn with Seed + i so that results do not depend on the workers.
+}
+
+// MonteCarloResult represents the outcome of a Monte Carlo analysis.
+type MonteCarloResult struct {
+	Params ParamSet
+	Runs   []Result // Run of each synthetic path, in path order.
+}
+
+// MetricDistribution represents the distribution of a metric over the successful runs of a Monte Carlo analysis.
+type MetricDistribution struct {
+	Name        string
+	Mean        decimal.Decimal
+	Percentiles []decimal.Decimal // Value of each of the MonteCarloPercentiles.
+}
+
+// candleReturn represents a candle relative to the close of the previous one.
+type candleReturn struct {
+	open, high, low, close decimal.Decimal
+	volume                 decimal.Decimal
+}
+
+// bootstrapSeries represents the historical candles of a market on an exchange, on the grid of the simulated times.
+type bootstrapSeries struct {
+	wrapper int // index of the inner wrapper serving the market.
+	market  *environment.Market
+	candles []environment.CandleStick
+	returns []candleReturn // returns[i] relates candles[i] to candles[i-1], returns[0] is unused.
+}
+
+// MonteCarlo simulates the strategies with the specified parameters on synthetic price paths. Each path is made of
+// blocks of consecutive historical candle returns, drawn at the same times for every market so that the correlations
+// between the coins are preserved, starting from the historical prices at the start of the simulation.
+func (runner *Runner) MonteCarlo(params ParamSet, config MonteCarloConfig) (*MonteCarloResult, error) {
+	if config.Paths <= 0 {
+		return nil, errors.New("a Monte Carlo analysis needs at least a path")
+	}
+	series, err := runner.bootstrapSeries()
+	if err != nil {
+		return nil, err
+	}
+
+	interval := runner.config.Bot.SimulationConfigs.SimInterval
+	period := time.Duration(interval) * time.Minute
+	length := len(series[0].candles)
+	blockSize := config.BlockSize
+	if blockSize <= 0 {
+		blockSize = 24 * 60 / interval
+	}
+	blockSize = max(1, min(blockSize, length-1))
+
+	result := &MonteCarloResult{Params: params, Runs: make([]Result, config.Paths)}
+	workers := runner.config.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				random := rand.New(rand.NewSource(config.Seed + int64(i)))
+				inner := bootstrapPath(runner.wrappers, series, period, blockSize, random)
+				result.Runs[i] = runner.run(params, runner.window, inner, nil, nil, nil, CheckpointConfig{})
+			}
+		}()
+	}
+	for i := range result.Runs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return result, nil
+}
+
+// bootstrapSeries loads the historical candles of the markets of the strategies over the simulated times, along with
+// their returns.
+func (runner *Runner) bootstrapSeries() ([]*bootstrapSeries, error) {
+	interval := runner.config.Bot.SimulationConfigs.SimInterval
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid simulation interval %d", interval)
+	}
+	period := time.Duration(interval) * time.Minute
+	// the simulators read the candle before the start and match orders against the one after the end.
+	start, end := runner.window.Start.Add(-period), runner.window.End.Add(period)
+	length := int(end.Sub(start)/period) + 1
+	if length < 3 {
+		return nil, errors.New("the simulation is too short to draw synthetic paths")
+	}
+
+	var ret []*bootstrapSeries
+	for i, wrapper := range runner.wrappers {
+		seen := make(map[string]bool)
+		for _, strategyConfig := range runner.config.Bot.Strategies {
+			for _, market := range helpers.InitMarkets(strategyConfig) {
+				if _, exists := market.ExchangeNames[wrapper.Name()]; !exists || seen[market.Name] {
+					continue
+				}
+				seen[market.Name] = true
+
+				candles, err := runner.store.Candles(wrapper, market, start, end, interval)
+				if err != nil {
+					return nil, fmt.Errorf("cannot get the candles of %s: %w", market.Name, err)
+				}
+				if len(candles) == 0 {
+					return nil, fmt.Errorf("no candles for %s in %s", market.Name, runner.window)
+				}
+				series := &bootstrapSeries{wrapper: i, market: market, candles: gridCandles(candles, start, period, length)}
+				series.returns = candleReturns(series.candles)
+				ret = append(ret, series)
+			}
+		}
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("no market of the strategies is bound to the configured exchanges")
+	}
+	return ret, nil
+}
+
+// gridCandles places sorted candles on the grid of the simulated times, repeating the previous candle in the gaps (the
+// first one before the first candle) as the simulator does.
+func gridCandles(candles []environment.CandleStick, start time.Time, period time.Duration, length int) []environment.CandleStick {
+	ret := make([]environment.CandleStick, length)
+	next, prev := 0, candles[0]
+	for i := range ret {
+		at := start.Add(time.Duration(i) * period)
+		for next < len(candles) && !candles[next].CandleTime.After(at) {
+			prev = candles[next]
+			next++
+		}
+		ret[i] = prev
+		ret[i].CandleTime = at
+	}
+	return ret
+}
+
+// candleReturns returns each candle relative to the close of the previous one.
+func candleReturns(candles []environment.CandleStick) []candleReturn {
+	ret := make([]candleReturn, len(candles))
+	one := decimal.NewFromInt(1)
+	for i := 1; i < len(candles); i++ {
+		prevClose, candle := candles[i-1].Close, candles[i]
+		ret[i] = candleReturn{open: one, high: one, low: one, close: one, volume: candle.Volume}
+		if prevClose.IsPositive() {
+			ret[i].open = candle.Open.Div(prevClose)
+			ret[i].high = candle.High.Div(prevClose)
+			ret[i].low = candle.Low.Div(prevClose)
+			ret[i].close = candle.Close.Div(prevClose)
+		}
+	}
+	return ret
+}
+
+// bootstrapPath draws a synthetic path and returns inner wrappers serving it in place of the historical candles.
+func bootstrapPath(wrappers []exchanges.ExchangeWrapper, series []*bootstrapSeries, period time.Duration, blockSize int, random *rand.Rand) []exchanges.ExchangeWrapper {
+	length := len(series[0].candles)
+	indexes := make([]int, 0, length)
+	indexes = append(indexes, 0)
+	for len(indexes) < length {
+		block := 1 + random.Intn(length-blockSize)
+		for i := block; i < block+blockSize && len(indexes) < length; i++ {
+			indexes = append(indexes, i)
+		}
+	}
+
+	paths := make([]*pathWrapper, len(wrappers))
+	ret := make([]exchanges.ExchangeWrapper, len(wrappers))
+	for i, wrapper := range wrappers {
+		paths[i] = &pathWrapper{ExchangeWrapper: wrapper, period: period, candles: make(map[string]*environment.CandleSeries)}
+		ret[i] = paths[i]
+	}
+
+	for _, historical := range series {
+		candles := make([]environment.CandleStick, length)
+		candles[0] = historical.candles[0]
+		for i := 1; i < length; i++ {
+			prevClose, change := candles[i-1].Close, historical.returns[indexes[i]]
+			candles[i] = environment.CandleStick{
+				Open:       prevClose.Mul(change.open),
+				High:       prevClose.Mul(change.high),
+				Low:        prevClose.Mul(change.low),
+				Close:      prevClose.Mul(change.close),
+				Volume:     change.volume,
+				CandleTime: historical.candles[i].CandleTime,
+			}
+		}
+		paths[historical.wrapper].candles[historical.market.Name] = environment.NewCandleSeries(candles...)
+	}
+	return ret
+}
+
+// pathWrapper serves the candles of a synthetic path in place of the historical data of the wrapper it wraps.
+type pathWrapper struct {
+	exchanges.ExchangeWrapper
+	period  time.Duration                        // simulation interval.
+	candles map[string]*environment.CandleSeries // candles of the path by market name.
+}
+
+// GetHistoricalCandles gets the candles of the path starting in [start, end].
+func (wrapper *pathWrapper) GetHistoricalCandles(market *environment.Market, start time.Time, end time.Time, interval int) ([]environment.CandleStick, error) {
+	series, exists := wrapper.candles[market.Name]
+	if !exists {
+		return nil, errors.New("no synthetic candles for market " + market.Name)
+	}
+	return series.Range(start, end.Add(time.Nanosecond)), nil
+}
+
+// GetHistoricalTrades synthesizes the trades of the path in [start, end] from its candles.
+func (wrapper *pathWrapper) GetHistoricalTrades(market *environment.Market, start time.Time, end time.Time) (*environment.TradeBook, error) {
+	series, exists := wrapper.candles[market.Name]
+	if !exists {
+		return nil, errors.New("no synthetic candles for market " + market.Name)
+	}
+	return exchanges.CandleTrades(market, series, wrapper.period, start, end), nil
+}
+
+// Failed returns the number of paths whose run failed.
+func (result *MonteCarloResult) Failed() int {
+	failed := 0
+	for _, run := range result.Runs {
+		if run.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Distributions returns the distributions of the final value, the APR and the max drawdown (in percent) of the paths.
+func (result *MonteCarloResult) Distributions() []MetricDistribution {
+	hundo := decimal.NewFromInt(100)
+	metrics := []struct {
+		name  string
+		value func(Metrics) decimal.Decimal
+	}{
+		{FinalValue.String(), func(metrics Metrics) decimal.Decimal { return metrics.FinalValue }},
+		{APR.String() + "_%", func(metrics Metrics) decimal.Decimal { return metrics.APR }},
+		{MaxDrawdown.String() + "_%", func(metrics Metrics) decimal.Decimal { return metrics.MaxDrawdown.Mul(hundo) }},
+	}
+
+	ret := make([]MetricDistribution, len(metrics))
+	for i, metric := range metrics {
+		values := make([]decimal.Decimal, 0, len(result.Runs))
+		for _, run := range result.Runs {
+			if run.Err == nil {
+				values = append(values, metric.value(run.Metrics))
+			}
+		}
+		ret[i] = newDistribution(metric.name, values)
+	}
+	return ret
+}
+
+// newDistribution computes the mean and the percentiles of the values, interpolating between the closest ranks.
+func newDistribution(name string, values []decimal.Decimal) MetricDistribution {
+	ret := MetricDistribution{Name: name, Mean: decimal.Zero, Percentiles: make([]decimal.Decimal, len(MonteCarloPercentiles))}
+	if len(values) == 0 {
+		for i := range ret.Percentiles {
+			ret.Percentiles[i] = decimal.Zero
+		}
+		return ret
+	}
+
+	sort.Slice(values, func(i, j int) bool { return values[i].LessThan(values[j]) })
+	ret.Mean = decimal.Sum(values[0], values[1:]...).Div(decimal.NewFromInt(int64(len(values))))
+	for i, percentile := range MonteCarloPercentiles {
+		rank := decimal.NewFromInt(int64(percentile * (len(values) - 1))).Div(decimal.NewFromInt(100))
+		lower := int(rank.IntPart())
+		upper := min(lower+1, len(values)-1)
+		weight := rank.Sub(decimal.NewFromInt(int64(lower)))
+		ret.Percentiles[i] = values[lower].Add(values[upper].Sub(values[lower]).Mul(weight))
+	}
+	return ret
+}
+
+// WriteMonteCarlo writes the distributions of the metrics over the paths as a text table.
+func WriteMonteCarlo(w io.Writer, result *MonteCarloResult) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(table, "params: %s, paths: %d, failed: %d\n\n", result.Params, len(result.Runs), result.Failed())
+
+	fmt.Fprint(table, "metric\tmean")
+	for _, percentile := range MonteCarloPercentiles {
+		fmt.Fprintf(table, "\tp%d", percentile)
+	}
+	fmt.Fprintln(table)
+	for _, distribution := range result.Distributions() {
+		fmt.Fprintf(table, "%s\t%s", distribution.Name, distribution.Mean.Round(2))
+		for _, value := range distribution.Percentiles {
+			fmt.Fprintf(table, "\t%s", value.Round(2))
+		}
+		fmt.Fprintln(table)
+	}
+	return table.Flush()
+}
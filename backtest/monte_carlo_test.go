@@ -0,0 +1,107 @@
+package backtest
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestMonteCarloSeedIsReproducible(t *testing.T) {
+	bot := syntheticBot()
+	bot.SimulationConfigs.SimEndDate = "2024-01-07"
+	config := MonteCarloConfig{Paths: 4, BlockSize: 12, Seed: 42}
+
+	// the paths do not depend on the workers drawing them.
+	results := make([]*MonteCarloResult, 0, 2)
+	for _, workers := range []int{1, 3} {
+		runner, err := NewRunner(Config{Bot: bot, Workers: workers})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { runner.Close() })
+
+		result, err := runner.MonteCarlo(nil, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed := result.Failed(); failed > 0 {
+			t.Fatalf("%d paths failed: %v", failed, result.Runs[0].Err)
+		}
+		results = append(results, result)
+	}
+
+	first, again := results[0], results[1]
+	for i, run := range again.Runs {
+		assertSameEquity(t, "path", run.Equity, first.Runs[i].Equity)
+	}
+
+	// every path starts from the historical prices of 2024-01-01 and lasts the six days of the window.
+	finals := []string{"10090.0711", "10763.789", "9032.0459", "9556.4091"}
+	if len(first.Runs) != len(finals) {
+		t.Fatalf("got %d paths, want %d", len(first.Runs), len(finals))
+	}
+	start := first.Runs[0].Equity[0].NeutralValue
+	for i, run := range first.Runs {
+		if len(run.Equity) != 145 {
+			t.Fatalf("path %d has %d equity points, want 145", i, len(run.Equity))
+		}
+		if !run.Equity[0].NeutralValue.Equal(start) {
+			t.Errorf("path %d starts at %s, want %s", i, run.Equity[0].NeutralValue, start)
+		}
+		if got := run.Metrics.FinalValue.Round(4); !got.Equal(decimal.RequireFromString(finals[i])) {
+			t.Errorf("path %d ends at %s, want %s", i, got, finals[i])
+		}
+	}
+
+	want := []struct {
+		name        string
+		mean        string
+		percentiles []string
+	}{
+		{"final_value", "9860.5788", []string{"9110.7004", "9425.3183", "9823.2401", "10258.5006", "10662.7313"}},
+		{"apr_%", "-66.0179", []string{"-524.6152", "-331.3976", "-87.9805", "177.3992", "423.327"}},
+		{"max_drawdown_%", "8.5713", []string{"5.9454", "6.5425", "7.7141", "9.743", "12.3974"}},
+	}
+	distributions := first.Distributions()
+	if len(distributions) != len(want) {
+		t.Fatalf("got %d distributions, want %d", len(distributions), len(want))
+	}
+	for i, distribution := range distributions {
+		if distribution.Name != want[i].name || !distribution.Mean.Round(4).Equal(decimal.RequireFromString(want[i].mean)) {
+			t.Errorf("distribution %d is %s with mean %s, want %s with mean %s", i, distribution.Name, distribution.Mean.Round(4), want[i].name, want[i].mean)
+		}
+		for j, value := range decimals(want[i].percentiles...) {
+			if got := distribution.Percentiles[j].Round(4); !got.Equal(value) {
+				t.Errorf("%s: p%d is %s, want %s", distribution.Name, MonteCarloPercentiles[j], got, value)
+			}
+		}
+	}
+}
+
+func TestNewDistribution(t *testing.T) {
+	tests := []struct {
+		name        string
+		values      []decimal.Decimal
+		mean        string
+		percentiles []string
+	}{
+		{"no values", nil, "0", []string{"0", "0", "0", "0", "0"}},
+		{"single value", decimals("7"), "7", []string{"7", "7", "7", "7", "7"}},
+		{"interpolated ranks", decimals("5", "1", "4", "2", "3"), "3", []string{"1.2", "2", "3", "4", "4.8"}},
+		{"even count", decimals("10", "20", "30", "40"), "25", []string{"11.5", "17.5", "25", "32.5", "38.5"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			distribution := newDistribution("metric", test.values)
+			if !distribution.Mean.Equal(decimal.RequireFromString(test.mean)) {
+				t.Errorf("mean is %s, want %s", distribution.Mean, test.mean)
+			}
+			for i, want := range decimals(test.percentiles...) {
+				if !distribution.Percentiles[i].Equal(want) {
+					t.Errorf("p%d is %s, want %s", MonteCarloPercentiles[i], distribution.Percentiles[i], want)
+				}
+			}
+		})
+	}
+}
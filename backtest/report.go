@@ -0,0 +1,212 @@
+package backtest
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/strategies"
+	"github.com/shopspring/decimal"
+)
+
+// Report represents a run as exported to share it, from the equity of the simulated portfolios, the trades of the
+// simulators and the portfolio analyses of the strategies.
+type Report struct {
+	Params      string            `json:"params"`
+	Start       time.Time         `json:"start"`
+	End         time.Time         `json:"end"`
+	NeutralCoin string            `json:"neutral_coin"`
+	Metrics     ReportMetrics     `json:"metrics"`
+	Strategies  []ReportStrategy  `json:"strategies"`
+	Benchmarks  []ReportBenchmark `json:"benchmarks"`
+	Equity      []ReportPoint     `json:"equity"`
+	Trades      []ReportTrade     `json:"trades"`
+}
+
+// ReportMetrics represents the metrics of a run or of a benchmark.
+type ReportMetrics struct {
+	InitialValue   decimal.Decimal `json:"initial_value"`
+	FinalValue     decimal.Decimal `json:"final_value"`
+	NetFlows       decimal.Decimal `json:"net_flows"`
+	ReturnPct      decimal.Decimal `json:"return_pct"`
+	APRPct         decimal.Decimal `json:"apr_pct"`
+	IRRPct         decimal.Decimal `json:"irr_pct"`
+	MaxDrawdownPct decimal.Decimal `json:"max_drawdown_pct"`
+	Days           decimal.Decimal `json:"days"`
+}
+
+// ReportStrategy represents the portfolio analysis of a strategy at the end of a run, in its neutral coin.
+type ReportStrategy struct {
+	Name          string                     `json:"name"`
+	NeutralCoin   string                     `json:"neutral_coin,omitempty"`
+	InitialValue  decimal.Decimal            `json:"initial_value"`
+	FinalValue    decimal.Decimal            `json:"final_value"`
+	NetCashFlows  decimal.Decimal            `json:"net_cash_flows"`
+	APRPct        decimal.Decimal            `json:"apr_pct"`
+	TWRPct        decimal.Decimal            `json:"time_weighted_return_pct"`
+	IRRPct        *decimal.Decimal           `json:"money_weighted_return_pct,omitempty"` // Not set if the cash flows have no rate of return.
+	Analyzed      bool                       `json:"analyzed"`                            // Whether the strategy analyzes its portfolio, the values being unset if not.
+	InitialAssets map[string]decimal.Decimal `json:"initial_assets,omitempty"`            // Balance of each coin at the start.
+	FinalAssets   map[string]decimal.Decimal `json:"final_assets,omitempty"`              // Balance of each coin at the end.
+}
+
+// ReportBenchmark represents a benchmark of a run.
+type ReportBenchmark struct {
+	Name             string          `json:"name"`
+	Metrics          ReportMetrics   `json:"metrics"`
+	ExcessReturnPct  decimal.Decimal `json:"excess_return_pct"`
+	ExcessAPRPct     decimal.Decimal `json:"excess_apr_pct"`
+	TrackingErrorPct decimal.Decimal `json:"tracking_error_pct"`
+	Equity           []ReportValue   `json:"equity,omitempty"`
+	Error            string          `json:"error,omitempty"`
+}
+
+// ReportPoint represents the simulated portfolios at a step of a run.
+type ReportPoint struct {
+	Time         time.Time                  `json:"time"`
+	Value        decimal.Decimal            `json:"value"`
+	NeutralValue decimal.Decimal            `json:"neutral_value"`
+	Flow         decimal.Decimal            `json:"flow"`
+	DrawdownPct  decimal.Decimal            `json:"drawdown_pct"`
+	Holdings     map[string]decimal.Decimal `json:"holdings"` // Value of each coin held.
+}
+
+// ReportValue represents the value of a portfolio at a step of a run.
+type ReportValue struct {
+	Time  time.Time       `json:"time"`
+	Value decimal.Decimal `json:"value"`
+}
+
+// ReportTrade represents a trade of the strategies.
+type ReportTrade struct {
+	Time     time.Time       `json:"time"`
+	Market   string          `json:"market"`
+	Side     string          `json:"side"`
+	Type     string          `json:"type"`
+	Status   string          `json:"status"`
+	Price    decimal.Decimal `json:"price"`
+	Quantity decimal.Decimal `json:"quantity"`
+	Total    decimal.Decimal `json:"total"`
+	Fees     decimal.Decimal `json:"fees"`
+}
+
+// Report exports a run of the runner.
+func (runner *Runner) Report(result Result) *Report {
+	return NewReport(result, runner.window, runner.config.NeutralCoin)
+}
+
+// NewReport exports a run over the window, the APR being measured in the neutral coin.
+func NewReport(result Result, window Window, neutralCoin string) *Report {
+	report := &Report{
+		Params:      result.Params.String(),
+		Start:       window.Start,
+		End:         window.End,
+		NeutralCoin: neutralCoin,
+		Metrics:     newReportMetrics(result.Metrics),
+	}
+
+	for _, strategy := range result.Strategies {
+		report.Strategies = append(report.Strategies, newReportStrategy(strategy))
+	}
+
+	for _, benchmark := range result.Benchmarks {
+		exported := ReportBenchmark{Name: benchmark.Benchmark.String()}
+		if benchmark.Err != nil {
+			exported.Error = benchmark.Err.Error()
+			report.Benchmarks = append(report.Benchmarks, exported)
+			continue
+		}
+		exported.Metrics = newReportMetrics(benchmark.Metrics)
+		exported.ExcessReturnPct = percent(benchmark.ExcessReturn)
+		exported.ExcessAPRPct = benchmark.ExcessAPR
+		exported.TrackingErrorPct = benchmark.TrackingError
+		for _, point := range benchmark.Equity {
+			exported.Equity = append(exported.Equity, ReportValue{Time: point.Time, Value: point.Value})
+		}
+		report.Benchmarks = append(report.Benchmarks, exported)
+	}
+
+	drawdowns := result.Equity.Drawdowns()
+	for i, point := range result.Equity {
+		report.Equity = append(report.Equity, ReportPoint{
+			Time:         point.Time,
+			Value:        point.Value,
+			NeutralValue: point.NeutralValue,
+			Flow:         point.Flow,
+			DrawdownPct:  percent(drawdowns[i]),
+			Holdings:     point.Holdings,
+		})
+	}
+
+	for _, trade := range result.Trades {
+		report.Trades = append(report.Trades, ReportTrade{
+			Time:     trade.Timestamp,
+			Market:   trade.Market,
+			Side:     trade.Side.String(),
+			Type:     trade.Type.String(),
+			Status:   trade.Status.String(),
+			Price:    trade.Price,
+			Quantity: trade.FillQuantity,
+			Total:    trade.Total(),
+			Fees:     trade.Fees,
+		})
+	}
+	return report
+}
+
+// newReportMetrics exports the metrics of a run, fractions being turned into percents.
+func newReportMetrics(metrics Metrics) ReportMetrics {
+	return ReportMetrics{
+		InitialValue:   metrics.InitialValue,
+		FinalValue:     metrics.FinalValue,
+		NetFlows:       metrics.NetFlows,
+		ReturnPct:      percent(metrics.Return),
+		APRPct:         metrics.APR,
+		IRRPct:         metrics.IRR,
+		MaxDrawdownPct: percent(metrics.MaxDrawdown),
+		Days:           metrics.Days.Round(4),
+	}
+}
+
+// newReportStrategy exports the portfolio analysis of a strategy, if it keeps one.
+func newReportStrategy(strategy strategies.Strategy) ReportStrategy {
+	exported := ReportStrategy{Name: strategy.GetName()}
+	analyzer, ok := strategy.(strategies.PortfolioAnalyzer)
+	if !ok || analyzer.GetPortfolioAnalysis() == nil {
+		return exported
+	}
+
+	analysis := analyzer.GetPortfolioAnalysis()
+	exported.Analyzed = true
+	exported.NeutralCoin = analysis.NuetralCoin
+	exported.InitialValue, _ = analysis.InitialBalances.GetTotalValueInCoin(analysis.NuetralCoin)
+	exported.FinalValue, _ = analysis.CurrentBalances.GetTotalValueInCoin(analysis.NuetralCoin)
+	exported.NetCashFlows = analysis.GetNetCashFlows()
+	exported.APRPct = analysis.CalcCurrAPR()
+	exported.TWRPct = analysis.CalcTimeWeightedReturn()
+	if irr, err := analysis.CalcMoneyWeightedReturn(); err == nil {
+		exported.IRRPct = &irr
+	}
+
+	exported.InitialAssets = make(map[string]decimal.Decimal, len(analysis.InitialBalances.Balances))
+	for coin, balance := range analysis.InitialBalances.Balances {
+		exported.InitialAssets[coin] = balance.Balance
+	}
+	exported.FinalAssets = make(map[string]decimal.Decimal, len(analysis.CurrentBalances.Balances))
+	for coin, balance := range analysis.CurrentBalances.Balances {
+		exported.FinalAssets[coin] = balance.Balance
+	}
+	return exported
+}
+
+// percent turns a fraction into a percent.
+func percent(fraction decimal.Decimal) decimal.Decimal {
+	return fraction.Mul(decimal.NewFromInt(100)).Round(4)
+}
+
+// WriteReportJSON writes the report as an indented JSON document.
+func WriteReportJSON(w io.Writer, report *Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -0,0 +1,341 @@
+package backtest
+
+import (
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Layout of the charts of the HTML report, in pixels.
+const (
+	chartWidth     = 960
+	chartHeight    = 260
+	chartLeft      = 70 // room for the value labels.
+	chartRight     = 10
+	chartTop       = 10
+	chartBottom    = 24 // room for the date labels.
+	chartMaxPoints = 1000
+)
+
+// chartColors are the colors of the series of the charts, in series order.
+var chartColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"}
+
+// htmlChart represents a chart of the HTML report, drawn as an inline SVG.
+type htmlChart struct {
+	Title  string
+	Width  int
+	Height int
+	Lines  []htmlSeries // series drawn as lines.
+	Areas  []htmlSeries // series drawn as filled areas.
+	Labels []htmlLabel
+	Grid   []htmlLabel // horizontal grid lines, at the label heights.
+	Left   int
+	Right  int
+	Empty  bool
+}
+
+// htmlSeries represents a series of a chart, its points being SVG coordinates.
+type htmlSeries struct {
+	Name   string
+	Color  string
+	Points string
+}
+
+// htmlLabel represents a text of a chart, at SVG coordinates.
+type htmlLabel struct {
+	X, Y   float64
+	Text   string
+	Anchor string
+}
+
+// chartScale maps the times and values of a chart to SVG coordinates.
+type chartScale struct {
+	start, end time.Time
+	min, max   float64
+}
+
+func (scale chartScale) x(at time.Time) float64 {
+	span := scale.end.Sub(scale.start).Seconds()
+	if span <= 0 {
+		return chartLeft
+	}
+	return chartLeft + at.Sub(scale.start).Seconds()/span*(chartWidth-chartLeft-chartRight)
+}
+
+func (scale chartScale) y(value float64) float64 {
+	span := scale.max - scale.min
+	if span <= 0 {
+		return chartHeight - chartBottom
+	}
+	return chartTop + (scale.max-value)/span*(chartHeight-chartTop-chartBottom)
+}
+
+// chartPoint represents a value of a series at a time.
+type chartPoint struct {
+	time  time.Time
+	value float64
+}
+
+// newHTMLChart creates a chart over the times of the points, scaled to the range of the values, with labels on both axes.
+func newHTMLChart(title string, start time.Time, end time.Time, min float64, max float64, format func(float64) string) (htmlChart, chartScale) {
+	if max <= min {
+		max = min + 1
+	}
+	scale := chartScale{start: start, end: end, min: min, max: max}
+	chart := htmlChart{Title: title, Width: chartWidth, Height: chartHeight, Left: chartLeft, Right: chartWidth - chartRight}
+
+	for i := 0; i <= 4; i++ {
+		value := min + (max-min)*float64(i)/4
+		label := htmlLabel{X: chartLeft - 6, Y: roundPixel(scale.y(value)), Text: format(value), Anchor: "end"}
+		chart.Labels = append(chart.Labels, label)
+		chart.Grid = append(chart.Grid, label)
+	}
+	for i := 0; i <= 4; i++ {
+		at := start.Add(time.Duration(float64(end.Sub(start)) * float64(i) / 4))
+		anchor := "middle"
+		if i == 0 {
+			anchor = "start"
+		} else if i == 4 {
+			anchor = "end"
+		}
+		chart.Labels = append(chart.Labels, htmlLabel{X: roundPixel(scale.x(at)), Y: chartHeight - 6, Text: at.Format(time.DateOnly), Anchor: anchor})
+	}
+	return chart, scale
+}
+
+// roundPixel rounds an SVG coordinate to a tenth of a pixel.
+func roundPixel(coordinate float64) float64 {
+	return math.Round(coordinate*10) / 10
+}
+
+// polyline returns the SVG coordinates of the points.
+func (scale chartScale) polyline(points []chartPoint) string {
+	var builder strings.Builder
+	for i, point := range points {
+		if i > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(strconv.FormatFloat(scale.x(point.time), 'f', 1, 64))
+		builder.WriteByte(',')
+		builder.WriteString(strconv.FormatFloat(scale.y(point.value), 'f', 1, 64))
+	}
+	return builder.String()
+}
+
+// sampleIndexes returns the indexes of at most chartMaxPoints points out of count, the first and last ones included.
+func sampleIndexes(count int) []int {
+	step := int(math.Ceil(float64(count) / chartMaxPoints))
+	if step < 1 {
+		step = 1
+	}
+	var ret []int
+	for i := 0; i < count; i += step {
+		ret = append(ret, i)
+	}
+	if count > 0 && ret[len(ret)-1] != count-1 {
+		ret = append(ret, count-1)
+	}
+	return ret
+}
+
+// equityChart draws the value of the strategies and of the benchmarks.
+func equityChart(report *Report) htmlChart {
+	series := []htmlSeries{{Name: "strategy"}}
+	values := [][]chartPoint{nil}
+	for _, i := range sampleIndexes(len(report.Equity)) {
+		values[0] = append(values[0], chartPoint{report.Equity[i].Time, report.Equity[i].Value.InexactFloat64()})
+	}
+	for _, benchmark := range report.Benchmarks {
+		if len(benchmark.Equity) == 0 {
+			continue
+		}
+		var points []chartPoint
+		for _, i := range sampleIndexes(len(benchmark.Equity)) {
+			points = append(points, chartPoint{benchmark.Equity[i].Time, benchmark.Equity[i].Value.InexactFloat64()})
+		}
+		series = append(series, htmlSeries{Name: benchmark.Name})
+		values = append(values, points)
+	}
+
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, points := range values {
+		for _, point := range points {
+			min, max = math.Min(min, point.value), math.Max(max, point.value)
+		}
+	}
+	if len(values[0]) == 0 {
+		return htmlChart{Title: "Equity", Empty: true}
+	}
+
+	chart, scale := newHTMLChart("Equity", report.Start, chartEnd(report), min, max, formatValue)
+	for i := range series {
+		series[i].Color = chartColors[i%len(chartColors)]
+		series[i].Points = scale.polyline(values[i])
+	}
+	chart.Lines = series
+	return chart
+}
+
+// drawdownChart draws the drops of the value of the strategies from their previous peak.
+func drawdownChart(report *Report) htmlChart {
+	if len(report.Equity) == 0 {
+		return htmlChart{Title: "Drawdown", Empty: true}
+	}
+
+	var points []chartPoint
+	deepest := 0.0
+	for _, i := range sampleIndexes(len(report.Equity)) {
+		drawdown := -report.Equity[i].DrawdownPct.InexactFloat64()
+		points = append(points, chartPoint{report.Equity[i].Time, drawdown})
+		deepest = math.Min(deepest, drawdown)
+	}
+
+	end := chartEnd(report)
+	chart, scale := newHTMLChart("Drawdown", report.Start, end, deepest, 0, formatPercent)
+	area := append([]chartPoint{{points[0].time, 0}}, points...)
+	area = append(area, chartPoint{points[len(points)-1].time, 0})
+	chart.Areas = []htmlSeries{{Name: "drawdown", Color: chartColors[3], Points: scale.polyline(area)}}
+	return chart
+}
+
+// allocationChart draws the share of the value of the strategies held in each coin, stacked.
+func allocationChart(report *Report) htmlChart {
+	coinSet := make(map[string]bool)
+	for _, point := range report.Equity {
+		for coin := range point.Holdings {
+			coinSet[coin] = true
+		}
+	}
+	if len(coinSet) == 0 {
+		return htmlChart{Title: "Allocation", Empty: true}
+	}
+	coins := make([]string, 0, len(coinSet))
+	for coin := range coinSet {
+		coins = append(coins, coin)
+	}
+	sort.Strings(coins)
+
+	chart, scale := newHTMLChart("Allocation", report.Start, chartEnd(report), 0, 100, formatPercent)
+	indexes := sampleIndexes(len(report.Equity))
+	lower := make([]float64, len(indexes)) // stacked share of the previous coins at each point.
+	for c, coin := range coins {
+		var top, bottom []chartPoint
+		for j, i := range indexes {
+			point := report.Equity[i]
+			share := 0.0
+			if total := point.Value.InexactFloat64(); total > 0 {
+				share = point.Holdings[coin].InexactFloat64() / total * 100
+			}
+			bottom = append(bottom, chartPoint{point.Time, lower[j]})
+			lower[j] += share
+			top = append(top, chartPoint{point.Time, lower[j]})
+		}
+		for i, j := 0, len(bottom)-1; i < j; i, j = i+1, j-1 {
+			bottom[i], bottom[j] = bottom[j], bottom[i]
+		}
+		chart.Areas = append(chart.Areas, htmlSeries{
+			Name:   coin,
+			Color:  chartColors[c%len(chartColors)],
+			Points: scale.polyline(append(top, bottom...)),
+		})
+	}
+	return chart
+}
+
+// chartEnd returns the time of the last point of the report, the end of its window if it has none.
+func chartEnd(report *Report) time.Time {
+	if len(report.Equity) > 0 && report.Equity[len(report.Equity)-1].Time.After(report.Start) {
+		return report.Equity[len(report.Equity)-1].Time
+	}
+	return report.End
+}
+
+func formatValue(value float64) string {
+	return decimal.NewFromFloat(value).Round(2).String()
+}
+
+func formatPercent(value float64) string {
+	return decimal.NewFromFloat(value).Round(1).String() + "%"
+}
+
+// WriteReportHTML writes the report as a self-contained HTML page, its charts being inline SVGs.
+func WriteReportHTML(w io.Writer, report *Report) error {
+	return reportTemplate.Execute(w, struct {
+		*Report
+		Charts []htmlChart
+	}{
+		Report: report,
+		Charts: []htmlChart{equityChart(report), drawdownChart(report), allocationChart(report)},
+	})
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Backtest {{.Start.Format "2006-01-02"}} to {{.End.Format "2006-01-02"}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 1000px; color: #222; }
+h1 { font-size: 1.5em; } h2 { font-size: 1.2em; margin-top: 2em; }
+table { border-collapse: collapse; font-size: 0.85em; margin: 0.5em 0; }
+th, td { padding: 3px 10px; border-bottom: 1px solid #ddd; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+svg { font-size: 11px; }
+.grid { stroke: #eee; } .legend span { display: inline-block; margin-right: 1.5em; font-size: 0.85em; }
+.legend i { display: inline-block; width: 12px; height: 12px; margin-right: 4px; vertical-align: middle; }
+.error { color: #d62728; }
+</style>
+</head>
+<body>
+<h1>Backtest {{.Start.Format "2006-01-02"}} to {{.End.Format "2006-01-02"}}</h1>
+<p>Parameters: {{.Params}}{{if .NeutralCoin}} &middot; APR in {{.NeutralCoin}}{{end}}</p>
+
+<table>
+<tr><th>initial value</th><th>final value</th><th>net flows</th><th>return</th><th>APR</th><th>IRR</th><th>max drawdown</th><th>days</th></tr>
+<tr><td>{{.Metrics.InitialValue.Round 4}}</td><td>{{.Metrics.FinalValue.Round 4}}</td><td>{{.Metrics.NetFlows.Round 4}}</td><td>{{.Metrics.ReturnPct.Round 2}}%</td><td>{{.Metrics.APRPct.Round 2}}%</td><td>{{.Metrics.IRRPct.Round 2}}%</td><td>{{.Metrics.MaxDrawdownPct.Round 2}}%</td><td>{{.Metrics.Days.Round 2}}</td></tr>
+</table>
+
+{{range .Charts}}
+<h2>{{.Title}}</h2>
+{{if .Empty}}<p>No data.</p>{{else}}
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" xmlns="http://www.w3.org/2000/svg">
+{{$chart := .}}{{range .Grid}}<line class="grid" x1="{{$chart.Left}}" x2="{{$chart.Right}}" y1="{{.Y}}" y2="{{.Y}}"/>
+{{end}}{{range .Areas}}<polygon points="{{.Points}}" fill="{{.Color}}" fill-opacity="0.7" stroke="none"><title>{{.Name}}</title></polygon>
+{{end}}{{range .Lines}}<polyline points="{{.Points}}" fill="none" stroke="{{.Color}}" stroke-width="1.5"><title>{{.Name}}</title></polyline>
+{{end}}{{range .Labels}}<text x="{{.X}}" y="{{.Y}}" text-anchor="{{.Anchor}}" dominant-baseline="middle" fill="#555">{{.Text}}</text>
+{{end}}</svg>
+<div class="legend">{{range .Lines}}<span><i style="background: {{.Color}}"></i>{{.Name}}</span>{{end}}{{range .Areas}}<span><i style="background: {{.Color}}"></i>{{.Name}}</span>{{end}}</div>
+{{end}}{{end}}
+
+{{if .Benchmarks}}
+<h2>Benchmarks</h2>
+<table>
+<tr><th>benchmark</th><th>final value</th><th>return</th><th>APR</th><th>max drawdown</th><th>excess return</th><th>excess APR</th><th>tracking error</th></tr>
+{{range .Benchmarks}}{{if .Error}}<tr><td>{{.Name}}</td><td class="error" colspan="7">{{.Error}}</td></tr>
+{{else}}<tr><td>{{.Name}}</td><td>{{.Metrics.FinalValue.Round 4}}</td><td>{{.Metrics.ReturnPct.Round 2}}%</td><td>{{.Metrics.APRPct.Round 2}}%</td><td>{{.Metrics.MaxDrawdownPct.Round 2}}%</td><td>{{.ExcessReturnPct.Round 2}}%</td><td>{{.ExcessAPRPct.Round 2}}%</td><td>{{.TrackingErrorPct.Round 2}}%</td></tr>
+{{end}}{{end}}</table>
+{{end}}
+
+{{if .Strategies}}
+<h2>Strategies</h2>
+<table>
+<tr><th>strategy</th><th>initial value</th><th>final value</th><th>net cash flows</th><th>APR</th><th>time weighted return</th><th>money weighted return</th></tr>
+{{range .Strategies}}{{if .Analyzed}}<tr><td>{{.Name}}</td><td>{{.InitialValue.Round 5}} {{.NeutralCoin}}</td><td>{{.FinalValue.Round 5}} {{.NeutralCoin}}</td><td>{{.NetCashFlows.Round 5}} {{.NeutralCoin}}</td><td>{{.APRPct.Round 2}}%</td><td>{{.TWRPct.Round 2}}%</td><td>{{if .IRRPct}}{{.IRRPct.Round 2}}%{{end}}</td></tr>
+{{else}}<tr><td>{{.Name}}</td><td colspan="6">no portfolio analysis</td></tr>
+{{end}}{{end}}</table>
+{{end}}
+
+<h2>Trades ({{len .Trades}})</h2>
+{{if .Trades}}<table>
+<tr><th>time</th><th>market</th><th>side</th><th>type</th><th>status</th><th>price</th><th>quantity</th><th>total</th><th>fees</th></tr>
+{{range .Trades}}<tr><td>{{.Time.Format "2006-01-02 15:04:05"}}</td><td>{{.Market}}</td><td>{{.Side}}</td><td>{{.Type}}</td><td>{{.Status}}</td><td>{{.Price.Round 6}}</td><td>{{.Quantity.Round 8}}</td><td>{{.Total.Round 4}}</td><td>{{.Fees.Round 4}}</td></tr>
+{{end}}</table>{{else}}<p>No trades.</p>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,162 @@
+package backtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/mcwarner5/BlockBot8000/strategies"
+	"github.com/shopspring/decimal"
+)
+
+// knownRun returns a run over 3 days rising from 100 to 120 then falling to 90, with a flat benchmark, a failed
+// benchmark and a single trade.
+func knownRun() (Result, Window) {
+	equity := curve([]string{"100", "120", "90"}, nil)
+	for i, eth := range []string{"50", "72", "36"} {
+		equity[i].NeutralValue = equity[i].Value
+		equity[i].Holdings = map[string]decimal.Decimal{
+			"eth":  decimal.RequireFromString(eth),
+			"usdt": equity[i].Value.Sub(decimal.RequireFromString(eth)),
+		}
+	}
+	flat := curve([]string{"100", "100", "100"}, nil)
+
+	result := Result{
+		Params:  ParamSet{{Name: "allowance_threshold", Value: decimal.RequireFromString("0.05")}},
+		Metrics: NewMetrics(equity),
+		Equity:  equity,
+		Benchmarks: []BenchmarkResult{
+			{Benchmark: StaticCoin, Equity: flat, Metrics: NewMetrics(flat)},
+			{Benchmark: Bitcoin, Err: errors.New("the btc benchmark needs a btc-usdt market in the strategy markets")},
+		},
+		Strategies: []strategies.Strategy{benchmarkStrategy{benchmark: EqualWeight}},
+		Trades: []environment.Trade{{
+			Price:        decimal.NewFromInt(2000),
+			FillQuantity: decimal.RequireFromString("0.025"),
+			Fees:         decimal.RequireFromString("0.13"),
+			Market:       "eth-usdt",
+			Side:         environment.Buy,
+			Status:       environment.Complete,
+			Type:         environment.MarketPrice,
+			Timestamp:    equity[1].Time,
+		}},
+	}
+	compareBenchmark(result, &result.Benchmarks[0])
+	return result, Window{Start: equity[0].Time, End: equity[2].Time}
+}
+
+func TestNewReport(t *testing.T) {
+	result, window := knownRun()
+	report := NewReport(result, window, "usdt")
+
+	if report.Params != "allowance_threshold=0.05" || report.NeutralCoin != "usdt" || !report.Start.Equal(window.Start) || !report.End.Equal(window.End) {
+		t.Errorf("got report of %q in %s from %s to %s", report.Params, report.NeutralCoin, report.Start, report.End)
+	}
+	if len(report.Equity) != 3 || len(report.Benchmarks) != 2 || len(report.Strategies) != 1 || len(report.Trades) != 1 {
+		t.Fatalf("got %d points, %d benchmarks, %d strategies and %d trades, want 3, 2, 1 and 1",
+			len(report.Equity), len(report.Benchmarks), len(report.Strategies), len(report.Trades))
+	}
+
+	checks := []struct {
+		name string
+		got  decimal.Decimal
+		want string
+	}{
+		{name: "initial value", got: report.Metrics.InitialValue, want: "100"},
+		{name: "final value", got: report.Metrics.FinalValue, want: "90"},
+		{name: "return", got: report.Metrics.ReturnPct, want: "-10"},
+		{name: "apr", got: report.Metrics.APRPct, want: "-1825"},
+		{name: "max drawdown", got: report.Metrics.MaxDrawdownPct, want: "25"},
+		{name: "days", got: report.Metrics.Days, want: "2"},
+		{name: "drawdown at the peak", got: report.Equity[1].DrawdownPct, want: "0"},
+		{name: "drawdown at the end", got: report.Equity[2].DrawdownPct, want: "25"},
+		{name: "eth held at the end", got: report.Equity[2].Holdings["eth"], want: "36"},
+		{name: "benchmark return", got: report.Benchmarks[0].Metrics.ReturnPct, want: "0"},
+		{name: "excess return", got: report.Benchmarks[0].ExcessReturnPct, want: "-10"},
+		{name: "excess apr", got: report.Benchmarks[0].ExcessAPRPct, want: "-1825"},
+		{name: "benchmark value at the end", got: report.Benchmarks[0].Equity[2].Value, want: "100"},
+		{name: "trade total", got: report.Trades[0].Total, want: "50"},
+		{name: "trade fees", got: report.Trades[0].Fees, want: "0.13"},
+	}
+	for _, check := range checks {
+		if !check.got.Equal(decimal.RequireFromString(check.want)) {
+			t.Errorf("%s is %s, want %s", check.name, check.got, check.want)
+		}
+	}
+
+	if failed := report.Benchmarks[1]; failed.Name != "btc" || failed.Error == "" || len(failed.Equity) != 0 {
+		t.Errorf("got failed benchmark %+v", failed)
+	}
+	if strategy := report.Strategies[0]; strategy.Name != "benchmark equal_weight" || strategy.Analyzed {
+		t.Errorf("got strategy %+v, want the benchmark without portfolio analysis", strategy)
+	}
+	if trade := report.Trades[0]; trade.Market != "eth-usdt" || trade.Side != "Buy" || trade.Type != "Market" || trade.Status != "Complete" {
+		t.Errorf("got trade %+v", trade)
+	}
+}
+
+func TestWriteReportJSON(t *testing.T) {
+	result, window := knownRun()
+	var buffer bytes.Buffer
+	if err := WriteReportJSON(&buffer, NewReport(result, window, "usdt")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{`"max_drawdown_pct": "25"`, `"return_pct": "-10"`, `"name": "btc"`, `"error": "the btc benchmark needs`, `"market": "eth-usdt"`} {
+		if !strings.Contains(buffer.String(), want) {
+			t.Errorf("the JSON report misses %s:\n%s", want, buffer.String())
+		}
+	}
+
+	var decoded Report
+	if err := json.Unmarshal(buffer.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Equity) != 3 || !decoded.Equity[2].Holdings["usdt"].Equal(decimal.NewFromInt(54)) || !decoded.End.Equal(window.End) {
+		t.Errorf("decoded report ends with %+v on %s", decoded.Equity[len(decoded.Equity)-1], decoded.End)
+	}
+}
+
+func TestWriteReportHTML(t *testing.T) {
+	result, window := knownRun()
+	var buffer bytes.Buffer
+	if err := WriteReportHTML(&buffer, NewReport(result, window, "usdt")); err != nil {
+		t.Fatal(err)
+	}
+	html := buffer.String()
+
+	// the values span 90 to 120 and the dates 2 days, over the 880x226 pixels of the plots starting at 70,10.
+	for _, want := range []string{
+		"<title>Backtest 2024-01-01 to 2024-01-03</title>",
+		"Parameters: allowance_threshold=0.05 &middot; APR in usdt",
+		"<td>100</td><td>90</td><td>0</td><td>-10%</td><td>-1825%</td><td>0%</td><td>25%</td><td>2</td>",
+		`<polyline points="70.0,160.7 510.0,10.0 950.0,236.0" fill="none" stroke="#1f77b4" stroke-width="1.5"><title>strategy</title></polyline>`,
+		`<polyline points="70.0,160.7 510.0,160.7 950.0,160.7" fill="none" stroke="#ff7f0e" stroke-width="1.5"><title>static_coin</title></polyline>`,
+		`<polygon points="70.0,10.0 70.0,10.0 510.0,10.0 950.0,236.0 950.0,10.0" fill="#d62728"`,
+		`<title>eth</title>`,
+		`<title>usdt</title>`,
+		`<td>btc</td><td class="error" colspan="7">the btc benchmark needs a btc-usdt market in the strategy markets</td>`,
+		`<td>benchmark equal_weight</td><td colspan="6">no portfolio analysis</td>`,
+		"<h2>Trades (1)</h2>",
+		"<td>2024-01-02 00:00:00</td><td>eth-usdt</td><td>Buy</td><td>Market</td><td>Complete</td><td>2000</td><td>0.025</td><td>50</td><td>0.13</td>",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("the HTML report misses %s", want)
+		}
+	}
+	if strings.Contains(html, "No data.") {
+		t.Error("the HTML report has an empty chart")
+	}
+
+	buffer.Reset()
+	if err := WriteReportHTML(&buffer, NewReport(Result{}, window, "")); err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.Count(buffer.String(), "<p>No data.</p>"); count != 3 {
+		t.Errorf("the HTML report of a run without equity has %d empty charts, want 3", count)
+	}
+}
@@ -0,0 +1,388 @@
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	helpers "github.com/mcwarner5/BlockBot8000/bot_helpers"
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/mcwarner5/BlockBot8000/exchanges"
+	"github.com/mcwarner5/BlockBot8000/strategies"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// Config represents a backtest: the bot configuration to simulate and the sweep over its strategy specs.
+type Config struct {
+	Bot         environment.BotConfig
+	Sweeps      []SweepParam // Swept spec parameters, a single run of the configuration if empty.
+	Workers     int          // Number of runs simulated at once, the number of CPUs if <= 0.
+	RankBy      RankMetric
+	NeutralCoin string      // Coin the APR is measured in, the nuetral_coin of the first strategy defining one if empty.
+	Benchmarks  []Benchmark // Portfolios simulated alongside each run over the same candles, none if empty.
+}
+
+// Result represents the outcome of a run of a backtest.
+type Result struct {
+	Params     ParamSet
+	Metrics    Metrics
+	Equity     EquityCurve
+	Benchmarks []BenchmarkResult     // Benchmarks of the run, in configuration order.
+	Strategies []strategies.Strategy // Strategies at the end of the run, in configuration order.
+	Trades     []environment.Trade   // Trades of the strategies, in time order.
+	Err        error                 // Why the run failed, if it did.
+}
+
+// Window represents the dates simulated by a run, both included.
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// String returns a string representation of the window.
+func (window Window) String() string {
+	return window.Start.Format(time.DateOnly) + ".." + window.End.Format(time.DateOnly)
+}
+
+// Runner runs backtests: each run simulates the strategies on isolated simulators, which share the exchange wrappers and
+// a read only market data store.
+type Runner struct {
+	config   Config
+	window   Window // simulation dates of the configuration.
+	store    *exchanges.MarketDataStore
+	wrappers []exchanges.ExchangeWrapper // inner wrappers of the simulators, by exchange configuration.
+	tempDir  string
+}
+
+// NewRunner creates a runner for the backtest. The historical data is stored in the configured data directory, or in a
+// temporary one removed by Close.
+func NewRunner(config Config) (*Runner, error) {
+	simConfig := config.Bot.SimulationConfigs
+	start, errStart := time.Parse(time.DateOnly, simConfig.SimStartDate)
+	end, errEnd := time.Parse(time.DateOnly, simConfig.SimEndDate)
+	if errStart != nil || errEnd != nil || !end.After(start) {
+		return nil, errors.New("backtests need valid simulation start_date and end_date")
+	}
+	if config.NeutralCoin == "" {
+		config.NeutralCoin = specNeutralCoin(config.Bot.Strategies)
+	}
+
+	runner := &Runner{config: config, window: Window{Start: start, End: end}}
+	dir := simConfig.SimDataDir
+	if dir == "" {
+		tempDir, err := os.MkdirTemp("", "backtest")
+		if err != nil {
+			return nil, err
+		}
+		runner.tempDir, dir = tempDir, tempDir
+	}
+
+	store, err := exchanges.NewMarketDataStore(dir)
+	if err != nil {
+		runner.Close()
+		return nil, err
+	}
+	runner.store = store
+
+	for _, exchangeConfig := range config.Bot.ExchangeConfigs {
+		wrapper := helpers.NewExchange(exchangeConfig, exchangeConfig.DepositAddresses)
+		if wrapper == nil {
+			runner.Close()
+			return nil, errors.New("unknown exchange " + exchangeConfig.ExchangeName)
+		}
+		runner.wrappers = append(runner.wrappers, wrapper)
+	}
+	return runner, nil
+}
+
+// Close removes the temporary data directory of the runner, if any.
+func (runner *Runner) Close() error {
+	if runner.tempDir == "" {
+		return nil
+	}
+	return os.RemoveAll(runner.tempDir)
+}
+
+// Window gets the simulation dates of the configuration.
+func (runner *Runner) Window() Window {
+	return runner.window
+}
+
+// Run simulates every combination of the swept values on a pool of workers, returning the results ranked by the metric
+// of the configuration, failed runs last.
+func (runner *Runner) Run() []Result {
+	return runner.RunIn(runner.window)
+}
+
+// RunIn runs the sweep like Run, over the specified dates.
+func (runner *Runner) RunIn(window Window) []Result {
+	grid := Grid(runner.config.Sweeps)
+	results := make([]Result, len(grid))
+
+	workers := runner.config.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = runner.RunOnceIn(grid[i], window)
+			}
+		}()
+	}
+	for i := range grid {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	Rank(results, runner.config.RankBy)
+	return results
+}
+
+// RunOnce simulates the strategies with the specified parameters.
+func (runner *Runner) RunOnce(params ParamSet) Result {
+	return runner.RunOnceIn(params, runner.window)
+}
+
+// RunOnceIn simulates the strategies with the specified parameters over the specified dates.
+func (runner *Runner) RunOnceIn(params ParamSet, window Window) Result {
+	return runner.run(params, window, runner.wrappers, runner.store, runner.config.Benchmarks, nil, CheckpointConfig{})
+}
+
+// RunCheckpointed simulates the strategies with the specified parameters like RunOnce, saving checkpoints as configured.
+// The run resumes from the checkpoint if not nil, with its parameters.
+func (runner *Runner) RunCheckpointed(params ParamSet, checkpoints CheckpointConfig, from *Checkpoint) Result {
+	if from == nil {
+		return runner.run(params, runner.window, runner.wrappers, runner.store, runner.config.Benchmarks, nil, checkpoints)
+	}
+	if !from.Window.Start.Equal(runner.window.Start) || !from.Window.End.Equal(runner.window.End) {
+		return Result{Params: from.Params, Err: fmt.Errorf("the checkpoint simulates %s, the configuration %s", from.Window, runner.window)}
+	}
+	return runner.run(from.Params, runner.window, runner.wrappers, runner.store, runner.config.Benchmarks, from, checkpoints)
+}
+
+// run simulates the strategies with the specified parameters over the specified dates, on simulators of the specified
+// inner wrappers reading the historical data through the store, nil for none, along with the benchmarks. The run resumes
+// from the checkpoint if not nil, and saves checkpoints as configured.
+func (runner *Runner) run(params ParamSet, window Window, inner []exchanges.ExchangeWrapper, store *exchanges.MarketDataStore, benchmarks []Benchmark, from *Checkpoint, checkpoints CheckpointConfig) (result Result) {
+	result.Params = params
+	defer func() {
+		if r := recover(); r != nil {
+			result.Err = fmt.Errorf("run panicked: %v", r)
+		}
+	}()
+
+	strategyConfigs, err := ApplyParams(runner.config.Bot.Strategies, params)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	wrappers := runner.simulators(window, inner, store)
+	tactics := make([]strategies.Tactic, len(strategyConfigs))
+	for i, strategyConfig := range strategyConfigs {
+		strategy, err := strategies.New(strategyConfig)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		tactics[i] = strategies.Tactic{Markets: helpers.InitMarkets(strategyConfig), Strategy: strategy}
+	}
+
+	// each benchmark trades its own sub-account on the markets of all the strategies, after them.
+	strategyCount := len(tactics)
+	benchmarkTactics := make([]int, len(benchmarks))
+	result.Benchmarks = make([]BenchmarkResult, len(benchmarks))
+	markets := configMarkets(strategyConfigs)
+	for i, benchmark := range benchmarks {
+		result.Benchmarks[i].Benchmark = benchmark
+		strategy, err := newBenchmarkStrategy(benchmark, strategyConfigs, markets)
+		if err != nil {
+			result.Benchmarks[i].Err, benchmarkTactics[i] = err, -1
+			continue
+		}
+		benchmarkTactics[i] = len(tactics)
+		tactics = append(tactics, strategies.Tactic{Markets: markets, Strategy: *strategy})
+	}
+
+	var resume *strategies.SimulationCheckpoint
+	saved := window.Start
+	if from != nil {
+		resume, saved = from.Simulation, from.Simulation.Time
+		result.Equity = append(result.Equity, from.Equity...)
+		for i := range result.Benchmarks {
+			if i < len(from.Benchmarks) {
+				result.Benchmarks[i].Equity = append(result.Benchmarks[i].Equity, from.Benchmarks[i]...)
+			}
+		}
+	}
+
+	final, err := strategies.SimulateFrom(wrappers, tactics, resume, func(now time.Time, simulated []strategies.SimulatedTactic) {
+		result.Equity = appendEquity(result.Equity, window.Start, now, simulated[:strategyCount], runner.config.NeutralCoin)
+		for i, tactic := range benchmarkTactics {
+			if tactic >= 0 {
+				benchmark := &result.Benchmarks[i]
+				benchmark.Equity = appendEquity(benchmark.Equity, window.Start, now, simulated[tactic:tactic+1], runner.config.NeutralCoin)
+			}
+		}
+
+		if checkpoints.Path == "" || checkpoints.Every <= 0 || now.Sub(saved) < checkpoints.Every {
+			return
+		}
+		simulation, err := strategies.Checkpoint(wrappers, simulated)
+		if err == nil {
+			checkpoint := &Checkpoint{Params: params, Window: window, Equity: result.Equity, Simulation: simulation}
+			for _, benchmark := range result.Benchmarks {
+				checkpoint.Benchmarks = append(checkpoint.Benchmarks, benchmark.Equity)
+			}
+			err = checkpoint.Save(checkpoints.Path)
+		}
+		if err != nil {
+			logrus.Warn("Cannot save checkpoint: ", err)
+			return
+		}
+		saved = now
+	})
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if len(result.Equity) == 0 {
+		result.Err = errors.New("the portfolio could not be valued")
+		return result
+	}
+
+	for _, tactic := range final[:strategyCount] {
+		result.Strategies = append(result.Strategies, tactic.Strategy)
+		for _, wrapper := range tactic.Wrappers {
+			if _, simulated := wrapper.(exchanges.Stepper); !simulated {
+				continue
+			}
+			if tradeBook, err := wrapper.GetAllTrades(tactic.Markets); err == nil {
+				result.Trades = append(result.Trades, tradeBook.Trades...)
+			}
+		}
+	}
+	sort.SliceStable(result.Trades, func(i, j int) bool {
+		return result.Trades[i].Timestamp.Before(result.Trades[j].Timestamp)
+	})
+
+	result.Metrics = NewMetrics(result.Equity)
+	for i := range result.Benchmarks {
+		benchmark := &result.Benchmarks[i]
+		if benchmark.Err != nil {
+			continue
+		}
+		if len(benchmark.Equity) == 0 {
+			benchmark.Err = errors.New("the benchmark could not be valued")
+			continue
+		}
+		benchmark.Metrics = NewMetrics(benchmark.Equity)
+		compareBenchmark(result, benchmark)
+	}
+	return result
+}
+
+// appendEquity values the portfolios of the tactics at the current step and appends them to the curve, the steps they
+// cannot be valued at being skipped.
+func appendEquity(curve EquityCurve, start time.Time, now time.Time, tactics []strategies.SimulatedTactic, neutralCoin string) EquityCurve {
+	since := start
+	if len(curve) > 0 {
+		since = curve[len(curve)-1].Time
+	}
+	point, err := equityPoint(since, now, tactics, neutralCoin)
+	if err != nil {
+		return curve
+	}
+	return append(curve, point)
+}
+
+// equityPoint values the portfolios of the tactics at the current step, with the cash flows they received since the
+// previous one.
+func equityPoint(since time.Time, now time.Time, tactics []strategies.SimulatedTactic, neutralCoin string) (EquityPoint, error) {
+	point := EquityPoint{Time: now, Value: decimal.Zero, NeutralValue: decimal.Zero, Flow: decimal.Zero, NeutralFlow: decimal.Zero,
+		Holdings: make(map[string]decimal.Decimal)}
+	for _, tactic := range tactics {
+		holdings, value, neutralValue, err := portfolioHoldings(tactic.Wrappers, tactic.Markets, neutralCoin)
+		if err != nil {
+			return point, err
+		}
+		for coin, coinValue := range holdings {
+			point.Holdings[coin] = point.Holdings[coin].Add(coinValue)
+		}
+		point.Value = point.Value.Add(value)
+		point.NeutralValue = point.NeutralValue.Add(neutralValue)
+
+		flow, neutralFlow, err := CashFlowValue(tactic.Wrappers, tactic.Markets, neutralCoin, since, now)
+		if err != nil {
+			return point, err
+		}
+		point.Flow = point.Flow.Add(flow)
+		point.NeutralFlow = point.NeutralFlow.Add(neutralFlow)
+	}
+	return point, nil
+}
+
+// simulators creates isolated simulators of the inner wrappers for a run over the dates, starting with the configured
+// fake balances.
+func (runner *Runner) simulators(window Window, inner []exchanges.ExchangeWrapper, store *exchanges.MarketDataStore) []exchanges.ExchangeWrapper {
+	simConfig := runner.config.Bot.SimulationConfigs
+	simConfig.SimStartDate = window.Start.Format(time.DateOnly)
+	simConfig.SimEndDate = window.End.Format(time.DateOnly)
+	ret := make([]exchanges.ExchangeWrapper, len(inner))
+	for i, wrapper := range inner {
+		balances := make(map[string]decimal.Decimal, len(simConfig.SimFakeBalances))
+		for coin, balance := range simConfig.SimFakeBalances {
+			balances[coin] = balance
+		}
+		simConfig.SimFakeBalances = balances
+		ret[i] = exchanges.NewExchangeWrapperSimulatorWithStore(wrapper, simConfig, store)
+	}
+	return ret
+}
+
+// Rank sorts the results by the specified metric, failed runs last.
+func Rank(results []Result, metric RankMetric) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if (results[i].Err == nil) != (results[j].Err == nil) {
+			return results[i].Err == nil
+		}
+		return results[i].Metrics.Better(results[j].Metrics, metric)
+	})
+}
+
+// configMarkets returns the markets of the strategies, once per name.
+func configMarkets(configs []environment.StrategyConfig) []*environment.Market {
+	var ret []*environment.Market
+	seen := make(map[string]bool)
+	for _, config := range configs {
+		for _, market := range helpers.InitMarkets(config) {
+			if !seen[market.Name] {
+				seen[market.Name] = true
+				ret = append(ret, market)
+			}
+		}
+	}
+	return ret
+}
+
+// specNeutralCoin returns the nuetral_coin of the first strategy spec defining one.
+func specNeutralCoin(configs []environment.StrategyConfig) string {
+	for _, config := range configs {
+		if coin, ok := config.Spec["nuetral_coin"].(string); ok && coin != "" {
+			return coin
+		}
+	}
+	return ""
+}
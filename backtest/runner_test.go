@@ -0,0 +1,129 @@
+package backtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/mcwarner5/BlockBot8000/strategies"
+	"github.com/shopspring/decimal"
+)
+
+func TestRunIsReproducible(t *testing.T) {
+	first := newSyntheticRunner(t, syntheticBot()).RunOnce(nil)
+	if first.Err != nil {
+		t.Fatal(first.Err)
+	}
+	// the run of the fixture, which must not change as long as the simulation and the rebalancer are unchanged.
+	if len(first.Equity) != 30*24+1 || len(first.Trades) != 51 || !first.Metrics.FinalValue.Round(4).Equal(decimal.RequireFromString("9020.8079")) {
+		t.Fatalf("got %d equity points, %d trades and a final value of %s, want 721, 51 and 9020.8079",
+			len(first.Equity), len(first.Trades), first.Metrics.FinalValue.Round(4))
+	}
+
+	for run := 0; run < 3; run++ {
+		again := newSyntheticRunner(t, syntheticBot()).RunOnce(nil)
+		if again.Err != nil {
+			t.Fatal(again.Err)
+		}
+		assertSameEquity(t, "strategy", again.Equity, first.Equity)
+		for i := range first.Benchmarks {
+			assertSameEquity(t, first.Benchmarks[i].Benchmark.String(), again.Benchmarks[i].Equity, first.Benchmarks[i].Equity)
+		}
+		if len(again.Trades) != len(first.Trades) {
+			t.Fatalf("%d trades, want %d", len(again.Trades), len(first.Trades))
+		}
+	}
+}
+
+func TestRunOnSyntheticExchange(t *testing.T) {
+	bot := syntheticBot()
+	bot.SimulationConfigs.SimEndDate = "2024-01-03"
+	runner := newSyntheticRunner(t, bot)
+
+	result := runner.RunOnce(nil)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	window := runner.Window()
+	if want := int(window.End.Sub(window.Start).Hours()) + 1; len(result.Equity) != want {
+		t.Fatalf("%d equity points, want one per hour: %d", len(result.Equity), want)
+	}
+	if first, last := result.Equity[0], result.Equity[len(result.Equity)-1]; !first.Time.Equal(window.Start) || !last.Time.Equal(window.End) {
+		t.Fatalf("the equity curve runs from %s to %s, want %s", first.Time, last.Time, window)
+	}
+	if len(result.Trades) != 8 || !result.Metrics.FinalValue.Round(4).Equal(decimal.RequireFromString("9828.0927")) {
+		t.Fatalf("got %d trades and a final value of %s, want 8 and 9828.0927", len(result.Trades), result.Metrics.FinalValue.Round(4))
+	}
+
+	// the 10000 usdt deposited are rebalanced to the weights of the spec at the first step, less the fees and spread.
+	first := result.Equity[0]
+	if neutral := first.NeutralValue.InexactFloat64(); neutral < 9970 || neutral >= 10000 {
+		t.Errorf("the portfolio started at %f usdt, want a bit less than 10000", neutral)
+	}
+	for coin, weight := range map[string]float64{"btc": 0.3, "eth": 0.25, "sol": 0.25, "usdt": 0.2} {
+		if share := first.Holdings[coin].Div(first.Value).InexactFloat64(); share < weight-0.005 || share > weight+0.005 {
+			t.Errorf("the portfolio started with %.4f of %s, want %.2f", share, coin, weight)
+		}
+	}
+	for _, point := range result.Equity {
+		total := decimal.Zero
+		for _, value := range point.Holdings {
+			total = total.Add(value)
+		}
+		if !total.Equal(point.Value) {
+			t.Fatalf("the portfolio is worth %s at %s, but its holdings %s", point.Value, point.Time, total)
+		}
+	}
+	for _, trade := range result.Trades {
+		fees := trade.Total().Mul(decimal.RequireFromString("0.0026"))
+		if trade.Market == "usdt-usd" {
+			fees = decimal.Zero // the rebalancer records the usdt deposited as bought without fees.
+		}
+		if !trade.Fees.Equal(fees) {
+			t.Errorf("trade %s of %s paid %s of fees, want the synthetic rate of 0.26%%: %s", trade.Market, trade.Total(), trade.Fees, fees)
+		}
+	}
+	for i := range result.Benchmarks {
+		if benchmark := result.Benchmarks[i]; benchmark.Err != nil || len(benchmark.Equity) != len(result.Equity) {
+			t.Fatalf("benchmark %s ran %d points: %v", benchmark.Benchmark, len(benchmark.Equity), benchmark.Err)
+		}
+	}
+}
+
+func TestRunWithCashFlows(t *testing.T) {
+	bot := syntheticBot()
+	bot.SimulationConfigs.SimEndDate = "2024-01-03"
+	bot.SimulationConfigs.SimCashFlows = []environment.CashFlowConfig{{Coin: "usdt", Amount: decimal.NewFromInt(1000), Date: "2024-01-02"}}
+	result := newSyntheticRunner(t, bot).RunOnce(nil)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	// the deposit is received by the step of 2024-01-02 only, valued in usd through the USDT-USD market.
+	deposited := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	for _, point := range result.Equity {
+		flow, neutralFlow := decimal.Zero, decimal.Zero
+		if point.Time.Equal(deposited) {
+			flow, neutralFlow = decimal.RequireFromString("999.89296"), decimal.NewFromInt(1000)
+		}
+		if !point.Flow.Equal(flow) || !point.NeutralFlow.Equal(neutralFlow) {
+			t.Errorf("%s: received %s usd and %s usdt, want %s and %s", point.Time, point.Flow, point.NeutralFlow, flow, neutralFlow)
+		}
+	}
+
+	// the time weighted return leaves the deposit out, while the final value holds it.
+	metrics := result.Metrics
+	if !metrics.NetFlows.Equal(decimal.RequireFromString("999.89296")) || !metrics.FinalValue.Round(4).Equal(decimal.RequireFromString("10822.4231")) {
+		t.Errorf("got net flows of %s and a final value of %s, want 999.89296 and 10822.4231", metrics.NetFlows, metrics.FinalValue.Round(4))
+	}
+	if !metrics.Return.Round(6).Equal(decimal.RequireFromString("-0.014837")) || !metrics.IRR.Equal(decimal.RequireFromString("-93.5384")) {
+		t.Errorf("got a return of %s and an IRR of %s%%, want -0.014837 and -93.5384%%", metrics.Return.Round(6), metrics.IRR)
+	}
+
+	// the rebalancer records the deposit in its own analysis, valued at its prices.
+	analysis := result.Strategies[0].(strategies.PortfolioAnalyzer).GetPortfolioAnalysis()
+	if len(analysis.CashFlows) != 1 || !analysis.GetNetCashFlows().Round(4).Equal(decimal.NewFromInt(1000)) {
+		t.Errorf("the analysis recorded %d cash flows worth %s usdt, want 1 worth 1000", len(analysis.CashFlows), analysis.GetNetCashFlows())
+	}
+}
@@ -0,0 +1,231 @@
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// portfolioWeightsKey is the spec key of the portfolio weights, which must keep adding up to 100% when swept.
+const portfolioWeightsKey = "portfolio_ratio_percent"
+
+// weightsTolerance is how far from 100% the portfolio weights may add up, as accepted by the rebalancer.
+const weightsTolerance = 0.01
+
+// maxSweepValues bounds the number of values of a single swept parameter, catching wrong steps.
+const maxSweepValues = 10_000
+
+// SweepParam represents a strategy spec parameter and the values it takes during a sweep.
+type SweepParam struct {
+	Path   []string // Keys of the parameter in the spec, through the nested maps (e.g. portfolio_ratio_percent.eth).
+	Values []decimal.Decimal
+}
+
+// Name returns the dotted name of the parameter.
+func (param SweepParam) Name() string {
+	return strings.Join(param.Path, ".")
+}
+
+// ParseSweep parses a sweep of the form name=start:end:step, the end being included, or name=value1,value2,...
+func ParseSweep(sweep string) (SweepParam, error) {
+	name, values, found := strings.Cut(sweep, "=")
+	if !found || name == "" || values == "" {
+		return SweepParam{}, fmt.Errorf("invalid sweep %q: expected name=start:end:step or name=value1,value2", sweep)
+	}
+	param := SweepParam{Path: strings.Split(name, ".")}
+
+	if bounds := strings.Split(values, ":"); len(bounds) == 3 {
+		start, errStart := decimal.NewFromString(bounds[0])
+		end, errEnd := decimal.NewFromString(bounds[1])
+		step, errStep := decimal.NewFromString(bounds[2])
+		if errStart != nil || errEnd != nil || errStep != nil {
+			return SweepParam{}, fmt.Errorf("invalid sweep %q: start, end and step must be numbers", sweep)
+		}
+		if !step.IsPositive() || end.LessThan(start) {
+			return SweepParam{}, fmt.Errorf("invalid sweep %q: step must be > 0 and end >= start", sweep)
+		}
+		for value := start; value.LessThanOrEqual(end); value = value.Add(step) {
+			if len(param.Values) == maxSweepValues {
+				return SweepParam{}, fmt.Errorf("invalid sweep %q: more than %d values", sweep, maxSweepValues)
+			}
+			param.Values = append(param.Values, value)
+		}
+		return param, nil
+	}
+
+	for _, raw := range strings.Split(values, ",") {
+		value, err := decimal.NewFromString(strings.TrimSpace(raw))
+		if err != nil {
+			return SweepParam{}, fmt.Errorf("invalid sweep %q: %s is not a number", sweep, raw)
+		}
+		param.Values = append(param.Values, value)
+	}
+	return param, nil
+}
+
+// ParamValue represents the value of a swept parameter in a run.
+type ParamValue struct {
+	Name  string
+	Value decimal.Decimal
+}
+
+// ParamSet represents the values of the swept parameters in a run, in the order of the sweeps.
+type ParamSet []ParamValue
+
+// String returns a string representation of the parameters.
+func (set ParamSet) String() string {
+	if len(set) == 0 {
+		return "(config)"
+	}
+	ret := make([]string, len(set))
+	for i, param := range set {
+		ret[i] = param.Name + "=" + param.Value.String()
+	}
+	return strings.Join(ret, " ")
+}
+
+// Grid returns every combination of the values of the parameters, the last parameter varying first.
+func Grid(params []SweepParam) []ParamSet {
+	grid := []ParamSet{{}}
+	for _, param := range params {
+		next := make([]ParamSet, 0, len(grid)*len(param.Values))
+		for _, set := range grid {
+			for _, value := range param.Values {
+				combination := make(ParamSet, len(set), len(set)+1)
+				copy(combination, set)
+				next = append(next, append(combination, ParamValue{Name: param.Name(), Value: value}))
+			}
+		}
+		grid = next
+	}
+	return grid
+}
+
+// ApplyParams returns a copy of the strategy configurations with the parameters set in the specs defining them, an error
+// is returned if no spec defines a parameter. The portfolio weights not swept are scaled so that they keep adding up to
+// 100% with the swept ones.
+func ApplyParams(configs []environment.StrategyConfig, set ParamSet) ([]environment.StrategyConfig, error) {
+	ret := make([]environment.StrategyConfig, len(configs))
+	for i, config := range configs {
+		config.Spec = copySpec(config.Spec)
+		ret[i] = config
+	}
+
+	for _, param := range set {
+		path := strings.Split(param.Name, ".")
+		applied := false
+		for _, config := range ret {
+			ok, err := setSpecValue(config.Spec, path, param.Value)
+			if err != nil {
+				return nil, fmt.Errorf("cannot set %s: %w", param.Name, err)
+			}
+			applied = applied || ok
+		}
+		if !applied {
+			return nil, fmt.Errorf("no strategy spec defines %s", param.Name)
+		}
+	}
+
+	for _, config := range ret {
+		if err := rebalanceWeights(config.Spec, set); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// setSpecValue sets an existing value of a spec, keeping its type, returning whether the spec defines it.
+func setSpecValue(spec map[string]interface{}, path []string, value decimal.Decimal) (bool, error) {
+	current, exists := spec[path[0]]
+	if !exists {
+		return false, nil
+	}
+	if len(path) > 1 {
+		nested, ok := current.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+		return setSpecValue(nested, path[1:], value)
+	}
+
+	switch current.(type) {
+	case int:
+		if !value.Equal(value.Truncate(0)) {
+			return true, errors.New("value " + value.String() + " is not an integer")
+		}
+		spec[path[0]] = int(value.IntPart())
+	case float64:
+		spec[path[0]] = value.InexactFloat64()
+	case string:
+		spec[path[0]] = value.String()
+	default:
+		return true, fmt.Errorf("cannot sweep a value of type %T", current)
+	}
+	return true, nil
+}
+
+// rebalanceWeights scales the portfolio weights not swept so that all the weights add up to 100%.
+func rebalanceWeights(spec map[string]interface{}, set ParamSet) error {
+	weights, ok := spec[portfolioWeightsKey].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	swept := make(map[string]bool)
+	for _, param := range set {
+		if coin, found := strings.CutPrefix(param.Name, portfolioWeightsKey+"."); found {
+			swept[coin] = true
+		}
+	}
+	if len(swept) == 0 {
+		return nil
+	}
+
+	sweptTotal, othersTotal := 0.0, 0.0
+	for coin, weight := range weights {
+		value, ok := weight.(float64)
+		if !ok {
+			return fmt.Errorf("portfolio weight of %s is not a number", coin)
+		}
+		if swept[coin] {
+			sweptTotal += value
+		} else {
+			othersTotal += value
+		}
+	}
+
+	if sweptTotal > 1 || (othersTotal == 0 && math.Abs(sweptTotal-1) > weightsTolerance) {
+		return fmt.Errorf("swept portfolio weights add up to %.4f, the portfolio cannot add up to 100%%", sweptTotal)
+	}
+	if othersTotal == 0 {
+		return nil // the swept weights already add up to 100%, the others stay at zero.
+	}
+	for coin, weight := range weights {
+		if !swept[coin] {
+			weights[coin] = weight.(float64) * (1 - sweptTotal) / othersTotal
+		}
+	}
+	return nil
+}
+
+// copySpec deep copies a strategy spec, so that runs never share nested maps.
+func copySpec(spec map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(spec))
+	for key, value := range spec {
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			ret[key] = copySpec(typed)
+		case []interface{}:
+			list := make([]interface{}, len(typed))
+			copy(list, typed)
+			ret[key] = list
+		default:
+			ret[key] = value
+		}
+	}
+	return ret
+}
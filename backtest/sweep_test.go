@@ -0,0 +1,209 @@
+package backtest
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+func TestParseSweep(t *testing.T) {
+	tests := []struct {
+		sweep  string
+		path   []string
+		values []decimal.Decimal
+		err    string
+	}{
+		{sweep: "interval=1:3:1", path: []string{"interval"}, values: decimals("1", "2", "3")},
+		{sweep: "threshold=0.1:0.3:0.1", path: []string{"threshold"}, values: decimals("0.1", "0.2", "0.3")},
+		{sweep: "threshold=1:2:0.3", path: []string{"threshold"}, values: decimals("1", "1.3", "1.6", "1.9")},
+		{sweep: "threshold=0.5:0.5:0.1", path: []string{"threshold"}, values: decimals("0.5")},
+		{sweep: "portfolio_ratio_percent.eth=0.2, 0.4", path: []string{"portfolio_ratio_percent", "eth"}, values: decimals("0.2", "0.4")},
+		{sweep: "threshold", err: "expected name="},
+		{sweep: "=1,2", err: "expected name="},
+		{sweep: "threshold=a:2:1", err: "must be numbers"},
+		{sweep: "threshold=1:2:0", err: "step must be > 0"},
+		{sweep: "threshold=2:1:1", err: "end >= start"},
+		{sweep: "threshold=0:1:0.00001", err: "more than"},
+		{sweep: "threshold=1,b", err: "b is not a number"},
+	}
+	for _, test := range tests {
+		param, err := ParseSweep(test.sweep)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ParseSweep(%q) returned error %v, want %q", test.sweep, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSweep(%q) returned error %v", test.sweep, err)
+			continue
+		}
+		if !reflect.DeepEqual(param.Path, test.path) {
+			t.Errorf("ParseSweep(%q) path is %v, want %v", test.sweep, param.Path, test.path)
+		}
+		if len(param.Values) != len(test.values) {
+			t.Errorf("ParseSweep(%q) values are %v, want %v", test.sweep, param.Values, test.values)
+			continue
+		}
+		for i := range test.values {
+			if !param.Values[i].Equal(test.values[i]) {
+				t.Errorf("ParseSweep(%q) values are %v, want %v", test.sweep, param.Values, test.values)
+				break
+			}
+		}
+	}
+}
+
+func TestGrid(t *testing.T) {
+	grid := Grid([]SweepParam{
+		{Path: []string{"a"}, Values: decimals("1", "2")},
+		{Path: []string{"b"}, Values: decimals("10", "20", "30")},
+	})
+	want := []string{"a=1 b=10", "a=1 b=20", "a=1 b=30", "a=2 b=10", "a=2 b=20", "a=2 b=30"}
+	if len(grid) != len(want) {
+		t.Fatalf("the grid has %d sets, want %d", len(grid), len(want))
+	}
+	for i, set := range grid {
+		if set.String() != want[i] {
+			t.Errorf("set %d is %s, want %s", i, set, want[i])
+		}
+	}
+
+	if empty := Grid(nil); len(empty) != 1 || empty[0].String() != "(config)" {
+		t.Errorf("the grid of no parameters is %v, want the configuration alone", empty)
+	}
+}
+
+// near returns whether two weights are equal but for rounding, never for NaN.
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) <= 1e-9
+}
+
+// weightsConfig returns a strategy configuration with portfolio weights.
+func weightsConfig(weights map[string]interface{}) []environment.StrategyConfig {
+	return []environment.StrategyConfig{{Spec: map[string]interface{}{
+		"interval":            60,
+		"threshold":           0.05,
+		portfolioWeightsKey:   weights,
+		"unrelated_parameter": "kept",
+	}}}
+}
+
+func TestApplyParams(t *testing.T) {
+	configs := weightsConfig(map[string]interface{}{"btc": 0.5, "eth": 0.3, "sol": 0.2})
+
+	applied, err := ApplyParams(configs, ParamSet{
+		{Name: "interval", Value: decimal.NewFromInt(120)},
+		{Name: "threshold", Value: decimal.RequireFromString("0.1")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := applied[0].Spec
+	if spec["interval"] != 120 || spec["threshold"] != 0.1 || spec["unrelated_parameter"] != "kept" {
+		t.Errorf("the spec is %v after applying the parameters", spec)
+	}
+	if configs[0].Spec["interval"] != 60 {
+		t.Errorf("applying the parameters changed the original spec: %v", configs[0].Spec)
+	}
+
+	errs := []struct {
+		set ParamSet
+		err string
+	}{
+		{set: ParamSet{{Name: "missing", Value: decimal.NewFromInt(1)}}, err: "no strategy spec defines missing"},
+		{set: ParamSet{{Name: "interval", Value: decimal.RequireFromString("1.5")}}, err: "is not an integer"},
+		{set: ParamSet{{Name: portfolioWeightsKey, Value: decimal.NewFromInt(1)}}, err: "cannot sweep a value of type"},
+	}
+	for _, test := range errs {
+		if _, err := ApplyParams(configs, test.set); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("applying %s returned error %v, want %q", test.set, err, test.err)
+		}
+	}
+}
+
+func TestRebalanceWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]interface{}
+		set     ParamSet
+		want    map[string]float64
+		err     string
+	}{
+		{
+			name:    "others scaled to the remainder",
+			weights: map[string]interface{}{"btc": 0.5, "eth": 0.3, "sol": 0.2},
+			set:     ParamSet{{Name: portfolioWeightsKey + ".btc", Value: decimal.RequireFromString("0.75")}},
+			want:    map[string]float64{"btc": 0.75, "eth": 0.15, "sol": 0.1},
+		},
+		{
+			name:    "many swept weights",
+			weights: map[string]interface{}{"btc": 0.4, "eth": 0.4, "sol": 0.2},
+			set: ParamSet{
+				{Name: portfolioWeightsKey + ".btc", Value: decimal.RequireFromString("0.3")},
+				{Name: portfolioWeightsKey + ".eth", Value: decimal.RequireFromString("0.3")},
+			},
+			want: map[string]float64{"btc": 0.3, "eth": 0.3, "sol": 0.4},
+		},
+		{
+			name:    "other weights at zero",
+			weights: map[string]interface{}{"btc": 0.5, "eth": 0.5, "sol": 0.0},
+			set: ParamSet{
+				{Name: portfolioWeightsKey + ".btc", Value: decimal.RequireFromString("0.6")},
+				{Name: portfolioWeightsKey + ".eth", Value: decimal.RequireFromString("0.4")},
+			},
+			want: map[string]float64{"btc": 0.6, "eth": 0.4, "sol": 0},
+		},
+		{
+			name:    "weights not swept",
+			weights: map[string]interface{}{"btc": 0.5, "eth": 0.5},
+			set:     ParamSet{{Name: "threshold", Value: decimal.RequireFromString("0.1")}},
+			want:    map[string]float64{"btc": 0.5, "eth": 0.5},
+		},
+		{
+			name:    "swept weights over 100%",
+			weights: map[string]interface{}{"btc": 0.5, "eth": 0.5},
+			set:     ParamSet{{Name: portfolioWeightsKey + ".btc", Value: decimal.RequireFromString("1.2")}},
+			err:     "cannot add up to 100%",
+		},
+		{
+			name:    "all weights swept under 100%",
+			weights: map[string]interface{}{"btc": 0.5, "eth": 0.5},
+			set: ParamSet{
+				{Name: portfolioWeightsKey + ".btc", Value: decimal.RequireFromString("0.2")},
+				{Name: portfolioWeightsKey + ".eth", Value: decimal.RequireFromString("0.2")},
+			},
+			err: "cannot add up to 100%",
+		},
+	}
+	for _, test := range tests {
+		applied, err := ApplyParams(weightsConfig(test.weights), test.set)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: returned error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: returned error %v", test.name, err)
+			continue
+		}
+
+		weights := applied[0].Spec[portfolioWeightsKey].(map[string]interface{})
+		total := 0.0
+		for coin, want := range test.want {
+			got := weights[coin].(float64)
+			if !near(got, want) {
+				t.Errorf("%s: weight of %s is %f, want %f", test.name, coin, got, want)
+			}
+			total += got
+		}
+		if !near(total, 1) {
+			t.Errorf("%s: weights add up to %f", test.name, total)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/shopspring/decimal"
+)
+
+// tableHeader is the header of the results table.
+var tableHeader = []string{"rank", "params", "initial_value", "final_value", "net_flows", "return_%", "apr_%", "irr_%", "max_drawdown_%", "error"}
+
+// tableRows returns the rows of the results table, in the order of the results.
+func tableRows(results []Result) [][]string {
+	hundo := decimal.NewFromInt(100)
+	rows := make([][]string, len(results))
+	for i, result := range results {
+		if result.Err != nil {
+			rows[i] = []string{strconv.Itoa(i + 1), result.Params.String(), "", "", "", "", "", "", "", result.Err.Error()}
+			continue
+		}
+		metrics := result.Metrics
+		rows[i] = []string{
+			strconv.Itoa(i + 1),
+			result.Params.String(),
+			metrics.InitialValue.Round(4).String(),
+			metrics.FinalValue.Round(4).String(),
+			metrics.NetFlows.Round(4).String(),
+			metrics.Return.Mul(hundo).Round(2).String(),
+			metrics.APR.Round(2).String(),
+			metrics.IRR.Round(2).String(),
+			metrics.MaxDrawdown.Mul(hundo).Round(2).String(),
+			"",
+		}
+	}
+	return rows
+}
+
+// WriteTable writes the results as an aligned text table.
+func WriteTable(w io.Writer, results []Result) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, row := range append([][]string{tableHeader}, tableRows(results)...) {
+		for i, cell := range row {
+			if i > 0 {
+				fmt.Fprint(table, "\t")
+			}
+			fmt.Fprint(table, cell)
+		}
+		fmt.Fprintln(table)
+	}
+	return table.Flush()
+}
+
+// WriteCSV writes the results as a CSV table.
+func WriteCSV(w io.Writer, results []Result) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(tableHeader); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(tableRows(results)); err != nil {
+		return err
+	}
+	return writer.Error()
+}
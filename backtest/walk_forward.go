@@ -0,0 +1,224 @@
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// WalkForwardConfig represents the windows of a walk-forward optimization, in days.
+type WalkForwardConfig struct {
+	InSample    int // Length of the windows the parameters are optimized on.
+	OutOfSample int // Length of the windows the optimized parameters are evaluated on, the windows roll by this length.
+}
+
+// WalkForwardWindow represents a step of a walk-forward optimization.
+type WalkForwardWindow struct {
+	InSample    Window
+	OutOfSample Window
+	Best        Result // Best run of the sweep over the in-sample window.
+	Validation  Result // Run of the best parameters over the out-of-sample window.
+}
+
+// WalkForwardResult represents the outcome of a walk-forward optimization.
+type WalkForwardResult struct {
+	Windows []WalkForwardWindow
+	Gaps    []Window    // Out-of-sample windows whose run failed, the curves are not stitched across them.
+	Equity  EquityCurve // Out-of-sample equity curves stitched together, empty if there are gaps.
+	Metrics Metrics     // Metrics of the stitched equity curve.
+}
+
+// ParamStability represents the values a parameter was optimized to across the windows.
+type ParamStability struct {
+	Name    string
+	Values  []decimal.Decimal // Best value of each window.
+	Mean    decimal.Decimal
+	StdDev  decimal.Decimal
+	Changes int // Number of windows whose best value differs from the previous window.
+}
+
+// SplitWalkForward splits the dates in rolling in-sample windows, each followed by its out-of-sample window.
+//
+//	NOTE: windows include both their dates, so each in-sample window ends the day before its out-of-sample window starts,
+//	never optimizing on the day it is evaluated on. The out-of-sample windows chain, each ending when the next starts.
+func SplitWalkForward(window Window, config WalkForwardConfig) ([]WalkForwardWindow, error) {
+	if config.InSample <= 0 || config.OutOfSample <= 0 {
+		return nil, errors.New("walk-forward windows must last at least a day")
+	}
+	inSample := time.Duration(config.InSample) * 24 * time.Hour
+	outOfSample := time.Duration(config.OutOfSample) * 24 * time.Hour
+
+	var ret []WalkForwardWindow
+	for start := window.Start; !start.Add(inSample + outOfSample).After(window.End); start = start.Add(outOfSample) {
+		ret = append(ret, WalkForwardWindow{
+			InSample:    Window{Start: start, End: start.Add(inSample).AddDate(0, 0, -1)},
+			OutOfSample: Window{Start: start.Add(inSample), End: start.Add(inSample + outOfSample)},
+		})
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("%s is shorter than a walk-forward window of %d days", window, config.InSample+config.OutOfSample)
+	}
+	return ret, nil
+}
+
+// WalkForward optimizes the swept parameters on each in-sample window and evaluates the best ones on the following
+// out-of-sample window.
+func (runner *Runner) WalkForward(config WalkForwardConfig) (*WalkForwardResult, error) {
+	windows, err := SplitWalkForward(runner.window, config)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &WalkForwardResult{Windows: windows}
+	curves := make([]EquityCurve, 0, len(windows))
+	for i := range windows {
+		window := &result.Windows[i]
+		window.Best = runner.RunIn(window.InSample)[0]
+		if window.Best.Err != nil {
+			window.Validation = Result{Params: window.Best.Params, Err: errors.New("no successful in-sample run")}
+		} else {
+			window.Validation = runner.RunOnceIn(window.Best.Params, window.OutOfSample)
+		}
+
+		if window.Validation.Err != nil {
+			result.Gaps = append(result.Gaps, window.OutOfSample)
+			continue
+		}
+		curves = append(curves, window.Validation.Equity)
+	}
+
+	// bridging a failed window would chain returns which were never made, so the curves are only stitched without gaps.
+	if len(result.Gaps) > 0 {
+		return result, nil
+	}
+	result.Equity, err = StitchEquity(curves)
+	if err != nil {
+		return nil, err
+	}
+	result.Metrics = NewMetrics(result.Equity)
+	return result, nil
+}
+
+// StitchEquity chains equity curves as if each one reinvested the final value of the previous one: every curve is scaled
+// to start where the previous one ended. An error is returned if a curve starts after the previous one ended.
+func StitchEquity(curves []EquityCurve) (EquityCurve, error) {
+	var ret EquityCurve
+	for _, curve := range curves {
+		if len(curve) == 0 {
+			continue
+		}
+		if len(ret) == 0 {
+			ret = append(ret, curve...)
+			continue
+		}
+
+		last, first := ret[len(ret)-1], curve[0]
+		if first.Time.After(last.Time) {
+			return nil, fmt.Errorf("cannot stitch equity curves with a gap from %s to %s", last.Time, first.Time)
+		}
+		scale, neutralScale := decimal.Zero, decimal.Zero
+		if first.Value.IsPositive() {
+			scale = last.Value.Div(first.Value)
+		}
+		if first.NeutralValue.IsPositive() {
+			neutralScale = last.NeutralValue.Div(first.NeutralValue)
+		}
+
+		for _, point := range curve {
+			if !point.Time.After(last.Time) {
+				continue
+			}
+			ret = append(ret, EquityPoint{
+				Time:         point.Time,
+				Value:        point.Value.Mul(scale),
+				NeutralValue: point.NeutralValue.Mul(neutralScale),
+				Flow:         point.Flow.Mul(scale),
+				NeutralFlow:  point.NeutralFlow.Mul(neutralScale),
+			})
+		}
+	}
+	return ret, nil
+}
+
+// Stability summarizes the values each swept parameter was optimized to, over the windows with a successful in-sample run.
+func (result *WalkForwardResult) Stability() []ParamStability {
+	var ret []ParamStability
+	index := make(map[string]int)
+	for _, window := range result.Windows {
+		if window.Best.Err != nil {
+			continue
+		}
+		for _, param := range window.Best.Params {
+			i, exists := index[param.Name]
+			if !exists {
+				i = len(ret)
+				index[param.Name] = i
+				ret = append(ret, ParamStability{Name: param.Name})
+			}
+			stability := &ret[i]
+			if n := len(stability.Values); n > 0 && !stability.Values[n-1].Equal(param.Value) {
+				stability.Changes++
+			}
+			stability.Values = append(stability.Values, param.Value)
+		}
+	}
+
+	for i := range ret {
+		stability := &ret[i]
+		count := decimal.NewFromInt(int64(len(stability.Values)))
+		sum := decimal.Zero
+		for _, value := range stability.Values {
+			sum = sum.Add(value)
+		}
+		stability.Mean = sum.Div(count)
+
+		variance := decimal.Zero
+		for _, value := range stability.Values {
+			diff := value.Sub(stability.Mean)
+			variance = variance.Add(diff.Mul(diff))
+		}
+		stability.StdDev = decimal.NewFromFloat(math.Sqrt(variance.Div(count).InexactFloat64()))
+	}
+	return ret
+}
+
+// WriteWalkForward writes the windows, the stability of the parameters and the out-of-sample metrics as text tables.
+func WriteWalkForward(w io.Writer, result *WalkForwardResult) error {
+	hundo := decimal.NewFromInt(100)
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(table, "in_sample\tout_of_sample\tbest_params\tin_sample_apr_%\tout_of_sample_apr_%\tout_of_sample_max_drawdown_%\terror")
+	for _, window := range result.Windows {
+		validation := window.Validation
+		if validation.Err != nil {
+			fmt.Fprintf(table, "%s\t%s\t%s\t\t\t\t%s\n", window.InSample, window.OutOfSample, validation.Params, validation.Err)
+			continue
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t\n", window.InSample, window.OutOfSample, validation.Params,
+			window.Best.Metrics.APR.Round(2), validation.Metrics.APR.Round(2), validation.Metrics.MaxDrawdown.Mul(hundo).Round(2))
+	}
+	fmt.Fprintln(table)
+
+	fmt.Fprintln(table, "param\tvalues\tmean\tstd_dev\tchanges")
+	for _, stability := range result.Stability() {
+		fmt.Fprintf(table, "%s\t%v\t%s\t%s\t%d\n", stability.Name, stability.Values, stability.Mean.Round(6), stability.StdDev.Round(6), stability.Changes)
+	}
+	fmt.Fprintln(table)
+
+	if len(result.Gaps) > 0 {
+		fmt.Fprintln(table, "out_of_sample\terror")
+		fmt.Fprintf(table, "stitched\tnot stitched, the runs of %v failed\n", result.Gaps)
+		return table.Flush()
+	}
+
+	metrics := result.Metrics
+	fmt.Fprintln(table, "out_of_sample\tinitial_value\tfinal_value\treturn_%\tapr_%\tmax_drawdown_%")
+	fmt.Fprintf(table, "stitched\t%s\t%s\t%s\t%s\t%s\n", metrics.InitialValue.Round(4), metrics.FinalValue.Round(4),
+		metrics.Return.Mul(hundo).Round(2), metrics.APR.Round(2), metrics.MaxDrawdown.Mul(hundo).Round(2))
+	return table.Flush()
+}
@@ -0,0 +1,58 @@
+package backtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestSplitWalkForwardWindowsDoNotOverlap(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	windows, err := SplitWalkForward(Window{Start: start, End: start.AddDate(0, 0, 40)}, WalkForwardConfig{InSample: 20, OutOfSample: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 2 {
+		t.Fatalf("got %d windows, want 2", len(windows))
+	}
+
+	for i, window := range windows {
+		if !window.InSample.End.Before(window.OutOfSample.Start) {
+			t.Errorf("window %d optimizes on %s and evaluates on %s", i, window.InSample, window.OutOfSample)
+		}
+		if want := window.InSample.Start.AddDate(0, 0, 19); !window.InSample.End.Equal(want) {
+			t.Errorf("window %d optimizes on %s, want 20 days", i, window.InSample)
+		}
+		if i > 0 && !windows[i-1].OutOfSample.End.Equal(window.OutOfSample.Start) {
+			t.Errorf("out-of-sample windows %s and %s do not chain", windows[i-1].OutOfSample, window.OutOfSample)
+		}
+	}
+}
+
+func TestStitchEquityRejectsGaps(t *testing.T) {
+	day := func(i int) time.Time {
+		return time.Date(2024, 1, 1+i, 0, 0, 0, 0, time.UTC)
+	}
+	point := func(i int, value int64) EquityPoint {
+		return EquityPoint{Time: day(i), Value: decimal.NewFromInt(value)}
+	}
+
+	stitched, err := StitchEquity([]EquityCurve{
+		{point(0, 100), point(1, 110)},
+		{point(1, 50), point(2, 60)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stitched) != 3 || !stitched[2].Value.Equal(decimal.NewFromInt(132)) {
+		t.Fatalf("stitched %v, want the second curve scaled to end at 132", stitched)
+	}
+
+	if _, err := StitchEquity([]EquityCurve{
+		{point(0, 100), point(1, 110)},
+		{point(2, 50), point(3, 60)},
+	}); err == nil {
+		t.Fatal("curves with a gap were stitched")
+	}
+}
@@ -1,30 +1,35 @@
 package helpers
 
 import (
+	"strings"
+
 	"github.com/mcwarner5/BlockBot8000/environment"
 	"github.com/mcwarner5/BlockBot8000/exchanges"
-	"github.com/mcwarner5/BlockBot8000/intervalstrategies"
+	_ "github.com/mcwarner5/BlockBot8000/intervalstrategies" // registers the built-in strategies.
 	"github.com/mcwarner5/BlockBot8000/strategies"
+	"github.com/sirupsen/logrus"
 )
 
 // InitExchange initialize a new ExchangeWrapper binded to the specified exchange provided.
 func InitExchange(exchangeConfig environment.ExchangeConfig, simulatedConfigs environment.SimulationConfig, depositAddresses map[string]string) exchanges.ExchangeWrapper {
+	return InitDecoratedExchange(exchangeConfig, simulatedConfigs, depositAddresses, nil)
+}
+
+// InitDecoratedExchange initializes an exchange like InitExchange, letting decorate wrap or replace the exchange wrapper before any simulation is applied.
+func InitDecoratedExchange(exchangeConfig environment.ExchangeConfig, simulatedConfigs environment.SimulationConfig, depositAddresses map[string]string, decorate func(exchanges.ExchangeWrapper) exchanges.ExchangeWrapper) exchanges.ExchangeWrapper {
 	if depositAddresses == nil && !simulatedConfigs.SimModeOn {
 		return nil
 	}
 
-	var exch exchanges.ExchangeWrapper
-	switch exchangeConfig.ExchangeName {
-	case "kucoin":
-		exch = exchanges.NewKucoinWrapper(exchangeConfig.PublicKey, exchangeConfig.SecretKey, depositAddresses)
-	case "kraken":
-		exch = exchanges.NewKrakenWrapper(exchangeConfig.PublicKey, exchangeConfig.SecretKey, depositAddresses)
-	case "coinbase":
-		exch = exchanges.NewCoinbaseWrapper(exchangeConfig.PublicKey, exchangeConfig.SecretKey, depositAddresses)
-	default:
+	exch := NewExchange(exchangeConfig, depositAddresses)
+	if exch == nil {
 		return nil
 	}
 
+	if decorate != nil {
+		exch = decorate(exch)
+	}
+
 	if simulatedConfigs.SimModeOn {
 		if simulatedConfigs.SimFakeBalances == nil {
 			return nil
@@ -35,13 +40,50 @@ func InitExchange(exchangeConfig environment.ExchangeConfig, simulatedConfigs en
 	return exch
 }
 
-func InitStrategy(rawStrategy environment.StrategyConfig) strategies.Strategy {
-	switch rawStrategy.Strategy {
-	case "PullMarketData":
-		return intervalstrategies.NewPullMarketData(rawStrategy)
-	case "RebalancerStrategy":
-		return intervalstrategies.NewRebalancerStrategy(rawStrategy)
+// NewExchange creates the wrapper of the exchange specified by the configuration, without any simulation.
+func NewExchange(exchangeConfig environment.ExchangeConfig, depositAddresses map[string]string) exchanges.ExchangeWrapper {
+	switch exchangeConfig.ExchangeName {
+	case "kucoin":
+		return exchanges.NewKucoinWrapper(exchangeConfig.PublicKey, exchangeConfig.SecretKey, depositAddresses)
+	case "kraken":
+		return exchanges.NewKrakenWrapper(exchangeConfig.PublicKey, exchangeConfig.SecretKey, depositAddresses, exchangeConfig.WithdrawKeys)
+	case "coinbase":
+		return exchanges.NewCoinbaseWrapper(exchangeConfig.PublicKey, exchangeConfig.SecretKey, depositAddresses, exchangeConfig.WithdrawFees)
+	case "file":
+		return exchanges.NewFileDataWrapper(exchangeConfig.DataDir, exchangeConfig.TradingFee, depositAddresses)
+	case "synthetic":
+		return exchanges.NewSyntheticWrapper(exchangeConfig.Synthetic, depositAddresses)
 	default:
 		return nil
 	}
 }
+
+// InitMarkets creates the markets a strategy is bound to, with their names on each exchange.
+func InitMarkets(strategyConfig environment.StrategyConfig) []*environment.Market {
+	mkts := make([]*environment.Market, len(strategyConfig.Markets))
+	for i, mkt := range strategyConfig.Markets {
+		currencies := strings.SplitN(mkt.Name, "-", 2)
+		mkts[i] = &environment.Market{
+			Name:           mkt.Name,
+			BaseCurrency:   currencies[0],
+			MarketCurrency: currencies[1],
+		}
+
+		mkts[i].ExchangeNames = make(map[string]string, len(mkt.Exchanges))
+		for _, exName := range mkt.Exchanges {
+			mkts[i].ExchangeNames[exName.Name] = exName.MarketName
+		}
+	}
+	return mkts
+}
+
+// InitStrategy creates the strategy of the configuration from the strategy types registered in the strategies package,
+// nil if its type is unknown or its spec is invalid.
+func InitStrategy(rawStrategy environment.StrategyConfig) strategies.Strategy {
+	strategy, err := strategies.New(rawStrategy)
+	if err != nil {
+		logrus.Errorf("Cannot create strategy %s: %s", rawStrategy.Strategy, err)
+		return nil
+	}
+	return strategy
+}
@@ -0,0 +1,237 @@
+package bot
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/backtest"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var backtestCmd = &cobra.Command{
+	Use:   "backtest",
+	Short: "Simulates the configured strategies over the simulation dates",
+	Long: `Simulates the configured strategies over the simulation dates, once per combination of the swept spec parameters.
+	Runs are ranked by the chosen metric and written to a results table.`,
+	Example: `  backtest --sweep allowance_threshold=0.1:0.5:0.05 --sweep min_trade_size=0.005,0.0075,0.01 --rank-by apr
+  backtest --sweep allowance_threshold=0.1:0.5:0.05 --in-sample 90 --out-of-sample 30
+  backtest --paths 500 --block-size 24 --seed 42
+  backtest --html-report report.html --json-report report.json
+  backtest --checkpoint backtest.ckpt --checkpoint-every 24
+  backtest --resume backtest.ckpt`,
+	Run: executeBacktestCommand,
+}
+
+func init() {
+	RootCmd.AddCommand(backtestCmd)
+	backtestCmd.Flags().StringArrayVar(&backtestFlags.Sweeps, "sweep", nil, "sweeps a spec parameter: name=start:end:step or name=value1,value2 (nested keys joined by dots)")
+	backtestCmd.Flags().IntVar(&backtestFlags.Workers, "workers", 0, "number of runs simulated at once (default: number of CPUs)")
+	backtestCmd.Flags().StringVar(&backtestFlags.RankBy, "rank-by", "final_value", "metric ranking the runs: final_value, apr or max_drawdown")
+	backtestCmd.Flags().StringVar(&backtestFlags.NeutralCoin, "neutral-coin", "", "coin the APR is measured in (default: nuetral_coin of the strategy spec)")
+	backtestCmd.Flags().StringVar(&backtestFlags.Output, "output", "backtest_results.csv", "CSV file the results table is written to")
+	backtestCmd.Flags().IntVar(&backtestFlags.InSample, "in-sample", 0, "walk-forward: days of the windows the parameters are optimized on")
+	backtestCmd.Flags().IntVar(&backtestFlags.OutOfSample, "out-of-sample", 0, "walk-forward: days of the windows the optimized parameters are evaluated on")
+	backtestCmd.Flags().IntVar(&backtestFlags.Paths, "paths", 0, "Monte Carlo: number of synthetic price paths the best parameters are simulated on")
+	backtestCmd.Flags().IntVar(&backtestFlags.BlockSize, "block-size", 0, "Monte Carlo: number of consecutive candles drawn at once (default: a day of candles)")
+	backtestCmd.Flags().Int64Var(&backtestFlags.Seed, "seed", 1, "Monte Carlo: seed of the synthetic price paths")
+	backtestCmd.Flags().StringVar(&backtestFlags.Checkpoint, "checkpoint", "", "file the state of a single run is periodically saved to (default: the --resume file)")
+	backtestCmd.Flags().IntVar(&backtestFlags.CheckpointEvery, "checkpoint-every", 24, "hours of simulated time between two checkpoints")
+	backtestCmd.Flags().StringVar(&backtestFlags.Resume, "resume", "", "checkpoint file a single run resumes from")
+	backtestCmd.Flags().StringSliceVar(&backtestFlags.Benchmarks, "benchmarks", []string{"buy_and_hold", "equal_weight", "static_coin", "btc"}, "portfolios simulated alongside the strategies: buy_and_hold, equal_weight, static_coin, btc or none")
+	backtestCmd.Flags().StringVar(&backtestFlags.JSONReport, "json-report", "", "JSON file the report of the best run is written to: metrics, equity, holdings, benchmarks and trades")
+	backtestCmd.Flags().StringVar(&backtestFlags.HTMLReport, "html-report", "", "HTML file the report of the best run is written to, with equity, drawdown and allocation charts")
+}
+
+func executeBacktestCommand(cmd *cobra.Command, args []string) {
+	logrus.Info("Getting configurations ... ")
+	if err := initConfigs(); err != nil {
+		logrus.Info("Cannot read from configuration file, please create or replace the current one using gobot init")
+		return
+	}
+
+	config := backtest.Config{
+		Bot:         botConfig,
+		Workers:     backtestFlags.Workers,
+		NeutralCoin: backtestFlags.NeutralCoin,
+	}
+	var err error
+	config.RankBy, err = backtest.ParseRankMetric(backtestFlags.RankBy)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	for _, name := range backtestFlags.Benchmarks {
+		if name == "none" {
+			continue
+		}
+		benchmark, err := backtest.ParseBenchmark(name)
+		if err != nil {
+			logrus.Error(err)
+			return
+		}
+		config.Benchmarks = append(config.Benchmarks, benchmark)
+	}
+	for _, sweep := range backtestFlags.Sweeps {
+		param, err := backtest.ParseSweep(sweep)
+		if err != nil {
+			logrus.Error(err)
+			return
+		}
+		config.Sweeps = append(config.Sweeps, param)
+	}
+
+	runner, err := backtest.NewRunner(config)
+	if err != nil {
+		logrus.Error("Cannot start backtest: ", err)
+		return
+	}
+	defer runner.Close()
+
+	if GlobalFlags.Verbose == 0 {
+		level := logrus.GetLevel()
+		logrus.SetLevel(logrus.WarnLevel)
+		defer logrus.SetLevel(level)
+	}
+
+	if backtestFlags.InSample > 0 || backtestFlags.OutOfSample > 0 {
+		executeWalkForward(runner)
+		return
+	}
+	if backtestFlags.Paths > 0 {
+		executeMonteCarlo(runner, config)
+		return
+	}
+	if backtestFlags.Checkpoint != "" || backtestFlags.Resume != "" {
+		if len(config.Sweeps) > 0 {
+			logrus.Error("Cannot checkpoint a sweep, checkpoints save a single run")
+			return
+		}
+		writeResults(runner, []backtest.Result{executeCheckpointedRun(runner)})
+		return
+	}
+
+	logrus.Warnf("Running %d backtests ... ", len(backtest.Grid(config.Sweeps)))
+	writeResults(runner, runner.Run())
+}
+
+// writeResults prints the results table, with the benchmarks of the best run, and writes it to the output CSV file
+// along with the reports of the best run.
+func writeResults(runner *backtest.Runner, results []backtest.Result) {
+	if err := backtest.WriteTable(os.Stdout, results); err != nil {
+		logrus.Error(err)
+	}
+	if len(results) > 0 && results[0].Err == nil && len(results[0].Benchmarks) > 0 {
+		fmt.Println()
+		if err := backtest.WriteBenchmarks(os.Stdout, results[0]); err != nil {
+			logrus.Error(err)
+		}
+	}
+
+	if len(results) > 0 && results[0].Err == nil {
+		report := runner.Report(results[0])
+		if backtestFlags.JSONReport != "" {
+			writeReport(backtestFlags.JSONReport, report, backtest.WriteReportJSON)
+		}
+		if backtestFlags.HTMLReport != "" {
+			writeReport(backtestFlags.HTMLReport, report, backtest.WriteReportHTML)
+		}
+	}
+
+	file, err := os.Create(backtestFlags.Output)
+	if err != nil {
+		logrus.Error("Cannot write results table: ", err)
+		return
+	}
+	defer file.Close()
+	if err := backtest.WriteCSV(file, results); err != nil {
+		logrus.Error("Cannot write results table: ", err)
+	}
+}
+
+// writeReport writes the report to the file in the format of the writer.
+func writeReport(path string, report *backtest.Report, write func(io.Writer, *backtest.Report) error) {
+	file, err := os.Create(path)
+	if err != nil {
+		logrus.Error("Cannot write report: ", err)
+		return
+	}
+	defer file.Close()
+	if err := write(file, report); err != nil {
+		logrus.Error("Cannot write report: ", err)
+		return
+	}
+	logrus.Warn("Report written to ", path)
+}
+
+// executeCheckpointedRun runs the configuration, or resumes the checkpointed run, saving checkpoints along the way.
+func executeCheckpointedRun(runner *backtest.Runner) backtest.Result {
+	checkpoints := backtest.CheckpointConfig{
+		Path:  backtestFlags.Checkpoint,
+		Every: time.Duration(backtestFlags.CheckpointEvery) * time.Hour,
+	}
+	if checkpoints.Path == "" {
+		checkpoints.Path = backtestFlags.Resume
+	}
+
+	var from *backtest.Checkpoint
+	if backtestFlags.Resume != "" {
+		var err error
+		if from, err = backtest.LoadCheckpoint(backtestFlags.Resume); err != nil {
+			return backtest.Result{Err: fmt.Errorf("cannot read checkpoint: %w", err)}
+		}
+		logrus.Warnf("Resuming backtest from %s ... ", from.Simulation.Time.Format(time.DateTime))
+	} else {
+		logrus.Warn("Running backtest ... ")
+	}
+	return runner.RunCheckpointed(nil, checkpoints, from)
+}
+
+// executeWalkForward runs a walk-forward optimization and prints its report.
+func executeWalkForward(runner *backtest.Runner) {
+	logrus.Warn("Running walk-forward optimization ... ")
+	result, err := runner.WalkForward(backtest.WalkForwardConfig{
+		InSample:    backtestFlags.InSample,
+		OutOfSample: backtestFlags.OutOfSample,
+	})
+	if err != nil {
+		logrus.Error("Cannot run walk-forward optimization: ", err)
+		return
+	}
+
+	if err := backtest.WriteWalkForward(os.Stdout, result); err != nil {
+		logrus.Error(err)
+	}
+}
+
+// executeMonteCarlo simulates the best parameters of the sweep, if any, on synthetic price paths and prints the
+// distributions of their metrics.
+func executeMonteCarlo(runner *backtest.Runner, config backtest.Config) {
+	var params backtest.ParamSet
+	if len(config.Sweeps) > 0 {
+		logrus.Warnf("Running %d backtests ... ", len(backtest.Grid(config.Sweeps)))
+		best := runner.Run()[0]
+		if best.Err != nil {
+			logrus.Error("Cannot run Monte Carlo analysis, no successful backtest: ", best.Err)
+			return
+		}
+		params = best.Params
+	}
+
+	logrus.Warnf("Running %d synthetic paths ... ", backtestFlags.Paths)
+	result, err := runner.MonteCarlo(params, backtest.MonteCarloConfig{
+		Paths:     backtestFlags.Paths,
+		BlockSize: backtestFlags.BlockSize,
+		Seed:      backtestFlags.Seed,
+	})
+	if err != nil {
+		logrus.Error("Cannot run Monte Carlo analysis: ", err)
+		return
+	}
+
+	if err := backtest.WriteMonteCarlo(os.Stdout, result); err != nil {
+		logrus.Error(err)
+	}
+}
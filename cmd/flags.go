@@ -29,6 +29,7 @@ var rootFlags struct {
 // initFlags provdes flag definition for init command.
 var initFlags struct {
 	ConfigFile string
+	Template   string
 	Exchange   string
 	Strategies []struct {
 		Market   string
@@ -39,4 +40,36 @@ var initFlags struct {
 // startFlags provdes flag definition for start command.
 var startFlags struct {
 	Simulate bool
+	Record   string
+	Replay   string
+	DryRun   bool
+	Journal  string
+}
+
+// transferFlags provides flag definition for transfer command.
+var transferFlags struct {
+	Coin   string
+	Amount string
+	From   string
+	To     string
+	Wait   bool
+}
+
+var backtestFlags struct {
+	Sweeps          []string
+	Workers         int
+	RankBy          string
+	NeutralCoin     string
+	Output          string
+	InSample        int
+	OutOfSample     int
+	Paths           int
+	BlockSize       int
+	Seed            int64
+	Checkpoint      string
+	CheckpointEvery int
+	Resume          string
+	Benchmarks      []string
+	JSONReport      string
+	HTMLReport      string
 }
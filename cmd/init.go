@@ -18,12 +18,16 @@ package bot
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/mitchellh/mapstructure"
 	viper "github.com/spf13/viper"
 	yaml "gopkg.in/yaml.v2"
 
 	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/mcwarner5/BlockBot8000/strategies"
 	"github.com/spf13/cobra"
 )
 
@@ -39,12 +43,82 @@ var initCmd = &cobra.Command{
 func init() {
 	RootCmd.AddCommand(initCmd)
 	initCmd.Flags().StringVar(&initFlags.ConfigFile, "import", "", "imports configuration from a file.")
+	initCmd.Flags().StringVar(&initFlags.Template, "template", "", "prints a strategies entry of the specified strategy type, with an example spec.")
 }
 
 func executeInitCommand(cmd *cobra.Command, args []string) {
+	if initFlags.Template != "" {
+		template, err := strategyTemplate(initFlags.Template)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Print(template)
+		return
+	}
 	initConfig()
 }
 
+// strategyTemplate returns a strategies entry of the config file for the strategy type, its spec holding the example
+// value of every field of the spec schema of the type, commented with its description.
+func strategyTemplate(typeName string) (string, error) {
+	schema, err := strategies.SchemaOf(typeName)
+	if err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+	builder.WriteString("strategies:\n")
+	builder.WriteString("  - strategy: " + typeName + "\n")
+	builder.WriteString("    markets:\n")
+	builder.WriteString("      - market: eth-usdt\n")
+	builder.WriteString("        bindings:\n")
+	builder.WriteString("          - exchange: kraken\n")
+	builder.WriteString("            market_name: ETHUSDT\n")
+	builder.WriteString("    spec:\n")
+	for _, field := range schema {
+		requirement := "optional"
+		if field.Required {
+			requirement = "required"
+		}
+		comment := fmt.Sprintf("# %s, %s: %s", field.Kind, requirement, field.Description)
+
+		weights, isWeights := field.Example.(map[string]interface{})
+		if !isWeights {
+			builder.WriteString(fmt.Sprintf("      %s: %s %s\n", field.Name, templateValue(field.Example), comment))
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("      %s: %s\n", field.Name, comment))
+		coins := make([]string, 0, len(weights))
+		for coin := range weights {
+			coins = append(coins, coin)
+		}
+		sort.Strings(coins)
+		for _, coin := range coins {
+			builder.WriteString(fmt.Sprintf("        %s: %s\n", coin, templateValue(weights[coin])))
+		}
+	}
+	return builder.String(), nil
+}
+
+// templateValue formats a spec value as YAML, floats keeping a dot so that they are not read back as ints.
+func templateValue(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "''"
+	case float64:
+		ret := strconv.FormatFloat(typed, 'f', -1, 64)
+		if !strings.Contains(ret, ".") {
+			ret += ".0"
+		}
+		return ret
+	case string:
+		return strconv.Quote(typed)
+	default:
+		return fmt.Sprint(typed)
+	}
+}
+
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
 	if initFlags.ConfigFile != "" {
@@ -150,7 +224,7 @@ func generateInitFile() {
 		var tempStrategyAppliance environment.StrategyConfig
 
 		fmt.Println("Please Enter The Name of the strategy you want to use\n" +
-			"in this market (must be in the system)")
+			"in this market (must be one of " + strings.Join(strategies.RegisteredTypes(), ", ") + ")")
 		fmt.Scanln(&tempStrategyAppliance.Strategy)
 
 		for {
@@ -17,7 +17,6 @@ package bot
 
 import (
 	"reflect"
-	"strings"
 
 	helpers "github.com/mcwarner5/BlockBot8000/bot_helpers"
 	"github.com/mcwarner5/BlockBot8000/environment"
@@ -43,6 +42,10 @@ var botConfig environment.BotConfig
 func init() {
 	RootCmd.AddCommand(startCmd)
 	startCmd.Flags().BoolVarP(&startFlags.Simulate, "simulate", "s", false, "Simulates the trades instead of actually doing them")
+	startCmd.Flags().StringVar(&startFlags.Record, "record", "", "Records every exchange call to the specified cassette file")
+	startCmd.Flags().BoolVar(&startFlags.DryRun, "dry-run", false, "Uses live data and real balances but only journals the orders instead of placing them")
+	startCmd.Flags().StringVar(&startFlags.Journal, "journal", "dry_run_journal.jsonl", "Journal file of the orders intended during a dry run")
+	startCmd.Flags().StringVar(&startFlags.Replay, "replay", "", "Replays the exchange calls of the specified cassette file instead of contacting the exchanges")
 }
 
 func DecimalHookFunction(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
@@ -99,38 +102,87 @@ func executeStartCommand(cmd *cobra.Command, args []string) {
 	}
 	logrus.Info("DONE")
 
+	if startFlags.Record != "" && startFlags.Replay != "" {
+		logrus.Error("Cannot record and replay at the same time")
+		return
+	}
+
+	if startFlags.DryRun && botConfig.SimulationConfigs.SimModeOn {
+		logrus.Error("Cannot dry run with simulation mode enabled")
+		return
+	}
+
 	logrus.Info("Getting exchange info ... ")
+	var journal *exchanges.DryRunJournal
+	var recorder *exchanges.CassetteRecorder
+	var cassette *exchanges.Cassette
+	var err error
+	if startFlags.Record != "" {
+		recorder, err = exchanges.NewCassetteRecorder(startFlags.Record)
+		if err != nil {
+			logrus.Error("Cannot create cassette: ", err)
+			return
+		}
+		defer recorder.Close()
+	}
+	if startFlags.DryRun {
+		journal, err = exchanges.NewDryRunJournal(startFlags.Journal)
+		if err != nil {
+			logrus.Error("Cannot open dry run journal: ", err)
+			return
+		}
+		defer journal.Close()
+	}
+	if startFlags.Replay != "" {
+		cassette, err = exchanges.LoadCassette(startFlags.Replay)
+		if err != nil {
+			logrus.Error("Cannot load cassette: ", err)
+			return
+		}
+	}
+
 	wrappers := make([]exchanges.ExchangeWrapper, len(botConfig.ExchangeConfigs))
+	var feedWrappers []exchanges.ExchangeWrapper
 	for i, config := range botConfig.ExchangeConfigs {
-		wrappers[i] = helpers.InitExchange(config, botConfig.SimulationConfigs, config.DepositAddresses)
+		wrappers[i] = helpers.InitDecoratedExchange(config, botConfig.SimulationConfigs, config.DepositAddresses, func(wrapper exchanges.ExchangeWrapper) exchanges.ExchangeWrapper {
+			switch {
+			case recorder != nil:
+				wrapper = exchanges.NewRecordingWrapper(wrapper, recorder)
+			case cassette != nil:
+				wrapper = exchanges.NewReplayWrapper(config.ExchangeName, cassette, config.DepositAddresses)
+			}
+			if journal != nil {
+				wrapper = exchanges.NewDryRunWrapper(wrapper, journal)
+			}
+			return wrapper
+		})
+		if config.Websocket && !botConfig.SimulationConfigs.SimModeOn && cassette == nil {
+			feedWrappers = append(feedWrappers, wrappers[i])
+		}
 	}
 	logrus.Info("DONE")
 
 	logrus.Info("Getting markets cold info ... ")
 	for _, strategyConf := range botConfig.Strategies {
-		mkts := make([]*environment.Market, len(strategyConf.Markets))
-		for i, mkt := range strategyConf.Markets {
-			currencies := strings.SplitN(mkt.Name, "-", 2)
-			mkts[i] = &environment.Market{
-				Name:           mkt.Name,
-				BaseCurrency:   currencies[0],
-				MarketCurrency: currencies[1],
-			}
-
-			mkts[i].ExchangeNames = make(map[string]string, len(wrappers))
-
-			for _, exName := range mkt.Exchanges {
-				mkts[i].ExchangeNames[exName.Name] = exName.MarketName
-			}
+		strategy := helpers.InitStrategy(strategyConf)
+		if strategy == nil {
+			logrus.Error("Cannot add tactic, run gobot validate to check the strategies of the config file")
+			continue
 		}
-
-		err := strategies.MatchWithMarkets(strategies.AddCustomStrategy(helpers.InitStrategy(strategyConf)), mkts)
+		mkts := helpers.InitMarkets(strategyConf)
+		err := strategies.MatchWithMarkets(strategies.AddCustomStrategy(strategy), mkts)
 		if err != nil {
 			logrus.Info("Cannot add tactic : ", err)
 		}
 	}
 	logrus.Info("DONE")
 
+	if len(feedWrappers) > 0 {
+		logrus.Info("Connecting feeds ... ")
+		strategies.ConnectFeeds(feedWrappers)
+		logrus.Info("DONE")
+	}
+
 	logrus.Info("Starting bot ... ")
 	executeBotLoop(wrappers)
 	logrus.Info("EXIT, good bye :)")
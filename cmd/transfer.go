@@ -0,0 +1,81 @@
+package bot
+
+import (
+	helpers "github.com/mcwarner5/BlockBot8000/bot_helpers"
+	"github.com/mcwarner5/BlockBot8000/exchanges"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// defaultTransferJournal is the file live transfers are recorded in if the configuration sets none.
+const defaultTransferJournal = "./.bot_transfers.json"
+
+// transferCmd represents the transfer command
+var transferCmd = &cobra.Command{
+	Use:   "transfer",
+	Short: "Transfers a coin between two configured exchanges",
+	Long: `Withdraws a coin from an exchange to the deposit address of another configured exchange.
+	The address must be in the transfer allowlist and the amount must fit the daily limit of the coin.`,
+	Run: executeTransferCommand,
+}
+
+func init() {
+	RootCmd.AddCommand(transferCmd)
+	transferCmd.Flags().StringVar(&transferFlags.Coin, "coin", "", "coin to transfer")
+	transferCmd.Flags().StringVar(&transferFlags.Amount, "amount", "", "amount to withdraw from the source exchange, fees included")
+	transferCmd.Flags().StringVar(&transferFlags.From, "from", "", "name of the source exchange")
+	transferCmd.Flags().StringVar(&transferFlags.To, "to", "", "name of the destination exchange")
+	transferCmd.Flags().BoolVarP(&transferFlags.Wait, "wait", "w", false, "waits until the transfer completes")
+	transferCmd.MarkFlagRequired("coin")
+	transferCmd.MarkFlagRequired("amount")
+	transferCmd.MarkFlagRequired("from")
+	transferCmd.MarkFlagRequired("to")
+}
+
+func executeTransferCommand(cmd *cobra.Command, args []string) {
+	logrus.Info("Getting configurations ... ")
+	if err := initConfigs(); err != nil {
+		logrus.Info("Cannot read from configuration file, please create or replace the current one using gobot init")
+		return
+	}
+
+	amount, err := decimal.NewFromString(transferFlags.Amount)
+	if err != nil {
+		logrus.Error("Invalid transfer amount: ", err)
+		return
+	}
+
+	wrappers := make(map[string]exchanges.ExchangeWrapper, len(botConfig.ExchangeConfigs))
+	for _, config := range botConfig.ExchangeConfigs {
+		wrapper := helpers.InitExchange(config, botConfig.SimulationConfigs, config.DepositAddresses)
+		if wrapper != nil {
+			wrappers[config.ExchangeName] = wrapper
+		}
+	}
+
+	// live transfers are journaled so that the daily limits count the ones of the previous invocations.
+	transferConfig := botConfig.TransferConfigs
+	if transferConfig.Journal == "" && !botConfig.SimulationConfigs.SimModeOn {
+		transferConfig.Journal = defaultTransferJournal
+	}
+
+	manager, err := exchanges.NewTransferManager(wrappers, transferConfig)
+	if err != nil {
+		logrus.Error("Cannot transfer: ", err)
+		return
+	}
+	transfer, err := manager.Transfer(transferFlags.Coin, amount, transferFlags.From, transferFlags.To)
+	if err != nil {
+		logrus.Error("Cannot transfer: ", err)
+		return
+	}
+
+	if transferFlags.Wait {
+		if err := manager.WaitForCompletion(transfer); err != nil {
+			logrus.Error(err)
+			return
+		}
+	}
+	logrus.Info(transfer.String())
+}
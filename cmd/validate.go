@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/mcwarner5/BlockBot8000/strategies"
+	"github.com/spf13/cobra"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Checks the strategies of the config file",
+	Long: `Checks every strategy of the config file without connecting to the exchanges: its type must be registered,
+	its spec must match the spec schema of the type and its markets must be bound to configured exchanges.`,
+	Run: executeValidateCommand,
+}
+
+func init() {
+	RootCmd.AddCommand(validateCmd)
+}
+
+func executeValidateCommand(cmd *cobra.Command, args []string) {
+	if err := initConfigs(); err != nil {
+		fmt.Println("Cannot read from configuration file:", err)
+		os.Exit(1)
+	}
+
+	problems := validateStrategies(botConfig)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+	fmt.Printf("%d strategies are valid\n", len(botConfig.Strategies))
+}
+
+// validateStrategies returns the problems of the strategies of the configuration, none if they are all valid.
+func validateStrategies(config environment.BotConfig) []string {
+	exchangeNames := make(map[string]bool, len(config.ExchangeConfigs))
+	for _, exchange := range config.ExchangeConfigs {
+		exchangeNames[exchange.ExchangeName] = true
+	}
+	if config.SimulationConfigs.SimModeOn {
+		// simulated wrappers are named simulator, whatever the exchange they wrap.
+		exchangeNames["simulator"] = true
+	}
+
+	var ret []string
+	names := make(map[string]int)
+	for i, strategy := range config.Strategies {
+		prefix := fmt.Sprintf("strategies[%d] (%s): ", i, strategy.Strategy)
+		if err := strategies.Validate(strategy); err != nil {
+			for _, line := range strings.Split(err.Error(), "\n") {
+				ret = append(ret, prefix+line)
+			}
+		}
+
+		if name, ok := strategy.Spec["name"].(string); ok {
+			if first, exists := names[name]; exists {
+				ret = append(ret, fmt.Sprintf("%sname %s is already used by strategies[%d]", prefix, name, first))
+			} else {
+				names[name] = i
+			}
+		}
+
+		if len(strategy.Markets) == 0 {
+			ret = append(ret, prefix+"no markets")
+		}
+		for _, market := range strategy.Markets {
+			if !strings.Contains(market.Name, "-") {
+				ret = append(ret, fmt.Sprintf("%smarket %q is not named base-quote (e.g. eth-usdt)", prefix, market.Name))
+			}
+			for _, binding := range market.Exchanges {
+				if !exchangeNames[binding.Name] {
+					ret = append(ret, fmt.Sprintf("%smarket %s is bound to exchange %s, which is not configured", prefix, market.Name, binding.Name))
+				}
+			}
+		}
+	}
+	return ret
+}
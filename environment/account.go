@@ -0,0 +1,60 @@
+package environment
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// AssetBalance represents the balance of a single coin in an account.
+type AssetBalance struct {
+	Total     decimal.Decimal `json:"total"`     // Total amount of the coin owned.
+	Available decimal.Decimal `json:"available"` // Amount of the coin which can be traded or withdrawn.
+	Hold      decimal.Decimal `json:"hold"`      // Amount of the coin locked by open orders or pending withdrawals.
+}
+
+// AccountSnapshot represents all the balances and open orders of an account, taken at once.
+type AccountSnapshot struct {
+	Time       time.Time               `json:"time"`        // Time the snapshot was taken.
+	Balances   map[string]AssetBalance `json:"balances"`    // Balances by lowercase coin ticker.
+	OpenOrders []Trade                 `json:"open_orders"` // Orders not yet completed nor canceled.
+}
+
+// NewAccountSnapshot creates an empty AccountSnapshot taken at the specified time.
+func NewAccountSnapshot(time time.Time) *AccountSnapshot {
+	return &AccountSnapshot{
+		Time:       time,
+		Balances:   make(map[string]AssetBalance),
+		OpenOrders: make([]Trade, 0),
+	}
+}
+
+// SetBalance sets the balance of a coin, the coin ticker is case insensitive.
+func (snapshot *AccountSnapshot) SetBalance(coin string, balance AssetBalance) {
+	snapshot.Balances[strings.ToLower(coin)] = balance
+}
+
+// Balance gets the balance of a coin, which is zero if the account does not hold it.
+func (snapshot AccountSnapshot) Balance(coin string) AssetBalance {
+	return snapshot.Balances[strings.ToLower(coin)]
+}
+
+// String returns the string representation of the object.
+func (snapshot AccountSnapshot) String() string {
+	coins := make([]string, 0, len(snapshot.Balances))
+	for coin := range snapshot.Balances {
+		coins = append(coins, coin)
+	}
+	sort.Strings(coins)
+
+	ret := fmt.Sprintln("Account Snapshot at", snapshot.Time)
+	for _, coin := range coins {
+		balance := snapshot.Balances[coin]
+		ret += fmt.Sprintf(" %s\ttotal: %s\tavailable: %s\thold: %s\n", coin, balance.Total, balance.Available, balance.Hold)
+	}
+	ret += fmt.Sprintln("Open orders:", len(snapshot.OpenOrders))
+	return ret
+}
@@ -0,0 +1,105 @@
+package environment
+
+import (
+	"sort"
+	"time"
+)
+
+// CandleSeries represents candles sorted by time, at most one per time.
+//
+//	NOTE: a CandleSeries is not thread safe.
+type CandleSeries struct {
+	candles []CandleStick
+}
+
+// NewCandleSeries creates a new CandleSeries from unsorted candles.
+func NewCandleSeries(candles ...CandleStick) *CandleSeries {
+	series := &CandleSeries{candles: make([]CandleStick, 0, len(candles))}
+	series.Insert(candles...)
+	return series
+}
+
+// Len returns the number of candles in the series.
+func (series *CandleSeries) Len() int {
+	return len(series.candles)
+}
+
+// Insert merges candles into the series, replacing the ones with the same time.
+func (series *CandleSeries) Insert(candles ...CandleStick) {
+	for _, candle := range candles {
+		last := len(series.candles) - 1
+		if last < 0 || candle.CandleTime.After(series.candles[last].CandleTime) {
+			series.candles = append(series.candles, candle)
+			continue
+		}
+
+		i := series.search(candle.CandleTime)
+		if series.candles[i].CandleTime.Equal(candle.CandleTime) {
+			series.candles[i] = candle
+			continue
+		}
+		series.candles = append(series.candles, CandleStick{})
+		copy(series.candles[i+1:], series.candles[i:])
+		series.candles[i] = candle
+	}
+}
+
+// At gets the candle starting at the specified time.
+func (series *CandleSeries) At(time time.Time) (CandleStick, bool) {
+	i := series.search(time)
+	if i == len(series.candles) || !series.candles[i].CandleTime.Equal(time) {
+		return CandleStick{}, false
+	}
+	return series.candles[i], true
+}
+
+// Range gets a copy of the candles starting in [start, end).
+func (series *CandleSeries) Range(start time.Time, end time.Time) []CandleStick {
+	from, to := series.search(start), series.search(end)
+	if from >= to {
+		return []CandleStick{}
+	}
+	ret := make([]CandleStick, to-from)
+	copy(ret, series.candles[from:to])
+	return ret
+}
+
+// First gets the oldest candle of the series.
+func (series *CandleSeries) First() (CandleStick, bool) {
+	if len(series.candles) == 0 {
+		return CandleStick{}, false
+	}
+	return series.candles[0], true
+}
+
+// Last gets the newest candle of the series.
+func (series *CandleSeries) Last() (CandleStick, bool) {
+	if len(series.candles) == 0 {
+		return CandleStick{}, false
+	}
+	return series.candles[len(series.candles)-1], true
+}
+
+// Candles gets a copy of all the candles of the series.
+func (series *CandleSeries) Candles() []CandleStick {
+	ret := make([]CandleStick, len(series.candles))
+	copy(ret, series.candles)
+	return ret
+}
+
+// Truncate drops the oldest candles so that at most size are kept.
+func (series *CandleSeries) Truncate(size int) {
+	if len(series.candles) <= size {
+		return
+	}
+	kept := make([]CandleStick, size)
+	copy(kept, series.candles[len(series.candles)-size:])
+	series.candles = kept
+}
+
+// search finds the index of the first candle starting at or after the specified time.
+func (series *CandleSeries) search(time time.Time) int {
+	return sort.Search(len(series.candles), func(i int) bool {
+		return !series.candles[i].CandleTime.Before(time)
+	})
+}
@@ -0,0 +1,185 @@
+package environment
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// CashFlow represents coins deposited to an account from outside of the portfolio, or withdrawn out of it.
+type CashFlow struct {
+	Time   time.Time       `json:"time"`
+	Coin   string          `json:"coin"`
+	Amount decimal.Decimal `json:"amount"` // Amount deposited, withdrawn if negative.
+}
+
+// NewCashFlowSchedule lists the cash flows of the configurations happening after start and until end, in time order.
+func NewCashFlowSchedule(configs []CashFlowConfig, start time.Time, end time.Time) ([]CashFlow, error) {
+	var ret []CashFlow
+	for _, config := range configs {
+		if config.Coin == "" || config.Amount.IsZero() {
+			return nil, errors.New("cash flows need a coin and a non zero amount")
+		}
+		if (config.Date == "") == (config.Cron == "") {
+			return nil, fmt.Errorf("cash flow of %s %s needs either a date or a cron schedule", config.Amount, config.Coin)
+		}
+
+		if config.Date != "" {
+			date, err := time.Parse(time.DateOnly, config.Date)
+			if err != nil {
+				if date, err = time.Parse(time.RFC3339, config.Date); err != nil {
+					return nil, fmt.Errorf("invalid date %s of cash flow", config.Date)
+				}
+			}
+			if date.After(start) && !date.After(end) {
+				ret = append(ret, CashFlow{Time: date, Coin: config.Coin, Amount: config.Amount})
+			}
+			continue
+		}
+
+		schedule, err := ParseCronSchedule(config.Cron)
+		if err != nil {
+			return nil, err
+		}
+		for date := schedule.Next(start); !date.IsZero() && !date.After(end); date = schedule.Next(date) {
+			ret = append(ret, CashFlow{Time: date, Coin: config.Coin, Amount: config.Amount})
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+	return ret, nil
+}
+
+// CronSchedule represents a cron expression: minute, hour, day of month, month and day of week, in UTC.
+type CronSchedule struct {
+	minutes  []bool
+	hours    []bool
+	days     []bool
+	months   []bool
+	weekdays []bool
+	anyDay   bool // the day of month is *, so only the day of week restricts the days.
+	anyWeek  bool // the day of week is *, so only the day of month restricts the days.
+}
+
+// cronSearchLimit is how far in the future the next time of a schedule is searched, so that impossible dates (e.g. the
+// 31st of February) end the schedule.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// ParseCronSchedule parses a cron expression of five fields, each a *, a value, a range or a list of them, with an
+// optional /step.
+func ParseCronSchedule(expression string) (*CronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, errors.New("cron expression " + expression + " does not have five fields")
+	}
+
+	var schedule CronSchedule
+	var err error
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if schedule.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if schedule.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	schedule.weekdays[0] = schedule.weekdays[0] || schedule.weekdays[7]
+	schedule.anyDay = fields[2] == "*"
+	schedule.anyWeek = fields[4] == "*"
+	return &schedule, nil
+}
+
+// parseCronField parses a field of a cron expression into the values it matches, indexed by value.
+func parseCronField(field string, min int, max int) ([]bool, error) {
+	ret := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if rangePart, stepPart, found := strings.Cut(part, "/"); found {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return nil, errors.New("invalid step in cron field " + field)
+			}
+			part = rangePart
+		}
+
+		low, high := min, max
+		if part != "*" {
+			lowPart, highPart, isRange := strings.Cut(part, "-")
+			var err error
+			if low, err = strconv.Atoi(lowPart); err != nil {
+				return nil, errors.New("invalid value in cron field " + field)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highPart); err != nil {
+					return nil, errors.New("invalid range in cron field " + field)
+				}
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("cron field %s is out of [%d, %d]", field, min, max)
+		}
+
+		for value := low; value <= high; value += step {
+			ret[value] = true
+		}
+	}
+	return ret, nil
+}
+
+// Next returns the first time of the schedule after the specified time, the zero time if there is none.
+func (schedule *CronSchedule) Next(after time.Time) time.Time {
+	next := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := next.Add(cronSearchLimit)
+
+	for next.Before(limit) {
+		if !schedule.months[next.Month()] {
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !schedule.matchesDay(next) {
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !schedule.hours[next.Hour()] {
+			next = next.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if !schedule.minutes[next.Minute()] {
+			next = next.Add(time.Minute)
+			continue
+		}
+		return next
+	}
+	return time.Time{}
+}
+
+// matchesDay returns whether the day of the time matches the schedule: when both the day of month and the day of week
+// are restricted, matching either is enough.
+func (schedule *CronSchedule) matchesDay(date time.Time) bool {
+	day, weekday := schedule.days[date.Day()], schedule.weekdays[date.Weekday()]
+	switch {
+	case schedule.anyDay && schedule.anyWeek:
+		return true
+	case schedule.anyDay:
+		return weekday
+	case schedule.anyWeek:
+		return day
+	default:
+		return day || weekday
+	}
+}
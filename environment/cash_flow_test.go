@@ -0,0 +1,65 @@
+package environment
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronScheduleErrors(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"0 0 1 *",
+		"0 0 1 * * *",
+		"60 0 1 * *",
+		"0 24 1 * *",
+		"0 0 0 * *",
+		"0 0 1 13 *",
+		"0 0 1 * 8",
+		"0 0 5-1 * *",
+		"0 0 a * *",
+		"0 0 1-b * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+	} {
+		if _, err := ParseCronSchedule(expression); err == nil {
+			t.Errorf("ParseCronSchedule(%q) returned no error", expression)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	at := func(month time.Month, day int, hour int, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		expression string
+		after      time.Time
+		want       time.Time
+	}{
+		{expression: "0 0 1 * *", after: at(1, 15, 12, 0), want: at(2, 1, 0, 0)},
+		{expression: "0 0 1 * *", after: at(2, 1, 0, 0), want: at(3, 1, 0, 0)},
+		{expression: "0 0 1 * *", after: at(12, 31, 23, 59), want: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{expression: "*/15 * * * *", after: at(1, 1, 10, 7), want: at(1, 1, 10, 15)},
+		{expression: "*/15 * * * *", after: at(1, 1, 10, 50), want: at(1, 1, 11, 0)},
+		{expression: "30 9-17/4 * * *", after: at(1, 1, 13, 31), want: at(1, 1, 17, 30)},
+		{expression: "0 9 * * 1", after: at(1, 3, 0, 0), want: at(1, 8, 9, 0)},                                // the 8th is the next monday.
+		{expression: "0 0 * * 7", after: at(1, 1, 0, 0), want: at(1, 7, 0, 0)},                                // 7 is sunday like 0.
+		{expression: "0 0 13 * 5", after: at(9, 1, 0, 0), want: at(9, 6, 0, 0)},                               // friday comes before the 13th.
+		{expression: "0 0 13 * 5", after: at(9, 9, 0, 0), want: at(9, 13, 0, 0)},                              // and the 13th before friday.
+		{expression: "0 0 29 2 *", after: at(3, 1, 0, 0), want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)}, // leap days only.
+		{expression: "0 0 31 2 *", after: at(1, 1, 0, 0), want: time.Time{}},                                  // never.
+		{expression: "0 12 1,15 1-3 *", after: at(1, 1, 12, 0), want: at(1, 15, 12, 0)},
+		{expression: "0 12 1,15 1-3 *", after: at(3, 15, 12, 0), want: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		schedule, err := ParseCronSchedule(test.expression)
+		if err != nil {
+			t.Errorf("ParseCronSchedule(%q) returned error %v", test.expression, err)
+			continue
+		}
+		if got := schedule.Next(test.after); !got.Equal(test.want) {
+			t.Errorf("%q after %s is %s, want %s", test.expression, test.after, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package environment
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock represents the source of time of the bot, which is simulated in backtests.
+type Clock interface {
+	Now() time.Time                         // Gets the current time.
+	Sleep(d time.Duration)                  // Waits for the specified duration.
+	After(d time.Duration) <-chan time.Time // Sends the time once the specified duration elapsed.
+}
+
+// RealClock is the wall clock.
+type RealClock struct{}
+
+// Now gets the current wall clock time.
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// Sleep blocks for the specified duration.
+func (RealClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// After waits for the specified duration in a goroutine, then sends the current time.
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SimulatedClock is a clock which only moves when set or advanced, as the simulator goes through the historical data.
+//
+//	NOTE: Sleep and After never wait, as the simulated time is advanced between the strategy updates.
+type SimulatedClock struct {
+	mutex *sync.Mutex
+	now   time.Time
+}
+
+// NewSimulatedClock creates a new SimulatedClock starting at the specified time.
+func NewSimulatedClock(start time.Time) *SimulatedClock {
+	return &SimulatedClock{
+		mutex: &sync.Mutex{},
+		now:   start,
+	}
+}
+
+// Now gets the current simulated time.
+func (clock *SimulatedClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return clock.now
+}
+
+// Set moves the simulated time to the specified time.
+func (clock *SimulatedClock) Set(now time.Time) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.now = now
+}
+
+// Advance moves the simulated time forward by the specified duration, returning the new time.
+func (clock *SimulatedClock) Advance(d time.Duration) time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.now = clock.now.Add(d)
+	return clock.now
+}
+
+// Sleep returns immediately.
+func (clock *SimulatedClock) Sleep(d time.Duration) {}
+
+// After sends at once the simulated time the duration would elapse at.
+func (clock *SimulatedClock) After(d time.Duration) <-chan time.Time {
+	ret := make(chan time.Time, 1)
+	ret <- clock.Now().Add(d)
+	return ret
+}
@@ -0,0 +1,42 @@
+package environment
+
+import "time"
+
+// EventKind represents what happened on an exchange for an Event.
+type EventKind int16
+
+const (
+	CandleCloseEvent EventKind = iota // A candle of a market closed.
+	TickerEvent                       // The ticker of a market changed.
+	OrderBookEvent                    // The order book of a market changed.
+	OrderUpdateEvent                  // An order of the account was filled or changed status.
+	TimerEvent                        // A timer of the strategy elapsed.
+)
+
+func (kind EventKind) String() string {
+	return [...]string{"candle_close", "ticker", "order_book", "order_update", "timer"}[kind]
+}
+
+func (kind EventKind) EnumIndex() int {
+	return int(kind)
+}
+
+// Event represents something happening on an exchange which strategies can react to, only the fields of its kind being set.
+type Event struct {
+	Kind      EventKind
+	Time      time.Time    // Time the event happened, on the clock of the exchange.
+	Exchange  string       // Name of the exchange of the event, empty for timers.
+	Market    *Market      // Market of the event, nil for timers.
+	Candle    *CandleStick // Closed candle, for CandleCloseEvent.
+	Ticker    *Ticker      // Updated ticker, for TickerEvent.
+	OrderBook *OrderBook   // Updated order book, for OrderBookEvent.
+	Order     *Trade       // Fill or status change of the order, for OrderUpdateEvent.
+}
+
+// EventKinds represents a set of event kinds, e.g. the ones a strategy handles.
+type EventKinds map[EventKind]bool
+
+// Has checks whether the set holds the kind.
+func (kinds EventKinds) Has(kind EventKind) bool {
+	return kinds[kind]
+}
@@ -16,7 +16,9 @@
 package environment
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -46,6 +48,173 @@ func (book OrderBook) String() string {
 		fmt.Sprintln(book.Bids)
 }
 
+// Sort orders the book levels from the best price: asks ascending and bids descending.
+func (book *OrderBook) Sort() {
+	sort.SliceStable(book.Asks, func(i, j int) bool {
+		return book.Asks[i].Value.LessThan(book.Asks[j].Value)
+	})
+	sort.SliceStable(book.Bids, func(i, j int) bool {
+		return book.Bids[i].Value.GreaterThan(book.Bids[j].Value)
+	})
+}
+
+// Validate checks that the book is sorted, has no empty levels and is not crossed.
+func (book OrderBook) Validate() error {
+	for i, ask := range book.Asks {
+		if !ask.Value.IsPositive() || !ask.Quantity.IsPositive() {
+			return fmt.Errorf("invalid ask level %d: price %s quantity %s", i, ask.Value, ask.Quantity)
+		}
+		if i > 0 && ask.Value.LessThan(book.Asks[i-1].Value) {
+			return errors.New("asks are not sorted by ascending price")
+		}
+	}
+	for i, bid := range book.Bids {
+		if !bid.Value.IsPositive() || !bid.Quantity.IsPositive() {
+			return fmt.Errorf("invalid bid level %d: price %s quantity %s", i, bid.Value, bid.Quantity)
+		}
+		if i > 0 && bid.Value.GreaterThan(book.Bids[i-1].Value) {
+			return errors.New("bids are not sorted by descending price")
+		}
+	}
+
+	bestAsk, hasAsk := book.BestAsk()
+	bestBid, hasBid := book.BestBid()
+	if hasAsk && hasBid && bestBid.Value.GreaterThanOrEqual(bestAsk.Value) {
+		return fmt.Errorf("crossed book: best bid %s >= best ask %s", bestBid.Value, bestAsk.Value)
+	}
+	return nil
+}
+
+// BestAsk returns the lowest ask of a sorted book, if any.
+func (book OrderBook) BestAsk() (Order, bool) {
+	if len(book.Asks) == 0 {
+		return Order{}, false
+	}
+	return book.Asks[0], true
+}
+
+// BestBid returns the highest bid of a sorted book, if any.
+func (book OrderBook) BestBid() (Order, bool) {
+	if len(book.Bids) == 0 {
+		return Order{}, false
+	}
+	return book.Bids[0], true
+}
+
+// MidPrice returns the price halfway between the best bid and the best ask.
+func (book OrderBook) MidPrice() (decimal.Decimal, bool) {
+	bestAsk, hasAsk := book.BestAsk()
+	bestBid, hasBid := book.BestBid()
+	if !hasAsk || !hasBid {
+		return decimal.Zero, false
+	}
+	return bestAsk.Value.Add(bestBid.Value).Div(decimal.NewFromInt(2)), true
+}
+
+// Spread returns the difference between the best ask and the best bid.
+func (book OrderBook) Spread() (decimal.Decimal, bool) {
+	bestAsk, hasAsk := book.BestAsk()
+	bestBid, hasBid := book.BestBid()
+	if !hasAsk || !hasBid {
+		return decimal.Zero, false
+	}
+	return bestAsk.Value.Sub(bestBid.Value), true
+}
+
+// SpreadBps returns the spread in basis points of the mid price.
+func (book OrderBook) SpreadBps() (decimal.Decimal, bool) {
+	spread, hasSpread := book.Spread()
+	mid, hasMid := book.MidPrice()
+	if !hasSpread || !hasMid || mid.IsZero() {
+		return decimal.Zero, false
+	}
+	return spread.Div(mid).Mul(decimal.NewFromInt(10000)), true
+}
+
+// DepthWithin returns the cumulative quantity of one side of a sorted book priced within bps basis points of the mid price.
+func (book OrderBook) DepthWithin(side OrderType, bps decimal.Decimal) decimal.Decimal {
+	mid, hasMid := book.MidPrice()
+	if !hasMid {
+		return decimal.Zero
+	}
+	offset := mid.Mul(bps).Div(decimal.NewFromInt(10000))
+
+	depth := decimal.Zero
+	if side == Ask {
+		for _, ask := range book.Asks {
+			if ask.Value.GreaterThan(mid.Add(offset)) {
+				break
+			}
+			depth = depth.Add(ask.Quantity)
+		}
+		return depth
+	}
+	for _, bid := range book.Bids {
+		if bid.Value.LessThan(mid.Sub(offset)) {
+			break
+		}
+		depth = depth.Add(bid.Quantity)
+	}
+	return depth
+}
+
+// BookFill represents the expected result of walking a sorted book with an order.
+type BookFill struct {
+	Quantity     decimal.Decimal // Quantity that can be filled.
+	Total        decimal.Decimal // Total value of the filled quantity.
+	AveragePrice decimal.Decimal // Volume weighted average price of the fill.
+	Levels       int             // Number of book levels touched.
+}
+
+// Complete returns true if the whole amount can be filled.
+func (fill BookFill) Complete(amount decimal.Decimal) bool {
+	return fill.Quantity.GreaterThanOrEqual(amount)
+}
+
+// Walk computes the expected fill of an order of the specified side and amount, buys take the asks and sells take the bids.
+//
+//	NOTE: a zero limit walks the book as a market order, otherwise levels priced worse than limit are not taken.
+func (book OrderBook) Walk(side TradeSide, amount decimal.Decimal, limit decimal.Decimal) BookFill {
+	levels := book.Bids
+	if side == Buy {
+		levels = book.Asks
+	}
+
+	fill := BookFill{
+		Quantity: decimal.Zero,
+		Total:    decimal.Zero,
+	}
+	remaining := amount
+	for _, level := range levels {
+		if !remaining.IsPositive() {
+			break
+		}
+		if !limit.IsZero() && ((side == Buy && level.Value.GreaterThan(limit)) || (side == Sell && level.Value.LessThan(limit))) {
+			break
+		}
+
+		quantity := decimal.Min(remaining, level.Quantity)
+		fill.Quantity = fill.Quantity.Add(quantity)
+		fill.Total = fill.Total.Add(quantity.Mul(level.Value))
+		fill.Levels++
+		remaining = remaining.Sub(quantity)
+	}
+
+	if fill.Quantity.IsPositive() {
+		fill.AveragePrice = fill.Total.Div(fill.Quantity)
+	}
+	return fill
+}
+
+// AverageFillPrice returns the expected average price of a market order of the specified side and amount.
+func (book OrderBook) AverageFillPrice(side TradeSide, amount decimal.Decimal) (decimal.Decimal, error) {
+	fill := book.Walk(side, amount, decimal.Zero)
+	if !fill.Complete(amount) {
+		return fill.AveragePrice, fmt.Errorf("not enough liquidity to %s %s: only %s available", side, amount, fill.Quantity)
+	}
+	return fill.AveragePrice, nil
+}
+
 //Order represents a single order in the Order Book for a market.
 type Order struct {
 	Value       decimal.Decimal //Value of the trade : e.g. in a BTC ETH is the value of a single ETH in BTC.
@@ -0,0 +1,82 @@
+package environment
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type TimeInForce int16
+
+const (
+	GoodTillCanceled  TimeInForce = iota
+	GoodTillDate      TimeInForce = iota
+	ImmediateOrCancel TimeInForce = iota
+)
+
+func (w TimeInForce) String() string {
+	return [...]string{"GTC", "GTD", "IOC"}[w]
+}
+
+func (w TimeInForce) EnumIndex() int {
+	return int(w)
+}
+
+// OrderRequest represents an order to be placed on an exchange.
+type OrderRequest struct {
+	Market        *Market
+	Side          TradeSide
+	Type          TradeType
+	TimeInForce   TimeInForce
+	PostOnly      bool            //If true the order is rejected instead of taking liquidity from the book.
+	Amount        decimal.Decimal //Quantity of coins to buy or sell, in base currency.
+	LimitPrice    decimal.Decimal //[optional] Limit price, required by limit and stop limit orders.
+	StopPrice     decimal.Decimal //[optional] Trigger price, required by stop loss and stop limit orders.
+	ExpireTime    time.Time       //[optional] Expiry of good till date orders.
+	ClientOrderID string          //[optional] Id chosen by the bot to identify the order.
+}
+
+// Validate checks that the fields required by the order type and time in force are set and consistent.
+func (request OrderRequest) Validate() error {
+	if request.Market == nil {
+		return errors.New("order request has no market")
+	}
+	if !request.Amount.IsPositive() {
+		return errors.New("order request amount must be > 0")
+	}
+	if (request.Type == LimitOrder || request.Type == StopLimitOrder) && !request.LimitPrice.IsPositive() {
+		return fmt.Errorf("%s order request requires a limit price", request.Type)
+	}
+	if request.Type.IsStop() && !request.StopPrice.IsPositive() {
+		return fmt.Errorf("%s order request requires a stop price", request.Type)
+	}
+	if request.TimeInForce == GoodTillDate && request.ExpireTime.IsZero() {
+		return errors.New("GTD order request requires an expire time")
+	}
+	if request.Type == MarketPrice && request.TimeInForce == GoodTillDate {
+		return errors.New("market order request cannot be GTD")
+	}
+	if request.Type.IsStop() && request.TimeInForce == ImmediateOrCancel {
+		return fmt.Errorf("%s order request cannot be IOC", request.Type)
+	}
+	if request.PostOnly && (request.Type == MarketPrice || request.TimeInForce == ImmediateOrCancel) {
+		return errors.New("post only order request must rest on the book")
+	}
+	return nil
+}
+
+func (request OrderRequest) String() string {
+	ret := fmt.Sprintf("%s %s %s %s", request.Side, request.Type, request.TimeInForce, request.Amount.String())
+	if request.Market != nil {
+		ret += " " + request.Market.Name
+	}
+	if request.Type == LimitOrder || request.Type == StopLimitOrder {
+		ret += " limit " + request.LimitPrice.String()
+	}
+	if request.Type.IsStop() {
+		ret += " stop " + request.StopPrice.String()
+	}
+	return ret
+}
@@ -0,0 +1,46 @@
+package environment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestOrderRequestValidate(t *testing.T) {
+	market := &Market{Name: "ETH-USD", BaseCurrency: "eth", MarketCurrency: "usd"}
+	one := decimal.NewFromInt(1)
+
+	tests := []struct {
+		name    string
+		request OrderRequest
+		valid   bool
+	}{
+		{"market order", OrderRequest{Market: market, Type: MarketPrice, Amount: one}, true},
+		{"no market", OrderRequest{Type: MarketPrice, Amount: one}, false},
+		{"no amount", OrderRequest{Market: market, Type: MarketPrice}, false},
+		{"limit order without limit", OrderRequest{Market: market, Type: LimitOrder, Amount: one}, false},
+		{"stop loss", OrderRequest{Market: market, Type: StopLossOrder, Amount: one, StopPrice: one}, true},
+		{"stop loss without stop price", OrderRequest{Market: market, Type: StopLossOrder, Amount: one}, false},
+		{"stop limit", OrderRequest{Market: market, Type: StopLimitOrder, Amount: one, StopPrice: one, LimitPrice: one}, true},
+		{"stop limit without limit", OrderRequest{Market: market, Type: StopLimitOrder, Amount: one, StopPrice: one}, false},
+		{"stop limit without stop price", OrderRequest{Market: market, Type: StopLimitOrder, Amount: one, LimitPrice: one}, false},
+		{"IOC stop loss", OrderRequest{Market: market, Type: StopLossOrder, TimeInForce: ImmediateOrCancel, Amount: one, StopPrice: one}, false},
+		{"GTD stop loss", OrderRequest{Market: market, Type: StopLossOrder, TimeInForce: GoodTillDate, Amount: one, StopPrice: one, ExpireTime: time.Now()}, true},
+		{"GTD stop loss without expiry", OrderRequest{Market: market, Type: StopLossOrder, TimeInForce: GoodTillDate, Amount: one, StopPrice: one}, false},
+		{"GTD market order", OrderRequest{Market: market, Type: MarketPrice, TimeInForce: GoodTillDate, Amount: one, ExpireTime: time.Now()}, false},
+		{"post only market order", OrderRequest{Market: market, Type: MarketPrice, PostOnly: true, Amount: one}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.request.Validate()
+			if test.valid && err != nil {
+				t.Fatalf("got %v, want a valid request", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("the invalid request was accepted")
+			}
+		})
+	}
+}
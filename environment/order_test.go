@@ -0,0 +1,116 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// testBook returns a book quoted at 99/101 around a mid price of 100, with levels one unit apart.
+func testBook() OrderBook {
+	level := func(price float64, quantity float64) Order {
+		return Order{Value: decimal.NewFromFloat(price), Quantity: decimal.NewFromFloat(quantity)}
+	}
+	return OrderBook{
+		Asks: []Order{level(101, 1), level(102, 2), level(103, 3)},
+		Bids: []Order{level(99, 1), level(98, 2), level(97, 3)},
+	}
+}
+
+func TestOrderBookWalk(t *testing.T) {
+	tests := []struct {
+		name     string
+		side     TradeSide
+		amount   float64
+		limit    float64
+		quantity float64
+		total    float64
+		levels   int
+	}{
+		{"buy within the best ask", Buy, 0.5, 0, 0.5, 50.5, 1},
+		{"buy across levels", Buy, 2, 0, 2, 101 + 102, 2},
+		{"buy the whole side", Buy, 10, 0, 6, 101 + 2*102 + 3*103, 3},
+		{"buy up to the limit", Buy, 10, 102, 3, 101 + 2*102, 2},
+		{"buy below the best ask", Buy, 1, 100, 0, 0, 0},
+		{"sell across levels", Sell, 2, 0, 2, 99 + 98, 2},
+		{"sell down to the limit", Sell, 10, 98, 3, 99 + 2*98, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fill := testBook().Walk(test.side, decimal.NewFromFloat(test.amount), decimal.NewFromFloat(test.limit))
+			if !fill.Quantity.Equal(decimal.NewFromFloat(test.quantity)) || !fill.Total.Equal(decimal.NewFromFloat(test.total)) || fill.Levels != test.levels {
+				t.Fatalf("filled %s for %s on %d levels, want %v for %v on %d", fill.Quantity, fill.Total, fill.Levels, test.quantity, test.total, test.levels)
+			}
+			if fill.Complete(decimal.NewFromFloat(test.amount)) != (test.quantity >= test.amount) {
+				t.Fatalf("Complete is %v for %s filled out of %v", !(test.quantity >= test.amount), fill.Quantity, test.amount)
+			}
+			if test.quantity > 0 && !fill.AveragePrice.Equal(fill.Total.Div(fill.Quantity)) {
+				t.Fatalf("average price %s, want %s", fill.AveragePrice, fill.Total.Div(fill.Quantity))
+			}
+		})
+	}
+}
+
+func TestOrderBookDepthWithin(t *testing.T) {
+	tests := []struct {
+		side  OrderType
+		bps   int64
+		depth int64
+	}{
+		{Ask, 50, 0},
+		{Ask, 100, 1},
+		{Ask, 250, 3},
+		{Ask, 1000, 6},
+		{Bid, 100, 1},
+		{Bid, 299, 3},
+		{Bid, 300, 6},
+	}
+
+	for _, test := range tests {
+		depth := testBook().DepthWithin(test.side, decimal.NewFromInt(test.bps))
+		if !depth.Equal(decimal.NewFromInt(test.depth)) {
+			t.Errorf("depth of side %d within %d bps is %s, want %d", test.side, test.bps, depth, test.depth)
+		}
+	}
+
+	if depth := (OrderBook{Asks: testBook().Asks}).DepthWithin(Ask, decimal.NewFromInt(1000)); !depth.IsZero() {
+		t.Errorf("depth of a one sided book is %s, want 0", depth)
+	}
+}
+
+func TestOrderBookSpreadBps(t *testing.T) {
+	spread, ok := testBook().SpreadBps()
+	if !ok || !spread.Equal(decimal.NewFromInt(200)) {
+		t.Fatalf("spread is %s bps (%v), want 200", spread, ok)
+	}
+
+	if _, ok := (OrderBook{Bids: testBook().Bids}).SpreadBps(); ok {
+		t.Fatal("a book without asks has a spread")
+	}
+}
+
+func TestOrderBookValidate(t *testing.T) {
+	book := testBook()
+	if err := book.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	unsorted := testBook()
+	unsorted.Asks[0], unsorted.Asks[1] = unsorted.Asks[1], unsorted.Asks[0]
+	crossed := testBook()
+	crossed.Bids[0].Value = decimal.NewFromInt(101)
+	empty := testBook()
+	empty.Bids[2].Quantity = decimal.Zero
+
+	for name, invalid := range map[string]OrderBook{"unsorted": unsorted, "crossed": crossed, "empty level": empty} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("the %s book is valid", name)
+		}
+	}
+
+	unsorted.Sort()
+	if err := unsorted.Validate(); err != nil {
+		t.Errorf("the sorted book is invalid: %s", err)
+	}
+}
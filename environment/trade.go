@@ -12,12 +12,19 @@ import (
 type TradeType int16
 
 const (
-	MarketPrice TradeType = iota
-	LimitOrder  TradeType = iota
+	MarketPrice    TradeType = iota
+	LimitOrder     TradeType = iota
+	StopLossOrder  TradeType = iota
+	StopLimitOrder TradeType = iota
 )
 
 func (w TradeType) String() string {
-	return [...]string{"Market", "Limit"}[w-1]
+	return [...]string{"Market", "Limit", "StopLoss", "StopLimit"}[w]
+}
+
+// IsStop returns true for order types that wait for a stop price to be reached.
+func (w TradeType) IsStop() bool {
+	return w == StopLossOrder || w == StopLimitOrder
 }
 
 func (w TradeType) EnumIndex() int {
@@ -30,10 +37,16 @@ const (
 	Complete TradeStatus = iota
 	Pending  TradeStatus = iota
 	Canceled TradeStatus = iota
+	Partial  TradeStatus = iota // Filled for less than the asked quantity, the remainder is not filled.
 )
 
 func (w TradeStatus) String() string {
-	return [...]string{"Complete", "Pending", "Cancled"}[w]
+	return [...]string{"Complete", "Pending", "Cancled", "Partial"}[w]
+}
+
+// IsFilled returns true for trades which filled some quantity, wholly or partly.
+func (w TradeStatus) IsFilled() bool {
+	return w == Complete || w == Partial
 }
 
 func (w TradeStatus) EnumIndex() int {
@@ -0,0 +1,49 @@
+package environment
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type TransferStatus int16
+
+const (
+	TransferPending  TransferStatus = iota
+	TransferComplete TransferStatus = iota
+	TransferFailed   TransferStatus = iota
+)
+
+func (w TransferStatus) String() string {
+	return [...]string{"Pending", "Complete", "Failed"}[w]
+}
+
+func (w TransferStatus) EnumIndex() int {
+	return int(w)
+}
+
+// Transfer represents a withdrawal from one exchange to the deposit address of another.
+type Transfer struct {
+	ID           string          //Internal transfer id.
+	WithdrawalID string          //Withdrawal reference as returned by the source exchange.
+	Coin         string          //Coin being moved.
+	Amount       decimal.Decimal //Amount withdrawn from the source exchange, fees included.
+	Fee          decimal.Decimal //Withdrawal fee quoted by the source exchange.
+	FromExchange string          //Name of the exchange the coin is withdrawn from.
+	ToExchange   string          //Name of the exchange the coin is deposited to.
+	Address      string          //Deposit address on the destination exchange.
+	Status       TransferStatus
+	RequestedAt  time.Time
+	CompletedAt  time.Time //[optional] Set once the transfer is no longer pending.
+}
+
+// Received returns the amount expected on the destination exchange.
+func (transfer Transfer) Received() decimal.Decimal {
+	return transfer.Amount.Sub(transfer.Fee)
+}
+
+func (transfer Transfer) String() string {
+	return fmt.Sprintf("#%s %s %s %s -> %s (fee %s) %s", transfer.ID, transfer.Amount.String(), transfer.Coin,
+		transfer.FromExchange, transfer.ToExchange, transfer.Fee.String(), transfer.Status.String())
+}
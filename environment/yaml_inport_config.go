@@ -27,10 +27,16 @@ type Balance struct {
 //
 //	Can be used to generate an ExchangeWrapper.
 type ExchangeConfig struct {
-	ExchangeName     string            `mapstructure:"exchange"`          // Represents the exchange name.
-	PublicKey        string            `mapstructure:"public_key"`        // Represents the public key used to connect to Exchange API.
-	SecretKey        string            `mapstructure:"secret_key"`        // Represents the secret key used to connect to Exchange API.
-	DepositAddresses map[string]string `mapstructure:"deposit_addresses"` // Represents the bindings between coins and deposit address on the exchange.
+	ExchangeName     string                     `mapstructure:"exchange"`          // Represents the exchange name.
+	PublicKey        string                     `mapstructure:"public_key"`        // Represents the public key used to connect to Exchange API.
+	SecretKey        string                     `mapstructure:"secret_key"`        // Represents the secret key used to connect to Exchange API.
+	DepositAddresses map[string]string          `mapstructure:"deposit_addresses"` // Represents the bindings between coins and deposit address on the exchange.
+	WithdrawKeys     map[string]string          `mapstructure:"withdraw_keys"`     // Represents the bindings between coins and withdrawal key names, for exchanges that withdraw by key (e.g. kraken).
+	WithdrawFees     map[string]decimal.Decimal `mapstructure:"withdraw_fees"`     // Represents the withdrawal fee of each coin, for exchanges that do not quote it (e.g. coinbase) [coin:fee].
+	Websocket        bool                       `mapstructure:"websocket"`         // Represents whether the market data is fed by the websocket feed of the exchange, if it has one.
+	DataDir          string                     `mapstructure:"data_dir"`          // Represents the directory of the candle files, for the file exchange.
+	TradingFee       decimal.Decimal            `mapstructure:"trading_fee"`       // Represents the fee rate charged on the orders, for the file exchange (e.g. 0.0026 for the kraken taker fee).
+	Synthetic        SyntheticConfig            `mapstructure:"synthetic"`         // Represents the processes generating the market data, for the synthetic exchange.
 }
 
 type StrategyConfig struct {
@@ -72,16 +78,98 @@ type ExchangeBindingsConfig struct {
 }
 
 type SimulationConfig struct {
-	SimModeOn       bool                       `mapstructure:"enabled"` // if true, do not create real orders and do not get real balance
-	SimStartDate    string                     `mapstructure:"start_date"`
-	SimEndDate      string                     `mapstructure:"end_date"`
-	SimInterval     int                        `mapstructure:"interval"`
-	SimFakeBalances map[string]decimal.Decimal `mapstructure:"fake_balances"` // Used only in simulation mode, fake starting balance [coin:balance].
+	SimModeOn        bool                       `mapstructure:"enabled"` // if true, do not create real orders and do not get real balance
+	SimStartDate     string                     `mapstructure:"start_date"`
+	SimEndDate       string                     `mapstructure:"end_date"`
+	SimInterval      int                        `mapstructure:"interval"`
+	SimFakeBalances  map[string]decimal.Decimal `mapstructure:"fake_balances"`  // Used only in simulation mode, fake starting balance [coin:balance].
+	SimTransferDelay int                        `mapstructure:"transfer_delay"` // Minutes a simulated withdrawal takes to reach the destination exchange.
+	SimWithdrawFees  map[string]decimal.Decimal `mapstructure:"withdraw_fees"`  // Flat simulated withdrawal fee per coin [coin:fee].
+	SimDataDir       string                     `mapstructure:"data_dir"`       // Directory where fetched candles and trades are stored for later runs, none if empty.
+	SimFillModel     FillModelConfig            `mapstructure:"fill_model"`     // How simulated orders are filled.
+	SimCashFlows     []CashFlowConfig           `mapstructure:"cash_flows"`     // Deposits and withdrawals received by the simulated accounts.
+}
+
+// CashFlowConfig contains a deposit or withdrawal received by the simulated accounts, once or on a schedule.
+type CashFlowConfig struct {
+	Coin   string          `mapstructure:"coin"`
+	Amount decimal.Decimal `mapstructure:"amount"` // Amount deposited, withdrawn if negative.
+	Date   string          `mapstructure:"date"`   // Date of a single cash flow, as a date or a RFC 3339 time.
+	Cron   string          `mapstructure:"cron"`   // Schedule of recurring cash flows (e.g. "0 0 1 * *" monthly), in UTC.
+}
+
+// FillModelConfig contains how the simulator fills the orders.
+type FillModelConfig struct {
+	Model         string          `mapstructure:"model"`         // Fill model: trades (default), candle or volume.
+	SpreadBps     decimal.Decimal `mapstructure:"spread_bps"`    // Spread paid around the candle open, in basis points (candle and volume models).
+	SlippageBps   decimal.Decimal `mapstructure:"slippage_bps"`  // Slippage paid on top of half the spread, in basis points (candle and volume models).
+	Participation decimal.Decimal `mapstructure:"participation"` // Maximum share of the candle volume an order can take (volume model).
+	Latency       int             `mapstructure:"latency"`       // Milliseconds between an order being sent and filled.
+}
+
+// SyntheticConfig contains how the synthetic exchange generates its market data.
+type SyntheticConfig struct {
+	Seed         int64                        `mapstructure:"seed"`         // Seed of the generator: the same seed always generates the same data.
+	StartDate    string                       `mapstructure:"start_date"`   // Date of the first generated candle (default 2020-01-01).
+	Interval     int                          `mapstructure:"interval"`     // Minutes between two generated candles (default 1).
+	SpreadBps    float64                      `mapstructure:"spread_bps"`   // Spread of the generated orderbooks, in basis points.
+	Markets      []SyntheticMarketConfig      `mapstructure:"markets"`      // Markets generated by the exchange.
+	Correlations []SyntheticCorrelationConfig `mapstructure:"correlations"` // Correlations between the returns of the markets, none if not listed.
+	Regimes      []SyntheticRegimeConfig      `mapstructure:"regimes"`      // Regimes the markets switch between at random, none if empty.
+	Scenarios    []SyntheticScenarioConfig    `mapstructure:"scenarios"`    // Scripted price shocks (e.g. crashes, depegs).
+}
+
+// SyntheticMarketConfig contains the process generating the prices of a synthetic market.
+type SyntheticMarketConfig struct {
+	Name          string  `mapstructure:"name"`           // Name of the market on the exchange (e.g. BTC-USD).
+	Process       string  `mapstructure:"process"`        // Price process: gbm (default), jump_diffusion or mean_reverting.
+	Price         float64 `mapstructure:"price"`          // Price at the start date.
+	Drift         float64 `mapstructure:"drift"`          // Expected yearly log return.
+	Volatility    float64 `mapstructure:"volatility"`     // Yearly volatility of the log returns.
+	Volume        float64 `mapstructure:"volume"`         // Average volume of a candle, in base coin.
+	JumpIntensity float64 `mapstructure:"jump_intensity"` // Expected number of jumps per year (jump_diffusion).
+	JumpMean      float64 `mapstructure:"jump_mean"`      // Mean log size of a jump (jump_diffusion).
+	JumpStdDev    float64 `mapstructure:"jump_std_dev"`   // Standard deviation of the log size of a jump (jump_diffusion).
+	Reversion     float64 `mapstructure:"reversion"`      // Yearly speed of the reversion to the start price (mean_reverting).
+}
+
+// SyntheticCorrelationConfig contains the correlation between the returns of two synthetic markets.
+type SyntheticCorrelationConfig struct {
+	Markets []string `mapstructure:"markets"` // Names of the two markets.
+	Value   float64  `mapstructure:"value"`   // Correlation, in [-1, 1].
+}
+
+// SyntheticRegimeConfig contains a regime of the synthetic markets (e.g. bull or bear market).
+type SyntheticRegimeConfig struct {
+	Name            string  `mapstructure:"name"`
+	Drift           float64 `mapstructure:"drift"`            // Yearly log return added to the drift of every market.
+	VolatilityScale float64 `mapstructure:"volatility_scale"` // Multiplier of the volatility of every market (default 1).
+	Duration        float64 `mapstructure:"duration"`         // Average days the regime lasts.
+}
+
+// SyntheticScenarioConfig contains a scripted price shock of synthetic markets.
+type SyntheticScenarioConfig struct {
+	Name     string   `mapstructure:"name"`
+	Date     string   `mapstructure:"date"`     // Start of the shock, as a date or a RFC 3339 time.
+	Markets  []string `mapstructure:"markets"`  // Names of the markets shocked, all if empty.
+	Change   float64  `mapstructure:"change"`   // Price change at the bottom of the shock, as a fraction (e.g. -0.5 for a 50% crash).
+	Duration int      `mapstructure:"duration"` // Minutes the shock takes to reach its full change.
+	Recovery int      `mapstructure:"recovery"` // Minutes the prices take to recover afterwards, never if 0.
+}
+
+// TransferConfig contains the safety limits applied to withdrawals between exchanges.
+type TransferConfig struct {
+	Allowlist    map[string][]string        `mapstructure:"allowlist"`     // Addresses each coin may be withdrawn to [coin:addresses].
+	DailyLimits  map[string]decimal.Decimal `mapstructure:"daily_limits"`  // Maximum amount of each coin withdrawn in any 24 hours [coin:amount].
+	PollInterval int                        `mapstructure:"poll_interval"` // Seconds between status checks of a pending transfer.
+	Timeout      int                        `mapstructure:"timeout"`       // Minutes to wait for a transfer to complete before giving up.
+	Journal      string                     `mapstructure:"journal"`       // File the transfers are recorded in, so that daily limits hold across runs (default ./.bot_transfers.json when live).
 }
 
 // BotConfig contains all config data of the bot, which can be also loaded from config file.
 type BotConfig struct {
 	SimulationConfigs SimulationConfig `mapstructure:"simulation_configs"`
 	ExchangeConfigs   []ExchangeConfig `mapstructure:"exchange_configs"` // Represents the current exchange configuration.
+	TransferConfigs   TransferConfig   `mapstructure:"transfer_configs"` // Represents the limits applied to transfers between exchanges.
 	Strategies        []StrategyConfig `mapstructure:"strategies"`       // Represents the current strategies adopted by the bot.
 }
@@ -15,31 +15,65 @@
 
 package examples
 
-/*
-// Websocket strategy
-var Websocket = strategies.WebsocketStrategy{
-	Model: strategies.StrategyModel{
-		Name: "Websocket",
-		Setup: func(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) error {
-			for _, wrapper := range wrappers {
-				err := wrapper.FeedConnect(markets)
-				if err == exchanges.ErrWebsocketNotSupported || err == nil {
-					continue
-				}
-				return err
-			}
-			return nil
-		},
-		OnUpdate: func(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) error {
-			// do something
-			return nil
-		},
-		TearDown: func(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) error {
-			return nil
-		},
-		OnError: func(err error) {
-			logrus.Error(err)
-		},
-	},
-}
-*/
+import (
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/mcwarner5/BlockBot8000/exchanges"
+	"github.com/mcwarner5/BlockBot8000/strategies"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	strategies.Register("CandleWatcher", NewCandleWatcher, strategies.BaseSpecSchema)
+}
+
+// CandleWatcher logs the candles of its markets as they close and the fills of its orders, and counts them every hour.
+// Being event driven, it runs the same way on the feeds of the exchanges and in backtests.
+type CandleWatcher struct {
+	strategies.StrategyModel
+	Candles int
+	Fills   int
+}
+
+// NewCandleWatcher creates a CandleWatcher from its configuration.
+func NewCandleWatcher(raw_strat environment.StrategyConfig) strategies.Strategy {
+	return CandleWatcher{StrategyModel: *strategies.NewBaseStrategy(raw_strat)}
+}
+
+// Setup connects the feeds of the exchanges supporting them.
+func (cw CandleWatcher) Setup(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) (strategies.Strategy, error) {
+	for _, wrapper := range wrappers {
+		err := wrapper.FeedConnect(markets)
+		if err == exchanges.ErrWebsocketNotSupported || err == nil {
+			continue
+		}
+		return cw, err
+	}
+	return cw, nil
+}
+
+// OnCandleClose logs the closed candle.
+func (cw CandleWatcher) OnCandleClose(wrappers []exchanges.ExchangeWrapper, market *environment.Market, candle environment.CandleStick) (strategies.Strategy, error) {
+	logrus.Infof("%s closed at %s", market.Name, candle.Close)
+	cw.Candles++
+	return cw, nil
+}
+
+// OnOrderUpdate logs the fill of an order.
+func (cw CandleWatcher) OnOrderUpdate(wrappers []exchanges.ExchangeWrapper, market *environment.Market, order environment.Trade) (strategies.Strategy, error) {
+	logrus.Infof("%s %s order %s filled %s at %s", market.Name, order.Side, order.TradeNumber, order.FillQuantity, order.Price)
+	cw.Fills++
+	return cw, nil
+}
+
+// TimerInterval makes OnTimer be called every hour.
+func (cw CandleWatcher) TimerInterval() time.Duration {
+	return time.Hour
+}
+
+// OnTimer logs the candles and fills seen so far.
+func (cw CandleWatcher) OnTimer(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market, now time.Time) (strategies.Strategy, error) {
+	logrus.Infof("%s: %d candles and %d fills seen by %s", cw.GetName(), cw.Candles, cw.Fills, now)
+	return cw, nil
+}
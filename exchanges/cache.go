@@ -1,248 +1,307 @@
 package exchanges
 
 import (
-	"fmt"
+	"container/list"
 	"sync"
 	"time"
 
 	"github.com/mcwarner5/BlockBot8000/environment"
 )
 
-// SummaryCache represents a local summary cache for every exchange. To allow dinamic polling from multiple sources (REST + Websocket)
-type SummaryCache struct {
-	mutex    *sync.RWMutex
-	internal map[*environment.Market]*environment.MarketSummary
+// CacheConfig represents the limits of a Cache, zero values mean no limit.
+type CacheConfig struct {
+	TTL     time.Duration // Time after which a value expires.
+	MaxSize int           // Maximum number of values, the least recently used ones are evicted beyond it.
 }
 
-// NewSummaryCache creates a new SummaryCache Object
-func NewSummaryCache() *SummaryCache {
-	return &SummaryCache{
-		mutex:    &sync.RWMutex{},
-		internal: make(map[*environment.Market]*environment.MarketSummary),
-	}
+// cacheEntry represents a value held by a Cache.
+type cacheEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time // zero if the value never expires.
+	stale   bool      // whether the value is no longer updated by its source.
 }
 
-// Set sets a value for the specified key.
-func (sc *SummaryCache) Set(market *environment.Market, summary *environment.MarketSummary) *environment.MarketSummary {
-	sc.mutex.Lock()
-	old := sc.internal[market]
-	sc.internal[market] = summary
-	sc.mutex.Unlock()
-	return old
+// Cache represents a thread safe key value cache with optional TTL and LRU eviction.
+type Cache[K comparable, V any] struct {
+	mutex   *sync.Mutex
+	config  CacheConfig
+	entries map[K]*list.Element
+	lru     *list.List // most recently used values first.
 }
 
-// Get gets the value for the specified key.
-func (sc *SummaryCache) Get(market *environment.Market) (*environment.MarketSummary, bool) {
-	sc.mutex.RLock()
-	ret, isSet := sc.internal[market]
-	sc.mutex.RUnlock()
-	return ret, isSet
+// NewCache creates a new Cache with the specified limits.
+func NewCache[K comparable, V any](config CacheConfig) *Cache[K, V] {
+	return &Cache[K, V]{
+		mutex:   &sync.Mutex{},
+		config:  config,
+		entries: make(map[K]*list.Element),
+		lru:     list.New(),
+	}
 }
 
-// CandlesCache represents a local candles cache for every exchange. To allow dinamic polling from multiple sources (REST + Websocket)
-type CandlesCache struct {
-	mutex    *sync.RWMutex
-	internal map[*environment.Market][]environment.CandleStick
+// Set sets a value for the specified key, returning the previous one if any.
+func (c *Cache[K, V]) Set(key K, value V) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.set(key, value)
 }
 
-// NewCandlesCache creates a new CandlesCache Object
-func NewCandlesCache() *CandlesCache {
-	return &CandlesCache{
-		mutex:    &sync.RWMutex{},
-		internal: make(map[*environment.Market][]environment.CandleStick),
+// Get gets the value for the specified key, expired and stale values are reported as not set.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, isSet := c.lookup(key)
+	if !isSet || entry.stale {
+		var zero V
+		return zero, false
 	}
+	return entry.value, true
 }
 
-// Set sets a value for the specified key.
-func (cc *CandlesCache) Set(market *environment.Market, candles []environment.CandleStick) []environment.CandleStick {
-	cc.mutex.Lock()
-	old := cc.internal[market]
-	cc.internal[market] = candles
-	cc.mutex.Unlock()
-	return old
-}
+// Update atomically replaces the value for the specified key with the one computed from the current one.
+func (c *Cache[K, V]) Update(key K, update func(old V, isSet bool) V) V {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-// Get gets the value for the specified key.
-func (cc *CandlesCache) Get(market *environment.Market) ([]environment.CandleStick, bool) {
-	cc.mutex.RLock()
-	ret, isSet := cc.internal[market]
-	cc.mutex.RUnlock()
-	return ret, isSet
+	var old V
+	entry, isSet := c.lookup(key)
+	if isSet {
+		old = entry.value
+	}
+	value := update(old, isSet)
+	c.set(key, value)
+	return value
 }
 
-// OrderbookCache represents a local orderbook cache for every exchange. To allow dinamic polling from multiple sources (REST + Websocket)
-type TradeBookbookCache struct {
-	mutex    *sync.RWMutex
-	internal map[*environment.Market]*environment.TradeBook
-}
+// Delete removes the value for the specified key.
+func (c *Cache[K, V]) Delete(key K) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-// NewOrderbookCache creates a new OrderbookCache Object
-func NewTradeBookbookCache() *TradeBookbookCache {
-	return &TradeBookbookCache{
-		mutex:    &sync.RWMutex{},
-		internal: make(map[*environment.Market]*environment.TradeBook),
+	if element, exists := c.entries[key]; exists {
+		c.remove(element)
 	}
 }
 
-// Set sets a value for the specified key.
-func (cc *TradeBookbookCache) Set(market *environment.Market, book *environment.TradeBook) *environment.TradeBook {
-	cc.mutex.Lock()
-	old := cc.internal[market]
-	cc.internal[market] = book
-	cc.mutex.Unlock()
-	return old
-}
+// MarkStale marks the values for the specified keys as stale until they are set again.
+func (c *Cache[K, V]) MarkStale(keys ...K) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-// Get gets the value for the specified key.
-func (cc *TradeBookbookCache) Get(market *environment.Market) (*environment.TradeBook, bool) {
-	cc.mutex.RLock()
-	ret, isSet := cc.internal[market]
-	cc.mutex.RUnlock()
-	return ret, isSet
+	for _, key := range keys {
+		if element, exists := c.entries[key]; exists {
+			element.Value.(*cacheEntry[K, V]).stale = true
+		}
+	}
 }
 
-// OrderbookCache represents a local orderbook cache for every exchange. To allow dinamic polling from multiple sources (REST + Websocket)
-type OrderbookCache struct {
-	mutex    *sync.RWMutex
-	internal map[*environment.Market]*environment.OrderBook
+// Len returns the number of values held, expired ones included until they are looked up or evicted.
+func (c *Cache[K, V]) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.lru.Len()
 }
 
-// NewOrderbookCache creates a new OrderbookCache Object
-func NewOrderbookCache() *OrderbookCache {
-	return &OrderbookCache{
-		mutex:    &sync.RWMutex{},
-		internal: make(map[*environment.Market]*environment.OrderBook),
+// set sets a value, evicting the least recently used ones beyond the maximum size. The mutex must be held.
+func (c *Cache[K, V]) set(key K, value V) (V, bool) {
+	var expires time.Time
+	if c.config.TTL > 0 {
+		expires = time.Now().Add(c.config.TTL)
 	}
-}
 
-// Set sets a value for the specified key.
-func (cc *OrderbookCache) Set(market *environment.Market, book *environment.OrderBook) *environment.OrderBook {
-	cc.mutex.Lock()
-	old := cc.internal[market]
-	cc.internal[market] = book
-	cc.mutex.Unlock()
-	return old
-}
+	if element, exists := c.entries[key]; exists {
+		entry := element.Value.(*cacheEntry[K, V])
+		old := entry.value
+		entry.value, entry.expires, entry.stale = value, expires, false
+		c.lru.MoveToFront(element)
+		return old, true
+	}
 
-// Get gets the value for the specified key.
-func (cc *OrderbookCache) Get(market *environment.Market) (*environment.OrderBook, bool) {
-	cc.mutex.RLock()
-	ret, isSet := cc.internal[market]
-	cc.mutex.RUnlock()
-	return ret, isSet
+	c.entries[key] = c.lru.PushFront(&cacheEntry[K, V]{key: key, value: value, expires: expires})
+	for c.config.MaxSize > 0 && c.lru.Len() > c.config.MaxSize {
+		c.remove(c.lru.Back())
+	}
+
+	var zero V
+	return zero, false
 }
 
-type CandleMap struct {
-	TimeMap map[string]*environment.CandleStick
+// lookup finds the entry for a key, dropping it if expired. The mutex must be held.
+func (c *Cache[K, V]) lookup(key K) (*cacheEntry[K, V], bool) {
+	element, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry[K, V])
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry, true
 }
 
-func NewSizedCandleMap(size int) CandleMap {
-	return CandleMap{TimeMap: make(map[string]*environment.CandleStick, size)}
+// remove drops an entry. The mutex must be held.
+func (c *Cache[K, V]) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry[K, V]).key)
 }
 
-type MappedCandlesCache struct {
-	mutex    *sync.RWMutex
-	internal map[*environment.Market]CandleMap
+// MarketCache represents a local cache of a value per market, keyed by market name. To allow dinamic polling from multiple sources (REST + Websocket)
+type MarketCache[V any] struct {
+	internal *Cache[string, V]
 }
 
-// NewCandlesCache creates a new CandlesCache Object
-func NewMappedCandlesCache() *MappedCandlesCache {
-	return &MappedCandlesCache{
-		mutex:    &sync.RWMutex{},
-		internal: make(map[*environment.Market]CandleMap),
-	}
+// NewMarketCache creates a new MarketCache with the specified limits.
+func NewMarketCache[V any](config CacheConfig) *MarketCache[V] {
+	return &MarketCache[V]{internal: NewCache[string, V](config)}
 }
 
-// Set sets a value for the specified key.
-func (mcc *MappedCandlesCache) SetMap(market *environment.Market, candles CandleMap) CandleMap {
-	mcc.mutex.Lock()
-	old := mcc.internal[market]
-	mcc.internal[market] = candles
-	mcc.mutex.Unlock()
+// Set sets a value for the specified market, returning the previous one.
+func (mc *MarketCache[V]) Set(market *environment.Market, value V) V {
+	old, _ := mc.internal.Set(market.Name, value)
 	return old
 }
 
-// Get gets the value for the specified key.
-func (mcc *MappedCandlesCache) GetMap(market *environment.Market) (CandleMap, bool) {
-	mcc.mutex.RLock()
-	ret, isSet := mcc.internal[market]
-	mcc.mutex.RUnlock()
-	return ret, isSet
+// Get gets the value for the specified market, expired and stale values are reported as not set.
+func (mc *MarketCache[V]) Get(market *environment.Market) (V, bool) {
+	return mc.internal.Get(market.Name)
 }
 
-// Get gets the value for the specified key.
-func (mcc *MappedCandlesCache) GetTime(market *environment.Market, time time.Time) (*environment.CandleStick, bool) {
-	mcc.mutex.RLock()
-	cc, isSet := mcc.internal[market]
-	if !isSet {
-		mcc.mutex.RUnlock()
-		return nil, isSet
-	}
-	time_key := fmt.Sprint(time.Unix())
+// Update atomically replaces the value for the specified market with the one computed from the current one.
+func (mc *MarketCache[V]) Update(market *environment.Market, update func(old V, isSet bool) V) V {
+	return mc.internal.Update(market.Name, update)
+}
 
-	ret, isSet := cc.TimeMap[time_key]
-	if !isSet {
-		mcc.mutex.RUnlock()
-		return nil, isSet
+// MarkStale marks the values of the specified markets as stale until they are set again.
+func (mc *MarketCache[V]) MarkStale(markets []*environment.Market) {
+	names := make([]string, 0, len(markets))
+	for _, market := range markets {
+		names = append(names, market.Name)
 	}
+	mc.internal.MarkStale(names...)
+}
 
-	mcc.mutex.RUnlock()
-	return ret, isSet
+// SummaryCache represents a local summary cache for every exchange.
+type SummaryCache = MarketCache[*environment.MarketSummary]
+
+// NewSummaryCache creates a new SummaryCache Object
+func NewSummaryCache() *SummaryCache {
+	return NewMarketCache[*environment.MarketSummary](CacheConfig{})
 }
 
-type OrderBookMap struct {
-	TimeMap map[string]*environment.OrderBook
+// CandlesCache represents a local candles cache for every exchange.
+type CandlesCache = MarketCache[[]environment.CandleStick]
+
+// NewCandlesCache creates a new CandlesCache Object
+func NewCandlesCache() *CandlesCache {
+	return NewMarketCache[[]environment.CandleStick](CacheConfig{})
 }
 
-func NewOrderBookMap(size int) OrderBookMap {
-	return OrderBookMap{TimeMap: make(map[string]*environment.OrderBook, size)}
+// TradeBookCache represents a local trades cache for every exchange.
+type TradeBookCache = MarketCache[*environment.TradeBook]
+
+// NewTradeBookCache creates a new TradeBookCache Object
+func NewTradeBookCache() *TradeBookCache {
+	return NewMarketCache[*environment.TradeBook](CacheConfig{})
 }
 
-type MappedOrdersCache struct {
-	mutex    *sync.RWMutex
-	internal map[*environment.Market]OrderBookMap
+// OrderbookCache represents a local orderbook cache for every exchange.
+type OrderbookCache = MarketCache[*environment.OrderBook]
+
+// NewOrderbookCache creates a new OrderbookCache Object
+func NewOrderbookCache() *OrderbookCache {
+	return NewMarketCache[*environment.OrderBook](CacheConfig{})
 }
 
-// NewCandlesCache creates a new CandlesCache Object
-func NewMappedOrdersCache() *MappedOrdersCache {
-	return &MappedOrdersCache{
-		mutex:    &sync.RWMutex{},
-		internal: make(map[*environment.Market]OrderBookMap),
-	}
+// CandleSeriesCache represents a local cache of the candles of many markets, sorted by time.
+type CandleSeriesCache struct {
+	mutex      *sync.RWMutex
+	internal   *Cache[string, *environment.CandleSeries]
+	maxCandles int // candles kept per market, the oldest are dropped beyond it.
 }
 
-func (moc *MappedOrdersCache) SetMap(market *environment.Market, orders OrderBookMap) OrderBookMap {
-	moc.mutex.Lock()
-	old := moc.internal[market]
-	moc.internal[market] = orders
-	moc.mutex.Unlock()
-	return old
+// NewCandleSeriesCache creates a new CandleSeriesCache keeping at most maxCandles candles of at most maxMarkets markets, zero means no limit.
+func NewCandleSeriesCache(maxMarkets int, maxCandles int) *CandleSeriesCache {
+	return &CandleSeriesCache{
+		mutex:      &sync.RWMutex{},
+		internal:   NewCache[string, *environment.CandleSeries](CacheConfig{MaxSize: maxMarkets}),
+		maxCandles: maxCandles,
+	}
 }
 
-// Get gets the value for the specified key.
-func (moc *MappedOrdersCache) GetMap(market *environment.Market) (OrderBookMap, bool) {
-	moc.mutex.RLock()
-	ret, isSet := moc.internal[market]
-	moc.mutex.RUnlock()
-	return ret, isSet
+// Insert merges candles into the series of a market, replacing the ones with the same time.
+func (csc *CandleSeriesCache) Insert(market *environment.Market, candles []environment.CandleStick) {
+	csc.mutex.Lock()
+	defer csc.mutex.Unlock()
+
+	csc.internal.Update(market.Name, func(series *environment.CandleSeries, isSet bool) *environment.CandleSeries {
+		if !isSet {
+			series = environment.NewCandleSeries()
+		}
+		series.Insert(candles...)
+		if csc.maxCandles > 0 {
+			series.Truncate(csc.maxCandles)
+		}
+		return series
+	})
 }
 
-// Get gets the value for the specified key.
-func (moc *MappedOrdersCache) GetTime(market *environment.Market, time time.Time) (*environment.OrderBook, bool) {
-	moc.mutex.RLock()
-	cc, isSet := moc.internal[market]
+// At gets the candle of a market starting at the specified time.
+func (csc *CandleSeriesCache) At(market *environment.Market, time time.Time) (*environment.CandleStick, bool) {
+	csc.mutex.RLock()
+	defer csc.mutex.RUnlock()
+
+	series, isSet := csc.internal.Get(market.Name)
+	if !isSet {
+		return nil, false
+	}
+	candle, isSet := series.At(time)
 	if !isSet {
-		moc.mutex.RUnlock()
-		return nil, isSet
+		return nil, false
 	}
-	time_key := fmt.Sprint(time.Unix())
+	return &candle, true
+}
 
-	ret, isSet := cc.TimeMap[time_key]
+// Range gets the candles of a market starting in [start, end).
+func (csc *CandleSeriesCache) Range(market *environment.Market, start time.Time, end time.Time) []environment.CandleStick {
+	csc.mutex.RLock()
+	defer csc.mutex.RUnlock()
+
+	series, isSet := csc.internal.Get(market.Name)
 	if !isSet {
-		moc.mutex.RUnlock()
-		return nil, isSet
+		return nil
 	}
+	return series.Range(start, end)
+}
+
+// timedKey identifies a value of a market at a given time.
+type timedKey struct {
+	market string
+	time   int64
+}
+
+// TimedOrderbookCache represents a local cache of the orderbooks of many markets at given times.
+type TimedOrderbookCache struct {
+	internal *Cache[timedKey, *environment.OrderBook]
+}
+
+// NewTimedOrderbookCache creates a new TimedOrderbookCache with the specified limits.
+func NewTimedOrderbookCache(config CacheConfig) *TimedOrderbookCache {
+	return &TimedOrderbookCache{internal: NewCache[timedKey, *environment.OrderBook](config)}
+}
+
+// Set sets the orderbook of a market at the specified time.
+func (toc *TimedOrderbookCache) Set(market *environment.Market, time time.Time, book *environment.OrderBook) {
+	toc.internal.Set(timedKey{market: market.Name, time: time.Unix()}, book)
+}
 
-	moc.mutex.RUnlock()
-	return ret, isSet
+// Get gets the orderbook of a market at the specified time.
+func (toc *TimedOrderbookCache) Get(market *environment.Market, time time.Time) (*environment.OrderBook, bool) {
+	return toc.internal.Get(timedKey{market: market.Name, time: time.Unix()})
 }
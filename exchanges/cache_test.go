@@ -0,0 +1,226 @@
+package exchanges
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions func(cache *Cache[string, int])
+		kept    []string
+		evicted []string
+	}{
+		{
+			name: "oldest set is evicted",
+			actions: func(cache *Cache[string, int]) {
+				cache.Set("a", 1)
+				cache.Set("b", 2)
+				cache.Set("c", 3)
+				cache.Set("d", 4)
+			},
+			kept:    []string{"b", "c", "d"},
+			evicted: []string{"a"},
+		},
+		{
+			name: "get makes a value recently used",
+			actions: func(cache *Cache[string, int]) {
+				cache.Set("a", 1)
+				cache.Set("b", 2)
+				cache.Set("c", 3)
+				cache.Get("a")
+				cache.Set("d", 4)
+			},
+			kept:    []string{"a", "c", "d"},
+			evicted: []string{"b"},
+		},
+		{
+			name: "set again makes a value recently used",
+			actions: func(cache *Cache[string, int]) {
+				cache.Set("a", 1)
+				cache.Set("b", 2)
+				cache.Set("c", 3)
+				cache.Set("a", 5)
+				cache.Set("d", 4)
+			},
+			kept:    []string{"a", "c", "d"},
+			evicted: []string{"b"},
+		},
+		{
+			name: "update makes a value recently used",
+			actions: func(cache *Cache[string, int]) {
+				cache.Set("a", 1)
+				cache.Set("b", 2)
+				cache.Set("c", 3)
+				cache.Update("a", func(old int, isSet bool) int { return old + 1 })
+				cache.Set("d", 4)
+			},
+			kept:    []string{"a", "c", "d"},
+			evicted: []string{"b"},
+		},
+		{
+			name: "deleted values free their slot",
+			actions: func(cache *Cache[string, int]) {
+				cache.Set("a", 1)
+				cache.Set("b", 2)
+				cache.Set("c", 3)
+				cache.Delete("b")
+				cache.Set("d", 4)
+			},
+			kept:    []string{"a", "c", "d"},
+			evicted: []string{"b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewCache[string, int](CacheConfig{MaxSize: 3})
+			test.actions(cache)
+
+			if cache.Len() != len(test.kept) {
+				t.Errorf("the cache holds %d values, want %d", cache.Len(), len(test.kept))
+			}
+			for _, key := range test.kept {
+				if _, isSet := cache.Get(key); !isSet {
+					t.Errorf("%s was evicted", key)
+				}
+			}
+			for _, key := range test.evicted {
+				if value, isSet := cache.Get(key); isSet {
+					t.Errorf("%s is still set to %d", key, value)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheExpiresValues(t *testing.T) {
+	cache := NewCache[string, int](CacheConfig{TTL: 100 * time.Millisecond})
+	cache.Set("old", 1)
+	time.Sleep(60 * time.Millisecond)
+	cache.Set("new", 2)
+	time.Sleep(60 * time.Millisecond)
+
+	if value, isSet := cache.Get("old"); isSet {
+		t.Errorf("the expired value is still set to %d", value)
+	}
+	if value, isSet := cache.Get("new"); !isSet || value != 2 {
+		t.Errorf("got %d, %t for the value not expired yet, want 2", value, isSet)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("the cache holds %d values once the expired one is looked up, want 1", cache.Len())
+	}
+
+	// setting a value again restarts its time to live.
+	time.Sleep(60 * time.Millisecond)
+	cache.Set("new", 3)
+	time.Sleep(60 * time.Millisecond)
+	if value, isSet := cache.Get("new"); !isSet || value != 3 {
+		t.Errorf("got %d, %t for the value set again, want 3", value, isSet)
+	}
+}
+
+func TestCacheStaleValues(t *testing.T) {
+	cache := NewCache[string, int](CacheConfig{})
+	cache.Set("a", 1)
+	cache.MarkStale("a", "unknown")
+
+	if _, isSet := cache.Get("a"); isSet {
+		t.Error("the stale value is reported as set")
+	}
+	cache.Set("a", 2)
+	if value, isSet := cache.Get("a"); !isSet || value != 2 {
+		t.Errorf("got %d, %t once set again, want 2", value, isSet)
+	}
+}
+
+func TestCandleSeriesCache(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	hour := func(h int) time.Time { return start.Add(time.Duration(h) * time.Hour) }
+	candle := func(h int, price int64) environment.CandleStick {
+		return environment.CandleStick{CandleTime: hour(h), Close: decimal.NewFromInt(price)}
+	}
+	market := &environment.Market{Name: "ETH-USD"}
+
+	tests := []struct {
+		name       string
+		maxCandles int
+		inserts    [][]environment.CandleStick
+		start, end int // hours of the range read.
+		want       []int64
+	}{
+		{
+			name:    "appends in time order",
+			inserts: [][]environment.CandleStick{{candle(0, 10), candle(1, 11)}, {candle(2, 12)}},
+			start:   0, end: 3,
+			want: []int64{10, 11, 12},
+		},
+		{
+			name:    "sorts unsorted candles",
+			inserts: [][]environment.CandleStick{{candle(2, 12), candle(0, 10)}, {candle(1, 11)}},
+			start:   0, end: 3,
+			want: []int64{10, 11, 12},
+		},
+		{
+			name:    "replaces candles of the same time",
+			inserts: [][]environment.CandleStick{{candle(0, 10), candle(1, 11)}, {candle(1, 21)}},
+			start:   0, end: 2,
+			want: []int64{10, 21},
+		},
+		{
+			name:    "range is half open",
+			inserts: [][]environment.CandleStick{{candle(0, 10), candle(1, 11), candle(2, 12), candle(3, 13)}},
+			start:   1, end: 3,
+			want: []int64{11, 12},
+		},
+		{
+			name:    "range without candles",
+			inserts: [][]environment.CandleStick{{candle(0, 10)}},
+			start:   5, end: 7,
+			want: []int64{},
+		},
+		{
+			name:       "keeps the newest candles",
+			maxCandles: 2,
+			inserts:    [][]environment.CandleStick{{candle(0, 10), candle(1, 11)}, {candle(2, 12)}},
+			start:      0, end: 3,
+			want: []int64{11, 12},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewCandleSeriesCache(0, test.maxCandles)
+			for _, candles := range test.inserts {
+				cache.Insert(market, candles)
+			}
+
+			candles := cache.Range(market, hour(test.start), hour(test.end))
+			if len(candles) != len(test.want) {
+				t.Fatalf("got %d candles, want %d", len(candles), len(test.want))
+			}
+			for i, candle := range candles {
+				if !candle.Close.Equal(decimal.NewFromInt(test.want[i])) {
+					t.Errorf("candle %d closes at %s at %s, want %d", i, candle.Close, candle.CandleTime, test.want[i])
+				}
+			}
+		})
+	}
+
+	cache := NewCandleSeriesCache(1, 0)
+	cache.Insert(market, []environment.CandleStick{candle(0, 10)})
+	if got, isSet := cache.At(market, hour(0)); !isSet || !got.Close.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("got %v, %t at hour 0, want the candle closing at 10", got, isSet)
+	}
+	if _, isSet := cache.At(market, hour(1)); isSet {
+		t.Error("got a candle at an hour without one")
+	}
+	cache.Insert(&environment.Market{Name: "BTC-USD"}, []environment.CandleStick{candle(0, 40000)})
+	if _, isSet := cache.At(market, hour(0)); isSet {
+		t.Error("the candles of the least recently used market were kept beyond the market limit")
+	}
+}
@@ -0,0 +1,187 @@
+package exchanges
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+)
+
+// ErrCassetteExhausted is the error representing when a replayed call has no recorded response left.
+var ErrCassetteExhausted = errors.New("cannot replay call: no recorded response left in cassette")
+
+// CassetteEntry represents a single exchange call as recorded in a cassette.
+type CassetteEntry struct {
+	Time     time.Time       `json:"time"`               // Time the call returned.
+	Exchange string          `json:"exchange"`           // Name of the exchange that served the call.
+	Method   string          `json:"method"`             // Name of the called wrapper method.
+	Args     json.RawMessage `json:"args"`               // Arguments of the call, markets are recorded by name.
+	Response json.RawMessage `json:"response,omitempty"` // Response of the call, if no error was returned.
+	Error    string          `json:"error,omitempty"`    // Error returned by the call, if any.
+}
+
+// CassetteRecorder writes exchange calls to a gzip compressed JSONL file, it can be shared by many RecordingWrappers.
+type CassetteRecorder struct {
+	mutex   *sync.Mutex
+	file    *os.File
+	writer  *gzip.Writer
+	encoder *json.Encoder
+}
+
+// NewCassetteRecorder creates the cassette file at the specified path, replacing any existing one.
+func NewCassetteRecorder(path string) (*CassetteRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := gzip.NewWriter(file)
+	return &CassetteRecorder{
+		mutex:   &sync.Mutex{},
+		file:    file,
+		writer:  writer,
+		encoder: json.NewEncoder(writer),
+	}, nil
+}
+
+// Record appends an entry to the cassette.
+func (recorder *CassetteRecorder) Record(entry CassetteEntry) error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if err := recorder.encoder.Encode(entry); err != nil {
+		return err
+	}
+	return recorder.writer.Flush()
+}
+
+// Close flushes the cassette and closes its file.
+func (recorder *CassetteRecorder) Close() error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if err := recorder.writer.Close(); err != nil {
+		recorder.file.Close()
+		return err
+	}
+	return recorder.file.Close()
+}
+
+// Cassette holds the recorded calls of a session, ready to be replayed.
+type Cassette struct {
+	mutex   *sync.Mutex
+	entries map[string][]*replayEntry // recorded entries by exchange and method, in call order.
+}
+
+// replayEntry represents a recorded entry and whether it was already served.
+type replayEntry struct {
+	entry  CassetteEntry
+	served bool
+}
+
+// LoadCassette reads a cassette written by a CassetteRecorder.
+func LoadCassette(path string) (*Cassette, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	cassette := &Cassette{
+		mutex:   &sync.Mutex{},
+		entries: make(map[string][]*replayEntry),
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(reader))
+	for {
+		var entry CassetteEntry
+		err := decoder.Decode(&entry)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// a cassette whose recording was interrupted is still valid up to its last complete entry.
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		key := cassetteKey(entry.Exchange, entry.Method)
+		cassette.entries[key] = append(cassette.entries[key], &replayEntry{entry: entry})
+	}
+
+	return cassette, nil
+}
+
+// Next returns the first unserved entry of a method recorded with the same arguments.
+//
+//	NOTE: when no entry matches the arguments (e.g. time ranges computed from the current time) the first unserved entry of the method is returned.
+func (cassette *Cassette) Next(exchange string, method string, args json.RawMessage) (CassetteEntry, error) {
+	cassette.mutex.Lock()
+	defer cassette.mutex.Unlock()
+
+	var fallback *replayEntry
+	for _, recorded := range cassette.entries[cassetteKey(exchange, method)] {
+		if recorded.served {
+			continue
+		}
+		if fallback == nil {
+			fallback = recorded
+		}
+		if string(recorded.entry.Args) == string(args) {
+			recorded.served = true
+			return recorded.entry, nil
+		}
+	}
+
+	if fallback == nil {
+		return CassetteEntry{}, ErrCassetteExhausted
+	}
+	fallback.served = true
+	return fallback.entry, nil
+}
+
+// cassetteKey gets the key of the recorded entries of a method.
+func cassetteKey(exchange string, method string) string {
+	return exchange + "." + method
+}
+
+// cassetteArgs encodes the arguments of a call, replacing markets with their names so that they do not depend on pointers.
+func cassetteArgs(args ...interface{}) json.RawMessage {
+	for i, arg := range args {
+		switch value := arg.(type) {
+		case *environment.Market:
+			args[i] = marketName(value)
+		case []*environment.Market:
+			names := make([]string, len(value))
+			for j, market := range value {
+				names[j] = marketName(market)
+			}
+			args[i] = names
+		}
+	}
+
+	encoded, err := json.Marshal(args)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	return encoded
+}
+
+// marketName gets the name of a market, if any.
+func marketName(market *environment.Market) string {
+	if market == nil {
+		return ""
+	}
+	return market.Name
+}
@@ -0,0 +1,101 @@
+package exchanges
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// cassetteCall is a call made on the recording wrapper, then on the replay wrapper.
+type cassetteCall struct {
+	name string
+	call func(wrapper ExchangeWrapper) (interface{}, error)
+}
+
+func TestCassetteRoundTrip(t *testing.T) {
+	market, btc := syntheticMarket("ETH-USD"), syntheticMarket("BTC-USD")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	calls := []cassetteCall{
+		{"historical candles", func(wrapper ExchangeWrapper) (interface{}, error) {
+			return wrapper.GetHistoricalCandles(market, start, start.Add(6*time.Hour), 60)
+		}},
+		{"historical candles of another market", func(wrapper ExchangeWrapper) (interface{}, error) {
+			return wrapper.GetHistoricalCandles(btc, start, start.Add(6*time.Hour), 60)
+		}},
+		{"historical trades", func(wrapper ExchangeWrapper) (interface{}, error) {
+			return wrapper.GetHistoricalTrades(market, start, start.Add(2*time.Hour))
+		}},
+		{"ticker", func(wrapper ExchangeWrapper) (interface{}, error) {
+			return wrapper.GetTicker(market)
+		}},
+		{"orderbook", func(wrapper ExchangeWrapper) (interface{}, error) {
+			return wrapper.GetOrderBook(market)
+		}},
+		{"market summaries", func(wrapper ExchangeWrapper) (interface{}, error) {
+			return wrapper.GetMarketSummaries([]*environment.Market{market, btc})
+		}},
+		{"trading fees", func(wrapper ExchangeWrapper) (interface{}, error) {
+			return wrapper.CalculateTradingFees(market, decimal.NewFromInt(2), decimal.NewFromInt(2000), environment.Buy), nil
+		}},
+		{"order", func(wrapper ExchangeWrapper) (interface{}, error) {
+			return wrapper.BuyLimit(market, decimal.NewFromInt(1), decimal.NewFromInt(1900))
+		}},
+	}
+
+	path := filepath.Join(t.TempDir(), "session.jsonl.gz")
+	recorder, err := NewCassetteRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recording := NewRecordingWrapper(NewSyntheticWrapper(syntheticConfig(1), nil), recorder)
+
+	responses := make([]interface{}, len(calls))
+	errs := make([]error, len(calls))
+	for i, call := range calls {
+		responses[i], errs[i] = call.call(recording)
+		if errs[i] != nil && i < len(calls)-1 {
+			t.Fatalf("recorded %s: %s", call.name, errs[i])
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay := NewReplayWrapper("synthetic", cassette, nil)
+
+	// the calls are replayed in reverse order, to check that responses are matched by arguments.
+	for i := len(calls) - 1; i >= 0; i-- {
+		call := calls[i]
+		t.Run(call.name, func(t *testing.T) {
+			response, err := call.call(replay)
+			if !errors.Is(err, errs[i]) {
+				t.Fatalf("replayed error %v, recorded %v", err, errs[i])
+			}
+			if err != nil {
+				return
+			}
+			replayed, _ := json.Marshal(response)
+			recorded, _ := json.Marshal(responses[i])
+			if string(replayed) != string(recorded) {
+				t.Errorf("replayed %s, recorded %s", replayed, recorded)
+			}
+		})
+	}
+
+	if !errors.Is(errs[len(calls)-1], ErrReadOnlyExchange) {
+		t.Errorf("recorded order error %v, want %v", errs[len(calls)-1], ErrReadOnlyExchange)
+	}
+	if _, err := replay.GetTicker(market); !errors.Is(err, ErrCassetteExhausted) {
+		t.Errorf("got error %v replaying a call made once more than recorded, want %v", err, ErrCassetteExhausted)
+	}
+}
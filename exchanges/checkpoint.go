@@ -0,0 +1,170 @@
+package exchanges
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// Checkpointer is implemented by the simulated wrappers whose state can be saved and restored, to resume simulations.
+type Checkpointer interface {
+	Checkpoint(markets []*environment.Market) (*SimulatorState, error)
+	Restore(state *SimulatorState, markets []*environment.Market) error
+}
+
+// SimulatorState represents the state of a simulator and of its sub-accounts at a simulated time.
+type SimulatorState struct {
+	Time     time.Time      `json:"time"`
+	Accounts []AccountState `json:"accounts"` // State of the simulator, then of each sub-account in creation order.
+}
+
+// AccountState represents the funds, pending orders and trades of a simulated account.
+type AccountState struct {
+	Balances    map[string]decimal.Decimal     `json:"balances"`
+	Trades      map[string][]environment.Trade `json:"trades"`      // Trades by market name.
+	Withdrawals map[string]WithdrawalState     `json:"withdrawals"` // Withdrawals travelling to their destination, by id.
+	StopOrders  []RestingOrderState            `json:"stop_orders"` // Stop orders not triggered yet, in placement order.
+	OpenOrders  []RestingOrderState            `json:"open_orders"` // Resting limit orders, in placement order.
+	CashFlows   []environment.CashFlow         `json:"cash_flows"`  // Deposits and withdrawals received so far.
+}
+
+// WithdrawalState represents a simulated withdrawal which has not arrived yet.
+type WithdrawalState struct {
+	Coin    string          `json:"coin"`
+	Amount  decimal.Decimal `json:"amount"`
+	Arrival time.Time       `json:"arrival"`
+}
+
+// RestingOrderState represents a resting limit order or a pending stop order of a simulated account.
+type RestingOrderState struct {
+	ID        string                   `json:"id"`
+	Order     environment.OrderRequest `json:"order"`
+	Remaining decimal.Decimal          `json:"remaining"`
+}
+
+// Checkpoint saves the state of the simulator and of its sub-accounts, with the trades of the specified markets.
+func (wrapper *ExchangeWrapperSimulator) Checkpoint(markets []*environment.Market) (*SimulatorState, error) {
+	if wrapper.parent != nil {
+		return nil, errors.New("the state of a simulated sub-account is saved by its simulator")
+	}
+
+	state := &SimulatorState{Time: wrapper.GetCurrDate()}
+	for _, account := range append([]*ExchangeWrapperSimulator{wrapper}, wrapper.subAccounts...) {
+		state.Accounts = append(state.Accounts, account.accountState(markets))
+	}
+	return state, nil
+}
+
+// Restore restores a state saved by Checkpoint, the sub-accounts of the simulator being already created.
+func (wrapper *ExchangeWrapperSimulator) Restore(state *SimulatorState, markets []*environment.Market) error {
+	if wrapper.parent != nil {
+		return errors.New("the state of a simulated sub-account is restored by its simulator")
+	}
+	accounts := append([]*ExchangeWrapperSimulator{wrapper}, wrapper.subAccounts...)
+	if len(state.Accounts) != len(accounts) {
+		return fmt.Errorf("the saved state has %d accounts, the simulator has %d", len(state.Accounts), len(accounts))
+	}
+	if wrapper.historicalSimulation && (state.Time.Before(*wrapper.startDate) || state.Time.After(*wrapper.endDate)) {
+		return fmt.Errorf("the saved state at %s is out of the simulated dates", state.Time)
+	}
+
+	byName := make(map[string]*environment.Market, len(markets))
+	for _, market := range markets {
+		byName[market.Name] = market
+	}
+	for i, account := range accounts {
+		if err := account.restoreAccount(state.Accounts[i], byName); err != nil {
+			return err
+		}
+		account.nextCashFlow = sort.Search(len(account.cashFlows), func(j int) bool {
+			return account.cashFlows[j].Time.After(state.Time)
+		})
+	}
+	if wrapper.historicalSimulation {
+		wrapper.clock.Set(state.Time)
+	}
+	return nil
+}
+
+// accountState saves the funds, orders and trades of the account.
+func (wrapper *ExchangeWrapperSimulator) accountState(markets []*environment.Market) AccountState {
+	state := AccountState{
+		Balances:    make(map[string]decimal.Decimal, len(wrapper.balances)),
+		Trades:      make(map[string][]environment.Trade),
+		Withdrawals: make(map[string]WithdrawalState, len(wrapper.withdrawals)),
+		CashFlows:   append([]environment.CashFlow(nil), wrapper.received...),
+	}
+	for coin, balance := range wrapper.balances {
+		state.Balances[coin] = balance
+	}
+	for _, market := range markets {
+		if tradeBook, isSet := wrapper.trades.Get(market); isSet {
+			state.Trades[market.Name] = append([]environment.Trade(nil), tradeBook.Trades...)
+		}
+	}
+	for id, withdrawal := range wrapper.withdrawals {
+		state.Withdrawals[id] = WithdrawalState{Coin: withdrawal.coin, Amount: withdrawal.amount, Arrival: withdrawal.arrival}
+	}
+	for _, stop := range wrapper.stopOrders {
+		state.StopOrders = append(state.StopOrders, RestingOrderState{ID: stop.id, Order: stop.order, Remaining: stop.remaining})
+	}
+	for _, resting := range wrapper.openOrders {
+		state.OpenOrders = append(state.OpenOrders, RestingOrderState{ID: resting.id, Order: resting.order, Remaining: resting.remaining})
+	}
+	return state
+}
+
+// restoreAccount replaces the funds, orders and trades of the account, binding them to the markets by name.
+func (wrapper *ExchangeWrapperSimulator) restoreAccount(state AccountState, markets map[string]*environment.Market) error {
+	bind := func(order environment.OrderRequest) (environment.OrderRequest, error) {
+		if order.Market == nil || markets[order.Market.Name] == nil {
+			return order, errors.New("the saved state has an order on an unknown market")
+		}
+		order.Market = markets[order.Market.Name]
+		return order, nil
+	}
+
+	wrapper.balances = make(map[string]decimal.Decimal, len(state.Balances))
+	for coin, balance := range state.Balances {
+		wrapper.balances[coin] = balance
+	}
+
+	wrapper.trades = NewTradeBookCache()
+	for name, trades := range state.Trades {
+		market, exists := markets[name]
+		if !exists {
+			return errors.New("the saved state has trades on unknown market " + name)
+		}
+		wrapper.trades.Set(market, &environment.TradeBook{Trades: append([]environment.Trade(nil), trades...)})
+	}
+
+	wrapper.received = append([]environment.CashFlow(nil), state.CashFlows...)
+
+	wrapper.withdrawals = make(map[string]*simulatedWithdrawal, len(state.Withdrawals))
+	for id, withdrawal := range state.Withdrawals {
+		wrapper.withdrawals[id] = &simulatedWithdrawal{coin: withdrawal.Coin, amount: withdrawal.Amount, arrival: withdrawal.Arrival}
+	}
+
+	wrapper.stopOrders = nil
+	for _, stop := range state.StopOrders {
+		bound, err := bind(stop.Order)
+		if err != nil {
+			return err
+		}
+		wrapper.stopOrders = append(wrapper.stopOrders, &restingOrder{id: stop.ID, order: bound, remaining: stop.Remaining})
+	}
+
+	wrapper.openOrders = nil
+	for _, resting := range state.OpenOrders {
+		bound, err := bind(resting.Order)
+		if err != nil {
+			return err
+		}
+		wrapper.openOrders = append(wrapper.openOrders, &restingOrder{id: resting.ID, order: bound, remaining: resting.Remaining})
+	}
+	return nil
+}
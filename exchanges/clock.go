@@ -0,0 +1,34 @@
+package exchanges
+
+import "github.com/mcwarner5/BlockBot8000/environment"
+
+// ClockProvider is implemented by the wrappers whose time is not the wall clock.
+type ClockProvider interface {
+	Clock() environment.Clock
+}
+
+// Stepper is implemented by the wrappers driving a simulated clock, which must be stepped between the strategy updates.
+type Stepper interface {
+	IncrementCurrDate() error
+}
+
+// SubAccountProvider is implemented by the simulated wrappers able to give each strategy its own balances.
+type SubAccountProvider interface {
+	SubAccount() ExchangeWrapper
+}
+
+// CashFlowProvider is implemented by the simulated wrappers receiving deposits and withdrawals from outside of the
+// portfolio, which are not gains nor losses of the strategies.
+type CashFlowProvider interface {
+	CashFlows() []environment.CashFlow
+}
+
+// ClockOf gets the clock of the first wrapper providing one, the wall clock if none does.
+func ClockOf(wrappers ...ExchangeWrapper) environment.Clock {
+	for _, wrapper := range wrappers {
+		if provider, ok := wrapper.(ClockProvider); ok {
+			return provider.Clock()
+		}
+	}
+	return environment.RealClock{}
+}
@@ -16,11 +16,19 @@
 package exchanges
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -28,20 +36,31 @@ import (
 	client "github.com/mcwarner5/BlockBot8000/libraries/coinbase-adv/client"
 	"github.com/mcwarner5/BlockBot8000/libraries/coinbase-adv/model"
 	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
 )
 
+// coinbaseV2URL is the base url of the coinbase v2 API, used for sends as the advanced trade API does not support them.
+const coinbaseV2URL = "https://api.coinbase.com"
+
 // coinbaseWrapper represents the wrapper for the coinbase exchange.
 type CoinbaseWrapper struct {
 	api              client.CoinbaseClient
+	publicKey        string
+	secretKey        string
 	summaries        *SummaryCache
 	candles          *CandlesCache
 	orderbook        *OrderbookCache
 	depositAddresses map[string]string
+	withdrawFees     map[string]decimal.Decimal
+	feed             *FeedSupervisor
+	events           *EventBus // tickers pushed by the feed.
 	websocketOn      bool
 }
 
 // NewCoinbaseWrapper creates a generic wrapper of the coinbase API.
-func NewCoinbaseWrapper(publicKey string, secretKey string, depositAddresses map[string]string) ExchangeWrapper {
+//
+//	NOTE: Coinbase does not quote network fees before a send, withdrawFees sets the fee expected for each coin.
+func NewCoinbaseWrapper(publicKey string, secretKey string, depositAddresses map[string]string, withdrawFees map[string]decimal.Decimal) ExchangeWrapper {
 	creds := client.Credentials{
 		ApiKey:      publicKey,
 		ApiSKey:     secretKey,
@@ -50,10 +69,14 @@ func NewCoinbaseWrapper(publicKey string, secretKey string, depositAddresses map
 
 	return &CoinbaseWrapper{
 		api:              client.NewClient(&creds),
+		publicKey:        publicKey,
+		secretKey:        secretKey,
 		summaries:        NewSummaryCache(),
 		candles:          NewCandlesCache(),
 		orderbook:        NewOrderbookCache(),
 		depositAddresses: depositAddresses,
+		withdrawFees:     withdrawFees,
+		events:           NewEventBus(),
 		websocketOn:      false,
 	}
 }
@@ -112,7 +135,8 @@ func (wrapper *CoinbaseWrapper) GetOrderBook(market *environment.Market) (*envir
 
 	orderbook, exists := wrapper.orderbook.Get(market)
 	if !exists {
-		return nil, errors.New("orderbook not loaded")
+		// the feed did not load the orderbook yet, or it is stale because the feed dropped.
+		return wrapper.orderbookFromREST(market)
 	}
 
 	return orderbook, nil
@@ -142,7 +166,7 @@ func (wrapper *CoinbaseWrapper) orderbookFromREST(market *environment.Market) (*
 		})
 	}
 
-	for _, bid := range pricebook.GetAsks() {
+	for _, bid := range pricebook.GetBids() {
 		qty := decimal.NewFromFloat(*bid.Size)
 		value := decimal.NewFromFloat(*bid.Price)
 
@@ -151,6 +175,10 @@ func (wrapper *CoinbaseWrapper) orderbookFromREST(market *environment.Market) (*
 			Value:    value,
 		})
 	}
+	orderBook.Sort()
+	if err := orderBook.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid coinbase order book of %s: %w", market.Name, err)
+	}
 
 	return &orderBook, nil
 }
@@ -298,6 +326,110 @@ func (wrapper *CoinbaseWrapper) SellMarket(market *environment.Market, amount de
 	return *orderResponse.OrderId, nil
 }
 
+// PlaceOrder places an order of any supported type and time in force.
+//
+//	NOTE: Coinbase does not support stop loss orders (use stop limit instead) nor immediate or cancel limit orders.
+func (wrapper *CoinbaseWrapper) PlaceOrder(order environment.OrderRequest) (string, error) {
+	if err := order.Validate(); err != nil {
+		return "", err
+	}
+
+	amount_str := order.Amount.String()
+	limit_str := order.LimitPrice.String()
+	stop_str := order.StopPrice.String()
+	order_confg := model.CreateOrderRequestOrderConfiguration{
+		MarketMarketIoc:       model.NewCreateOrderRequestOrderConfigurationMarketMarketIoc(),
+		LimitLimitGtc:         model.NewCreateOrderRequestOrderConfigurationLimitLimitGtc(),
+		LimitLimitGtd:         model.NewCreateOrderRequestOrderConfigurationLimitLimitGtd(),
+		StopLimitStopLimitGtc: model.NewCreateOrderRequestOrderConfigurationStopLimitStopLimitGtc(),
+		StopLimitStopLimitGtd: model.NewCreateOrderRequestOrderConfigurationStopLimitStopLimitGtd(),
+	}
+
+	stop_direction := "STOP_DIRECTION_STOP_DOWN"
+	if order.Side == environment.Buy {
+		stop_direction = "STOP_DIRECTION_STOP_UP"
+	}
+
+	switch {
+	case order.Type == environment.MarketPrice:
+		order_confg.MarketMarketIoc = &model.CreateOrderRequestOrderConfigurationMarketMarketIoc{
+			BaseSize: &amount_str,
+		}
+	case order.Type == environment.LimitOrder && order.TimeInForce == environment.GoodTillCanceled:
+		order_confg.LimitLimitGtc = &model.CreateOrderRequestOrderConfigurationLimitLimitGtc{
+			BaseSize:   &amount_str,
+			LimitPrice: &limit_str,
+			PostOnly:   model.PtrBool(order.PostOnly),
+		}
+	case order.Type == environment.LimitOrder && order.TimeInForce == environment.GoodTillDate:
+		order_confg.LimitLimitGtd = &model.CreateOrderRequestOrderConfigurationLimitLimitGtd{
+			BaseSize:   &amount_str,
+			LimitPrice: &limit_str,
+			EndTime:    &order.ExpireTime,
+			PostOnly:   model.PtrBool(order.PostOnly),
+		}
+	case order.Type == environment.StopLimitOrder && order.TimeInForce == environment.GoodTillCanceled:
+		order_confg.StopLimitStopLimitGtc = &model.CreateOrderRequestOrderConfigurationStopLimitStopLimitGtc{
+			BaseSize:      &amount_str,
+			LimitPrice:    &limit_str,
+			StopPrice:     &stop_str,
+			StopDirection: &stop_direction,
+		}
+	case order.Type == environment.StopLimitOrder && order.TimeInForce == environment.GoodTillDate:
+		order_confg.StopLimitStopLimitGtd = &model.CreateOrderRequestOrderConfigurationStopLimitStopLimitGtd{
+			BaseSize:      &amount_str,
+			LimitPrice:    &limit_str,
+			StopPrice:     &stop_str,
+			EndTime:       &order.ExpireTime,
+			StopDirection: &stop_direction,
+		}
+	default:
+		return "", ErrOrderNotSupported
+	}
+
+	client_order_id := order.ClientOrderID
+	if client_order_id == "" {
+		new_order_id, _ := uuid.NewV4()
+		client_order_id = new_order_id.String()
+	}
+	market_name := MarketNameFor(order.Market, wrapper)
+	side, _ := model.NewOrderSideFromValue(strings.ToUpper(order.Side.String()))
+
+	request := model.CreateOrderRequest{
+		ClientOrderId:      &client_order_id,
+		ProductId:          &market_name,
+		Side:               (*string)(side.Ptr()),
+		OrderConfiguration: &order_confg,
+	}
+
+	orderResponse, err := wrapper.api.CreateOrder(context.Background(), &request)
+	if err != nil {
+		return "", err
+	}
+	if orderResponse == nil || orderResponse.OrderId == nil || !(*orderResponse.Success) {
+		return "", errors.New(*orderResponse.FailureReason)
+	}
+	return *orderResponse.OrderId, nil
+}
+
+// CancelOrder cancels an open order.
+func (wrapper *CoinbaseWrapper) CancelOrder(market *environment.Market, side environment.TradeSide, orderID string) error {
+	response, err := wrapper.api.CancelOrders(context.Background(), &model.CancelOrdersRequest{OrderIds: []string{orderID}})
+	if err != nil {
+		return err
+	}
+	for _, result := range response.Results {
+		if result.Success != nil && !*result.Success {
+			reason := "unknown reason"
+			if result.FailureReason != nil {
+				reason = *result.FailureReason
+			}
+			return errors.New("cannot cancel order " + orderID + ": " + reason)
+		}
+	}
+	return nil
+}
+
 func (wrapper *CoinbaseWrapper) GetHistoricalTrades(market *environment.Market, start time.Time, end time.Time) (*environment.TradeBook, error) {
 	var params = client.ListProductsTickerHistoryParams{
 		ProductId: MarketNameFor(market, wrapper),
@@ -361,59 +493,74 @@ func (wrapper *CoinbaseWrapper) GetTicker(market *environment.Market) (*environm
 	}, nil
 }
 
+// GetMarketSummaries gets the current summaries of many markets, requesting them concurrently.
+func (wrapper *CoinbaseWrapper) GetMarketSummaries(markets []*environment.Market) ([]*environment.MarketSummary, error) {
+	return getMarketSummariesConcurrently(wrapper, markets)
+}
+
 // GetMarketSummary gets the current market summary.
 func (wrapper *CoinbaseWrapper) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
 	if !wrapper.websocketOn {
-
-		var candle_params = client.ListProductsCandlesParams{
-			Product:   MarketNameFor(market, wrapper),
-			StartTime: time.Now().Add(-2 * time.Minute),
-			EndTime:   time.Now(),
-			Interval:  1,
-		}
-
-		coinbaseCandles, err := wrapper.api.GetProductCandles(context.Background(), &candle_params)
+		ret, err := wrapper.summaryFromREST(market)
 		if err != nil {
 			return nil, err
 		}
-		curr_candles := coinbaseCandles.GetCandleSticks()
-		if len(curr_candles) == 0 {
-			return nil, errors.New("no Candles Found for Coinbase MarketSummary")
-		}
 
-		var params = client.ListProductsTickerHistoryParams{
-			ProductId: MarketNameFor(market, wrapper),
-		}
-		ticker, err := wrapper.api.ListProductsTickerHistory(context.Background(), &params)
-		if err != nil {
-			return nil, err
-		}
-
-		ask, _ := decimal.NewFromString(*ticker.Trades[0].Ask)
-		bid, _ := decimal.NewFromString(*ticker.Trades[0].Bid)
-		high, _ := decimal.NewFromString(*curr_candles[0].High)
-		low, _ := decimal.NewFromString(*curr_candles[0].Low)
-		last, _ := decimal.NewFromString(*curr_candles[0].Open)
-		volume := decimal.NewFromFloat(*ticker.Trades[0].Size)
-
-		wrapper.summaries.Set(market, &environment.MarketSummary{
-			Last:   last,
-			Ask:    ask,
-			Bid:    bid,
-			High:   high,
-			Low:    low,
-			Volume: volume,
-		})
+		wrapper.summaries.Set(market, ret)
+		return ret, nil
 	}
 
 	ret, summaryLoaded := wrapper.summaries.Get(market)
 	if !summaryLoaded {
-		return nil, errors.New("summary not loaded")
+		// the feed did not load the summary yet, or it is stale because the feed dropped.
+		return wrapper.summaryFromREST(market)
 	}
 
 	return ret, nil
 }
 
+func (wrapper *CoinbaseWrapper) summaryFromREST(market *environment.Market) (*environment.MarketSummary, error) {
+	var candle_params = client.ListProductsCandlesParams{
+		Product:   MarketNameFor(market, wrapper),
+		StartTime: time.Now().Add(-2 * time.Minute),
+		EndTime:   time.Now(),
+		Interval:  1,
+	}
+
+	coinbaseCandles, err := wrapper.api.GetProductCandles(context.Background(), &candle_params)
+	if err != nil {
+		return nil, err
+	}
+	curr_candles := coinbaseCandles.GetCandleSticks()
+	if len(curr_candles) == 0 {
+		return nil, errors.New("no Candles Found for Coinbase MarketSummary")
+	}
+
+	var params = client.ListProductsTickerHistoryParams{
+		ProductId: MarketNameFor(market, wrapper),
+	}
+	ticker, err := wrapper.api.ListProductsTickerHistory(context.Background(), &params)
+	if err != nil {
+		return nil, err
+	}
+
+	ask, _ := decimal.NewFromString(*ticker.Trades[0].Ask)
+	bid, _ := decimal.NewFromString(*ticker.Trades[0].Bid)
+	high, _ := decimal.NewFromString(*curr_candles[0].High)
+	low, _ := decimal.NewFromString(*curr_candles[0].Low)
+	last, _ := decimal.NewFromString(*curr_candles[0].Open)
+	volume := decimal.NewFromFloat(*ticker.Trades[0].Size)
+
+	return &environment.MarketSummary{
+		Last:   last,
+		Ask:    ask,
+		Bid:    bid,
+		High:   high,
+		Low:    low,
+		Volume: volume,
+	}, nil
+}
+
 func (wrapper *CoinbaseWrapper) GetHistoricalCandles(market *environment.Market, start time.Time, end time.Time, interval int) ([]environment.CandleStick, error) {
 	var params = client.ListProductsCandlesParams{
 		Product:   MarketNameFor(market, wrapper),
@@ -427,8 +574,11 @@ func (wrapper *CoinbaseWrapper) GetHistoricalCandles(market *environment.Market,
 		return nil, err
 	}
 
-	coinbaseCandles := response.GetCandleSticks()
+	return coinbaseCandleSticks(response.GetCandleSticks()), nil
+}
 
+// coinbaseCandleSticks converts the candles of the exchange, which are sent newest first, to candles in time order.
+func coinbaseCandleSticks(coinbaseCandles []model.Candle) []environment.CandleStick {
 	sort.Slice(coinbaseCandles, func(i, j int) bool {
 		m_t_u_str, _ := strconv.ParseInt(*coinbaseCandles[i].Start, 10, 64)
 		o_t_u_str, _ := strconv.ParseInt(*coinbaseCandles[j].Start, 10, 64)
@@ -458,50 +608,26 @@ func (wrapper *CoinbaseWrapper) GetHistoricalCandles(market *environment.Market,
 		}
 	}
 
-	return ret, nil
+	return ret
 }
 
 // GetCandles gets the candle data from the exchange.
 func (wrapper *CoinbaseWrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
-	if !wrapper.websocketOn {
-		var params = client.ListProductsCandlesParams{
-			Product:   MarketNameFor(market, wrapper),
-			StartTime: time.Now().Add(-24 * time.Hour),
-			EndTime:   time.Now(),
-			Interval:  1,
-		}
-
-		coinbaseCandles, err := wrapper.api.GetProductCandles(context.Background(), &params)
-		if err != nil {
-			return nil, err
-		}
-
-		ret := make([]environment.CandleStick, len(coinbaseCandles.CandleSticks))
-
-		for i, coinbaseCandle := range coinbaseCandles.GetCandleSticks() {
-			high, _ := decimal.NewFromString(*coinbaseCandle.High)
-			open, _ := decimal.NewFromString(*coinbaseCandle.Open)
-			close, _ := decimal.NewFromString(*coinbaseCandle.Close)
-			low, _ := decimal.NewFromString(*coinbaseCandle.Low)
-			volume, _ := decimal.NewFromString(*coinbaseCandle.Volume)
-
-			ret[i] = environment.CandleStick{
-				High:   high,
-				Open:   open,
-				Close:  close,
-				Low:    low,
-				Volume: volume,
-			}
-		}
-
-		wrapper.candles.Set(market, ret)
+	// the feed carries no candles, so they are always requested.
+	var params = client.ListProductsCandlesParams{
+		Product:   MarketNameFor(market, wrapper),
+		StartTime: time.Now().Add(-24 * time.Hour),
+		EndTime:   time.Now(),
+		Interval:  1,
 	}
 
-	ret, candleLoaded := wrapper.candles.Get(market)
-	if !candleLoaded {
-		return nil, errors.New("no candle data yet")
+	response, err := wrapper.api.GetProductCandles(context.Background(), &params)
+	if err != nil {
+		return nil, err
 	}
 
+	ret := coinbaseCandleSticks(response.GetCandleSticks())
+	wrapper.candles.Set(market, ret)
 	return ret, nil
 }
 
@@ -525,6 +651,113 @@ func (wrapper *CoinbaseWrapper) GetBalance(symbol string) (*decimal.Decimal, err
 	return nil, errors.New("symbol not found")
 }
 
+// GetAccountSnapshot gets all the balances and open orders of the account.
+func (wrapper *CoinbaseWrapper) GetAccountSnapshot() (*environment.AccountSnapshot, error) {
+	snapshot := environment.NewAccountSnapshot(time.Now())
+
+	accountParams := client.ListAccountsParams{
+		Limit: client.MaxLimit,
+	}
+	for {
+		accounts, err := wrapper.api.ListAccounts(context.Background(), &accountParams)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, account := range accounts.Accounts {
+			if account.Currency == nil {
+				continue
+			}
+			available, hold := decimal.Zero, decimal.Zero
+			if account.AvailableBalance != nil && account.AvailableBalance.Value != nil {
+				available = decimal.NewFromFloat(*account.AvailableBalance.Value)
+			}
+			if account.Hold != nil && account.Hold.Value != nil {
+				hold = decimal.NewFromFloat(*account.Hold.Value)
+			}
+			snapshot.SetBalance(*account.Currency, environment.AssetBalance{
+				Total:     available.Add(hold),
+				Available: available,
+				Hold:      hold,
+			})
+		}
+
+		if accounts.HasNext == nil || !*accounts.HasNext || accounts.Cursor == nil {
+			break
+		}
+		accountParams.Cursor = *accounts.Cursor
+	}
+
+	orderParams := client.ListOrdersParams{
+		OrderStatus: []string{"OPEN"},
+		Limit:       client.MaxLimit,
+	}
+	for {
+		orders, err := wrapper.api.ListOrders(context.Background(), &orderParams)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, order := range orders.Orders {
+			snapshot.OpenOrders = append(snapshot.OpenOrders, coinbaseOpenOrder(order))
+		}
+
+		if orders.HasNext == nil || !*orders.HasNext || orders.Cursor == nil {
+			break
+		}
+		orderParams.Cursor = *orders.Cursor
+	}
+
+	return snapshot, nil
+}
+
+// coinbaseOpenOrder converts an open coinbase order to a pending trade.
+func coinbaseOpenOrder(order model.Order) environment.Trade {
+	trade := environment.Trade{
+		Status: environment.Pending,
+		Type:   environment.LimitOrder,
+		Side:   environment.Buy,
+	}
+	if order.OrderId != nil {
+		trade.TradeNumber = *order.OrderId
+	}
+	if order.ProductId != nil {
+		trade.Market = *order.ProductId
+	}
+	if order.Side != nil && *order.Side == "SELL" {
+		trade.Side = environment.Sell
+	}
+	if order.FilledSize != nil {
+		trade.FillQuantity, _ = decimal.NewFromString(*order.FilledSize)
+	}
+	if order.TotalFees != nil {
+		trade.Fees, _ = decimal.NewFromString(*order.TotalFees)
+	}
+	if order.CreatedTime != nil {
+		trade.Timestamp = *order.CreatedTime
+	}
+
+	if config := order.OrderConfiguration; config != nil {
+		switch {
+		case config.LimitLimitGtc != nil && config.LimitLimitGtc.BaseSize != nil:
+			trade.AskQuantity, _ = decimal.NewFromString(*config.LimitLimitGtc.BaseSize)
+			trade.Price, _ = decimal.NewFromString(*config.LimitLimitGtc.LimitPrice)
+		case config.LimitLimitGtd != nil && config.LimitLimitGtd.BaseSize != nil:
+			trade.AskQuantity, _ = decimal.NewFromString(*config.LimitLimitGtd.BaseSize)
+			trade.Price, _ = decimal.NewFromString(*config.LimitLimitGtd.LimitPrice)
+		case config.StopLimitStopLimitGtc != nil && config.StopLimitStopLimitGtc.BaseSize != nil:
+			trade.Type = environment.StopLimitOrder
+			trade.AskQuantity, _ = decimal.NewFromString(*config.StopLimitStopLimitGtc.BaseSize)
+			trade.Price, _ = decimal.NewFromString(*config.StopLimitStopLimitGtc.LimitPrice)
+		case config.StopLimitStopLimitGtd != nil && config.StopLimitStopLimitGtd.BaseSize != nil:
+			trade.Type = environment.StopLimitOrder
+			trade.AskQuantity, _ = decimal.NewFromString(*config.StopLimitStopLimitGtd.BaseSize)
+			trade.Price, _ = decimal.NewFromString(*config.StopLimitStopLimitGtd.LimitPrice)
+		}
+	}
+	return trade
+}
+
 // GetDepositAddress gets the deposit address for the specified coin on the exchange.
 func (wrapper *CoinbaseWrapper) GetDepositAddress(coinTicker string) (string, bool) {
 	addr, exists := wrapper.depositAddresses[coinTicker]
@@ -557,18 +790,147 @@ func (wrapper *CoinbaseWrapper) CalculateTradingFees(market *environment.Market,
 }
 
 // CalculateWithdrawFees calculates the withdrawal fees on a specified market.
+//
+//	NOTE: Coinbase does not quote network fees before a send, the fee configured for the market base currency is used.
 func (wrapper *CoinbaseWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) decimal.Decimal {
-	panic("CalculateWithdrawFees Not Implemented for Coinbase wrapper yet")
+	fee, exists := wrapper.withdrawFees[market.BaseCurrency]
+	if !exists {
+		logrus.Warn("no coinbase withdrawal fee configured for " + market.BaseCurrency + ", assuming none")
+		return decimal.Zero
+	}
+	return fee
 }
 
-// FeedConnect connects to the feed of the exchange.
+// FeedConnect connects to the ticker feed of the exchange, which keeps the summaries of the markets updated until the
+// bot exits.
 func (wrapper *CoinbaseWrapper) FeedConnect(markets []*environment.Market) error {
-	panic("FeedConnect Not supported on Coinbase wrapper yet")
+	if wrapper.feed != nil {
+		return errors.New("feed of coinbase already connected")
+	}
+
+	feed := NewFeedSupervisor(wrapper.Name(), newCoinbaseFeed(wrapper), FeedSupervisorConfig{}, wrapper.summaries)
+	if err := feed.Start(markets); err != nil {
+		return err
+	}
+	wrapper.feed = feed
+	wrapper.websocketOn = true
+	return nil
+}
+
+// FeedHealth returns the health of the feed of the exchange, if connected.
+func (wrapper *CoinbaseWrapper) FeedHealth() (FeedHealth, bool) {
+	if wrapper.feed == nil {
+		return FeedHealth{}, false
+	}
+	return wrapper.feed.FeedHealth(), true
+}
+
+// FeedEventKinds returns the kinds of the events pushed by the feed of the exchange: the tickers, once connected.
+func (wrapper *CoinbaseWrapper) FeedEventKinds() environment.EventKinds {
+	if wrapper.feed == nil {
+		return environment.EventKinds{}
+	}
+	return environment.EventKinds{environment.TickerEvent: true}
+}
+
+// SubscribeEvents returns the events of the specified kinds and markets pushed by the feed of the exchange, until the
+// returned function is called.
+func (wrapper *CoinbaseWrapper) SubscribeEvents(markets []*environment.Market, kinds environment.EventKinds) (<-chan environment.Event, func()) {
+	return wrapper.events.SubscribeEvents(markets, kinds)
+}
+
+// coinbaseTransaction is the subset of a coinbase v2 transaction used by the wrapper.
+type coinbaseTransaction struct {
+	Data struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	} `json:"data"`
 }
 
 // Withdraw performs a withdraw operation from the exchange to a destination address.
-func (wrapper *CoinbaseWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
-	panic("subscribeOrderbookFeed Not supported on Coinbase wrapper yet")
+//
+//	NOTE: Coinbase charges the network fee on top of the amount sent, so the configured fee is sent less to withdraw
+//	amount in total, fees included, like the other exchanges.
+func (wrapper *CoinbaseWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) (string, error) {
+	sent := amount.Sub(wrapper.CalculateWithdrawFees(&environment.Market{Name: coinTicker, BaseCurrency: coinTicker}, amount))
+	if !sent.IsPositive() {
+		return "", fmt.Errorf("cannot withdraw %s %s: it does not cover the withdrawal fee", amount.String(), coinTicker)
+	}
+
+	idem, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"type":     "send",
+		"to":       destinationAddress,
+		"amount":   sent.String(),
+		"currency": strings.ToUpper(coinTicker),
+		"idem":     idem.String(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var transaction coinbaseTransaction
+	path := fmt.Sprintf("/v2/accounts/%s/transactions", strings.ToUpper(coinTicker))
+	if err := wrapper.v2Request(http.MethodPost, path, body, &transaction); err != nil {
+		return "", err
+	}
+
+	return transaction.Data.ID, nil
+}
+
+// GetWithdrawStatus gets the status of a withdrawal previously made with Withdraw.
+func (wrapper *CoinbaseWrapper) GetWithdrawStatus(coinTicker string, withdrawalID string) (environment.TransferStatus, error) {
+	var transaction coinbaseTransaction
+	path := fmt.Sprintf("/v2/accounts/%s/transactions/%s", strings.ToUpper(coinTicker), withdrawalID)
+	if err := wrapper.v2Request(http.MethodGet, path, nil, &transaction); err != nil {
+		return environment.TransferPending, err
+	}
+
+	switch transaction.Data.Status {
+	case "completed":
+		return environment.TransferComplete, nil
+	case "failed", "canceled", "expired":
+		return environment.TransferFailed, nil
+	default:
+		return environment.TransferPending, nil
+	}
+}
+
+// v2Request performs a signed request against the coinbase v2 API and decodes the response into result.
+func (wrapper *CoinbaseWrapper) v2Request(method string, path string, body []byte, result interface{}) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(wrapper.secretKey))
+	mac.Write([]byte(timestamp + method + path + string(body)))
+
+	request, err := http.NewRequest(method, coinbaseV2URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("CB-ACCESS-KEY", wrapper.publicKey)
+	request.Header.Set("CB-ACCESS-SIGN", hex.EncodeToString(mac.Sum(nil)))
+	request.Header.Set("CB-ACCESS-TIMESTAMP", timestamp)
+	request.Header.Set("CB-VERSION", "2024-01-01")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("coinbase %s %s failed with status %d: %s", method, path, response.StatusCode, string(content))
+	}
+
+	return json.Unmarshal(content, result)
 }
 
 func (wrapper *CoinbaseWrapper) IsHistoricalSimulation() bool {
@@ -0,0 +1,157 @@
+package exchanges
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/dgrr/fastws"
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// coinbaseFeedURL is the url of the market data websocket of the coinbase advanced trade API.
+const coinbaseFeedURL = "wss://advanced-trade-ws.coinbase.com"
+
+// coinbaseFeed represents the ticker feed of coinbase, updating the summaries of the wrapper and publishing its tickers.
+//
+//	NOTE: the ticker and heartbeats channels are public, so the feed needs no credentials. The heartbeats channel sends a
+//	message every second, which keeps the heartbeat deadline of the supervisor even when the markets are quiet.
+type coinbaseFeed struct {
+	wrapper *CoinbaseWrapper
+	mutex   *sync.Mutex
+	conn    *fastws.Conn
+	markets map[string][]*environment.Market // subscribed markets, by product id.
+}
+
+// coinbaseSubscription represents a subscription request to a channel of the coinbase feed.
+type coinbaseSubscription struct {
+	Type       string   `json:"type"`
+	ProductIDs []string `json:"product_ids"`
+	Channel    string   `json:"channel"`
+}
+
+// coinbaseFeedMessage represents the subset of a message of the coinbase feed used by the wrapper.
+type coinbaseFeedMessage struct {
+	Channel string `json:"channel"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Events  []struct {
+		Tickers []coinbaseFeedTicker `json:"tickers"`
+	} `json:"events"`
+}
+
+// coinbaseFeedTicker represents a ticker of the coinbase feed.
+type coinbaseFeedTicker struct {
+	ProductID string `json:"product_id"`
+	Price     string `json:"price"`
+	Volume    string `json:"volume_24_h"`
+	Low       string `json:"low_24_h"`
+	High      string `json:"high_24_h"`
+	BestBid   string `json:"best_bid"`
+	BestAsk   string `json:"best_ask"`
+}
+
+func newCoinbaseFeed(wrapper *CoinbaseWrapper) *coinbaseFeed {
+	return &coinbaseFeed{
+		wrapper: wrapper,
+		mutex:   &sync.Mutex{},
+	}
+}
+
+// Connect opens the websocket of the coinbase feed.
+func (feed *coinbaseFeed) Connect() error {
+	conn, err := fastws.Dial(coinbaseFeedURL)
+	if err != nil {
+		return err
+	}
+
+	feed.mutex.Lock()
+	feed.conn = conn
+	feed.mutex.Unlock()
+	return nil
+}
+
+// Subscribe subscribes to the ticker of the markets, and to the heartbeats of the feed.
+func (feed *coinbaseFeed) Subscribe(markets []*environment.Market) error {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	names, byName := feedMarkets(feed.wrapper, markets)
+	feed.markets = byName
+	for _, channel := range []string{"ticker", "heartbeats"} {
+		request, err := json.Marshal(coinbaseSubscription{Type: "subscribe", ProductIDs: names, Channel: channel})
+		if err != nil {
+			return err
+		}
+		if _, err := feed.conn.Write(request); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read blocks until the next message, applying tickers to the summaries and the events of the wrapper.
+func (feed *coinbaseFeed) Read() error {
+	feed.mutex.Lock()
+	conn := feed.conn
+	feed.mutex.Unlock()
+
+	_, payload, err := conn.ReadMessage(nil)
+	if err != nil {
+		return err
+	}
+	return feed.apply(payload)
+}
+
+// apply applies a message to the summaries and the events of the wrapper, the messages of the other channels being
+// heartbeats.
+func (feed *coinbaseFeed) apply(payload []byte) error {
+	var message coinbaseFeedMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		return err
+	}
+	if message.Type == "error" {
+		return errors.New("coinbase feed error: " + message.Message)
+	}
+	if message.Channel != "ticker" {
+		return nil
+	}
+
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	for _, event := range message.Events {
+		for _, ticker := range event.Tickers {
+			last, _ := decimal.NewFromString(ticker.Price)
+			ask, _ := decimal.NewFromString(ticker.BestAsk)
+			bid, _ := decimal.NewFromString(ticker.BestBid)
+			high, _ := decimal.NewFromString(ticker.High)
+			low, _ := decimal.NewFromString(ticker.Low)
+			volume, _ := decimal.NewFromString(ticker.Volume)
+
+			summary := &environment.MarketSummary{
+				Last:   last,
+				Ask:    ask,
+				Bid:    bid,
+				High:   high,
+				Low:    low,
+				Volume: volume,
+			}
+			feedSummary(feed.wrapper, feed.wrapper.summaries, feed.wrapper.events, feed.markets[ticker.ProductID], summary)
+		}
+	}
+	return nil
+}
+
+// Close closes the websocket, making any pending Read return.
+func (feed *coinbaseFeed) Close() error {
+	feed.mutex.Lock()
+	conn := feed.conn
+	feed.mutex.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
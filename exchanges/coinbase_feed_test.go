@@ -0,0 +1,47 @@
+package exchanges
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+func TestCoinbaseFeedPublishesTickers(t *testing.T) {
+	wrapper := NewCoinbaseWrapper("", "", nil, nil).(*CoinbaseWrapper)
+	market := &environment.Market{Name: "eth-usd", BaseCurrency: "eth", MarketCurrency: "usd", ExchangeNames: map[string]string{"coinbase": "ETH-USD"}}
+	feed := newCoinbaseFeed(wrapper)
+	_, feed.markets = feedMarkets(wrapper, []*environment.Market{market})
+
+	if kinds := FeedEventKindsOf(wrapper); len(kinds) != 0 {
+		t.Fatalf("the feed pushes %v before it is connected", kinds)
+	}
+	wrapper.feed = NewFeedSupervisor(wrapper.Name(), feed, FeedSupervisorConfig{}, wrapper.summaries)
+
+	// the tickers come from the feed once it is connected, instead of polling the REST API.
+	events, stop := EventsOf(wrapper, []*environment.Market{market}, environment.EventKinds{environment.TickerEvent: true}, time.Hour)
+	defer stop()
+
+	err := feed.apply([]byte(`{"channel":"ticker","events":[{"tickers":[{"product_id":"ETH-USD","price":"2001.5","best_bid":"2001","best_ask":"2002","volume_24_h":"100","low_24_h":"1900","high_24_h":"2100"}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Kind != environment.TickerEvent || event.Market != market || event.Exchange != "coinbase" {
+			t.Fatalf("got a %s event of %s on %s, want the ticker of %s", event.Kind, event.Market, event.Exchange, market)
+		}
+		if !event.Ticker.Last.Equal(decimal.RequireFromString("2001.5")) || !event.Ticker.Bid.Equal(decimal.NewFromInt(2001)) || !event.Ticker.Ask.Equal(decimal.NewFromInt(2002)) {
+			t.Fatalf("got ticker %+v", event.Ticker)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the ticker of the feed was not published")
+	}
+
+	summary, cached := wrapper.summaries.Get(market)
+	if !cached || !summary.High.Equal(decimal.NewFromInt(2100)) {
+		t.Fatalf("the summary %+v was not cached", summary)
+	}
+}
@@ -0,0 +1,325 @@
+package exchanges
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// IntendedTrade represents an order (or withdrawal) that a dry run would have sent to the exchange.
+type IntendedTrade struct {
+	ID            string          `json:"id"`                      // Fake ID returned to the caller.
+	Time          time.Time       `json:"time"`                    // Time the order was requested.
+	Exchange      string          `json:"exchange"`                // Name of the exchange the order was meant for.
+	Method        string          `json:"method"`                  // Name of the called wrapper method.
+	Market        string          `json:"market,omitempty"`        // Name of the market of the order.
+	Side          string          `json:"side,omitempty"`          // Side of the order.
+	Type          string          `json:"type,omitempty"`          // Type of the order.
+	TimeInForce   string          `json:"time_in_force,omitempty"` // Time in force of the order.
+	Amount        decimal.Decimal `json:"amount"`                  // Amount of the order.
+	LimitPrice    decimal.Decimal `json:"limit_price"`             // Limit price of the order, zero for market orders.
+	StopPrice     decimal.Decimal `json:"stop_price"`              // Stop price of the order, zero for non stop orders.
+	ExpectedPrice decimal.Decimal `json:"expected_price"`          // Average fill price expected from the live orderbook, zero if unknown.
+	ExpectedFees  decimal.Decimal `json:"expected_fees"`           // Trading fees expected for the order.
+	Destination   string          `json:"destination,omitempty"`   // Destination address of a withdrawal.
+	Error         string          `json:"error,omitempty"`         // Why the expected fill could not be computed, if it could not.
+}
+
+// DryRunJournal writes the intended trades of a dry run to a JSONL file, it can be shared by many DryRunWrappers.
+type DryRunJournal struct {
+	mutex   *sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewDryRunJournal opens the journal at the specified path, appending to any existing one.
+func NewDryRunJournal(path string) (*DryRunJournal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DryRunJournal{
+		mutex:   &sync.Mutex{},
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// Write appends an intended trade to the journal.
+func (journal *DryRunJournal) Write(trade IntendedTrade) error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	return journal.encoder.Encode(trade)
+}
+
+// Close closes the journal file.
+func (journal *DryRunJournal) Close() error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	return journal.file.Close()
+}
+
+// DryRunWrapper wraps a real wrapper, passing all reads through but only journaling orders and withdrawals.
+//
+//	NOTE: every method is implemented explicitly rather than by embedding the live wrapper, so that a method added to
+//	ExchangeWrapper does not compile until the dry run decides whether it may reach the exchange.
+type DryRunWrapper struct {
+	liveWrapper ExchangeWrapper
+	journal     *DryRunJournal
+}
+
+var _ ExchangeWrapper = (*DryRunWrapper)(nil)
+
+// NewDryRunWrapper creates a new dry run wrapper around a real wrapper.
+func NewDryRunWrapper(liveWrapper ExchangeWrapper, journal *DryRunJournal) *DryRunWrapper {
+	return &DryRunWrapper{
+		liveWrapper: liveWrapper,
+		journal:     journal,
+	}
+}
+
+// Name returns the name of the wrapped exchange.
+func (wrapper *DryRunWrapper) Name() string {
+	return wrapper.liveWrapper.Name()
+}
+
+// String returns a string representation of the dry run wrapper.
+func (wrapper *DryRunWrapper) String() string {
+	return wrapper.liveWrapper.String() + "_dry_run"
+}
+
+func (wrapper *DryRunWrapper) IsHistoricalSimulation() bool {
+	return wrapper.liveWrapper.IsHistoricalSimulation()
+}
+
+// GetCandles gets the candle data from the exchange.
+func (wrapper *DryRunWrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
+	return wrapper.liveWrapper.GetCandles(market)
+}
+
+// GetHistoricalCandles gets the candle data of a period from the exchange.
+func (wrapper *DryRunWrapper) GetHistoricalCandles(market *environment.Market, start time.Time, end time.Time, interval int) ([]environment.CandleStick, error) {
+	return wrapper.liveWrapper.GetHistoricalCandles(market, start, end, interval)
+}
+
+// GetMarkets gets all the markets info.
+func (wrapper *DryRunWrapper) GetMarkets() ([]*environment.Market, error) {
+	return wrapper.liveWrapper.GetMarkets()
+}
+
+// GetTicker gets the updated ticker for a market.
+func (wrapper *DryRunWrapper) GetTicker(market *environment.Market) (*environment.Ticker, error) {
+	return wrapper.liveWrapper.GetTicker(market)
+}
+
+// GetMarketSummary gets the current market summary.
+func (wrapper *DryRunWrapper) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
+	return wrapper.liveWrapper.GetMarketSummary(market)
+}
+
+// GetMarketSummaries gets the current summaries of many markets, in the same order.
+func (wrapper *DryRunWrapper) GetMarketSummaries(markets []*environment.Market) ([]*environment.MarketSummary, error) {
+	return wrapper.liveWrapper.GetMarketSummaries(markets)
+}
+
+// GetOrderBook gets the order(ASK + BID) book of a market.
+func (wrapper *DryRunWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
+	return wrapper.liveWrapper.GetOrderBook(market)
+}
+
+// GetHistoricalTrades gets the trades of a market over a period from the exchange.
+func (wrapper *DryRunWrapper) GetHistoricalTrades(market *environment.Market, start time.Time, end time.Time) (*environment.TradeBook, error) {
+	return wrapper.liveWrapper.GetHistoricalTrades(market, start, end)
+}
+
+// GetAllTrades gets the trades of the user on the markets, the journaled ones excluded.
+func (wrapper *DryRunWrapper) GetAllTrades(markets []*environment.Market) (*environment.TradeBook, error) {
+	return wrapper.liveWrapper.GetAllTrades(markets)
+}
+
+// GetAllMarketTrades gets the trades of the user on a market, the journaled ones excluded.
+func (wrapper *DryRunWrapper) GetAllMarketTrades(market *environment.Market) (*environment.TradeBook, error) {
+	return wrapper.liveWrapper.GetAllMarketTrades(market)
+}
+
+// GetFilteredTrades gets the trades of the user on a market matching the filters, the journaled ones excluded.
+func (wrapper *DryRunWrapper) GetFilteredTrades(market *environment.Market, symbol string, tradeSide environment.TradeSide, tradeType environment.TradeType, tradeStatus environment.TradeStatus) (*environment.TradeBook, error) {
+	return wrapper.liveWrapper.GetFilteredTrades(market, symbol, tradeSide, tradeType, tradeStatus)
+}
+
+// CalculateTradingFees calculates the trading fees for an order on a specified market.
+func (wrapper *DryRunWrapper) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderSide environment.TradeSide) decimal.Decimal {
+	return wrapper.liveWrapper.CalculateTradingFees(market, amount, limit, orderSide)
+}
+
+// CalculateWithdrawFees calculates the withdrawal fees on a specified market.
+func (wrapper *DryRunWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) decimal.Decimal {
+	return wrapper.liveWrapper.CalculateWithdrawFees(market, amount)
+}
+
+// GetBalance gets the live balance of the user of the specified currency.
+func (wrapper *DryRunWrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
+	return wrapper.liveWrapper.GetBalance(symbol)
+}
+
+// GetAccountSnapshot gets all the live balances and open orders of the user at once.
+func (wrapper *DryRunWrapper) GetAccountSnapshot() (*environment.AccountSnapshot, error) {
+	return wrapper.liveWrapper.GetAccountSnapshot()
+}
+
+// GetDepositAddress gets the deposit address for the specified coin on the exchange, if exists.
+func (wrapper *DryRunWrapper) GetDepositAddress(coinTicker string) (string, bool) {
+	return wrapper.liveWrapper.GetDepositAddress(coinTicker)
+}
+
+// FeedConnect connects to the feed of the exchange, which only reads market data.
+func (wrapper *DryRunWrapper) FeedConnect(markets []*environment.Market) error {
+	return wrapper.liveWrapper.FeedConnect(markets)
+}
+
+// FeedHealth returns the health of the feed of the exchange, if connected.
+func (wrapper *DryRunWrapper) FeedHealth() (FeedHealth, bool) {
+	return FeedHealthOf(wrapper.liveWrapper)
+}
+
+// FeedEventKinds returns the kinds of the events pushed by the feed of the exchange.
+func (wrapper *DryRunWrapper) FeedEventKinds() environment.EventKinds {
+	return FeedEventKindsOf(wrapper.liveWrapper)
+}
+
+// SubscribeEvents returns the events of the specified kinds and markets pushed by the feed of the exchange.
+func (wrapper *DryRunWrapper) SubscribeEvents(markets []*environment.Market, kinds environment.EventKinds) (<-chan environment.Event, func()) {
+	return subscribeFeedEvents(wrapper.liveWrapper, markets, kinds)
+}
+
+// intend journals an order that would have been placed, estimating its fill from the live orderbook.
+func (wrapper *DryRunWrapper) intend(method string, order environment.OrderRequest) (string, error) {
+	if err := order.Validate(); err != nil {
+		return "", err
+	}
+
+	orderID, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+
+	trade := IntendedTrade{
+		ID:          fmt.Sprintf("DRY_RUN_%s-%s", strings.ToUpper(order.Side.String()), orderID.String()),
+		Time:        time.Now(),
+		Exchange:    wrapper.Name(),
+		Method:      method,
+		Market:      order.Market.Name,
+		Side:        order.Side.String(),
+		Type:        order.Type.String(),
+		TimeInForce: order.TimeInForce.String(),
+		Amount:      order.Amount,
+		LimitPrice:  order.LimitPrice,
+		StopPrice:   order.StopPrice,
+	}
+
+	orderbook, err := wrapper.GetOrderBook(order.Market)
+	if err != nil {
+		trade.Error = err.Error()
+	} else {
+		limit := decimal.Zero
+		if order.Type == environment.LimitOrder {
+			limit = order.LimitPrice
+		}
+		fill := orderbook.Walk(order.Side, order.Amount, limit)
+		trade.ExpectedPrice = fill.AveragePrice
+		trade.ExpectedFees = wrapper.CalculateTradingFees(order.Market, fill.Quantity, fill.AveragePrice, order.Side)
+		if !fill.Complete(order.Amount) {
+			trade.Error = fmt.Sprintf("only %s can be filled now", fill.Quantity)
+		}
+	}
+
+	if err := wrapper.journal.Write(trade); err != nil {
+		return "", err
+	}
+	logrus.Infof("DRY RUN: would %s %s %s on %s (%s)", strings.ToLower(trade.Side), trade.Amount, trade.Market, trade.Exchange, trade.Type)
+	return trade.ID, nil
+}
+
+// BuyLimit journals a limit buy action.
+func (wrapper *DryRunWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.intend("BuyLimit", environment.OrderRequest{Market: market, Side: environment.Buy, Type: environment.LimitOrder, Amount: amount, LimitPrice: limit})
+}
+
+// SellLimit journals a limit sell action.
+func (wrapper *DryRunWrapper) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.intend("SellLimit", environment.OrderRequest{Market: market, Side: environment.Sell, Type: environment.LimitOrder, Amount: amount, LimitPrice: limit})
+}
+
+// BuyMarket journals a market buy action.
+func (wrapper *DryRunWrapper) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.intend("BuyMarket", environment.OrderRequest{Market: market, Side: environment.Buy, Type: environment.MarketPrice, Amount: amount})
+}
+
+// SellMarket journals a market sell action.
+func (wrapper *DryRunWrapper) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.intend("SellMarket", environment.OrderRequest{Market: market, Side: environment.Sell, Type: environment.MarketPrice, Amount: amount})
+}
+
+// PlaceOrder journals an order of any type.
+func (wrapper *DryRunWrapper) PlaceOrder(order environment.OrderRequest) (string, error) {
+	return wrapper.intend("PlaceOrder", order)
+}
+
+// CancelOrder journals an order cancellation, the orders on the exchange are never canceled.
+func (wrapper *DryRunWrapper) CancelOrder(market *environment.Market, side environment.TradeSide, orderID string) error {
+	trade := IntendedTrade{
+		ID:       orderID,
+		Time:     time.Now(),
+		Exchange: wrapper.Name(),
+		Method:   "CancelOrder",
+		Market:   market.Name,
+		Side:     side.String(),
+	}
+	if err := wrapper.journal.Write(trade); err != nil {
+		return err
+	}
+	logrus.Infof("DRY RUN: would cancel order %s on %s", orderID, trade.Exchange)
+	return nil
+}
+
+// Withdraw journals a withdraw operation.
+func (wrapper *DryRunWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) (string, error) {
+	withdrawalID, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+
+	trade := IntendedTrade{
+		ID:          fmt.Sprintf("DRY_RUN_WITHDRAW-%s", withdrawalID.String()),
+		Time:        time.Now(),
+		Exchange:    wrapper.Name(),
+		Method:      "Withdraw",
+		Market:      coinTicker,
+		Amount:      amount,
+		Destination: destinationAddress,
+	}
+	if err := wrapper.journal.Write(trade); err != nil {
+		return "", err
+	}
+	logrus.Infof("DRY RUN: would withdraw %s %s from %s to %s", amount, coinTicker, trade.Exchange, destinationAddress)
+	return trade.ID, nil
+}
+
+// GetWithdrawStatus reports journaled withdrawals as failed, since no coin was actually moved.
+func (wrapper *DryRunWrapper) GetWithdrawStatus(coinTicker string, withdrawalID string) (environment.TransferStatus, error) {
+	if strings.HasPrefix(withdrawalID, "DRY_RUN_WITHDRAW-") {
+		return environment.TransferFailed, nil
+	}
+	return wrapper.liveWrapper.GetWithdrawStatus(coinTicker, withdrawalID)
+}
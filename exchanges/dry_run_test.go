@@ -0,0 +1,139 @@
+package exchanges
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// liveOrdersWrapper serves the market data of a wrapper and counts the orders, cancellations and withdrawals reaching it.
+type liveOrdersWrapper struct {
+	ExchangeWrapper
+	calls []string
+}
+
+func (wrapper *liveOrdersWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	wrapper.calls = append(wrapper.calls, "BuyLimit")
+	return "live", nil
+}
+
+func (wrapper *liveOrdersWrapper) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	wrapper.calls = append(wrapper.calls, "SellLimit")
+	return "live", nil
+}
+
+func (wrapper *liveOrdersWrapper) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	wrapper.calls = append(wrapper.calls, "BuyMarket")
+	return "live", nil
+}
+
+func (wrapper *liveOrdersWrapper) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	wrapper.calls = append(wrapper.calls, "SellMarket")
+	return "live", nil
+}
+
+func (wrapper *liveOrdersWrapper) PlaceOrder(order environment.OrderRequest) (string, error) {
+	wrapper.calls = append(wrapper.calls, "PlaceOrder")
+	return "live", nil
+}
+
+func (wrapper *liveOrdersWrapper) CancelOrder(market *environment.Market, side environment.TradeSide, orderID string) error {
+	wrapper.calls = append(wrapper.calls, "CancelOrder")
+	return nil
+}
+
+func (wrapper *liveOrdersWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) (string, error) {
+	wrapper.calls = append(wrapper.calls, "Withdraw")
+	return "live", nil
+}
+
+func TestDryRunNeverReachesTheExchange(t *testing.T) {
+	live := &liveOrdersWrapper{ExchangeWrapper: NewSyntheticWrapper(syntheticConfig(1), nil)}
+	path := filepath.Join(t.TempDir(), "dry_run.jsonl")
+	journal, err := NewDryRunJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapper := NewDryRunWrapper(live, journal)
+	market := syntheticMarket("ETH-USD")
+	amount := decimal.RequireFromString("0.5")
+
+	orders := []struct {
+		method string
+		send   func() (string, error)
+	}{
+		{"BuyLimit", func() (string, error) { return wrapper.BuyLimit(market, amount, decimal.NewFromInt(1000)) }},
+		{"SellLimit", func() (string, error) { return wrapper.SellLimit(market, amount, decimal.NewFromInt(3000)) }},
+		{"BuyMarket", func() (string, error) { return wrapper.BuyMarket(market, amount) }},
+		{"SellMarket", func() (string, error) { return wrapper.SellMarket(market, amount) }},
+		{"PlaceOrder", func() (string, error) {
+			return wrapper.PlaceOrder(environment.OrderRequest{Market: market, Side: environment.Sell, Type: environment.StopLossOrder, Amount: amount, StopPrice: decimal.NewFromInt(1500)})
+		}},
+		{"CancelOrder", func() (string, error) { return "live", wrapper.CancelOrder(market, environment.Buy, "live") }},
+		{"Withdraw", func() (string, error) { return wrapper.Withdraw("0xdestination", "ETH", amount) }},
+	}
+	for _, order := range orders {
+		id, err := order.send()
+		if err != nil {
+			t.Fatalf("%s: %s", order.method, err)
+		}
+		if order.method != "CancelOrder" && !strings.HasPrefix(id, "DRY_RUN_") {
+			t.Errorf("%s returned id %s, want a dry run id", order.method, id)
+		}
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(live.calls) > 0 {
+		t.Errorf("the exchange received %v", live.calls)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	trades := make([]IntendedTrade, 0, len(orders))
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var trade IntendedTrade
+		if err := json.Unmarshal(scanner.Bytes(), &trade); err != nil {
+			t.Fatal(err)
+		}
+		trades = append(trades, trade)
+	}
+	if len(trades) != len(orders) {
+		t.Fatalf("journaled %d intended trades, want %d", len(trades), len(orders))
+	}
+	for i, order := range orders {
+		if trades[i].Method != order.method {
+			t.Errorf("intended trade %d is a %s, want a %s", i, trades[i].Method, order.method)
+		}
+	}
+
+	// market orders are expected to fill at the price of the live orderbook.
+	orderbook, err := live.GetOrderBook(market)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buy := orderbook.Walk(environment.Buy, amount, decimal.Zero)
+	if !buy.AveragePrice.IsPositive() || !trades[2].ExpectedPrice.Equal(buy.AveragePrice) {
+		t.Errorf("market buy expected to fill at %s, want %s", trades[2].ExpectedPrice, buy.AveragePrice)
+	}
+	if !trades[2].ExpectedFees.Equal(live.CalculateTradingFees(market, buy.Quantity, buy.AveragePrice, environment.Buy)) {
+		t.Errorf("market buy expected to pay %s of fees", trades[2].ExpectedFees)
+	}
+
+	// the withdrawals that never left are reported failed, instead of pending forever.
+	status, err := wrapper.GetWithdrawStatus("ETH", trades[6].ID)
+	if err != nil || status != environment.TransferFailed {
+		t.Errorf("got status %v, %v for the journaled withdrawal, want %v", status, err, environment.TransferFailed)
+	}
+}
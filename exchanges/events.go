@@ -0,0 +1,412 @@
+package exchanges
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/sirupsen/logrus"
+)
+
+// eventBufferSize is the number of events a subscription holds before the following ones are dropped.
+const eventBufferSize = 256
+
+// EventSource is implemented by the wrappers pushing events from their websocket feed.
+type EventSource interface {
+	// FeedEventKinds returns the kinds of the events the feed pushes, none while it is not connected.
+	FeedEventKinds() environment.EventKinds
+	// SubscribeEvents returns the events of the specified kinds and markets until the returned function is called.
+	SubscribeEvents(markets []*environment.Market, kinds environment.EventKinds) (<-chan environment.Event, func())
+}
+
+// FeedEventKindsOf returns the kinds of the events pushed by the feed of the wrapper, none if it has no feed.
+func FeedEventKindsOf(wrapper ExchangeWrapper) environment.EventKinds {
+	if source, ok := wrapper.(EventSource); ok {
+		return source.FeedEventKinds()
+	}
+	return environment.EventKinds{}
+}
+
+// subscribeFeedEvents subscribes to the events pushed by the feed of the wrapper, the events of a wrapper without feed
+// end at once.
+func subscribeFeedEvents(wrapper ExchangeWrapper, markets []*environment.Market, kinds environment.EventKinds) (<-chan environment.Event, func()) {
+	if source, ok := wrapper.(EventSource); ok {
+		return source.SubscribeEvents(markets, kinds)
+	}
+	events := make(chan environment.Event)
+	close(events)
+	return events, func() {}
+}
+
+// eventSubscription represents the events a subscriber of an EventBus receives.
+type eventSubscription struct {
+	markets map[string]bool // names of the markets, all of them if empty.
+	kinds   environment.EventKinds
+	events  chan environment.Event
+}
+
+// accepts checks whether the event is one the subscriber asked for, timers being sent to every subscriber.
+func (subscription *eventSubscription) accepts(event environment.Event) bool {
+	if !subscription.kinds.Has(event.Kind) {
+		return false
+	}
+	return event.Market == nil || len(subscription.markets) == 0 || subscription.markets[event.Market.Name]
+}
+
+// EventBus dispatches the events published by a feed to its subscribers, so that wrappers can implement EventSource by
+// publishing the messages their FeedConnection reads.
+//
+//	NOTE: Publish never blocks the feed, the events a slow subscriber has no room for are dropped.
+type EventBus struct {
+	mutex         *sync.Mutex
+	subscriptions []*eventSubscription
+}
+
+// NewEventBus creates a new EventBus without subscribers.
+func NewEventBus() *EventBus {
+	return &EventBus{mutex: &sync.Mutex{}}
+}
+
+// SubscribeEvents returns the events of the specified kinds and markets published from now on, until the returned
+// function is called.
+func (bus *EventBus) SubscribeEvents(markets []*environment.Market, kinds environment.EventKinds) (<-chan environment.Event, func()) {
+	subscription := &eventSubscription{
+		markets: make(map[string]bool, len(markets)),
+		kinds:   kinds,
+		events:  make(chan environment.Event, eventBufferSize),
+	}
+	for _, market := range markets {
+		subscription.markets[market.Name] = true
+	}
+
+	bus.mutex.Lock()
+	bus.subscriptions = append(bus.subscriptions, subscription)
+	bus.mutex.Unlock()
+
+	var once sync.Once
+	return subscription.events, func() {
+		once.Do(func() { bus.unsubscribe(subscription) })
+	}
+}
+
+// unsubscribe removes the subscription and closes its events.
+func (bus *EventBus) unsubscribe(subscription *eventSubscription) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	for i, current := range bus.subscriptions {
+		if current == subscription {
+			bus.subscriptions = append(bus.subscriptions[:i:i], bus.subscriptions[i+1:]...)
+			close(subscription.events)
+			return
+		}
+	}
+}
+
+// Publish sends the event to the subscribers asking for it.
+func (bus *EventBus) Publish(event environment.Event) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	for _, subscription := range bus.subscriptions {
+		if !subscription.accepts(event) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			logrus.Warnf("dropping %s event of %s: subscriber is too slow", event.Kind, event.Exchange)
+		}
+	}
+}
+
+// Close closes the events of every subscriber, e.g. once the feed is stopped.
+func (bus *EventBus) Close() {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	for _, subscription := range bus.subscriptions {
+		close(subscription.events)
+	}
+	bus.subscriptions = nil
+}
+
+// EventsOf subscribes to the events of a wrapper: the kinds its feed pushes come from the feed, the other ones are made
+// by polling its REST API at the specified interval.
+//
+//	NOTE: the kinds are split when subscribing, so the events of a feed connected later are still polled.
+func EventsOf(wrapper ExchangeWrapper, markets []*environment.Market, kinds environment.EventKinds, pollInterval time.Duration) (<-chan environment.Event, func()) {
+	feedKinds := FeedEventKindsOf(wrapper)
+	pushed, polled := make(environment.EventKinds), make(environment.EventKinds)
+	for kind, wanted := range kinds {
+		switch {
+		case !wanted:
+		case feedKinds.Has(kind):
+			pushed[kind] = true
+		default:
+			polled[kind] = true
+		}
+	}
+
+	switch {
+	case len(pushed) == 0:
+		return NewEventPoller(wrapper, pollInterval).SubscribeEvents(markets, polled)
+	case len(polled) == 0:
+		return subscribeFeedEvents(wrapper, markets, pushed)
+	}
+	feedEvents, stopFeed := subscribeFeedEvents(wrapper, markets, pushed)
+	polledEvents, stopPolling := NewEventPoller(wrapper, pollInterval).SubscribeEvents(markets, polled)
+	return mergeEvents([]<-chan environment.Event{feedEvents, polledEvents}, []func(){stopFeed, stopPolling})
+}
+
+// mergeEvents merges the events of several subscriptions, until the returned function stops them all.
+func mergeEvents(subscriptions []<-chan environment.Event, stops []func()) (<-chan environment.Event, func()) {
+	events := make(chan environment.Event, eventBufferSize)
+	stopped := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(len(subscriptions))
+	for _, subscription := range subscriptions {
+		go func(subscription <-chan environment.Event) {
+			defer wg.Done()
+			// once stopped the events are drained until the subscription closes them.
+			for event := range subscription {
+				select {
+				case events <- event:
+				case <-stopped:
+				}
+			}
+		}(subscription)
+	}
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			close(stopped)
+			for _, stop := range stops {
+				stop()
+			}
+		})
+	}
+}
+
+// EventPoller makes the events of a wrapper without feed by polling its REST API, or the simulated data of a simulator
+// at each step of its clock: candles closed, tickers changed, order books, and trades of the account not seen before.
+//
+//	NOTE: a poller reports the changes since its previous poll, so it must not be polled from several goroutines.
+type EventPoller struct {
+	wrapper  ExchangeWrapper
+	interval time.Duration
+	state    *pollState
+}
+
+// NewEventPoller creates a new EventPoller polling the wrapper at the specified interval, on the clock of the wrapper.
+func NewEventPoller(wrapper ExchangeWrapper, interval time.Duration) *EventPoller {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &EventPoller{wrapper: wrapper, interval: interval, state: newPollState()}
+}
+
+// Prime records the current state of the markets without reporting it, so that the next poll only reports changes.
+func (poller *EventPoller) Prime(markets []*environment.Market, kinds environment.EventKinds) {
+	poller.state.primed = false
+	poller.Poll(markets, kinds)
+}
+
+// Poll returns the events of the specified kinds and markets which happened since the previous poll, in time order.
+func (poller *EventPoller) Poll(markets []*environment.Market, kinds environment.EventKinds) []environment.Event {
+	ret := poller.state.poll(poller.wrapper, markets, kinds, ClockOf(poller.wrapper).Now())
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+	return ret
+}
+
+// SubscribeEvents polls the events of the specified kinds and markets in background at the interval of the poller,
+// until the returned function is called.
+func (poller *EventPoller) SubscribeEvents(markets []*environment.Market, kinds environment.EventKinds) (<-chan environment.Event, func()) {
+	events := make(chan environment.Event, eventBufferSize)
+	stop := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		defer close(events)
+
+		clock := ClockOf(poller.wrapper)
+		poller.Prime(markets, kinds)
+		for {
+			select {
+			case <-clock.After(poller.interval):
+			case <-stop:
+				return
+			}
+			for _, event := range poller.Poll(markets, kinds) {
+				select {
+				case events <- event:
+				case <-stop:
+					return
+				}
+			}
+		}
+	}()
+
+	return events, func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+// candleCloser is implemented by the simulated wrappers replaying history, whose candles close as their clock is stepped.
+type candleCloser interface {
+	ClosedCandle(market *environment.Market) (*environment.CandleStick, error)
+}
+
+// pollState represents what a poller already reported, so that only changes make events.
+type pollState struct {
+	primed      bool                          // whether the state was recorded by a first poll.
+	lastCandles map[string]time.Time          // time of the last closed candle of each market.
+	tickers     map[string]environment.Ticker // last ticker of each market.
+	trades      map[string]bool               // trades of the account already seen, by tradeKey.
+}
+
+func newPollState() *pollState {
+	return &pollState{
+		lastCandles: make(map[string]time.Time),
+		tickers:     make(map[string]environment.Ticker),
+		trades:      make(map[string]bool),
+	}
+}
+
+// poll returns the events of the kinds which happened since the previous poll. The first poll only records the candles
+// and trades of the past, so that they are not reported as new.
+func (state *pollState) poll(wrapper ExchangeWrapper, markets []*environment.Market, kinds environment.EventKinds, now time.Time) []environment.Event {
+	var ret []environment.Event
+	newEvent := func(kind environment.EventKind, market *environment.Market) environment.Event {
+		return environment.Event{Kind: kind, Time: now, Exchange: wrapper.Name(), Market: market}
+	}
+
+	for _, market := range markets {
+		if kinds.Has(environment.CandleCloseEvent) {
+			for _, candle := range closedCandles(wrapper, market) {
+				if !candle.CandleTime.After(state.lastCandles[market.Name]) {
+					continue
+				}
+				state.lastCandles[market.Name] = candle.CandleTime
+				if state.primed {
+					candle := candle
+					event := newEvent(environment.CandleCloseEvent, market)
+					event.Candle = &candle
+					ret = append(ret, event)
+				}
+			}
+		}
+
+		if kinds.Has(environment.TickerEvent) {
+			ticker, err := wrapper.GetTicker(market)
+			if err != nil {
+				logrus.Warn("cannot poll ticker of "+market.Name+": ", err)
+			} else if last, seen := state.tickers[market.Name]; !seen || !last.Ask.Equal(ticker.Ask) || !last.Bid.Equal(ticker.Bid) || !last.Last.Equal(ticker.Last) {
+				state.tickers[market.Name] = *ticker
+				event := newEvent(environment.TickerEvent, market)
+				event.Ticker = ticker
+				ret = append(ret, event)
+			}
+		}
+
+		if kinds.Has(environment.OrderBookEvent) {
+			book, err := wrapper.GetOrderBook(market)
+			if err != nil {
+				logrus.Warn("cannot poll order book of "+market.Name+": ", err)
+			} else {
+				event := newEvent(environment.OrderBookEvent, market)
+				event.OrderBook = book
+				ret = append(ret, event)
+			}
+		}
+	}
+
+	if kinds.Has(environment.OrderUpdateEvent) {
+		ret = append(ret, state.orderUpdates(wrapper, markets, now)...)
+	}
+	state.primed = true
+	return ret
+}
+
+// closedCandles returns the closed candles of the market known by the wrapper, in time order: the candle closed by the
+// last step of a simulator, or the candles of the exchange but the newest one, which is still open.
+func closedCandles(wrapper ExchangeWrapper, market *environment.Market) []environment.CandleStick {
+	if closer, ok := wrapper.(candleCloser); ok && wrapper.IsHistoricalSimulation() {
+		candle, err := closer.ClosedCandle(market)
+		if err != nil {
+			logrus.Warn("cannot get closed candle of "+market.Name+": ", err)
+			return nil
+		}
+		return []environment.CandleStick{*candle}
+	}
+
+	candles, err := wrapper.GetCandles(market)
+	if err != nil {
+		logrus.Warn("cannot poll candles of "+market.Name+": ", err)
+		return nil
+	}
+	if len(candles) == 0 {
+		return nil
+	}
+
+	// the candles are not trusted to be in time order, and the cached ones are shared with the wrapper.
+	candles = append([]environment.CandleStick(nil), candles...)
+	sort.SliceStable(candles, func(i, j int) bool {
+		return candles[i].CandleTime.Before(candles[j].CandleTime)
+	})
+	return candles[:len(candles)-1]
+}
+
+// orderUpdates returns an event for each trade of the account on the markets which was not seen by a previous call.
+func (state *pollState) orderUpdates(wrapper ExchangeWrapper, markets []*environment.Market, now time.Time) []environment.Event {
+	tradeBook, err := wrapper.GetAllTrades(markets)
+	if err != nil || tradeBook == nil {
+		logrus.Warn("cannot poll trades: ", err)
+		return nil
+	}
+
+	byName := make(map[string]*environment.Market, len(markets))
+	for _, market := range markets {
+		byName[market.Name] = market
+	}
+
+	var ret []environment.Event
+	for _, trade := range tradeBook.Trades {
+		key := tradeKey(trade)
+		if state.trades[key] {
+			continue
+		}
+		state.trades[key] = true
+		if !state.primed {
+			continue
+		}
+
+		trade := trade
+		at := trade.Timestamp
+		if at.IsZero() {
+			at = now
+		}
+		ret = append(ret, environment.Event{
+			Kind:     environment.OrderUpdateEvent,
+			Time:     at,
+			Exchange: wrapper.Name(),
+			Market:   byName[trade.Market],
+			Order:    &trade,
+		})
+	}
+	return ret
+}
+
+// tradeKey identifies a trade of the account along with its progress, so that partial fills and status changes of an
+// order are reported too.
+func tradeKey(trade environment.Trade) string {
+	return trade.TradeNumber + "|" + trade.Status.String() + "|" + trade.FillQuantity.String() + "|" + trade.Timestamp.String()
+}
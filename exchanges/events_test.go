@@ -0,0 +1,71 @@
+package exchanges
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// candlesWrapper returns its candles in the order they are set, like the exchanges sending them newest first.
+type candlesWrapper struct {
+	ExchangeWrapper
+	candles []environment.CandleStick
+}
+
+func (wrapper *candlesWrapper) Name() string {
+	return "candles"
+}
+
+func (wrapper *candlesWrapper) IsHistoricalSimulation() bool {
+	return false
+}
+
+func (wrapper *candlesWrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
+	return wrapper.candles, nil
+}
+
+func TestPollReportsClosedCandlesOfUnsortedCandles(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	candle := func(hour int) environment.CandleStick {
+		price := decimal.NewFromInt(int64(2000 + hour))
+		return environment.CandleStick{Open: price, High: price, Low: price, Close: price, CandleTime: start.Add(time.Duration(hour) * time.Hour)}
+	}
+	market := &environment.Market{Name: "ETH-USD", BaseCurrency: "eth", MarketCurrency: "usd"}
+	kinds := environment.EventKinds{environment.CandleCloseEvent: true}
+
+	// the candle of hour 2 is still open.
+	wrapper := &candlesWrapper{candles: []environment.CandleStick{candle(2), candle(0), candle(1)}}
+	poller := NewEventPoller(wrapper, time.Minute)
+	poller.Prime([]*environment.Market{market}, kinds)
+
+	// the candle of hour 2 closed, the one of hour 3 opened.
+	wrapper.candles = []environment.CandleStick{candle(3), candle(1), candle(2), candle(0)}
+	events := poller.Poll([]*environment.Market{market}, kinds)
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want the close of the candle of hour 2", len(events))
+	}
+	if closed := events[0].Candle; closed == nil || !closed.CandleTime.Equal(start.Add(2*time.Hour)) || !closed.Close.Equal(decimal.NewFromInt(2002)) {
+		t.Fatalf("got the close of %+v, want the candle of hour 2", closed)
+	}
+	if first := wrapper.candles[0]; !first.CandleTime.Equal(start.Add(3 * time.Hour)) {
+		t.Fatal("the candles of the wrapper were reordered")
+	}
+
+	if events := poller.Poll([]*environment.Market{market}, kinds); len(events) != 0 {
+		t.Fatalf("got %d events, want none until another candle closes", len(events))
+	}
+}
+
+func TestPollKucoinCandlesDoesNotPanic(t *testing.T) {
+	wrapper := NewKucoinWrapper("", "", nil)
+	market := &environment.Market{Name: "ETH-USD", BaseCurrency: "eth", MarketCurrency: "usd", ExchangeNames: map[string]string{"kucoin": "ETH-USDT"}}
+	kinds := environment.EventKinds{environment.CandleCloseEvent: true}
+
+	poller := NewEventPoller(wrapper, time.Minute)
+	poller.Prime([]*environment.Market{market}, kinds)
+	if events := poller.Poll([]*environment.Market{market}, kinds); len(events) != 0 {
+		t.Fatalf("got %d events from an exchange without candles", len(events))
+	}
+}
@@ -2,6 +2,7 @@ package exchanges
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -11,22 +12,70 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// Limits of the simulated market data kept in memory, so that long backtests run in bounded memory.
+const (
+	simulatorMaxMarkets    = 256    // markets whose candles are kept.
+	simulatorMaxCandles    = 20_000 // candles kept per market, about two weeks of one minute candles.
+	simulatorMaxOrderbooks = 4_096  // orderbooks kept across all markets and times.
+)
+
 // ExchangeWrapperSimulator wraps another wrapper and returns simulated balances and orders.
 type ExchangeWrapperSimulator struct {
 	innerWrapper         ExchangeWrapper
-	candles              *MappedCandlesCache
-	orders               *MappedOrdersCache
-	trades               *TradeBookbookCache
+	candles              *CandleSeriesCache
+	orders               *TimedOrderbookCache
+	trades               *TradeBookCache
+	store                *MarketDataStore // local copy of the historical data, nil if not configured.
+	fillModel            FillModel
 	balances             map[string]decimal.Decimal
+	withdrawals          map[string]*simulatedWithdrawal
+	stopOrders           []*restingOrder // pending stop orders in placement order, triggered against the simulated candles.
+	openOrders           []*restingOrder // resting limit orders in placement order.
+	withdrawFees         map[string]decimal.Decimal
+	transferDelay        time.Duration
 	historicalSimulation bool
 	interval             int
 	startDate            *time.Time
 	endDate              *time.Time
-	currDate             *time.Time
+	clock                *environment.SimulatedClock // simulated time of historical simulations.
+	cashFlows            []environment.CashFlow      // scheduled deposits and withdrawals, in time order.
+	nextCashFlow         int                         // index of the first scheduled cash flow not received yet.
+	received             []environment.CashFlow      // cash flows received by the account.
+	parent               *ExchangeWrapperSimulator   // simulator stepping this sub-account, nil if not a sub-account.
+	subAccounts          []*ExchangeWrapperSimulator
+}
+
+// simulatedWithdrawal represents a withdrawal travelling to its destination exchange.
+type simulatedWithdrawal struct {
+	coin    string
+	amount  decimal.Decimal
+	arrival time.Time
+}
+
+// restingOrder represents a limit order waiting in the simulated book until the price reaches its limit, or a stop order
+// waiting until the price reaches its stop price.
+type restingOrder struct {
+	id        string
+	order     environment.OrderRequest
+	remaining decimal.Decimal // amount not filled yet.
 }
 
 // NewExchangeWrapperSimulator creates a new simulated wrapper from another wrapper and an initial balance.
 func NewExchangeWrapperSimulator(mockedWrapper ExchangeWrapper, simConfigs environment.SimulationConfig) *ExchangeWrapperSimulator {
+	var store *MarketDataStore
+	if simConfigs.SimDataDir != "" {
+		var err error
+		store, err = NewMarketDataStore(simConfigs.SimDataDir)
+		if err != nil {
+			logrus.Warn("cannot open market data store, historical data will not be stored: ", err)
+		}
+	}
+	return NewExchangeWrapperSimulatorWithStore(mockedWrapper, simConfigs, store)
+}
+
+// NewExchangeWrapperSimulatorWithStore creates a new simulated wrapper like NewExchangeWrapperSimulator, reading the
+// historical data through a store which may be shared by many simulators, nil for none.
+func NewExchangeWrapperSimulatorWithStore(mockedWrapper ExchangeWrapper, simConfigs environment.SimulationConfig, store *MarketDataStore) *ExchangeWrapperSimulator {
 
 	var start_date, curr_date, end_date time.Time
 	var err error
@@ -48,17 +97,36 @@ func NewExchangeWrapperSimulator(mockedWrapper ExchangeWrapper, simConfigs envir
 		}
 	}
 
+	fillModel, err := NewFillModel(simConfigs.SimFillModel)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	var cashFlows []environment.CashFlow
+	if historical {
+		cashFlows, err = environment.NewCashFlowSchedule(simConfigs.SimCashFlows, start_date, end_date)
+		if err != nil {
+			panic(err.Error())
+		}
+	}
+
 	return &ExchangeWrapperSimulator{
 		innerWrapper:         mockedWrapper,
-		candles:              NewMappedCandlesCache(),
-		orders:               NewMappedOrdersCache(),
-		trades:               NewTradeBookbookCache(),
+		candles:              NewCandleSeriesCache(simulatorMaxMarkets, simulatorMaxCandles),
+		orders:               NewTimedOrderbookCache(CacheConfig{MaxSize: simulatorMaxOrderbooks}),
+		trades:               NewTradeBookCache(),
+		store:                store,
+		fillModel:            fillModel,
 		balances:             simConfigs.SimFakeBalances,
+		withdrawals:          make(map[string]*simulatedWithdrawal),
+		withdrawFees:         simConfigs.SimWithdrawFees,
+		transferDelay:        time.Duration(simConfigs.SimTransferDelay) * time.Minute,
 		historicalSimulation: historical,
 		interval:             simConfigs.SimInterval,
 		startDate:            &start_date,
 		endDate:              &end_date,
-		currDate:             &curr_date,
+		clock:                environment.NewSimulatedClock(curr_date),
+		cashFlows:            cashFlows,
 	}
 }
 
@@ -76,36 +144,137 @@ func (wrapper *ExchangeWrapperSimulator) IsHistoricalSimulation() bool {
 	return wrapper.historicalSimulation
 }
 
+// Clock gets the clock of the simulation: the simulated clock when replaying history, the wall clock otherwise.
+func (wrapper *ExchangeWrapperSimulator) Clock() environment.Clock {
+	if wrapper.historicalSimulation {
+		return wrapper.clock
+	}
+	return environment.RealClock{}
+}
+
+// GetCurrDate gets the current time of the simulation.
 func (wrapper *ExchangeWrapperSimulator) GetCurrDate() time.Time {
-	if wrapper.historicalSimulation && !wrapper.currDate.IsZero() {
-		return *wrapper.currDate
+	return wrapper.Clock().Now()
+}
+
+// SubAccount creates a simulated account starting with a copy of the current balances, with its own orders and trades.
+// It shares the market data and the clock of the simulator, which steps it along with its own account.
+func (wrapper *ExchangeWrapperSimulator) SubAccount() ExchangeWrapper {
+	root := wrapper
+	if wrapper.parent != nil {
+		root = wrapper.parent
+	}
+
+	balances := make(map[string]decimal.Decimal, len(wrapper.balances))
+	for coin, balance := range wrapper.balances {
+		balances[coin] = balance
 	}
-	return time.Now()
+
+	account := &ExchangeWrapperSimulator{
+		innerWrapper:         root.innerWrapper,
+		candles:              root.candles,
+		orders:               root.orders,
+		trades:               NewTradeBookCache(),
+		store:                root.store,
+		fillModel:            root.fillModel,
+		balances:             balances,
+		withdrawals:          make(map[string]*simulatedWithdrawal),
+		withdrawFees:         root.withdrawFees,
+		transferDelay:        root.transferDelay,
+		historicalSimulation: root.historicalSimulation,
+		interval:             root.interval,
+		startDate:            root.startDate,
+		endDate:              root.endDate,
+		clock:                root.clock,
+		cashFlows:            root.cashFlows,
+		nextCashFlow:         wrapper.nextCashFlow,
+		parent:               root,
+	}
+	root.subAccounts = append(root.subAccounts, account)
+	return account
 }
 
+// IncrementCurrDate moves the simulated clock to the next candle, then fills the resting orders of every account against
+// the candle which just closed: the orders were placed while it was quoted, after its open, and are filled at its close.
+//
+//	NOTE: outside of historical simulations time passes by itself, so only the resting orders of the account itself are
+//	matched. Each paper trading strategy steps its own sub-account, and never touches the state of another one.
 func (wrapper *ExchangeWrapperSimulator) IncrementCurrDate() error {
+	if !wrapper.historicalSimulation {
+		wrapper.matchOpenOrders(wrapper.GetCurrDate())
+		return nil
+	}
+	if wrapper.parent != nil {
+		return errors.New("the date of a simulated sub-account is moved by its simulator")
+	}
+
+	accounts := append([]*ExchangeWrapperSimulator{wrapper}, wrapper.subAccounts...)
+
 	var interval_len = time.Duration(wrapper.interval) * time.Minute
-	*wrapper.currDate = wrapper.currDate.Add(interval_len)
+	curr_date := wrapper.clock.Advance(interval_len)
 
-	if wrapper.currDate.After(*wrapper.endDate) {
-		*wrapper.currDate = wrapper.currDate.Add(-interval_len)
+	if curr_date.After(*wrapper.endDate) {
+		curr_date = wrapper.clock.Advance(-interval_len)
 
-		diff_duration := wrapper.currDate.Sub(*wrapper.startDate)
+		diff_duration := curr_date.Sub(*wrapper.startDate)
 		iterations := decimal.NewFromFloat(diff_duration.Minutes()).DivRound(decimal.NewFromInt(int64(wrapper.interval)), 2)
 		diff_days := decimal.NewFromFloat(diff_duration.Hours()).DivRound(decimal.NewFromInt(24), 3)
 
 		end_str := fmt.Sprintln("End of Simulation")
 		end_str += "Simulation Start Date:" + wrapper.startDate.String() + "\n"
-		end_str += "Simulation End Date:" + wrapper.currDate.String() + "\n"
+		end_str += "Simulation End Date:" + curr_date.String() + "\n"
 		end_str += "Simulation Iterations:" + iterations.String() + "\n"
 		end_str += "Simulation Days:" + diff_days.String() + "\n"
 		logrus.Info(end_str)
 		return errors.New("End of Simulation Date has been reached")
 	}
 
+	// the orders rested while the candle just closed was quoted, so they are filled against it, at its close.
+	for _, account := range accounts {
+		account.matchOpenOrders(curr_date)
+	}
+
+	// cash flows go to the accounts the strategies trade on, the sub-accounts once there are some.
+	funded := accounts
+	if len(wrapper.subAccounts) > 0 {
+		funded = wrapper.subAccounts
+	}
+	for _, account := range funded {
+		account.receiveCashFlows(curr_date)
+	}
+	for _, account := range accounts {
+		account.triggerStopOrders(curr_date)
+	}
 	return nil
 }
 
+// receiveCashFlows credits the scheduled deposits and debits the scheduled withdrawals due by the specified time.
+//
+//	NOTE: withdrawals are limited to the funds not held by resting orders.
+func (wrapper *ExchangeWrapperSimulator) receiveCashFlows(until time.Time) {
+	for ; wrapper.nextCashFlow < len(wrapper.cashFlows); wrapper.nextCashFlow++ {
+		flow := wrapper.cashFlows[wrapper.nextCashFlow]
+		if flow.Time.After(until) {
+			return
+		}
+
+		if flow.Amount.IsNegative() {
+			available := decimal.Max(wrapper.balances[flow.Coin].Sub(wrapper.heldBalance(flow.Coin)), decimal.Zero)
+			if flow.Amount.Neg().GreaterThan(available) {
+				logrus.Warnf("Simulated withdrawal of %s %s limited to the available %s", flow.Amount.Neg(), flow.Coin, available)
+				flow.Amount = available.Neg()
+			}
+		}
+		wrapper.balances[flow.Coin] = wrapper.balances[flow.Coin].Add(flow.Amount)
+		wrapper.received = append(wrapper.received, flow)
+	}
+}
+
+// CashFlows gets the deposits and withdrawals received by the account so far.
+func (wrapper *ExchangeWrapperSimulator) CashFlows() []environment.CashFlow {
+	return wrapper.received
+}
+
 // GetCandles gets the candle data from the exchange.
 func (wrapper *ExchangeWrapperSimulator) UpdateMappedCandles(market *environment.Market, from_time time.Time) (*environment.CandleStick, error) {
 
@@ -120,16 +289,15 @@ func (wrapper *ExchangeWrapperSimulator) UpdateMappedCandles(market *environment
 	}
 
 	var prev_candle *environment.CandleStick
-	pot_prev_candle, isSet := wrapper.candles.GetTime(market, from_time.Add(-one_interval))
+	pot_prev_candle, isSet := wrapper.candles.At(market, from_time.Add(-one_interval))
 	if isSet {
 		prev_candle = pot_prev_candle
 	}
-	new_map := NewSizedCandleMap(len(historicalCandles))
+	new_candles := make([]environment.CandleStick, 0, len(historicalCandles))
 
 	next_fill_time := from_time
 	for i := 0; i < len(historicalCandles); i++ {
 		candle := historicalCandles[i]
-		curr_time_key := fmt.Sprint(candle.CandleTime.Unix())
 
 		new_candle := environment.CandleStick{
 			High:       candle.High,
@@ -147,13 +315,13 @@ func (wrapper *ExchangeWrapperSimulator) UpdateMappedCandles(market *environment
 
 		if candle.CandleTime.Equal(next_fill_time) {
 			next_fill_time = next_fill_time.Add(one_interval)
-			new_map.TimeMap[curr_time_key] = &new_candle
+			new_candles = append(new_candles, new_candle)
 			prev_candle = &new_candle
 			continue
 		}
 
 		if candle.CandleTime.Before(next_fill_time) {
-			new_map.TimeMap[curr_time_key] = &new_candle
+			new_candles = append(new_candles, new_candle)
 			prev_candle = &new_candle
 			continue
 		}
@@ -165,15 +333,15 @@ func (wrapper *ExchangeWrapperSimulator) UpdateMappedCandles(market *environment
 			} else {
 				copy_candle = new_candle
 			}
-			next_fill_time_str := fmt.Sprint(next_fill_time.Unix())
-			new_map.TimeMap[next_fill_time_str] = &copy_candle
+			copy_candle.CandleTime = next_fill_time
+			new_candles = append(new_candles, copy_candle)
 			next_fill_time = next_fill_time.Add(one_interval)
 
 		}
 	}
 
-	wrapper.candles.SetMap(market, new_map)
-	candle, isSet := wrapper.candles.GetTime(market, from_time)
+	wrapper.candles.Insert(market, new_candles)
+	candle, isSet := wrapper.candles.At(market, from_time)
 	if !isSet {
 		return nil, errors.New("no data for that time set panic")
 	}
@@ -182,7 +350,7 @@ func (wrapper *ExchangeWrapperSimulator) UpdateMappedCandles(market *environment
 }
 
 func (wrapper *ExchangeWrapperSimulator) GetCandle(market *environment.Market, time time.Time) (*environment.CandleStick, error) {
-	candle, isSet := wrapper.candles.GetTime(market, time)
+	candle, isSet := wrapper.candles.At(market, time)
 
 	if !isSet {
 		new_candle, err := wrapper.UpdateMappedCandles(market, time)
@@ -195,11 +363,19 @@ func (wrapper *ExchangeWrapperSimulator) GetCandle(market *environment.Market, t
 	return candle, nil
 }
 
+// GetHistoricalTrades gets the trades of a market in a time range, from the market data store when configured.
 func (wrapper *ExchangeWrapperSimulator) GetHistoricalTrades(market *environment.Market, start time.Time, end time.Time) (*environment.TradeBook, error) {
+	if wrapper.store != nil {
+		return wrapper.store.Trades(wrapper.innerWrapper, market, start, end)
+	}
 	return wrapper.innerWrapper.GetHistoricalTrades(market, start, end)
 }
 
+// GetHistoricalCandles gets the candle data of a time range, from the market data store when configured.
 func (wrapper *ExchangeWrapperSimulator) GetHistoricalCandles(market *environment.Market, start time.Time, end time.Time, interval int) ([]environment.CandleStick, error) {
+	if wrapper.store != nil {
+		return wrapper.store.Candles(wrapper.innerWrapper, market, start, end, interval)
+	}
 	return wrapper.innerWrapper.GetHistoricalCandles(market, start, end, interval)
 }
 
@@ -218,22 +394,89 @@ func (wrapper *ExchangeWrapperSimulator) GetMarketSummary(market *environment.Ma
 		return wrapper.innerWrapper.GetMarketSummary(market)
 	}
 
-	var c_time *time.Time = &time.Time{}
-	*c_time = *wrapper.currDate
-
-	candle, err := wrapper.GetCandle(market, *c_time)
+	candle, err := wrapper.GetCandle(market, wrapper.GetCurrDate())
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &environment.MarketSummary{
-		High:   candle.High,
-		Low:    candle.Low,
-		Volume: candle.Volume,
+	// only the open of the current candle is known yet, the range and volume are those of the candle just closed.
+	summary := &environment.MarketSummary{
+		High:   candle.Open,
+		Low:    candle.Open,
+		Volume: decimal.Zero,
 		Last:   candle.Open,
 		Ask:    candle.Open,
-		Bid:    candle.Close,
+		Bid:    candle.Open,
+	}
+	if closed, err := wrapper.ClosedCandle(market); err == nil {
+		summary.High = decimal.Max(closed.High, candle.Open)
+		summary.Low = decimal.Min(closed.Low, candle.Open)
+		summary.Volume = closed.Volume
+	}
+	return summary, nil
+}
+
+// CurrentCandle gets the candle of the current simulated time, or one made of the 24 hours summary when not replaying history.
+func (wrapper *ExchangeWrapperSimulator) CurrentCandle(market *environment.Market) (*environment.CandleStick, error) {
+	if wrapper.historicalSimulation {
+		return wrapper.GetCandle(market, wrapper.GetCurrDate())
+	}
+
+	summary, err := wrapper.innerWrapper.GetMarketSummary(market)
+	if err != nil {
+		return nil, err
+	}
+	return &environment.CandleStick{
+		High:       summary.High,
+		Open:       summary.Last,
+		Close:      summary.Last,
+		Low:        summary.Low,
+		Volume:     summary.Volume,
+		CandleTime: wrapper.GetCurrDate(),
+	}, nil
+}
+
+// ClosedCandle gets the candle closed at the current simulated time, which started an interval earlier.
+func (wrapper *ExchangeWrapperSimulator) ClosedCandle(market *environment.Market) (*environment.CandleStick, error) {
+	if !wrapper.historicalSimulation {
+		return nil, errors.New("candles of the simulator only close when replaying history")
+	}
+	return wrapper.GetCandle(market, wrapper.GetCurrDate().Add(-time.Duration(wrapper.interval)*time.Minute))
+}
+
+// GetMarketSummaries gets the current summaries of many markets, in the same order.
+func (wrapper *ExchangeWrapperSimulator) GetMarketSummaries(markets []*environment.Market) ([]*environment.MarketSummary, error) {
+	if !wrapper.historicalSimulation {
+		return wrapper.innerWrapper.GetMarketSummaries(markets)
+	}
+
+	ret := make([]*environment.MarketSummary, len(markets))
+	for i, market := range markets {
+		summary, err := wrapper.GetMarketSummary(market)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = summary
+	}
+	return ret, nil
+}
+
+// GetTicker gets the updated ticker for a market.
+func (wrapper *ExchangeWrapperSimulator) GetTicker(market *environment.Market) (*environment.Ticker, error) {
+	if !wrapper.historicalSimulation {
+		return wrapper.innerWrapper.GetTicker(market)
+	}
+
+	summary, err := wrapper.GetMarketSummary(market)
+	if err != nil {
+		return nil, err
+	}
+
+	return &environment.Ticker{
+		Ask:  summary.Ask,
+		Bid:  summary.Bid,
+		Last: summary.Last,
 	}, nil
 }
 
@@ -246,7 +489,6 @@ func (wrapper *ExchangeWrapperSimulator) UpdateMappedOrders(market *environment.
 		return nil, err
 	}
 
-	new_map := OrderBookMap{TimeMap: make(map[string]*environment.OrderBook)}
 	curr_map_time := from_time
 
 	var c_asks []environment.Order = make([]environment.Order, 0)
@@ -279,21 +521,15 @@ func (wrapper *ExchangeWrapperSimulator) UpdateMappedOrders(market *environment.
 
 	}
 
-	curr_map_time_key := fmt.Sprint(curr_map_time.Unix())
 	new_order_book := environment.OrderBook{
 		Asks: c_asks,
 		Bids: c_bids,
 	}
+	new_order_book.Sort()
 
-	new_map.TimeMap[curr_map_time_key] = &new_order_book
-	wrapper.orders.SetMap(market, new_map)
+	wrapper.orders.Set(market, curr_map_time, &new_order_book)
 
-	order, isSet := wrapper.orders.GetTime(market, from_time)
-	if !isSet {
-		return nil, errors.New("no data for that time  set panic")
-	}
-
-	return order, nil
+	return &new_order_book, nil
 }
 
 // GetOrderBook gets the order(ASK + BID) book of a market.
@@ -302,10 +538,10 @@ func (wrapper *ExchangeWrapperSimulator) GetOrderBook(market *environment.Market
 		return wrapper.innerWrapper.GetOrderBook(market)
 	}
 
-	order, isSet := wrapper.orders.GetTime(market, *wrapper.currDate)
+	order, isSet := wrapper.orders.Get(market, wrapper.GetCurrDate())
 
 	if !isSet {
-		order, err := wrapper.UpdateMappedOrders(market, *wrapper.currDate)
+		order, err := wrapper.UpdateMappedOrders(market, wrapper.GetCurrDate())
 
 		if err != nil {
 			return nil, err
@@ -316,281 +552,369 @@ func (wrapper *ExchangeWrapperSimulator) GetOrderBook(market *environment.Market
 	return order, nil
 }
 
+// BuyLimit places a FAKE limit buy order, filled over the following candles whose low reaches limit.
 func (wrapper *ExchangeWrapperSimulator) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
-	baseBalance, _ := wrapper.GetBalance(market.BaseCurrency)
-	quoteBalance, _ := wrapper.GetBalance(market.MarketCurrency)
+	return wrapper.restOrder(environment.OrderRequest{Market: market, Side: environment.Buy, Type: environment.LimitOrder, Amount: amount, LimitPrice: limit})
+}
 
-	orderbook, err := wrapper.GetOrderBook(market)
-	if err != nil {
-		return "", errors.Annotate(err, "Cannot market buy without orderbook knowledge")
-	}
+// SellLimit places a FAKE limit sell order, filled over the following candles whose high reaches limit.
+func (wrapper *ExchangeWrapperSimulator) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return wrapper.restOrder(environment.OrderRequest{Market: market, Side: environment.Sell, Type: environment.LimitOrder, Amount: amount, LimitPrice: limit})
+}
 
-	totalQuote := decimal.Zero
-	remainingAmount := amount
-	expense := decimal.Zero
-	avg_price := decimal.Zero
+// BuyMarket performs a FAKE market buy action.
+func (wrapper *ExchangeWrapperSimulator) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.fillOrder(market, environment.Buy, environment.MarketPrice, amount, decimal.Zero)
+}
 
-	for _, ask := range orderbook.Asks {
-		if ask.Value.LessThan(limit) {
-			continue
-		}
+// SellMarket performs a FAKE market sell action.
+func (wrapper *ExchangeWrapperSimulator) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return wrapper.fillOrder(market, environment.Sell, environment.MarketPrice, amount, decimal.Zero)
+}
 
-		if remainingAmount.LessThanOrEqual(ask.Quantity) {
-			totalQuote = totalQuote.Add(remainingAmount)
-			expense = expense.Add(remainingAmount.Mul(ask.Value))
-			avg_price = ask.Value
-			if expense.GreaterThan(*quoteBalance) {
-				return "", fmt.Errorf("cannot Buy not enough %s balance", market.BaseCurrency)
-			}
-			break
-		}
+// fillOrder fills an order with the fill model, updating the balances and recording the resulting trade.
+func (wrapper *ExchangeWrapperSimulator) fillOrder(market *environment.Market, side environment.TradeSide, tradeType environment.TradeType, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	baseBalance, _ := wrapper.GetBalance(market.BaseCurrency)
+	quoteBalance, _ := wrapper.GetBalance(market.MarketCurrency)
+	baseTotal, quoteTotal := wrapper.balances[market.BaseCurrency], wrapper.balances[market.MarketCurrency]
 
-		old_totalQuote := totalQuote
-		new_totalQuote := totalQuote.Add(ask.Quantity)
-		avg_price = (old_totalQuote.Mul(avg_price).Add((ask.Quantity.Mul(ask.Value)))).Div(new_totalQuote)
+	if side == environment.Sell && baseBalance.LessThan(amount) {
+		return "", fmt.Errorf("cannot Sell: not enough %s balance", market.BaseCurrency)
+	}
 
-		totalQuote = new_totalQuote
-		remainingAmount = remainingAmount.Sub(ask.Quantity)
+	fill, err := wrapper.fillModel.Fill(wrapper, FillRequest{Market: market, Side: side, Amount: amount, Limit: limit})
+	if err != nil {
+		return "", errors.Annotatef(err, "cannot %s without market data", strings.ToLower(side.String()))
+	}
+	if !fill.Quantity.IsPositive() {
+		return "", fmt.Errorf("cannot %s: no liquidity to fill %s %s", side, amount, market.Name)
+	}
 
-		expense = expense.Add(ask.Quantity.Mul(ask.Value))
+	fees := wrapper.CalculateTradingFees(market, fill.Quantity, fill.AveragePrice, side)
+
+	if side == environment.Buy {
+		expense := fill.Total.Add(fees)
 		if expense.GreaterThan(*quoteBalance) {
-			return "", fmt.Errorf("cannot Buy not enough %s balance", market.BaseCurrency)
+			return "", fmt.Errorf("cannot Buy: not enough %s balance", market.MarketCurrency)
 		}
+		wrapper.balances[market.BaseCurrency] = baseTotal.Add(fill.Quantity)
+		wrapper.balances[market.MarketCurrency] = quoteTotal.Sub(expense)
+	} else {
+		wrapper.balances[market.BaseCurrency] = baseTotal.Sub(fill.Quantity)
+		wrapper.balances[market.MarketCurrency] = quoteTotal.Add(fill.Total.Sub(fees))
 	}
 
-	fees := wrapper.CalculateTradingFees(market, totalQuote, avg_price, environment.Buy)
-	expense = expense.Add(fees)
-
-	wrapper.balances[market.BaseCurrency] = baseBalance.Add(totalQuote)
-	wrapper.balances[market.MarketCurrency] = quoteBalance.Sub(expense)
-
 	orderFakeID, err := uuid.NewV4()
 	if err != nil {
 		return "", errors.Annotate(err, "UUID Generation")
 	}
 
+	// the remainder of a partial fill is not left resting, like an IOC order.
+	status := environment.Complete
+	if fill.Quantity.LessThan(amount) {
+		status = environment.Partial
+	}
+
 	new_trade := environment.Trade{
-		Price:        avg_price,
+		Price:        fill.AveragePrice,
 		AskQuantity:  amount,
-		FillQuantity: totalQuote,
+		FillQuantity: fill.Quantity,
 		Fees:         fees,
 		Market:       market.Name,
-		Side:         environment.Buy,
-		Status:       environment.Complete,
-		Type:         environment.LimitOrder,
+		Side:         side,
+		Status:       status,
+		Type:         tradeType,
 		TradeNumber:  orderFakeID.String(),
-		Timestamp:    time.Now(),
+		Timestamp:    wrapper.GetCurrDate().Add(fill.Latency),
 	}
 	wrapper.AddTrade(market, new_trade)
 
-	return fmt.Sprintf("FAKE_BUY-%s", new_trade.String()), nil
+	return fmt.Sprintf("FAKE_%s-%s", strings.ToUpper(side.String()), new_trade.String()), nil
 }
 
-// SellLimit here is just to implement the ExchangeWrapper Interface, do not use, use SellMarket instead.
-func (wrapper *ExchangeWrapperSimulator) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
-	baseBalance, _ := wrapper.GetBalance(market.BaseCurrency)
-	quoteBalance, _ := wrapper.GetBalance(market.MarketCurrency)
-
-	orderbook, err := wrapper.GetOrderBook(market)
-	if err != nil {
-		return "", errors.Annotate(err, "cannot market sell without orderbook knowledge")
+// PlaceOrder places an order of any supported type, stop orders wait until the simulated price reaches their stop price
+// and limit orders rest until it reaches their limit, unless IOC.
+func (wrapper *ExchangeWrapperSimulator) PlaceOrder(order environment.OrderRequest) (string, error) {
+	if err := order.Validate(); err != nil {
+		return "", err
 	}
 
-	totalQuote := decimal.Zero
-	remainingAmount := amount
-	gain := decimal.Zero
-	avg_price := decimal.Zero
-
-	if baseBalance.LessThan(remainingAmount) {
-		return "", fmt.Errorf("cannot Sell: not enough %s balance", market.MarketCurrency)
+	if order.Type.IsStop() {
+		orderFakeID, err := uuid.NewV4()
+		if err != nil {
+			return "", errors.Annotate(err, "UUID Generation")
+		}
+		orderID := fmt.Sprintf("FAKE_STOP-%s", orderFakeID.String())
+		wrapper.stopOrders = append(wrapper.stopOrders, &restingOrder{id: orderID, order: order, remaining: order.Amount})
+		return orderID, nil
 	}
 
-	for _, bid := range orderbook.Bids {
-		if bid.Value.GreaterThan(limit) {
-			continue
+	if order.PostOnly {
+		orderbook, err := wrapper.GetOrderBook(order.Market)
+		if err != nil {
+			return "", errors.Annotate(err, "Cannot place post only order without orderbook knowledge")
 		}
-
-		if remainingAmount.LessThanOrEqual(bid.Quantity) {
-			totalQuote = totalQuote.Add(remainingAmount)
-			gain = gain.Add(remainingAmount.Mul(bid.Value))
-			avg_price = bid.Value
-			break
+		if wouldCross(orderbook, order.Side, order.LimitPrice) {
+			return "", errors.New("post only order would take liquidity")
 		}
+	}
 
-		old_totalQuote := totalQuote
-		new_totalQuote := totalQuote.Add(bid.Quantity)
-		avg_price = (old_totalQuote.Mul(avg_price).Add((bid.Quantity.Mul(bid.Value)))).Div(new_totalQuote)
+	return wrapper.executeOrder(order)
+}
 
-		totalQuote = new_totalQuote
-		remainingAmount = remainingAmount.Sub(bid.Quantity)
-		gain = gain.Add(bid.Quantity.Mul(bid.Value))
+// executeOrder fills a market or IOC limit order at once, other limit orders are left resting.
+func (wrapper *ExchangeWrapperSimulator) executeOrder(order environment.OrderRequest) (string, error) {
+	if order.Type == environment.LimitOrder && order.TimeInForce != environment.ImmediateOrCancel {
+		return wrapper.restOrder(order)
 	}
 
-	fees := wrapper.CalculateTradingFees(market, totalQuote, avg_price, environment.Sell)
-	gain = gain.Sub(fees)
+	limit := decimal.Zero
+	if order.Type == environment.LimitOrder {
+		limit = order.LimitPrice
+	}
+	return wrapper.fillOrder(order.Market, order.Side, order.Type, order.Amount, limit)
+}
 
-	wrapper.balances[market.BaseCurrency] = baseBalance.Sub(totalQuote)
-	wrapper.balances[market.MarketCurrency] = quoteBalance.Add(gain)
+// restOrder adds a limit order to the simulated book, holding the funds it needs until it is filled or canceled.
+func (wrapper *ExchangeWrapperSimulator) restOrder(order environment.OrderRequest) (string, error) {
+	if err := order.Validate(); err != nil {
+		return "", err
+	}
+
+	resting := &restingOrder{order: order, remaining: order.Amount}
+	coin, hold := wrapper.orderHold(resting)
+	available, _ := wrapper.GetBalance(coin)
+	if hold.GreaterThan(*available) {
+		return "", fmt.Errorf("cannot %s: not enough %s balance", order.Side, coin)
+	}
 
 	orderFakeID, err := uuid.NewV4()
 	if err != nil {
 		return "", errors.Annotate(err, "UUID Generation")
 	}
+	resting.id = fmt.Sprintf("FAKE_LIMIT-%s", orderFakeID.String())
 
-	new_trade := environment.Trade{
-		Price:        avg_price,
-		AskQuantity:  amount,
-		FillQuantity: totalQuote,
-		Fees:         fees,
-		Market:       market.Name,
-		Side:         environment.Sell,
-		Status:       environment.Complete,
-		Type:         environment.LimitOrder,
-		TradeNumber:  orderFakeID.String(),
-		Timestamp:    time.Now(),
-	}
-	wrapper.AddTrade(market, new_trade)
+	wrapper.openOrders = append(wrapper.openOrders, resting)
+	return resting.id, nil
+}
 
-	return fmt.Sprintf("FAKE_SELL-%s", new_trade.String()), nil
+// CancelOrder cancels a FAKE resting limit order or pending stop order.
+func (wrapper *ExchangeWrapperSimulator) CancelOrder(market *environment.Market, side environment.TradeSide, orderID string) error {
+	for _, orders := range []*[]*restingOrder{&wrapper.stopOrders, &wrapper.openOrders} {
+		for i, pending := range *orders {
+			if pending.id == orderID {
+				*orders = append((*orders)[:i:i], (*orders)[i+1:]...)
+				return nil
+			}
+		}
+	}
+	return errors.New("order " + orderID + " not found")
 }
 
-// BuyMarket performs a FAKE market buy action.
-func (wrapper *ExchangeWrapperSimulator) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
-	baseBalance, _ := wrapper.GetBalance(market.BaseCurrency)
-	quoteBalance, _ := wrapper.GetBalance(market.MarketCurrency)
+// orderHold returns the coin and the amount of it held by a resting order: the quote coin with fees for buys, the base coin for sells.
+func (wrapper *ExchangeWrapperSimulator) orderHold(resting *restingOrder) (string, decimal.Decimal) {
+	market := resting.order.Market
+	if resting.order.Side == environment.Sell {
+		return market.BaseCurrency, resting.remaining
+	}
+	total := resting.remaining.Mul(resting.order.LimitPrice)
+	return market.MarketCurrency, total.Add(wrapper.CalculateTradingFees(market, resting.remaining, resting.order.LimitPrice, environment.Buy))
+}
 
-	orderbook, err := wrapper.GetOrderBook(market)
-	if err != nil {
-		return "", errors.Annotate(err, "Cannot market buy without orderbook knowledge")
+// heldBalance returns the amount of a coin held by the resting orders.
+func (wrapper *ExchangeWrapperSimulator) heldBalance(coin string) decimal.Decimal {
+	held := decimal.Zero
+	for _, resting := range wrapper.openOrders {
+		if holdCoin, hold := wrapper.orderHold(resting); holdCoin == coin {
+			held = held.Add(hold)
+		}
 	}
+	return held
+}
 
-	totalQuote := decimal.Zero
-	remainingAmount := amount
-	expense := decimal.Zero
-	avg_price := decimal.Zero
+// matchOpenOrders fills the resting orders reached by the matched candle of their market, in placement order and within
+// the candle volume, recording the fills at the specified time. Expired orders are dropped.
+func (wrapper *ExchangeWrapperSimulator) matchOpenOrders(fillTime time.Time) {
+	candles := make(map[string]*environment.CandleStick)
+	liquidity := make(map[string]decimal.Decimal)
 
-	for _, ask := range orderbook.Asks {
-		if remainingAmount.LessThanOrEqual(ask.Quantity) {
-			totalQuote = totalQuote.Add(remainingAmount)
-			expense = expense.Add(remainingAmount.Mul(ask.Value))
-			avg_price = ask.Value
-			if expense.GreaterThan(*quoteBalance) {
-				return "", fmt.Errorf("cannot Buy not enough %s balance", market.BaseCurrency)
+	kept := make([]*restingOrder, 0, len(wrapper.openOrders))
+	for _, resting := range wrapper.openOrders {
+		order := resting.order
+		if order.TimeInForce == environment.GoodTillDate && fillTime.After(order.ExpireTime) {
+			continue
+		}
+		kept = append(kept, resting)
+
+		marketName := order.Market.Name
+		candle, known := candles[marketName]
+		if !known {
+			var err error
+			if candle, err = wrapper.matchedCandle(order.Market); err != nil {
+				logrus.Warn("cannot match open orders of "+marketName+": ", err)
+			} else {
+				liquidity[marketName] = candle.Volume
 			}
-			break
+			candles[marketName] = candle
+		}
+		if candle == nil {
+			continue
 		}
 
-		old_totalQuote := totalQuote
-		new_totalQuote := totalQuote.Add(ask.Quantity)
-		avg_price = (old_totalQuote.Mul(avg_price).Add((ask.Quantity.Mul(ask.Value)))).Div(new_totalQuote)
-
-		totalQuote = new_totalQuote
-		remainingAmount = remainingAmount.Sub(ask.Quantity)
-
-		expense = expense.Add(ask.Quantity.Mul(ask.Value))
-		if expense.GreaterThan(*quoteBalance) {
-			return "", fmt.Errorf("cannot Buy not enough %s balance", market.BaseCurrency)
+		price, reached := limitFillPrice(candle, order.Side, order.LimitPrice)
+		quantity := decimal.Min(resting.remaining, liquidity[marketName])
+		if reached && quantity.IsPositive() {
+			wrapper.fillRestingOrder(resting, quantity, price, fillTime)
+			liquidity[marketName] = liquidity[marketName].Sub(quantity)
+		}
+		if !resting.remaining.IsPositive() {
+			kept = kept[:len(kept)-1]
 		}
 	}
+	wrapper.openOrders = kept
+}
 
-	fees := wrapper.CalculateTradingFees(market, totalQuote, avg_price, environment.Buy)
-	expense = expense.Add(fees)
+// matchedCandle gets the candle the pending orders are matched against: the candle just closed when replaying history,
+// the current one made of the last 24 hours otherwise.
+func (wrapper *ExchangeWrapperSimulator) matchedCandle(market *environment.Market) (*environment.CandleStick, error) {
+	if wrapper.historicalSimulation {
+		return wrapper.ClosedCandle(market)
+	}
+	return wrapper.CurrentCandle(market)
+}
 
-	wrapper.balances[market.BaseCurrency] = baseBalance.Add(totalQuote)
-	wrapper.balances[market.MarketCurrency] = quoteBalance.Sub(expense)
+// fillRestingOrder fills part of a pending order, updating the balances and recording the fill as a trade of the order.
+func (wrapper *ExchangeWrapperSimulator) fillRestingOrder(resting *restingOrder, quantity decimal.Decimal, price decimal.Decimal, fillTime time.Time) {
+	market, side := resting.order.Market, resting.order.Side
+	total := quantity.Mul(price)
+	fees := wrapper.CalculateTradingFees(market, quantity, price, side)
 
-	orderFakeID, err := uuid.NewV4()
-	if err != nil {
-		return "", errors.Annotate(err, "UUID Generation")
+	if side == environment.Buy {
+		wrapper.balances[market.BaseCurrency] = wrapper.balances[market.BaseCurrency].Add(quantity)
+		wrapper.balances[market.MarketCurrency] = wrapper.balances[market.MarketCurrency].Sub(total.Add(fees))
+	} else {
+		wrapper.balances[market.BaseCurrency] = wrapper.balances[market.BaseCurrency].Sub(quantity)
+		wrapper.balances[market.MarketCurrency] = wrapper.balances[market.MarketCurrency].Add(total.Sub(fees))
 	}
-	new_trade := environment.Trade{
-		Price:        avg_price,
-		AskQuantity:  amount,
-		FillQuantity: totalQuote,
-		Fees:         fees,
-		Market:       market.Name,
-		Side:         environment.Buy,
-		Status:       environment.Complete,
-		Type:         environment.MarketPrice,
-		TradeNumber:  orderFakeID.String(),
-		Timestamp:    time.Now(),
+	resting.remaining = resting.remaining.Sub(quantity)
+
+	// every fill but the last of the order is partial, the order resting for its remainder.
+	status := environment.Complete
+	if resting.remaining.IsPositive() {
+		status = environment.Partial
 	}
-	wrapper.AddTrade(market, new_trade)
 
-	return fmt.Sprintf("FAKE_BUY-%s", new_trade.String()), nil
+	wrapper.AddTrade(market, environment.Trade{
+		Price:        price,
+		AskQuantity:  resting.order.Amount,
+		FillQuantity: quantity,
+		Fees:         fees,
+		Market:       market.Name,
+		Side:         side,
+		Status:       status,
+		Type:         resting.order.Type,
+		TradeNumber:  resting.id,
+		Timestamp:    fillTime,
+	})
 }
 
-// SellMarket performs a FAKE market buy action.
-func (wrapper *ExchangeWrapperSimulator) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
-	baseBalance, _ := wrapper.GetBalance(market.BaseCurrency)
-	quoteBalance, _ := wrapper.GetBalance(market.MarketCurrency)
-
-	orderbook, err := wrapper.GetOrderBook(market)
-	if err != nil {
-		return "", errors.Annotate(err, "cannot market sell without orderbook knowledge")
+// limitFillPrice returns the price a limit order is filled at during a candle, if the candle reaches its limit:
+// the limit itself, or the open when the candle opens beyond it.
+func limitFillPrice(candle *environment.CandleStick, side environment.TradeSide, limit decimal.Decimal) (decimal.Decimal, bool) {
+	if side == environment.Buy {
+		return decimal.Min(limit, candle.Open), candle.Low.LessThanOrEqual(limit)
 	}
+	return decimal.Max(limit, candle.Open), candle.High.GreaterThanOrEqual(limit)
+}
 
-	totalQuote := decimal.Zero
-	remainingAmount := amount
-	gain := decimal.Zero
-	avg_price := decimal.Zero
+// triggerStopOrders executes the pending stop orders whose stop price was reached by the candle just closed, in
+// placement order, recording the fills at the specified time. Expired orders are dropped.
+//
+//	NOTE: a triggered order fills at its stop price, or at the open of the candle when it opened beyond it. A stop limit
+//	order whose limit is not reached by that price rests as a limit order from the next candle on.
+func (wrapper *ExchangeWrapperSimulator) triggerStopOrders(fillTime time.Time) {
+	candles := make(map[string]*environment.CandleStick)
+
+	kept := make([]*restingOrder, 0, len(wrapper.stopOrders))
+	for _, stop := range wrapper.stopOrders {
+		order := stop.order
+		if order.TimeInForce == environment.GoodTillDate && fillTime.After(order.ExpireTime) {
+			continue
+		}
 
-	if baseBalance.LessThan(remainingAmount) {
-		return "", fmt.Errorf("cannot Sell: not enough %s balance", market.MarketCurrency)
-	}
+		candle, known := candles[order.Market.Name]
+		if !known {
+			var err error
+			if candle, err = wrapper.ClosedCandle(order.Market); err != nil {
+				logrus.Warn("cannot evaluate stop orders of "+order.Market.Name+": ", err)
+			}
+			candles[order.Market.Name] = candle
+		}
+		if candle == nil {
+			kept = append(kept, stop)
+			continue
+		}
 
-	for _, bid := range orderbook.Bids {
-		if remainingAmount.LessThanOrEqual(bid.Quantity) {
-			totalQuote = totalQuote.Add(remainingAmount)
-			gain = gain.Add(remainingAmount.Mul(bid.Value))
-			avg_price = bid.Value
-			break
+		price, triggered := stopFillPrice(candle, order.Side, order.StopPrice)
+		if !triggered {
+			kept = append(kept, stop)
+			continue
 		}
 
-		old_totalQuote := totalQuote
-		new_totalQuote := totalQuote.Add(bid.Quantity)
-		avg_price = (old_totalQuote.Mul(avg_price).Add((bid.Quantity.Mul(bid.Value)))).Div(new_totalQuote)
+		if order.Type == environment.StopLimitOrder {
+			order.Type = environment.LimitOrder
+			reached := (order.Side == environment.Buy && price.LessThanOrEqual(order.LimitPrice)) ||
+				(order.Side == environment.Sell && price.GreaterThanOrEqual(order.LimitPrice))
+			if !reached {
+				if _, err := wrapper.restOrder(order); err != nil {
+					logrus.Warn("cannot rest triggered stop order "+stop.id+": ", err)
+				}
+				continue
+			}
+		} else {
+			order.Type = environment.MarketPrice
+		}
 
-		totalQuote = new_totalQuote
-		remainingAmount = remainingAmount.Sub(bid.Quantity)
-		gain = gain.Add(bid.Quantity.Mul(bid.Value))
+		coin, needed := order.Market.BaseCurrency, order.Amount
+		if order.Side == environment.Buy {
+			coin = order.Market.MarketCurrency
+			needed = order.Amount.Mul(price).Add(wrapper.CalculateTradingFees(order.Market, order.Amount, price, order.Side))
+		}
+		if available, _ := wrapper.GetBalance(coin); needed.GreaterThan(*available) {
+			logrus.Warn("cannot execute triggered stop order " + stop.id + ": not enough " + coin + " balance")
+			continue
+		}
+		wrapper.fillRestingOrder(&restingOrder{id: stop.id, order: order, remaining: order.Amount}, order.Amount, price, fillTime)
 	}
+	wrapper.stopOrders = kept
+}
 
-	fees := wrapper.CalculateTradingFees(market, totalQuote, avg_price, environment.Sell)
-	gain = gain.Sub(fees)
-
-	wrapper.balances[market.BaseCurrency] = baseBalance.Sub(totalQuote)
-	wrapper.balances[market.MarketCurrency] = quoteBalance.Add(gain)
-
-	orderFakeID, err := uuid.NewV4()
-	if err != nil {
-		return "", errors.Annotate(err, "UUID Generation")
+// stopFillPrice returns the price a stop order is filled at during a candle, if the candle reaches its stop price: the
+// stop price itself, or the open when the candle opens beyond it.
+func stopFillPrice(candle *environment.CandleStick, side environment.TradeSide, stop decimal.Decimal) (decimal.Decimal, bool) {
+	if side == environment.Buy {
+		return decimal.Max(stop, candle.Open), candle.High.GreaterThanOrEqual(stop)
 	}
+	return decimal.Min(stop, candle.Open), candle.Low.LessThanOrEqual(stop)
+}
 
-	new_trade := environment.Trade{
-		Price:        avg_price,
-		AskQuantity:  amount,
-		FillQuantity: totalQuote,
-		Fees:         fees,
-		Market:       market.Name,
-		Side:         environment.Sell,
-		Status:       environment.Complete,
-		Type:         environment.MarketPrice,
-		TradeNumber:  orderFakeID.String(),
-		Timestamp:    time.Now(),
+// wouldCross checks whether a limit order at the specified price would match an order already in the book.
+func wouldCross(orderbook *environment.OrderBook, side environment.TradeSide, limit decimal.Decimal) bool {
+	if side == environment.Buy {
+		bestAsk, exists := orderbook.BestAsk()
+		return exists && bestAsk.Value.LessThanOrEqual(limit)
 	}
-	wrapper.AddTrade(market, new_trade)
-
-	return fmt.Sprintf("FAKE_SELL-%s", new_trade.String()), nil
+	bestBid, exists := orderbook.BestBid()
+	return exists && bestBid.Value.GreaterThanOrEqual(limit)
 }
 
 func (wrapper *ExchangeWrapperSimulator) AddTrade(market *environment.Market, trade environment.Trade) error {
-	tradeBook, isSet := wrapper.trades.Get(market)
-	if !isSet {
-		wrapper.trades.Set(market, &environment.TradeBook{Trades: []environment.Trade{trade}})
-	} else {
-		wrapper.trades.Set(market, &environment.TradeBook{Trades: append(tradeBook.Trades, trade)})
-	}
+	wrapper.trades.Update(market, func(tradeBook *environment.TradeBook, isSet bool) *environment.TradeBook {
+		if !isSet {
+			return &environment.TradeBook{Trades: []environment.Trade{trade}}
+		}
+		return &environment.TradeBook{Trades: append(tradeBook.Trades, trade)}
+	})
 
 	return nil
 }
@@ -625,7 +949,7 @@ func (wrapper *ExchangeWrapperSimulator) GetFilteredTrades(market *environment.M
 	finalTradeBook := environment.NewTradeBook()
 	if !isSet {
 		var err error
-		tradeBook, err = wrapper.UpdateTrades(market, *wrapper.currDate)
+		tradeBook, err = wrapper.UpdateTrades(market, wrapper.GetCurrDate())
 		if err != nil {
 			return nil, err
 		}
@@ -645,12 +969,18 @@ func (wrapper *ExchangeWrapperSimulator) CalculateTradingFees(market *environmen
 	return wrapper.innerWrapper.CalculateTradingFees(market, amount, limit, orderSide)
 }
 
-// CalculateWithdrawFees calculates the withdrawal fees on a specified market.
+// CalculateWithdrawFees calculates the withdrawal fees on a specified market, using the simulated flat fee of the coin.
 func (wrapper *ExchangeWrapperSimulator) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) decimal.Decimal {
-	return wrapper.innerWrapper.CalculateWithdrawFees(market, amount)
+	fee, exists := wrapper.withdrawFees[market.BaseCurrency]
+	if !exists {
+		return decimal.Zero
+	}
+	return fee
 }
 
 // GetBalance gets the balance of the user of the specified currency.
+//
+//	NOTE: the amount held by resting limit orders is not available.
 func (wrapper *ExchangeWrapperSimulator) GetBalance(symbol string) (*decimal.Decimal, error) {
 	bal, exists := wrapper.balances[symbol]
 	if !exists {
@@ -658,12 +988,41 @@ func (wrapper *ExchangeWrapperSimulator) GetBalance(symbol string) (*decimal.Dec
 		var bal = decimal.Zero
 		return &bal, nil
 	}
+	bal = bal.Sub(wrapper.heldBalance(symbol))
 	return &bal, nil
 }
 
+// GetAccountSnapshot gets all the simulated balances, with the resting limit orders and pending stop orders as open orders.
+func (wrapper *ExchangeWrapperSimulator) GetAccountSnapshot() (*environment.AccountSnapshot, error) {
+	snapshot := environment.NewAccountSnapshot(wrapper.GetCurrDate())
+	for coin, balance := range wrapper.balances {
+		hold := wrapper.heldBalance(coin)
+		snapshot.SetBalance(coin, environment.AssetBalance{
+			Total:     balance,
+			Available: balance.Sub(hold),
+			Hold:      hold,
+		})
+	}
+
+	for _, pending := range append(wrapper.openOrders[:len(wrapper.openOrders):len(wrapper.openOrders)], wrapper.stopOrders...) {
+		snapshot.OpenOrders = append(snapshot.OpenOrders, environment.Trade{
+			Price:        pending.order.LimitPrice,
+			AskQuantity:  pending.order.Amount,
+			FillQuantity: pending.order.Amount.Sub(pending.remaining),
+			Fees:         decimal.Zero,
+			Market:       pending.order.Market.Name,
+			Side:         pending.order.Side,
+			Status:       environment.Pending,
+			Type:         pending.order.Type,
+			TradeNumber:  pending.id,
+		})
+	}
+	return snapshot, nil
+}
+
 // GetDepositAddress gets the deposit address for the specified coin on the exchange.
 func (wrapper *ExchangeWrapperSimulator) GetDepositAddress(coinTicker string) (string, bool) {
-	return "", false
+	return wrapper.innerWrapper.GetDepositAddress(coinTicker)
 }
 
 // FeedConnect connects to the feed of the exchange.
@@ -672,17 +1031,48 @@ func (wrapper *ExchangeWrapperSimulator) FeedConnect(markets []*environment.Mark
 }
 
 // Withdraw performs a FAKE withdraw operation from the exchange to a destination address.
-func (wrapper *ExchangeWrapperSimulator) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+//
+//	NOTE: the withdrawal completes after the simulated transfer delay, the destination receives the amount minus the simulated fee.
+func (wrapper *ExchangeWrapperSimulator) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) (string, error) {
 	if amount.LessThanOrEqual(decimal.Zero) {
-		return errors.New("Withdraw amount must be > 0")
+		return "", errors.New("Withdraw amount must be > 0")
 	}
 
-	bal, exists := wrapper.balances[coinTicker]
-	if !exists || amount.GreaterThan(bal) {
-		return errors.New("not enough balance")
+	bal, _ := wrapper.GetBalance(coinTicker)
+	if amount.GreaterThan(*bal) {
+		return "", errors.New("not enough balance")
 	}
 
-	wrapper.balances[coinTicker] = bal.Sub(amount)
+	withdrawalFakeID, err := uuid.NewV4()
+	if err != nil {
+		return "", errors.Annotate(err, "UUID Generation")
+	}
 
-	return nil
+	withdrawalID := fmt.Sprintf("FAKE_WITHDRAW-%s", withdrawalFakeID.String())
+	wrapper.balances[coinTicker] = wrapper.balances[coinTicker].Sub(amount)
+	wrapper.withdrawals[withdrawalID] = &simulatedWithdrawal{
+		coin:    coinTicker,
+		amount:  amount,
+		arrival: wrapper.GetCurrDate().Add(wrapper.transferDelay),
+	}
+
+	return withdrawalID, nil
+}
+
+// GetWithdrawStatus gets the status of a FAKE withdrawal, which completes once the simulated transfer delay has passed.
+func (wrapper *ExchangeWrapperSimulator) GetWithdrawStatus(coinTicker string, withdrawalID string) (environment.TransferStatus, error) {
+	withdrawal, exists := wrapper.withdrawals[withdrawalID]
+	if !exists || withdrawal.coin != coinTicker {
+		return environment.TransferFailed, errors.New("withdrawal " + withdrawalID + " not found")
+	}
+
+	if wrapper.GetCurrDate().Before(withdrawal.arrival) {
+		return environment.TransferPending, nil
+	}
+	return environment.TransferComplete, nil
+}
+
+// ReceiveDeposit credits a FAKE deposit coming from another exchange.
+func (wrapper *ExchangeWrapperSimulator) ReceiveDeposit(coinTicker string, amount decimal.Decimal) {
+	wrapper.balances[coinTicker] = wrapper.balances[coinTicker].Add(amount)
 }
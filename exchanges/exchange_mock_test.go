@@ -0,0 +1,288 @@
+package exchanges
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+func TestVolumeFillRecordsPartialTrade(t *testing.T) {
+	wrapper, market := ethSimulator(environment.FillModelConfig{Model: "volume", Participation: decimal.NewFromFloat(0.01)}, "2024-01-02", "2024-01-03")
+
+	closed, err := wrapper.ClosedCandle(market)
+	if err != nil {
+		t.Fatal(err)
+	}
+	amount := closed.Volume
+	if _, err := wrapper.BuyMarket(market, amount); err != nil {
+		t.Fatal(err)
+	}
+
+	trades, err := wrapper.GetFilteredTrades(market, market.Name, environment.Buy, environment.MarketPrice, environment.Partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades.Trades) != 1 {
+		t.Fatalf("got %d partial trades, want 1", len(trades.Trades))
+	}
+	trade := trades.Trades[0]
+	// the order takes its share of the volume of the candle just closed, the volume of the current one is not known yet.
+	if want := closed.Volume.Mul(decimal.NewFromFloat(0.01)); !trade.AskQuantity.Equal(amount) || !trade.FillQuantity.Equal(want) {
+		t.Fatalf("the trade filled %s of %s, want %s", trade.FillQuantity, trade.AskQuantity, want)
+	}
+}
+
+func TestRestingOrdersFillOnTheCandleTheyArePlacedOn(t *testing.T) {
+	wrapper, market := ethSimulator(environment.FillModelConfig{Model: "candle"}, "2024-01-02", "2024-01-04")
+
+	// moves to a candle whose low is below its open, but not reached by the next one.
+	var limit decimal.Decimal
+	for {
+		current, err := wrapper.CurrentCandle(market)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := wrapper.GetCandle(market, wrapper.GetCurrDate().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current.Low.LessThan(next.Low) && current.Low.LessThan(current.Open) {
+			limit = current.Low
+			break
+		}
+		if err := wrapper.IncrementCurrDate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	placed := wrapper.GetCurrDate()
+
+	amount := decimal.NewFromFloat(0.01)
+	order := environment.OrderRequest{
+		Market:      market,
+		Side:        environment.Buy,
+		Type:        environment.LimitOrder,
+		TimeInForce: environment.GoodTillCanceled,
+		Amount:      amount,
+		LimitPrice:  limit,
+	}
+	if _, err := wrapper.PlaceOrder(order); err != nil {
+		t.Fatal(err)
+	}
+	if bought := wrapper.balances["eth"]; !bought.IsZero() {
+		t.Fatalf("the order bought %s eth before its candle closed", bought)
+	}
+	if err := wrapper.IncrementCurrDate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if bought := wrapper.balances["eth"]; !bought.Equal(amount) {
+		t.Fatalf("the order bought %s eth on the candle it was placed on, want %s", bought, amount)
+	}
+	trades, err := wrapper.GetFilteredTrades(market, market.Name, environment.Buy, environment.LimitOrder, environment.Complete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades.Trades) != 1 {
+		t.Fatalf("got %d trades, want 1", len(trades.Trades))
+	}
+	trade := trades.Trades[0]
+	if !trade.Price.Equal(limit) {
+		t.Errorf("the order filled at %s, want its limit %s", trade.Price, limit)
+	}
+	if closed := placed.Add(time.Hour); !trade.Timestamp.Equal(closed) {
+		t.Errorf("the order filled at %s, want the close of its candle %s", trade.Timestamp, closed)
+	}
+}
+
+func TestStopOrders(t *testing.T) {
+	half := decimal.NewFromFloat(0.5)
+	between := func(a decimal.Decimal, b decimal.Decimal) decimal.Decimal { return a.Add(b).Mul(half) }
+
+	tests := []struct {
+		name    string
+		side    environment.TradeSide
+		typ     environment.TradeType
+		stop    func(candle *environment.CandleStick) decimal.Decimal
+		limit   func(candle *environment.CandleStick) decimal.Decimal // nil for stop loss orders.
+		price   func(candle *environment.CandleStick) decimal.Decimal // nil when the order does not fill.
+		pending int                                                   // stop orders left.
+		resting int                                                   // limit orders left.
+	}{
+		{
+			name:  "sell stop reached fills at the stop",
+			side:  environment.Sell,
+			typ:   environment.StopLossOrder,
+			stop:  func(c *environment.CandleStick) decimal.Decimal { return between(c.Open, c.Low) },
+			price: func(c *environment.CandleStick) decimal.Decimal { return between(c.Open, c.Low) },
+		},
+		{
+			name:  "sell stop above the open fills at the open",
+			side:  environment.Sell,
+			typ:   environment.StopLossOrder,
+			stop:  func(c *environment.CandleStick) decimal.Decimal { return between(c.Open, c.High) },
+			price: func(c *environment.CandleStick) decimal.Decimal { return c.Open },
+		},
+		{
+			name:  "buy stop reached fills at the stop",
+			side:  environment.Buy,
+			typ:   environment.StopLossOrder,
+			stop:  func(c *environment.CandleStick) decimal.Decimal { return between(c.Open, c.High) },
+			price: func(c *environment.CandleStick) decimal.Decimal { return between(c.Open, c.High) },
+		},
+		{
+			name:  "buy stop below the open fills at the open",
+			side:  environment.Buy,
+			typ:   environment.StopLossOrder,
+			stop:  func(c *environment.CandleStick) decimal.Decimal { return between(c.Open, c.Low) },
+			price: func(c *environment.CandleStick) decimal.Decimal { return c.Open },
+		},
+		{
+			name:    "sell stop below the low stays pending",
+			side:    environment.Sell,
+			typ:     environment.StopLossOrder,
+			stop:    func(c *environment.CandleStick) decimal.Decimal { return c.Low.Mul(half) },
+			pending: 1,
+		},
+		{
+			name:  "sell stop limit reached fills at the stop",
+			side:  environment.Sell,
+			typ:   environment.StopLimitOrder,
+			stop:  func(c *environment.CandleStick) decimal.Decimal { return between(c.Open, c.Low) },
+			limit: func(c *environment.CandleStick) decimal.Decimal { return c.Low },
+			price: func(c *environment.CandleStick) decimal.Decimal { return between(c.Open, c.Low) },
+		},
+		{
+			name:    "sell stop limit below its limit rests",
+			side:    environment.Sell,
+			typ:     environment.StopLimitOrder,
+			stop:    func(c *environment.CandleStick) decimal.Decimal { return between(c.Open, c.High) },
+			limit:   func(c *environment.CandleStick) decimal.Decimal { return between(c.Open, c.High) },
+			resting: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wrapper, market := ethSimulator(environment.FillModelConfig{Model: "candle"}, "2024-01-02", "2024-01-04")
+			wrapper.balances["eth"] = decimal.NewFromInt(1)
+			candle := rangingCandle(t, wrapper, market)
+			placed := wrapper.GetCurrDate()
+
+			order := environment.OrderRequest{Market: market, Side: test.side, Type: test.typ, Amount: half, StopPrice: test.stop(candle)}
+			if test.limit != nil {
+				order.LimitPrice = test.limit(candle)
+			}
+			if _, err := wrapper.PlaceOrder(order); err != nil {
+				t.Fatal(err)
+			}
+			if err := wrapper.IncrementCurrDate(); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(wrapper.stopOrders) != test.pending || len(wrapper.openOrders) != test.resting {
+				t.Fatalf("got %d stop and %d limit orders left, want %d and %d", len(wrapper.stopOrders), len(wrapper.openOrders), test.pending, test.resting)
+			}
+			tradeBook, _ := wrapper.trades.Get(market)
+			if test.price == nil {
+				if tradeBook != nil && len(tradeBook.Trades) > 0 {
+					t.Fatalf("the order filled at %s", tradeBook.Trades[0].Price)
+				}
+				return
+			}
+			if tradeBook == nil || len(tradeBook.Trades) != 1 {
+				t.Fatal("the order did not fill")
+			}
+			trade := tradeBook.Trades[0]
+			if want := test.price(candle); !trade.Price.Equal(want) || !trade.FillQuantity.Equal(half) {
+				t.Errorf("the order filled %s at %s, want %s at %s", trade.FillQuantity, trade.Price, half, want)
+			}
+			if closed := placed.Add(time.Hour); !trade.Timestamp.Equal(closed) {
+				t.Errorf("the order filled at %s, want the close of its candle %s", trade.Timestamp, closed)
+			}
+		})
+	}
+}
+
+func TestStopOrdersTriggerInPlacementOrder(t *testing.T) {
+	for run := 0; run < 10; run++ {
+		wrapper, market := ethSimulator(environment.FillModelConfig{Model: "candle"}, "2024-01-02", "2024-01-04")
+		wrapper.balances["eth"] = decimal.NewFromInt(1)
+		candle := rangingCandle(t, wrapper, market)
+
+		// every order sells the whole balance, only the first one placed can fill.
+		var ids []string
+		for i := 0; i < 3; i++ {
+			id, err := wrapper.PlaceOrder(environment.OrderRequest{Market: market, Side: environment.Sell, Type: environment.StopLossOrder, Amount: decimal.NewFromInt(1), StopPrice: candle.Open})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		if err := wrapper.IncrementCurrDate(); err != nil {
+			t.Fatal(err)
+		}
+
+		tradeBook, _ := wrapper.trades.Get(market)
+		if tradeBook == nil || len(tradeBook.Trades) != 1 || tradeBook.Trades[0].TradeNumber != ids[0] {
+			t.Fatalf("got trades %v, want only the first order %s filled", tradeBook, ids[0])
+		}
+	}
+}
+
+// rangingCandle steps the simulator to a candle whose low and high are both away from its open, and returns it.
+func rangingCandle(t *testing.T, wrapper *ExchangeWrapperSimulator, market *environment.Market) *environment.CandleStick {
+	t.Helper()
+	for {
+		candle, err := wrapper.CurrentCandle(market)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if candle.Low.LessThan(candle.Open) && candle.High.GreaterThan(candle.Open) {
+			return candle
+		}
+		if err := wrapper.IncrementCurrDate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPaperSubAccountsStepConcurrently(t *testing.T) {
+	wrapper, market := ethSimulator(environment.FillModelConfig{Model: "candle"}, "", "")
+	summary, err := wrapper.GetMarketSummary(market)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	accounts := []ExchangeWrapper{wrapper.SubAccount(), wrapper.SubAccount()}
+	errs := make([]error, len(accounts))
+	for i, account := range accounts {
+		wg.Add(1)
+		go func(i int, account ExchangeWrapper) {
+			defer wg.Done()
+			for step := 0; step < 20 && errs[i] == nil; step++ {
+				_, errs[i] = account.PlaceOrder(environment.OrderRequest{
+					Market:      market,
+					Side:        environment.Buy,
+					Type:        environment.LimitOrder,
+					TimeInForce: environment.GoodTillCanceled,
+					Amount:      decimal.NewFromFloat(0.01),
+					LimitPrice:  summary.Low,
+				})
+				if errs[i] == nil {
+					errs[i] = account.(Stepper).IncrementCurrDate()
+				}
+			}
+		}(i, account)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package exchanges
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFeedHeartbeatTimeout = 30 * time.Second
+	defaultFeedMinBackoff       = time.Second
+	defaultFeedMaxBackoff       = 2 * time.Minute
+)
+
+// FeedConnection represents the websocket feed of an exchange, as driven by a FeedSupervisor.
+type FeedConnection interface {
+	Connect() error                                // Opens the connection.
+	Subscribe(markets []*environment.Market) error // Subscribes to the updates of the specified markets.
+	Read() error                                   // Blocks until the next message (heartbeats included) is received and applied to the caches.
+	Close() error                                  // Closes the connection, making any pending Read return.
+}
+
+// staleMarker is implemented by the caches fed by a feed, which must not be trusted while the feed is down.
+type staleMarker interface {
+	MarkStale(markets []*environment.Market)
+}
+
+// FeedHealth represents the health of the feed of an exchange.
+type FeedHealth struct {
+	Exchange    string    // Name of the exchange of the feed.
+	Connected   bool      // Whether the feed is currently connected and subscribed.
+	LastMessage time.Time // Time the last message was received.
+	Reconnects  int       // Number of reconnections since the feed was started.
+	LastError   string    // Last error of the feed, if any.
+}
+
+// FeedHealthReporter is implemented by wrappers which can supervise their feed.
+type FeedHealthReporter interface {
+	FeedHealth() (FeedHealth, bool) // Returns the health of the feed, false if it is not connected by FeedConnect.
+}
+
+// FeedSupervisorConfig represents the timings of a FeedSupervisor, zero values are replaced by defaults.
+type FeedSupervisorConfig struct {
+	HeartbeatTimeout time.Duration // Maximum time without messages before the connection is considered dropped.
+	MinBackoff       time.Duration // Delay before the first reconnection attempt.
+	MaxBackoff       time.Duration // Maximum delay between reconnection attempts.
+}
+
+// FeedSupervisor keeps the feed of an exchange alive: it watches a heartbeat deadline, reconnects with exponential backoff and
+// replays the subscriptions, marking the fed caches stale while the feed is down.
+type FeedSupervisor struct {
+	mutex      *sync.Mutex
+	exchange   string
+	connection FeedConnection
+	config     FeedSupervisorConfig
+	caches     []staleMarker
+	markets    []*environment.Market
+	health     FeedHealth
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// NewFeedSupervisor creates a new FeedSupervisor for the feed of an exchange, keeping the specified caches consistent with it.
+func NewFeedSupervisor(exchange string, connection FeedConnection, config FeedSupervisorConfig, caches ...staleMarker) *FeedSupervisor {
+	if config.HeartbeatTimeout <= 0 {
+		config.HeartbeatTimeout = defaultFeedHeartbeatTimeout
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = defaultFeedMinBackoff
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = defaultFeedMaxBackoff
+	}
+
+	return &FeedSupervisor{
+		mutex:      &sync.Mutex{},
+		exchange:   exchange,
+		connection: connection,
+		config:     config,
+		caches:     caches,
+		health:     FeedHealth{Exchange: exchange},
+	}
+}
+
+// Start connects the feed and subscribes to the markets, then keeps it alive in background until Stop is called.
+func (fs *FeedSupervisor) Start(markets []*environment.Market) error {
+	fs.mutex.Lock()
+	if fs.stop != nil {
+		fs.mutex.Unlock()
+		return errors.New("feed of " + fs.exchange + " already started")
+	}
+	fs.markets = markets
+	fs.mutex.Unlock()
+
+	if err := fs.connect(); err != nil {
+		return err
+	}
+
+	fs.mutex.Lock()
+	fs.stop = make(chan struct{})
+	fs.done = make(chan struct{})
+	fs.mutex.Unlock()
+
+	go fs.run()
+	return nil
+}
+
+// Stop closes the feed and waits for the supervisor to exit.
+func (fs *FeedSupervisor) Stop() {
+	fs.mutex.Lock()
+	stop, done := fs.stop, fs.done
+	fs.mutex.Unlock()
+	if stop == nil {
+		return
+	}
+
+	close(stop)
+	fs.connection.Close()
+	<-done
+}
+
+// FeedHealth returns the current health of the feed.
+func (fs *FeedSupervisor) FeedHealth() FeedHealth {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fs.health
+}
+
+// connect opens the connection and replays the subscriptions.
+func (fs *FeedSupervisor) connect() error {
+	if err := fs.connection.Connect(); err != nil {
+		fs.setError(err)
+		return err
+	}
+	if err := fs.connection.Subscribe(fs.markets); err != nil {
+		fs.connection.Close()
+		fs.setError(err)
+		return err
+	}
+
+	fs.mutex.Lock()
+	fs.health.Connected = true
+	fs.health.LastMessage = time.Now()
+	fs.mutex.Unlock()
+	return nil
+}
+
+// run reads the feed until it drops, then reconnects it, until stopped.
+func (fs *FeedSupervisor) run() {
+	defer close(fs.done)
+
+	for {
+		err := fs.readUntilDropped()
+		if fs.stopped() {
+			return
+		}
+
+		logrus.Warn("feed of "+fs.exchange+" dropped: ", err)
+		fs.markDown(err)
+
+		if !fs.reconnect() {
+			return
+		}
+	}
+}
+
+// readUntilDropped reads messages until the connection fails or misses its heartbeat deadline.
+func (fs *FeedSupervisor) readUntilDropped() error {
+	// the reader exits once done is closed, so that it never blocks on a message nobody waits for anymore.
+	messages := make(chan error)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			err := fs.connection.Read()
+			select {
+			case messages <- err:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	deadline := time.NewTimer(fs.config.HeartbeatTimeout)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case err := <-messages:
+			if err != nil {
+				return err
+			}
+			fs.mutex.Lock()
+			fs.health.LastMessage = time.Now()
+			fs.mutex.Unlock()
+
+			if !deadline.Stop() {
+				<-deadline.C
+			}
+			deadline.Reset(fs.config.HeartbeatTimeout)
+		case <-deadline.C:
+			// closing the connection unblocks the pending Read, so that the reader can exit.
+			fs.connection.Close()
+			return errors.New("no message received within " + fs.config.HeartbeatTimeout.String())
+		}
+	}
+}
+
+// reconnect retries to connect with exponential backoff, returning false if stopped meanwhile.
+func (fs *FeedSupervisor) reconnect() bool {
+	backoff := fs.config.MinBackoff
+	for {
+		select {
+		case <-fs.stop:
+			return false
+		case <-time.After(backoff):
+		}
+
+		err := fs.connect()
+		if err == nil {
+			fs.mutex.Lock()
+			fs.health.Reconnects++
+			fs.mutex.Unlock()
+			logrus.Info("feed of " + fs.exchange + " reconnected")
+			return true
+		}
+
+		logrus.Warn("cannot reconnect feed of "+fs.exchange+": ", err)
+		backoff *= 2
+		if backoff > fs.config.MaxBackoff {
+			backoff = fs.config.MaxBackoff
+		}
+	}
+}
+
+// markDown records the feed as disconnected and marks the fed caches stale, so that wrappers fall back to REST.
+func (fs *FeedSupervisor) markDown(err error) {
+	fs.setError(err)
+	for _, cache := range fs.caches {
+		cache.MarkStale(fs.markets)
+	}
+}
+
+// setError records the feed as disconnected because of the specified error.
+func (fs *FeedSupervisor) setError(err error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fs.health.Connected = false
+	if err != nil {
+		fs.health.LastError = err.Error()
+	}
+}
+
+// stopped checks whether Stop was called.
+func (fs *FeedSupervisor) stopped() bool {
+	select {
+	case <-fs.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// FeedHealthOf gets the health of the feed of a wrapper, if it is supervised.
+func FeedHealthOf(wrapper ExchangeWrapper) (FeedHealth, bool) {
+	reporter, ok := wrapper.(FeedHealthReporter)
+	if !ok {
+		return FeedHealth{}, false
+	}
+	return reporter.FeedHealth()
+}
+
+// feedMarkets groups the markets by their name on the exchange of the wrapper, returning the names in order: several
+// tactics may trade the same market through distinct Market values, which must all be updated by the feed.
+func feedMarkets(wrapper ExchangeWrapper, markets []*environment.Market) ([]string, map[string][]*environment.Market) {
+	byName := make(map[string][]*environment.Market, len(markets))
+	var names []string
+	for _, market := range markets {
+		name := MarketNameFor(market, wrapper)
+		if _, exists := byName[name]; !exists {
+			names = append(names, name)
+		}
+		byName[name] = append(byName[name], market)
+	}
+	sort.Strings(names)
+	return names, byName
+}
+
+// feedSummary updates the summary of the markets pushed by a feed, and publishes their ticker to the subscribers of
+// the events of the wrapper.
+func feedSummary(wrapper ExchangeWrapper, summaries *SummaryCache, events *EventBus, markets []*environment.Market, summary *environment.MarketSummary) {
+	now := ClockOf(wrapper).Now()
+	for _, market := range markets {
+		summaries.Set(market, summary)
+		events.Publish(environment.Event{
+			Kind:     environment.TickerEvent,
+			Time:     now,
+			Exchange: wrapper.Name(),
+			Market:   market,
+			Ticker:   &environment.Ticker{Ask: summary.Ask, Bid: summary.Bid, Last: summary.Last},
+		})
+	}
+}
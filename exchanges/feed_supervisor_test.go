@@ -0,0 +1,103 @@
+package exchanges
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+)
+
+// silentConnection is a feed which connects but never sends a message, its reads only return once it is closed.
+type silentConnection struct {
+	mutex    *sync.Mutex
+	connects int
+	closed   chan struct{}
+}
+
+func (connection *silentConnection) Connect() error {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	connection.connects++
+	connection.closed = make(chan struct{})
+	return nil
+}
+
+func (connection *silentConnection) Subscribe(markets []*environment.Market) error {
+	return nil
+}
+
+func (connection *silentConnection) Read() error {
+	connection.mutex.Lock()
+	closed := connection.closed
+	connection.mutex.Unlock()
+	<-closed
+	return errors.New("connection closed")
+}
+
+func (connection *silentConnection) Close() error {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	select {
+	case <-connection.closed:
+	default:
+		close(connection.closed)
+	}
+	return nil
+}
+
+// staleRecorder records the markets marked stale.
+type staleRecorder struct {
+	mutex *sync.Mutex
+	marks int
+}
+
+func (recorder *staleRecorder) MarkStale(markets []*environment.Market) {
+	recorder.mutex.Lock()
+	recorder.marks++
+	recorder.mutex.Unlock()
+}
+
+func TestFeedSupervisorReconnectsSilentFeed(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	connection := &silentConnection{mutex: &sync.Mutex{}}
+	cache := &staleRecorder{mutex: &sync.Mutex{}}
+	supervisor := NewFeedSupervisor("test", connection, FeedSupervisorConfig{
+		HeartbeatTimeout: 10 * time.Millisecond,
+		MinBackoff:       time.Millisecond,
+		MaxBackoff:       time.Millisecond,
+	}, cache)
+	if err := supervisor.Start([]*environment.Market{{Name: "ETH-USD"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for health := supervisor.FeedHealth(); health.Reconnects < 3; health = supervisor.FeedHealth() {
+		if time.Now().After(deadline) {
+			t.Fatalf("the feed reconnected %d times, want 3", health.Reconnects)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	supervisor.Stop()
+
+	cache.mutex.Lock()
+	marks := cache.marks
+	cache.mutex.Unlock()
+	if marks < 3 {
+		t.Errorf("the cache was marked stale %d times, want at least 3", marks)
+	}
+	if health := supervisor.FeedHealth(); health.LastError == "" {
+		t.Error("the heartbeat timeout was not recorded")
+	}
+
+	// every reader exits with its connection, none is left blocked on a message nobody waits for.
+	for runtime.NumGoroutine() > goroutines {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left running, want %d", runtime.NumGoroutine(), goroutines)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
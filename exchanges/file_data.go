@@ -0,0 +1,567 @@
+package exchanges
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// defaultFileTradingFee is the fee rate charged on the orders simulated against file data, when none is configured.
+const defaultFileTradingFee = 0.0026
+
+// ErrReadOnlyExchange is the error representing when an exchange only serves market data and cannot trade nor hold funds.
+var ErrReadOnlyExchange = errors.New("cannot trade: exchange only serves market data")
+
+// FileDataWrapper serves market data read from local candle files, to run historical simulations without network access.
+//
+// The candles of a market are read from <dir>/<market name>.csv (or .json) and from every file in <dir>/<market name>/.
+// CSV files may be Kraken OHLCVT dumps, Binance kline files or any file with a header naming the time, open, high,
+// low, close and volume columns; JSON files hold an array of objects with the same keys. Candles are resampled to
+// the requested interval, and trades are synthesized from them.
+type FileDataWrapper struct {
+	dir              string
+	tradingFee       decimal.Decimal // fee rate charged on the orders.
+	depositAddresses map[string]string
+	mutex            *sync.Mutex
+	candles          map[string]*fileCandles // candles by market name, loaded lazily.
+}
+
+// fileCandles represents the candles read from the files of a market.
+type fileCandles struct {
+	series      *environment.CandleSeries
+	granularity time.Duration // shortest time between two candles.
+}
+
+// NewFileDataWrapper creates a new wrapper reading the candle files in the specified directory, charging the specified
+// fee rate on the orders (the kraken taker fee if zero).
+func NewFileDataWrapper(dir string, tradingFee decimal.Decimal, depositAddresses map[string]string) *FileDataWrapper {
+	if tradingFee.IsZero() {
+		tradingFee = decimal.NewFromFloat(defaultFileTradingFee)
+	}
+	return &FileDataWrapper{
+		dir:              dir,
+		tradingFee:       tradingFee,
+		depositAddresses: depositAddresses,
+		mutex:            &sync.Mutex{},
+		candles:          make(map[string]*fileCandles),
+	}
+}
+
+// Name returns the name of the wrapped exchange.
+func (wrapper *FileDataWrapper) Name() string {
+	return "file"
+}
+
+// String returns a string representation of the file wrapper.
+func (wrapper *FileDataWrapper) String() string {
+	return "file(" + wrapper.dir + ")"
+}
+
+func (wrapper *FileDataWrapper) IsHistoricalSimulation() bool {
+	return false
+}
+
+// GetMarkets gets the markets which have candle files, named as their files.
+func (wrapper *FileDataWrapper) GetMarkets() ([]*environment.Market, error) {
+	entries, err := os.ReadDir(wrapper.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	markets := make([]*environment.Market, 0, len(entries))
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() {
+			extension := filepath.Ext(name)
+			if extension != ".csv" && extension != ".json" {
+				continue
+			}
+			name = strings.TrimSuffix(name, extension)
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		markets = append(markets, &environment.Market{Name: name, ExchangeNames: map[string]string{wrapper.Name(): name}})
+	}
+	return markets, nil
+}
+
+// GetCandles gets all the candles of a market, at the granularity of its files.
+func (wrapper *FileDataWrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
+	candles, err := wrapper.load(market)
+	if err != nil {
+		return nil, err
+	}
+	return candles.series.Candles(), nil
+}
+
+// GetHistoricalCandles gets the candles of a market starting in [start, end], resampled to the specified interval in minutes.
+func (wrapper *FileDataWrapper) GetHistoricalCandles(market *environment.Market, start time.Time, end time.Time, interval int) ([]environment.CandleStick, error) {
+	candles, err := wrapper.load(market)
+	if err != nil {
+		return nil, err
+	}
+
+	period := time.Duration(interval) * time.Minute
+	if period <= 0 {
+		return nil, fmt.Errorf("invalid candle interval %d", interval)
+	}
+	if candles.granularity > period {
+		return nil, fmt.Errorf("cannot resample %s candles of %s to %s", candles.granularity, market.Name, period)
+	}
+
+	return resampleCandles(candles.series.Range(start.Truncate(period), end.Truncate(period).Add(period)), period), nil
+}
+
+// GetHistoricalTrades synthesizes the trades of a market in [start, end] from its candles: each candle is traded at its
+// close price at the end of its period, half of its volume bought and half sold.
+func (wrapper *FileDataWrapper) GetHistoricalTrades(market *environment.Market, start time.Time, end time.Time) (*environment.TradeBook, error) {
+	candles, err := wrapper.load(market)
+	if err != nil {
+		return nil, err
+	}
+
+	return CandleTrades(market, candles.series, candles.granularity, start, end), nil
+}
+
+// GetMarketSummary gets the summary of a market over the last 24 hours of its files.
+func (wrapper *FileDataWrapper) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
+	candles, err := wrapper.load(market)
+	if err != nil {
+		return nil, err
+	}
+	last, exists := candles.series.Last()
+	if !exists {
+		return nil, errors.New("no candles for market " + market.Name)
+	}
+
+	day := mergeCandles(candles.series.Range(last.CandleTime.Add(-24*time.Hour).Add(time.Nanosecond), last.CandleTime.Add(time.Nanosecond)))
+	return &environment.MarketSummary{
+		High:   day.High,
+		Low:    day.Low,
+		Volume: day.Volume,
+		Ask:    last.Close,
+		Bid:    last.Close,
+		Last:   last.Close,
+	}, nil
+}
+
+// GetTicker gets the ticker of a market at the last candle of its files.
+func (wrapper *FileDataWrapper) GetTicker(market *environment.Market) (*environment.Ticker, error) {
+	summary, err := wrapper.GetMarketSummary(market)
+	if err != nil {
+		return nil, err
+	}
+	return &environment.Ticker{Ask: summary.Ask, Bid: summary.Bid, Last: summary.Last}, nil
+}
+
+// GetMarketSummaries gets the summaries of many markets, in the same order.
+func (wrapper *FileDataWrapper) GetMarketSummaries(markets []*environment.Market) ([]*environment.MarketSummary, error) {
+	ret := make([]*environment.MarketSummary, len(markets))
+	for i, market := range markets {
+		summary, err := wrapper.GetMarketSummary(market)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = summary
+	}
+	return ret, nil
+}
+
+// GetOrderBook gets a single level orderbook at the close of the last candle of a market.
+func (wrapper *FileDataWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
+	candles, err := wrapper.load(market)
+	if err != nil {
+		return nil, err
+	}
+	last, exists := candles.series.Last()
+	if !exists {
+		return nil, errors.New("no candles for market " + market.Name)
+	}
+
+	level := environment.Order{Value: last.Close, Quantity: last.Volume, Timestamp: last.CandleTime}
+	return &environment.OrderBook{Asks: []environment.Order{level}, Bids: []environment.Order{level}}, nil
+}
+
+// BuyLimit is not supported, as file data cannot be traded.
+func (wrapper *FileDataWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return "", ErrReadOnlyExchange
+}
+
+// SellLimit is not supported, as file data cannot be traded.
+func (wrapper *FileDataWrapper) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return "", ErrReadOnlyExchange
+}
+
+// BuyMarket is not supported, as file data cannot be traded.
+func (wrapper *FileDataWrapper) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return "", ErrReadOnlyExchange
+}
+
+// SellMarket is not supported, as file data cannot be traded.
+func (wrapper *FileDataWrapper) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return "", ErrReadOnlyExchange
+}
+
+// PlaceOrder is not supported, as file data cannot be traded.
+func (wrapper *FileDataWrapper) PlaceOrder(order environment.OrderRequest) (string, error) {
+	return "", ErrReadOnlyExchange
+}
+
+// CancelOrder is not supported, as file data cannot be traded.
+func (wrapper *FileDataWrapper) CancelOrder(market *environment.Market, side environment.TradeSide, orderID string) error {
+	return ErrReadOnlyExchange
+}
+
+// GetAllTrades returns no trades, as file data cannot be traded.
+func (wrapper *FileDataWrapper) GetAllTrades(markets []*environment.Market) (*environment.TradeBook, error) {
+	return environment.NewTradeBook(), nil
+}
+
+// GetAllMarketTrades returns no trades, as file data cannot be traded.
+func (wrapper *FileDataWrapper) GetAllMarketTrades(market *environment.Market) (*environment.TradeBook, error) {
+	return environment.NewTradeBook(), nil
+}
+
+// GetFilteredTrades returns no trades, as file data cannot be traded.
+func (wrapper *FileDataWrapper) GetFilteredTrades(market *environment.Market, symbol string, tradeSide environment.TradeSide, tradeType environment.TradeType, tradeStatus environment.TradeStatus) (*environment.TradeBook, error) {
+	return environment.NewTradeBook(), nil
+}
+
+// CalculateTradingFees calculates the trading fees for an order, at the configured flat rate.
+func (wrapper *FileDataWrapper) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderSide environment.TradeSide) decimal.Decimal {
+	return amount.Mul(limit).Mul(wrapper.tradingFee)
+}
+
+// CalculateWithdrawFees returns no fees, as file data cannot be withdrawn.
+func (wrapper *FileDataWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) decimal.Decimal {
+	return decimal.Zero
+}
+
+// GetBalance is not supported, as file data holds no funds.
+func (wrapper *FileDataWrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
+	return nil, ErrReadOnlyExchange
+}
+
+// GetAccountSnapshot is not supported, as file data holds no funds.
+func (wrapper *FileDataWrapper) GetAccountSnapshot() (*environment.AccountSnapshot, error) {
+	return nil, ErrAccountSnapshotNotSupported
+}
+
+// GetDepositAddress gets the deposit address for the specified coin, if configured.
+func (wrapper *FileDataWrapper) GetDepositAddress(coinTicker string) (string, bool) {
+	addr, exists := wrapper.depositAddresses[coinTicker]
+	return addr, exists
+}
+
+// FeedConnect is not supported, as files have no feed.
+func (wrapper *FileDataWrapper) FeedConnect(markets []*environment.Market) error {
+	return ErrWebsocketNotSupported
+}
+
+// Withdraw is not supported, as file data holds no funds.
+func (wrapper *FileDataWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) (string, error) {
+	return "", ErrReadOnlyExchange
+}
+
+// GetWithdrawStatus is not supported, as file data holds no funds.
+func (wrapper *FileDataWrapper) GetWithdrawStatus(coinTicker string, withdrawalID string) (environment.TransferStatus, error) {
+	return environment.TransferFailed, ErrWithdrawStatusNotSupported
+}
+
+// load gets the candles of a market, reading its files the first time.
+func (wrapper *FileDataWrapper) load(market *environment.Market) (*fileCandles, error) {
+	name := MarketNameFor(market, wrapper)
+	if name == "" {
+		name = market.Name
+	}
+
+	wrapper.mutex.Lock()
+	defer wrapper.mutex.Unlock()
+
+	if candles, loaded := wrapper.candles[name]; loaded {
+		return candles, nil
+	}
+
+	paths := make([]string, 0)
+	for _, extension := range []string{".csv", ".json"} {
+		if _, err := os.Stat(filepath.Join(wrapper.dir, name+extension)); err == nil {
+			paths = append(paths, filepath.Join(wrapper.dir, name+extension))
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(wrapper.dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if extension := filepath.Ext(entry.Name()); !entry.IsDir() && (extension == ".csv" || extension == ".json") {
+			paths = append(paths, filepath.Join(wrapper.dir, name, entry.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("no candle files for market " + name + " in " + wrapper.dir)
+	}
+
+	series := environment.NewCandleSeries()
+	for _, path := range paths {
+		candles, err := readCandleFile(path)
+		if err != nil {
+			return nil, err
+		}
+		series.Insert(candles...)
+	}
+
+	loaded := &fileCandles{series: series, granularity: candleGranularity(series.Candles())}
+	wrapper.candles[name] = loaded
+	return loaded, nil
+}
+
+// candleGranularity returns the shortest time between two consecutive sorted candles.
+func candleGranularity(candles []environment.CandleStick) time.Duration {
+	granularity := time.Duration(0)
+	for i := 1; i < len(candles); i++ {
+		gap := candles[i].CandleTime.Sub(candles[i-1].CandleTime)
+		if granularity == 0 || gap < granularity {
+			granularity = gap
+		}
+	}
+	if granularity == 0 {
+		granularity = time.Minute
+	}
+	return granularity
+}
+
+// CandleTrades synthesizes the trades of a market in [start, end] from candles of the specified period: each candle is
+// traded at its close price at the end of its period, half of its volume bought and half sold.
+func CandleTrades(market *environment.Market, series *environment.CandleSeries, period time.Duration, start time.Time, end time.Time) *environment.TradeBook {
+	half := decimal.NewFromInt(2)
+	ret := environment.NewTradeBook()
+	for _, candle := range series.Range(start.Add(-period), end.Add(time.Nanosecond)) {
+		timestamp := candle.CandleTime.Add(period - time.Second)
+		if timestamp.Before(start) || timestamp.After(end) {
+			continue
+		}
+		for _, side := range []environment.TradeSide{environment.Buy, environment.Sell} {
+			ret.Trades = append(ret.Trades, environment.Trade{
+				Price:        candle.Close,
+				AskQuantity:  candle.Volume.Div(half),
+				FillQuantity: candle.Volume.Div(half),
+				Market:       market.Name,
+				Side:         side,
+				Status:       environment.Complete,
+				Type:         environment.MarketPrice,
+				TradeNumber:  fmt.Sprintf("FILE_%d_%s", timestamp.Unix(), strings.ToUpper(side.String())),
+				Timestamp:    timestamp,
+			})
+		}
+	}
+	return ret
+}
+
+// resampleCandles merges sorted candles into candles of the specified period, aligned to the period.
+func resampleCandles(candles []environment.CandleStick, period time.Duration) []environment.CandleStick {
+	ret := make([]environment.CandleStick, 0)
+	for start := 0; start < len(candles); {
+		bucket := candles[start].CandleTime.Truncate(period)
+		end := start + 1
+		for end < len(candles) && candles[end].CandleTime.Truncate(period).Equal(bucket) {
+			end++
+		}
+
+		merged := mergeCandles(candles[start:end])
+		merged.CandleTime = bucket
+		ret = append(ret, merged)
+		start = end
+	}
+	return ret
+}
+
+// mergeCandles merges sorted candles into a single one, starting at the first of them.
+func mergeCandles(candles []environment.CandleStick) environment.CandleStick {
+	if len(candles) == 0 {
+		return environment.CandleStick{}
+	}
+
+	merged := candles[0]
+	for _, candle := range candles[1:] {
+		merged.High = decimal.Max(merged.High, candle.High)
+		merged.Low = decimal.Min(merged.Low, candle.Low)
+		merged.Close = candle.Close
+		merged.Volume = merged.Volume.Add(candle.Volume)
+	}
+	return merged
+}
+
+// readCandleFile reads the candles of a CSV or JSON file, detecting its layout.
+func readCandleFile(path string) ([]environment.CandleStick, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var candles []environment.CandleStick
+	if filepath.Ext(path) == ".json" {
+		candles, err = readJSONCandles(file)
+	} else {
+		candles, err = readCSVCandles(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return candles, nil
+}
+
+// readCSVCandles reads CSV candles. Files with a header are read by column name, files without one are read as
+// Kraken OHLCVT or Binance kline dumps, which both start with time, open, high, low, close and volume.
+func readCSVCandles(reader io.Reader) ([]environment.CandleStick, error) {
+	rows, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{"time": 0, "open": 1, "high": 2, "low": 3, "close": 4, "volume": 5}
+	if _, err := strconv.ParseFloat(strings.TrimSpace(rows[0][0]), 64); err != nil {
+		columns, err = candleColumns(rows[0])
+		if err != nil {
+			return nil, err
+		}
+		rows = rows[1:]
+	}
+
+	candles := make([]environment.CandleStick, 0, len(rows))
+	for i, row := range rows {
+		fields := make(map[string]string, len(columns))
+		for name, column := range columns {
+			if column >= len(row) {
+				return nil, fmt.Errorf("row %d: missing %s column", i+1, name)
+			}
+			fields[name] = row[column]
+		}
+		candle, err := parseCandle(fields)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		candles = append(candles, candle)
+	}
+	return candles, nil
+}
+
+// candleColumns finds the candle columns in a CSV header.
+func candleColumns(header []string) (map[string]int, error) {
+	aliases := map[string]string{
+		"time": "time", "timestamp": "time", "date": "time", "datetime": "time", "open_time": "time", "opentime": "time",
+		"open": "open", "o": "open",
+		"high": "high", "h": "high",
+		"low": "low", "l": "low",
+		"close": "close", "c": "close",
+		"volume": "volume", "vol": "volume", "v": "volume",
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		if field, exists := aliases[strings.ToLower(strings.TrimSpace(name))]; exists {
+			if _, found := columns[field]; !found {
+				columns[field] = i
+			}
+		}
+	}
+	for _, field := range []string{"time", "open", "high", "low", "close", "volume"} {
+		if _, found := columns[field]; !found {
+			return nil, errors.New("header has no " + field + " column")
+		}
+	}
+	return columns, nil
+}
+
+// readJSONCandles reads a JSON array of candle objects.
+func readJSONCandles(reader io.Reader) ([]environment.CandleStick, error) {
+	var objects []map[string]interface{}
+	if err := json.NewDecoder(reader).Decode(&objects); err != nil {
+		return nil, err
+	}
+
+	candles := make([]environment.CandleStick, 0, len(objects))
+	for i, object := range objects {
+		fields := make(map[string]string, len(object))
+		for key, value := range object {
+			fields[strings.ToLower(key)] = fmt.Sprint(value)
+			if number, isNumber := value.(float64); isNumber {
+				fields[strings.ToLower(key)] = strconv.FormatFloat(number, 'f', -1, 64)
+			}
+		}
+		if _, exists := fields["time"]; !exists {
+			fields["time"] = fields["timestamp"]
+		}
+		candle, err := parseCandle(fields)
+		if err != nil {
+			return nil, fmt.Errorf("candle %d: %w", i, err)
+		}
+		candles = append(candles, candle)
+	}
+	return candles, nil
+}
+
+// parseCandle parses a candle from its time, open, high, low, close and volume fields.
+func parseCandle(fields map[string]string) (environment.CandleStick, error) {
+	candleTime, err := parseCandleTime(strings.TrimSpace(fields["time"]))
+	if err != nil {
+		return environment.CandleStick{}, err
+	}
+
+	values := make([]string, 0, 5)
+	for _, field := range []string{"open", "high", "low", "close", "volume"} {
+		values = append(values, strings.TrimSpace(fields[field]))
+	}
+	parsed, err := parseDecimals(values)
+	if err != nil {
+		return environment.CandleStick{}, err
+	}
+
+	return environment.CandleStick{
+		CandleTime: candleTime,
+		Open:       parsed[0],
+		High:       parsed[1],
+		Low:        parsed[2],
+		Close:      parsed[3],
+		Volume:     parsed[4],
+	}, nil
+}
+
+// parseCandleTime parses a unix timestamp in seconds, milliseconds or microseconds, or a formatted date.
+func parseCandleTime(value string) (time.Time, error) {
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		switch abs := math.Abs(number); {
+		case abs >= 1e14:
+			return time.UnixMicro(int64(number)).UTC(), nil
+		case abs >= 1e11:
+			return time.UnixMilli(int64(number)).UTC(), nil
+		default:
+			return time.Unix(int64(number), 0).UTC(), nil
+		}
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed.UTC(), nil
+		}
+	}
+	return time.Time{}, errors.New("cannot parse candle time " + value)
+}
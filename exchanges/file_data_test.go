@@ -0,0 +1,175 @@
+package exchanges
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// fileCandle is the candle every file of TestReadCandleFile holds.
+var fileCandle = environment.CandleStick{
+	CandleTime: time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC),
+	Open:       decimal.RequireFromString("2300.5"),
+	High:       decimal.RequireFromString("2310"),
+	Low:        decimal.RequireFromString("2295.25"),
+	Close:      decimal.RequireFromString("2305"),
+	Volume:     decimal.RequireFromString("12.5"),
+}
+
+func TestReadCandleFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr bool
+	}{
+		{
+			name:    "kraken ohlcvt",
+			file:    "kraken.csv",
+			content: "1704164400,2300.5,2310,2295.25,2305,12.5,42\n",
+		},
+		{
+			name:    "binance kline",
+			file:    "binance.csv",
+			content: "1704164400000,2300.5,2310,2295.25,2305,12.5,1704167999999,28812.5,42,6,13800,0\n",
+		},
+		{
+			name:    "csv with header",
+			file:    "header.csv",
+			content: "Date,Vol,O,H,L,C\n2024-01-02 03:00:00,12.5,2300.5,2310,2295.25,2305\n",
+		},
+		{
+			name:    "csv with rfc3339 times",
+			file:    "rfc3339.csv",
+			content: "timestamp,open,high,low,close,volume\n2024-01-02T03:00:00Z,2300.5,2310,2295.25,2305,12.5\n",
+		},
+		{
+			name:    "json",
+			file:    "candles.json",
+			content: `[{"time": 1704164400, "open": 2300.5, "high": 2310, "low": 2295.25, "close": 2305, "volume": 12.5}]`,
+		},
+		{
+			name:    "json with timestamp key",
+			file:    "timestamp.json",
+			content: `[{"Timestamp": "2024-01-02T03:00:00Z", "Open": "2300.5", "High": "2310", "Low": "2295.25", "Close": "2305", "Volume": "12.5"}]`,
+		},
+		{
+			name:    "header without volume",
+			file:    "volume.csv",
+			content: "time,open,high,low,close\n1704164400,2300.5,2310,2295.25,2305\n",
+			wantErr: true,
+		},
+		{
+			name:    "row with missing columns",
+			file:    "short.csv",
+			content: "1704164400,2300.5,2310,2295.25,2305,12.5\n1704168000,2305,2311\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid time",
+			file:    "time.csv",
+			content: "time,open,high,low,close,volume\nyesterday,2300.5,2310,2295.25,2305,12.5\n",
+			wantErr: true,
+		},
+	}
+
+	dir := t.TempDir()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, test.file)
+			if err := os.WriteFile(path, []byte(test.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			candles, err := readCandleFile(path)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("read %v, want an error", candles)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(candles) != 1 {
+				t.Fatalf("read %d candles, want 1", len(candles))
+			}
+			assertSameCandle(t, candles[0], fileCandle)
+		})
+	}
+}
+
+func TestFileDataWrapper(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "ETH-USD"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// two files of the same market, the second overlapping the first and out of order.
+	files := map[string]string{
+		"ETH-USD.csv":            "1704153600,100,110,90,105,1\n1704157200,105,120,100,115,2\n",
+		"ETH-USD/later.json":     `[{"time": 1704164400, "open": 125, "high": 130, "low": 95, "close": 100, "volume": 4}, {"time": 1704160800, "open": 115, "high": 125, "low": 110, "close": 125, "volume": 3}]`,
+		"ETH-USD/ignored.txt":    "not candles",
+		"BTC-USD.json":           `[]`,
+		"ETH-USD/overlapped.csv": "1704157200,105,120,100,115,2\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wrapper := NewFileDataWrapper(dir, decimal.RequireFromString("0.001"), nil)
+	market := &environment.Market{Name: "ETH-USD"}
+
+	markets, err := wrapper.GetMarkets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(markets) != 2 {
+		t.Errorf("got %d markets, want 2", len(markets))
+	}
+
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	candles, err := wrapper.GetHistoricalCandles(market, start, start.Add(3*time.Hour), 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []environment.CandleStick{
+		{CandleTime: start, Open: decimal.NewFromInt(100), High: decimal.NewFromInt(120), Low: decimal.NewFromInt(90), Close: decimal.NewFromInt(115), Volume: decimal.NewFromInt(3)},
+		{CandleTime: start.Add(2 * time.Hour), Open: decimal.NewFromInt(115), High: decimal.NewFromInt(130), Low: decimal.NewFromInt(95), Close: decimal.NewFromInt(100), Volume: decimal.NewFromInt(7)},
+	}
+	if len(candles) != len(want) {
+		t.Fatalf("got %d two hour candles, want %d", len(candles), len(want))
+	}
+	for i := range want {
+		assertSameCandle(t, candles[i], want[i])
+	}
+
+	if _, err := wrapper.GetHistoricalCandles(market, start, start.Add(3*time.Hour), 30); err == nil {
+		t.Error("resampled hourly candles to 30 minutes")
+	}
+
+	fee := wrapper.CalculateTradingFees(market, decimal.NewFromInt(2), decimal.NewFromInt(100), environment.Buy)
+	if !fee.Equal(decimal.RequireFromString("0.2")) {
+		t.Errorf("charged %s on 200 at the configured rate of 0.001, want 0.2", fee)
+	}
+	fee = NewFileDataWrapper(dir, decimal.Zero, nil).CalculateTradingFees(market, decimal.NewFromInt(2), decimal.NewFromInt(100), environment.Buy)
+	if !fee.Equal(decimal.RequireFromString("0.52")) {
+		t.Errorf("charged %s on 200 without a configured rate, want the kraken taker fee of 0.52", fee)
+	}
+}
+
+// assertSameCandle fails the test if the candles differ.
+func assertSameCandle(t *testing.T, got environment.CandleStick, want environment.CandleStick) {
+	t.Helper()
+	if !got.CandleTime.Equal(want.CandleTime) || !got.Open.Equal(want.Open) || !got.High.Equal(want.High) ||
+		!got.Low.Equal(want.Low) || !got.Close.Equal(want.Close) || !got.Volume.Equal(want.Volume) {
+		t.Errorf("got candle %s O%s H%s L%s C%s V%s, want %s O%s H%s L%s C%s V%s",
+			got.CandleTime, got.Open, got.High, got.Low, got.Close, got.Volume,
+			want.CandleTime, want.Open, want.High, want.Low, want.Close, want.Volume)
+	}
+}
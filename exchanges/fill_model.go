@@ -0,0 +1,143 @@
+package exchanges
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// bpsDivisor converts basis points to a rate.
+var bpsDivisor = decimal.NewFromInt(10000)
+
+// FillSource provides the market data a FillModel fills the orders against.
+type FillSource interface {
+	IsHistoricalSimulation() bool                                               // Checks whether the source replays history.
+	CurrentCandle(market *environment.Market) (*environment.CandleStick, error) // Gets the candle the orders are currently filled in.
+	ClosedCandle(market *environment.Market) (*environment.CandleStick, error)  // Gets the last candle closed when replaying history.
+	GetOrderBook(market *environment.Market) (*environment.OrderBook, error)    // Gets the current orderbook of a market.
+}
+
+// FillRequest represents an order to be filled by a FillModel.
+type FillRequest struct {
+	Market *environment.Market
+	Side   environment.TradeSide
+	Amount decimal.Decimal
+	Limit  decimal.Decimal // Worst accepted price, zero for market orders.
+}
+
+// SimulatedFill represents how an order was filled by a FillModel.
+type SimulatedFill struct {
+	environment.BookFill
+	Latency time.Duration // Time between the order being sent and filled.
+}
+
+// FillModel computes how the simulator fills an order, a fill may be partial or empty.
+//
+//	NOTE: the latency only delays the timestamp of the recorded trade, the fill is still priced on the market data at
+//	the time the order is sent.
+type FillModel interface {
+	Fill(source FillSource, order FillRequest) (SimulatedFill, error)
+}
+
+// NewFillModel creates the fill model specified by the configuration, the trade replay model is used by default.
+func NewFillModel(config environment.FillModelConfig) (FillModel, error) {
+	latency := time.Duration(config.Latency) * time.Millisecond
+	switch config.Model {
+	case "", "trades":
+		return &TradeReplayFillModel{Latency: latency}, nil
+	case "candle":
+		return &CandleFillModel{SpreadBps: config.SpreadBps, SlippageBps: config.SlippageBps, Latency: latency}, nil
+	case "volume":
+		if !config.Participation.IsPositive() || config.Participation.GreaterThan(decimal.NewFromInt(1)) {
+			return nil, errors.New("volume fill model needs a participation between 0 and 1")
+		}
+		return &VolumeFillModel{
+			CandleFillModel: CandleFillModel{SpreadBps: config.SpreadBps, SlippageBps: config.SlippageBps, Latency: latency},
+			Participation:   config.Participation,
+		}, nil
+	default:
+		return nil, errors.New("unknown fill model " + config.Model)
+	}
+}
+
+// TradeReplayFillModel fills orders against the orderbook rebuilt from the historical public trades.
+type TradeReplayFillModel struct {
+	Latency time.Duration
+}
+
+// Fill walks the orderbook with the order.
+func (model *TradeReplayFillModel) Fill(source FillSource, order FillRequest) (SimulatedFill, error) {
+	orderbook, err := source.GetOrderBook(order.Market)
+	if err != nil {
+		return SimulatedFill{}, err
+	}
+	return SimulatedFill{BookFill: orderbook.Walk(order.Side, order.Amount, order.Limit), Latency: model.Latency}, nil
+}
+
+// CandleFillModel fills orders entirely at the open of the current candle, moved against the order by half the spread
+// and by the slippage.
+type CandleFillModel struct {
+	SpreadBps   decimal.Decimal
+	SlippageBps decimal.Decimal
+	Latency     time.Duration
+}
+
+// Fill fills the whole order, unless its limit is worse than the fill price.
+func (model *CandleFillModel) Fill(source FillSource, order FillRequest) (SimulatedFill, error) {
+	candle, err := source.CurrentCandle(order.Market)
+	if err != nil {
+		return SimulatedFill{}, err
+	}
+	return model.fill(candle, order, order.Amount), nil
+}
+
+// fill fills a quantity of the order at the candle price, if within the order limit.
+func (model *CandleFillModel) fill(candle *environment.CandleStick, order FillRequest, quantity decimal.Decimal) SimulatedFill {
+	cost := model.SpreadBps.Div(decimal.NewFromInt(2)).Add(model.SlippageBps).Div(bpsDivisor)
+	price := candle.Open.Mul(decimal.NewFromInt(1).Add(cost))
+	if order.Side == environment.Sell {
+		price = candle.Open.Mul(decimal.NewFromInt(1).Sub(cost))
+	}
+
+	ret := SimulatedFill{BookFill: environment.BookFill{Quantity: decimal.Zero, Total: decimal.Zero}, Latency: model.Latency}
+	if !order.Limit.IsZero() && ((order.Side == environment.Buy && price.GreaterThan(order.Limit)) || (order.Side == environment.Sell && price.LessThan(order.Limit))) {
+		return ret
+	}
+	if !quantity.IsPositive() || !price.IsPositive() {
+		return ret
+	}
+
+	ret.Quantity = quantity
+	ret.Total = quantity.Mul(price)
+	ret.AveragePrice = price
+	ret.Levels = 1
+	return ret
+}
+
+// VolumeFillModel fills orders like CandleFillModel, but at most for a share of the volume of the last closed candle.
+//
+//	NOTE: the volume of the current candle is only known once it closes. Outside of historical simulations the current
+//	candle is made of the last 24 hours, so its volume is already known.
+type VolumeFillModel struct {
+	CandleFillModel
+	Participation decimal.Decimal // Maximum share of the candle volume an order can take.
+}
+
+// Fill fills the order up to its share of the candle volume, leaving the rest unfilled.
+func (model *VolumeFillModel) Fill(source FillSource, order FillRequest) (SimulatedFill, error) {
+	candle, err := source.CurrentCandle(order.Market)
+	if err != nil {
+		return SimulatedFill{}, err
+	}
+	volume := candle.Volume
+	if source.IsHistoricalSimulation() {
+		closed, err := source.ClosedCandle(order.Market)
+		if err != nil {
+			return SimulatedFill{}, err
+		}
+		volume = closed.Volume
+	}
+	return model.fill(candle, order, decimal.Min(order.Amount, volume.Mul(model.Participation))), nil
+}
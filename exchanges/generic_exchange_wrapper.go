@@ -17,6 +17,7 @@ package exchanges
 
 import (
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/mcwarner5/BlockBot8000/environment"
@@ -29,13 +30,17 @@ type ExchangeWrapper interface {
 	GetCandles(market *environment.Market) ([]environment.CandleStick, error)                                                         // Gets the candle data from the exchange.
 	GetHistoricalCandles(market *environment.Market, start time.Time, end time.Time, interval int) ([]environment.CandleStick, error) // Gets the candle data from the exchange.
 	GetMarkets() ([]*environment.Market, error)
-	GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) // Gets the current market summary.
-	GetOrderBook(market *environment.Market) (*environment.OrderBook, error)         // Gets the order(ASK + BID) book of a market.
+	GetTicker(market *environment.Market) (*environment.Ticker, error)                      // Gets the updated ticker for a market.
+	GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error)        // Gets the current market summary.
+	GetMarketSummaries(markets []*environment.Market) ([]*environment.MarketSummary, error) // Gets the current summaries of many markets, in the same order.
+	GetOrderBook(market *environment.Market) (*environment.OrderBook, error)                // Gets the order(ASK + BID) book of a market.
 
 	BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error)  // Performs a limit buy action.
 	SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) // Performs a limit sell action.
 	BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error)                        // Performs a market buy action.
 	SellMarket(market *environment.Market, amount decimal.Decimal) (string, error)                       // Performs a market sell action.
+	PlaceOrder(order environment.OrderRequest) (string, error)                                           // Places an order of any supported type and time in force.
+	CancelOrder(market *environment.Market, side environment.TradeSide, orderID string) error            // Cancels an open order previously placed on a market.
 
 	GetHistoricalTrades(market *environment.Market, start time.Time, end time.Time) (*environment.TradeBook, error)
 	GetAllTrades(markets []*environment.Market) (*environment.TradeBook, error)
@@ -44,12 +49,14 @@ type ExchangeWrapper interface {
 	CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderSide environment.TradeSide) decimal.Decimal // Calculates the trading fees for an order on a specified market.
 	CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) decimal.Decimal                                                        // Calculates the withdrawal fees on a specified market.
 
-	GetBalance(symbol string) (*decimal.Decimal, error) // Gets the balance of the user of the specified currency.
-	GetDepositAddress(coinTicker string) (string, bool) // Gets the deposit address for the specified coin on the exchange, if exists.
+	GetBalance(symbol string) (*decimal.Decimal, error)        // Gets the available balance of the user of the specified currency, holds of open orders excluded.
+	GetAccountSnapshot() (*environment.AccountSnapshot, error) // Gets all the balances and open orders of the user at once.
+	GetDepositAddress(coinTicker string) (string, bool)        // Gets the deposit address for the specified coin on the exchange, if exists.
 
 	FeedConnect(markets []*environment.Market) error // Connects to the feed of the exchange.
 
-	Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error // Performs a withdraw operation from the exchange to a destination address.
+	Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) (string, error) // Performs a withdraw operation from the exchange to a destination address, returning the withdrawal reference.
+	GetWithdrawStatus(coinTicker string, withdrawalID string) (environment.TransferStatus, error)  // Gets the status of a withdrawal previously made with Withdraw.
 
 	String() string // Returns a string representation of the object.
 	IsHistoricalSimulation() bool
@@ -58,7 +65,72 @@ type ExchangeWrapper interface {
 // ErrWebsocketNotSupported is the error representing when an exchange does not support websocket.
 var ErrWebsocketNotSupported = errors.New("cannot use websocket: exchange does not support it")
 
+// ErrWithdrawStatusNotSupported is the error representing when an exchange cannot report the status of a withdrawal.
+var ErrWithdrawStatusNotSupported = errors.New("cannot track withdrawal: exchange does not report withdrawal status")
+
+// ErrOrderNotSupported is the error representing when an exchange does not support the requested order type or time in force.
+var ErrOrderNotSupported = errors.New("cannot place order: exchange does not support it")
+
+// ErrAccountSnapshotNotSupported is the error representing when an exchange cannot list all the balances of an account at once.
+var ErrAccountSnapshotNotSupported = errors.New("cannot take account snapshot: exchange does not list all balances")
+
 // MarketNameFor gets the market name as seen by the exchange.
 func MarketNameFor(m *environment.Market, wrapper ExchangeWrapper) string {
 	return m.ExchangeNames[wrapper.Name()]
 }
+
+// maxConcurrentSummaries is the maximum number of market summaries requested at once when an exchange has no batch endpoint.
+const maxConcurrentSummaries = 4
+
+// getMarketSummariesConcurrently gets the summaries of many markets with concurrent GetMarketSummary calls, in the same order as markets.
+func getMarketSummariesConcurrently(wrapper ExchangeWrapper, markets []*environment.Market) ([]*environment.MarketSummary, error) {
+	ret := make([]*environment.MarketSummary, len(markets))
+	errs := make([]error, len(markets))
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, maxConcurrentSummaries)
+	for i, market := range markets {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, market *environment.Market) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			ret[i], errs[i] = wrapper.GetMarketSummary(market)
+		}(i, market)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// AccountSnapshotFor gets the account snapshot of a wrapper, falling back to a GetBalance call per coin if the exchange cannot list all balances.
+//
+//	NOTE: portfolios are valued on the Total of the snapshot, holds included. The exchanges falling back to GetBalance
+//	do not report their holds, so their Total is the available balance.
+//
+//	NOTE: the fallback reports the balances as fully available and no open orders.
+func AccountSnapshotFor(wrapper ExchangeWrapper, coins []string) (*environment.AccountSnapshot, error) {
+	snapshot, err := wrapper.GetAccountSnapshot()
+	if !errors.Is(err, ErrAccountSnapshotNotSupported) {
+		return snapshot, err
+	}
+
+	snapshot = environment.NewAccountSnapshot(ClockOf(wrapper).Now())
+	for _, coin := range coins {
+		balance, err := wrapper.GetBalance(coin)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.SetBalance(coin, environment.AssetBalance{
+			Total:     *balance,
+			Available: *balance,
+			Hold:      decimal.Zero,
+		})
+	}
+	return snapshot, nil
+}
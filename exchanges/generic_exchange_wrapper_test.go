@@ -0,0 +1,36 @@
+package exchanges
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// balancesOnlyWrapper reports its balances one coin at a time, like the exchanges without account snapshots.
+type balancesOnlyWrapper struct {
+	*ExchangeWrapperSimulator
+}
+
+func (wrapper balancesOnlyWrapper) GetAccountSnapshot() (*environment.AccountSnapshot, error) {
+	return nil, ErrAccountSnapshotNotSupported
+}
+
+func TestAccountSnapshotForUsesTheClockOfTheWrapper(t *testing.T) {
+	simulator, _ := ethSimulator(environment.FillModelConfig{Model: "candle"}, "2024-01-02", "2024-01-04")
+	if err := simulator.IncrementCurrDate(); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := AccountSnapshotFor(balancesOnlyWrapper{simulator}, []string{"usd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC); !snapshot.Time.Equal(want) {
+		t.Errorf("the snapshot was taken at %s, want the simulated time %s", snapshot.Time, want)
+	}
+	if balance := snapshot.Balances["usd"]; !balance.Total.Equal(decimal.NewFromInt(1000000)) || !balance.Available.Equal(balance.Total) {
+		t.Errorf("got usd balance %+v, want one million available", balance)
+	}
+}
@@ -0,0 +1,55 @@
+package exchanges
+
+import (
+	"strings"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// syntheticConfig returns two correlated markets and an independent one, generated every hour.
+func syntheticConfig(seed int64) environment.SyntheticConfig {
+	return environment.SyntheticConfig{
+		Seed:      seed,
+		StartDate: "2024-01-01",
+		Interval:  60,
+		Markets: []environment.SyntheticMarketConfig{
+			{Name: "BTC-USD", Price: 40000, Drift: 0.2, Volatility: 0.8, Volume: 5},
+			{Name: "ETH-USD", Price: 2000, Drift: 0.2, Volatility: 1.0, Volume: 50},
+			{Name: "SOL-USD", Price: 100, Volatility: 1.2, Volume: 500},
+		},
+		Correlations: []environment.SyntheticCorrelationConfig{{Markets: []string{"BTC-USD", "ETH-USD"}, Value: 0.8}},
+	}
+}
+
+// syntheticMarket returns the market of a synthetic market name, e.g. ETH-USD trading eth for usd.
+func syntheticMarket(name string) *environment.Market {
+	currencies := strings.SplitN(strings.ToLower(name), "-", 2)
+	return &environment.Market{Name: name, BaseCurrency: currencies[0], MarketCurrency: currencies[1], ExchangeNames: map[string]string{"synthetic": name}}
+}
+
+// ethSynthetic returns a synthetic exchange generating an hourly ETH-USD market from 2024-01-01 with seed 1, and its market.
+func ethSynthetic(depositAddresses map[string]string) (*SyntheticWrapper, *environment.Market) {
+	wrapper := NewSyntheticWrapper(environment.SyntheticConfig{
+		Seed:      1,
+		StartDate: "2024-01-01",
+		Interval:  60,
+		Markets:   []environment.SyntheticMarketConfig{{Name: "ETH-USD", Price: 2000, Volatility: 0.5, Volume: 10}},
+	}, depositAddresses)
+	return wrapper, syntheticMarket("ETH-USD")
+}
+
+// ethSimulator creates a simulator replaying the market of ethSynthetic between the dates, paper trading when they are
+// empty, with one million usd and no eth. It returns the simulator and its market.
+func ethSimulator(fillModel environment.FillModelConfig, start string, end string) (*ExchangeWrapperSimulator, *environment.Market) {
+	inner, market := ethSynthetic(nil)
+	wrapper := NewExchangeWrapperSimulator(inner, environment.SimulationConfig{
+		SimModeOn:       true,
+		SimStartDate:    start,
+		SimEndDate:      end,
+		SimInterval:     60,
+		SimFakeBalances: map[string]decimal.Decimal{"eth": decimal.Zero, "usd": decimal.NewFromInt(1000000)},
+		SimFillModel:    fillModel,
+	})
+	return wrapper, market
+}
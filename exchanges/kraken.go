@@ -18,12 +18,15 @@ package exchanges
 import (
 	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/fatih/structs"
 	"github.com/mcwarner5/BlockBot8000/environment"
 	krakenapi "github.com/mcwarner5/BlockBot8000/libraries/kraken-go-api-client"
 	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
 )
 
 // NOTE: https://www.kraken.com/help/api
@@ -34,16 +37,48 @@ type KrakenWrapper struct {
 	summaries        *SummaryCache
 	candles          *CandlesCache
 	depositAddresses map[string]string
+	withdrawKeys     map[string]string
 	websocketOn      bool
 }
 
+// krakenAssetNames maps coin tickers to the asset names kraken uses for them, where they differ.
+var krakenAssetNames = map[string]string{
+	"BTC":  "XBT",
+	"DOGE": "XDG",
+}
+
+// krakenLegacyAssets maps the legacy asset codes kraken still reports balances with, X prefixed for crypto currencies
+// and Z for fiat, to their asset names.
+var krakenLegacyAssets = map[string]string{
+	"XETC": "ETC",
+	"XETH": "ETH",
+	"XLTC": "LTC",
+	"XMLN": "MLN",
+	"XREP": "REP",
+	"XXBT": "XBT",
+	"XXDG": "XDG",
+	"XXLM": "XLM",
+	"XXMR": "XMR",
+	"XXRP": "XRP",
+	"XZEC": "ZEC",
+	"ZAUD": "AUD",
+	"ZCAD": "CAD",
+	"ZEUR": "EUR",
+	"ZGBP": "GBP",
+	"ZJPY": "JPY",
+	"ZUSD": "USD",
+}
+
 // NewKrakenWrapper creates a generic wrapper of the poloniex API.
-func NewKrakenWrapper(publicKey string, secretKey string, depositAddresses map[string]string) ExchangeWrapper {
+//
+//	NOTE: Kraken withdraws to pre-approved withdrawal keys, withdrawKeys binds each coin to the key name set up on kraken.
+func NewKrakenWrapper(publicKey string, secretKey string, depositAddresses map[string]string, withdrawKeys map[string]string) ExchangeWrapper {
 	return &KrakenWrapper{
 		api:              krakenapi.New(publicKey, secretKey),
 		summaries:        NewSummaryCache(),
 		candles:          NewCandlesCache(),
 		depositAddresses: depositAddresses,
+		withdrawKeys:     withdrawKeys,
 		websocketOn:      false,
 	}
 }
@@ -107,6 +142,10 @@ func (wrapper *KrakenWrapper) GetOrderBook(market *environment.Market) (*environ
 			Timestamp: time.Unix(order.Ts, 0),
 		})
 	}
+	orderBook.Sort()
+	if err := orderBook.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid kraken order book of %s: %w", market.Name, err)
+	}
 
 	return &orderBook, nil
 }
@@ -149,6 +188,63 @@ func (wrapper *KrakenWrapper) SellMarket(market *environment.Market, amount deci
 	return fmt.Sprint(orderNumber.TransactionIds), nil
 }
 
+// krakenOrderTypes maps order types to the kraken ordertype values.
+var krakenOrderTypes = map[environment.TradeType]string{
+	environment.MarketPrice:    "market",
+	environment.LimitOrder:     "limit",
+	environment.StopLossOrder:  "stop-loss",
+	environment.StopLimitOrder: "stop-loss-limit",
+}
+
+// PlaceOrder places an order of any supported type and time in force.
+func (wrapper *KrakenWrapper) PlaceOrder(order environment.OrderRequest) (string, error) {
+	if err := order.Validate(); err != nil {
+		return "", err
+	}
+
+	args := map[string]string{}
+	switch order.Type {
+	case environment.LimitOrder:
+		args["price"] = order.LimitPrice.String()
+	case environment.StopLossOrder:
+		args["price"] = order.StopPrice.String()
+	case environment.StopLimitOrder:
+		args["price"] = order.StopPrice.String()
+		args["price2"] = order.LimitPrice.String()
+	}
+	if order.Type != environment.MarketPrice {
+		args["timeinforce"] = order.TimeInForce.String()
+	}
+	if order.TimeInForce == environment.GoodTillDate {
+		args["expiretm"] = fmt.Sprint(order.ExpireTime.Unix())
+	}
+	if order.PostOnly {
+		args["oflags"] = "post"
+	}
+	if order.ClientOrderID != "" {
+		args["cl_ord_id"] = order.ClientOrderID
+	}
+
+	direction := strings.ToLower(order.Side.String())
+	orderNumber, err := wrapper.api.AddOrder(MarketNameFor(order.Market, wrapper), direction, krakenOrderTypes[order.Type], order.Amount.String(), args)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(orderNumber.TransactionIds), nil
+}
+
+// CancelOrder cancels an open order.
+//
+//	NOTE: orders placed by the wrapper are referenced by all their transaction ids, which are canceled one by one.
+func (wrapper *KrakenWrapper) CancelOrder(market *environment.Market, side environment.TradeSide, orderID string) error {
+	for _, txid := range strings.Fields(strings.Trim(orderID, "[]")) {
+		if _, err := wrapper.api.CancelOrder(txid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetTicker gets the updated ticker for a market.
 func (wrapper *KrakenWrapper) GetTicker(market *environment.Market) (*environment.Ticker, error) {
 	krakenTicker, err := wrapper.api.Ticker(MarketNameFor(market, wrapper))
@@ -176,8 +272,30 @@ func (wrapper *KrakenWrapper) GetMarketSummary(market *environment.Market) (*env
 		return nil, err
 	}
 
-	sum := krakenSummary.GetPairTickerInfo(MarketNameFor(market, wrapper))
+	return krakenMarketSummary(krakenSummary.GetPairTickerInfo(MarketNameFor(market, wrapper))), nil
+}
 
+// GetMarketSummaries gets the current summaries of many markets with a single ticker request.
+func (wrapper *KrakenWrapper) GetMarketSummaries(markets []*environment.Market) ([]*environment.MarketSummary, error) {
+	pairs := make([]string, len(markets))
+	for i, market := range markets {
+		pairs[i] = MarketNameFor(market, wrapper)
+	}
+
+	krakenSummaries, err := wrapper.api.Ticker(pairs...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*environment.MarketSummary, len(markets))
+	for i, pair := range pairs {
+		ret[i] = krakenMarketSummary(krakenSummaries.GetPairTickerInfo(pair))
+	}
+	return ret, nil
+}
+
+// krakenMarketSummary converts the ticker info of a kraken pair to a market summary.
+func krakenMarketSummary(sum krakenapi.PairTickerInfo) *environment.MarketSummary {
 	high, _ := decimal.NewFromString(sum.High[0])
 	low, _ := decimal.NewFromString(sum.Low[0])
 	volume, _ := decimal.NewFromString(sum.Volume[0])
@@ -191,7 +309,7 @@ func (wrapper *KrakenWrapper) GetMarketSummary(market *environment.Market) (*env
 		Bid:    bid,
 		Ask:    ask,
 		Last:   ask, // TODO: find a better way for last value, if any
-	}, nil
+	}
 }
 
 func (wrapper *KrakenWrapper) GetHistoricalCandles(market *environment.Market, start time.Time, end time.Time, interval int) ([]environment.CandleStick, error) {
@@ -288,14 +406,93 @@ func (wrapper *KrakenWrapper) GetCandles(market *environment.Market) ([]environm
 	return ret, nil
 }
 
-// GetBalance gets the balance of the user of the specified currency.
+// GetBalance gets the available balance of the user of the specified currency, with a single private call.
 func (wrapper *KrakenWrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
-	_, err := wrapper.api.Balance()
+	snapshot := environment.NewAccountSnapshot(time.Now())
+	if err := wrapper.balancesInto(snapshot); err != nil {
+		return nil, err
+	}
+
+	ret := snapshot.Balance(symbol).Available
+	return &ret, nil
+}
+
+// balancesInto sets the balances of the account in the snapshot, with a single BalanceEx call.
+//
+//	NOTE: staked and earn balances (e.g. DOT.S, ETH.F) are not tradable and are left out.
+func (wrapper *KrakenWrapper) balancesInto(snapshot *environment.AccountSnapshot) error {
+	response, err := wrapper.api.Query("BalanceEx", map[string]string{})
+	if err != nil {
+		return err
+	}
+
+	balances, ok := response.(map[string]interface{})
+	if !ok {
+		return errors.New("unexpected kraken BalanceEx response")
+	}
+
+	for asset, raw := range balances {
+		if strings.Contains(asset, ".") {
+			continue
+		}
+		balance, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		total, _ := decimal.NewFromString(fmt.Sprint(balance["balance"]))
+		hold, _ := decimal.NewFromString(fmt.Sprint(balance["hold_trade"]))
+		snapshot.SetBalance(krakenTicker(asset), environment.AssetBalance{
+			Total:     total,
+			Available: total.Sub(hold),
+			Hold:      hold,
+		})
+	}
+	return nil
+}
+
+// GetAccountSnapshot gets all the balances and open orders of the account.
+func (wrapper *KrakenWrapper) GetAccountSnapshot() (*environment.AccountSnapshot, error) {
+	snapshot := environment.NewAccountSnapshot(time.Now())
+	if err := wrapper.balancesInto(snapshot); err != nil {
+		return nil, err
+	}
+
+	openOrders, err := wrapper.api.OpenOrders(map[string]string{})
 	if err != nil {
 		return nil, err
 	}
 
-	panic("Help me integrate this feature!")
+	for txid, order := range openOrders.Open {
+		side := environment.Buy
+		if order.Description.Type == "sell" {
+			side = environment.Sell
+		}
+		tradeType := environment.LimitOrder
+		for orderType, krakenOrderType := range krakenOrderTypes {
+			if krakenOrderType == order.Description.OrderType {
+				tradeType = orderType
+			}
+		}
+
+		volume, _ := decimal.NewFromString(order.Volume)
+		price, _ := decimal.NewFromString(order.Description.PrimaryPrice)
+		sec, dec := math.Modf(order.OpenTime)
+		snapshot.OpenOrders = append(snapshot.OpenOrders, environment.Trade{
+			Price:        price,
+			AskQuantity:  volume,
+			FillQuantity: decimal.NewFromFloat(order.VolumeExecuted),
+			Fees:         decimal.NewFromFloat(order.Fee),
+			Market:       order.Description.AssetPair,
+			Side:         side,
+			Status:       environment.Pending,
+			Type:         tradeType,
+			TradeNumber:  txid,
+			Timestamp:    time.Unix(int64(sec), int64(dec*1e9)),
+		})
+	}
+
+	return snapshot, nil
 }
 
 // GetDepositAddress gets the deposit address for the specified coin on the exchange.
@@ -332,8 +529,38 @@ func (wrapper *KrakenWrapper) CalculateTradingFees(market *environment.Market, a
 }
 
 // CalculateWithdrawFees calculates the withdrawal fees on a specified market.
+//
+//	NOTE: Kraken quotes fees per withdrawal key, so a key must be configured for the market base currency.
 func (wrapper *KrakenWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) decimal.Decimal {
-	panic("Not Implemented")
+	key, exists := wrapper.withdrawKeys[market.BaseCurrency]
+	if !exists {
+		logrus.Warn("no kraken withdrawal key configured for " + market.BaseCurrency + ", cannot quote withdrawal fees")
+		return decimal.Zero
+	}
+
+	response, err := wrapper.api.Query("WithdrawInfo", map[string]string{
+		"asset":  krakenAsset(market.BaseCurrency),
+		"key":    key,
+		"amount": amount.String(),
+	})
+	if err != nil {
+		logrus.Warn("cannot quote kraken withdrawal fees: ", err)
+		return decimal.Zero
+	}
+
+	info, ok := response.(map[string]interface{})
+	if !ok {
+		logrus.Warn("cannot quote kraken withdrawal fees: unexpected WithdrawInfo response")
+		return decimal.Zero
+	}
+
+	fee, err := decimal.NewFromString(fmt.Sprint(info["fee"]))
+	if err != nil {
+		logrus.Warn("cannot quote kraken withdrawal fees: ", err)
+		return decimal.Zero
+	}
+
+	return fee
 }
 
 // FeedConnect connects to the feed of the exchange.
@@ -347,9 +574,97 @@ func (wrapper *KrakenWrapper) subscribeMarketSummaryFeed(market *environment.Mar
 }
 
 // Withdraw performs a withdraw operation from the exchange to a destination address.
-func (wrapper *KrakenWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
-	panic("Not Supported")
+//
+//	NOTE: the destination address is sent along with the withdrawal key, kraken rejects the withdrawal if they do not match.
+func (wrapper *KrakenWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) (string, error) {
+	key, exists := wrapper.withdrawKeys[coinTicker]
+	if !exists {
+		return "", fmt.Errorf("cannot withdraw %s: no kraken withdrawal key configured", coinTicker)
+	}
+
+	response, err := wrapper.api.Query("Withdraw", map[string]string{
+		"asset":   krakenAsset(coinTicker),
+		"key":     key,
+		"address": destinationAddress,
+		"amount":  amount.String(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	result, ok := response.(map[string]interface{})
+	if !ok {
+		return "", errors.New("unexpected kraken Withdraw response")
+	}
+
+	refID, ok := result["refid"].(string)
+	if !ok {
+		return "", errors.New("kraken Withdraw response has no refid")
+	}
+
+	return refID, nil
+}
+
+// GetWithdrawStatus gets the status of a withdrawal previously made with Withdraw.
+func (wrapper *KrakenWrapper) GetWithdrawStatus(coinTicker string, withdrawalID string) (environment.TransferStatus, error) {
+	response, err := wrapper.api.Query("WithdrawStatus", map[string]string{
+		"asset": krakenAsset(coinTicker),
+	})
+	if err != nil {
+		return environment.TransferPending, err
+	}
+
+	withdrawals, ok := response.([]interface{})
+	if !ok {
+		return environment.TransferPending, errors.New("unexpected kraken WithdrawStatus response")
+	}
+
+	for _, raw := range withdrawals {
+		withdrawal, ok := raw.(map[string]interface{})
+		if !ok || withdrawal["refid"] != withdrawalID {
+			continue
+		}
+
+		if withdrawal["status-prop"] == "canceled" {
+			return environment.TransferFailed, nil
+		}
+
+		switch withdrawal["status"] {
+		case "Success":
+			return environment.TransferComplete, nil
+		case "Failure":
+			return environment.TransferFailed, nil
+		default:
+			return environment.TransferPending, nil
+		}
+	}
+
+	return environment.TransferPending, fmt.Errorf("kraken withdrawal %s not found in recent %s withdrawals", withdrawalID, coinTicker)
+}
+
+// krakenAsset gets the asset name kraken uses for a coin ticker.
+func krakenAsset(coinTicker string) string {
+	asset := strings.ToUpper(coinTicker)
+	if krakenName, exists := krakenAssetNames[asset]; exists {
+		return krakenName
+	}
+	return asset
 }
+
+// krakenTicker converts a kraken asset name to the lowercase coin ticker used by the bot, replacing the legacy codes.
+func krakenTicker(asset string) string {
+	if name, legacy := krakenLegacyAssets[asset]; legacy {
+		asset = name
+	}
+	for ticker, krakenName := range krakenAssetNames {
+		if krakenName == asset {
+			asset = ticker
+			break
+		}
+	}
+	return strings.ToLower(asset)
+}
+
 func (wrapper *KrakenWrapper) IsHistoricalSimulation() bool {
 	return false
 }
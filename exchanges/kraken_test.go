@@ -0,0 +1,27 @@
+package exchanges
+
+import "testing"
+
+func TestKrakenTicker(t *testing.T) {
+	tests := []struct {
+		asset  string
+		ticker string
+	}{
+		{"XXBT", "btc"},
+		{"XBT", "btc"},
+		{"XXDG", "doge"},
+		{"XETH", "eth"},
+		{"ZUSD", "usd"},
+		{"ZEUR", "eur"},
+		{"USDT", "usdt"},
+		{"ZEUS", "zeus"},
+		{"XCAD", "xcad"},
+		{"ZRX", "zrx"},
+	}
+
+	for _, test := range tests {
+		if got := krakenTicker(test.asset); got != test.ticker {
+			t.Errorf("krakenTicker(%s) = %s, want %s", test.asset, got, test.ticker)
+		}
+	}
+}
@@ -19,18 +19,20 @@ package exchanges
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/fiore/kucoin-go"
-	"github.com/fiore/kucoin-go/websocket"
 	"github.com/mcwarner5/BlockBot8000/environment"
 	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
 )
 
 // KucoinWrapper wrapsKucoin
 type KucoinWrapper struct {
 	api              *kucoin.Kucoin
-	ws               *websocket.WebSocket
+	feed             *FeedSupervisor
+	events           *EventBus // tickers pushed by the feed.
 	websocketOn      bool
 	summaries        *SummaryCache
 	orderbook        *OrderbookCache
@@ -39,11 +41,10 @@ type KucoinWrapper struct {
 
 // NewKucoinWrapper creates a generic wrapper of theKucoin
 func NewKucoinWrapper(publicKey string, secretKey string, depositAddresses map[string]string) ExchangeWrapper {
-	ws, _ := websocket.NewWS()
 	return &KucoinWrapper{
 		api:              kucoin.New(publicKey, secretKey),
-		ws:               ws,
 		websocketOn:      false,
+		events:           NewEventBus(),
 		summaries:        NewSummaryCache(),
 		orderbook:        NewOrderbookCache(),
 		depositAddresses: depositAddresses,
@@ -81,38 +82,51 @@ func (wrapper *KucoinWrapper) GetMarkets() ([]*environment.Market, error) {
 
 // GetOrderBook gets the order(ASK + BID) book of a market.
 func (wrapper *KucoinWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
-	ret, exists := wrapper.orderbook.Get(market)
 	if !wrapper.websocketOn {
-		kucoinOrderBook, err := wrapper.api.OrdersBook(MarketNameFor(market, wrapper), 0, 0, "")
-
+		ret, err := wrapper.orderbookFromREST(market)
 		if err != nil {
 			return nil, err
 		}
 
-		ret = &environment.OrderBook{}
-		for _, order := range kucoinOrderBook.BUY {
-			amount := order[1]
-			rate := order[0]
-			ret.Bids = append(ret.Bids, environment.Order{
-				Quantity: decimal.NewFromFloat(amount),
-				Value:    decimal.NewFromFloat(rate),
-			})
-		}
-		for _, order := range kucoinOrderBook.SELL {
-			amount := order[1]
-			rate := order[0]
-			ret.Asks = append(ret.Asks, environment.Order{
-				Quantity: decimal.NewFromFloat(amount),
-				Value:    decimal.NewFromFloat(rate),
-			})
-		}
-
 		wrapper.orderbook.Set(market, ret)
 		return ret, nil
 	}
 
+	ret, exists := wrapper.orderbook.Get(market)
 	if !exists {
-		return nil, errors.New("orderbook not loaded")
+		// the feed did not load the orderbook yet, or it is stale because the feed dropped.
+		return wrapper.orderbookFromREST(market)
+	}
+
+	return ret, nil
+}
+
+func (wrapper *KucoinWrapper) orderbookFromREST(market *environment.Market) (*environment.OrderBook, error) {
+	kucoinOrderBook, err := wrapper.api.OrdersBook(MarketNameFor(market, wrapper), 0, 0, "")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &environment.OrderBook{}
+	for _, order := range kucoinOrderBook.BUY {
+		amount := order[1]
+		rate := order[0]
+		ret.Bids = append(ret.Bids, environment.Order{
+			Quantity: decimal.NewFromFloat(amount),
+			Value:    decimal.NewFromFloat(rate),
+		})
+	}
+	for _, order := range kucoinOrderBook.SELL {
+		amount := order[1]
+		rate := order[0]
+		ret.Asks = append(ret.Asks, environment.Order{
+			Quantity: decimal.NewFromFloat(amount),
+			Value:    decimal.NewFromFloat(rate),
+		})
+	}
+	ret.Sort()
+	if err := ret.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid kucoin order book of %s: %w", market.Name, err)
 	}
 
 	return ret, nil
@@ -154,6 +168,30 @@ func (wrapper *KucoinWrapper) SellMarket(market *environment.Market, amount deci
 	panic("Not Implemented")
 }
 
+// PlaceOrder places an order of any supported type and time in force.
+//
+//	NOTE: Kucoin only supports good till canceled limit orders.
+func (wrapper *KucoinWrapper) PlaceOrder(order environment.OrderRequest) (string, error) {
+	if err := order.Validate(); err != nil {
+		return "", err
+	}
+	if order.Type != environment.LimitOrder || order.TimeInForce != environment.GoodTillCanceled || order.PostOnly {
+		return "", ErrOrderNotSupported
+	}
+
+	orderOid, err := wrapper.api.CreateOrderByString(MarketNameFor(order.Market, wrapper), strings.ToUpper(order.Side.String()), order.LimitPrice.String(), order.Amount.String())
+	if err != nil {
+		return "", err
+	}
+
+	return orderOid, nil
+}
+
+// CancelOrder cancels an open order.
+func (wrapper *KucoinWrapper) CancelOrder(market *environment.Market, side environment.TradeSide, orderID string) error {
+	return wrapper.api.CancelOrder(MarketNameFor(market, wrapper), orderID, strings.ToUpper(side.String()))
+}
+
 // GetTicker gets the updated ticker for a market.
 func (wrapper *KucoinWrapper) GetTicker(market *environment.Market) (*environment.Ticker, error) {
 
@@ -172,42 +210,55 @@ func (wrapper *KucoinWrapper) GetTicker(market *environment.Market) (*environmen
 	}, nil
 }
 
+// GetMarketSummaries gets the current summaries of many markets, requesting them concurrently.
+func (wrapper *KucoinWrapper) GetMarketSummaries(markets []*environment.Market) ([]*environment.MarketSummary, error) {
+	return getMarketSummariesConcurrently(wrapper, markets)
+}
+
 // GetMarketSummary gets the current market summary.
 func (wrapper *KucoinWrapper) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
-	ret, exists := wrapper.summaries.Get(market)
 	if !wrapper.websocketOn {
-		kucoinSummary, err := wrapper.api.GetSymbol(MarketNameFor(market, wrapper))
+		ret, err := wrapper.summaryFromREST(market)
 		if err != nil {
 			return nil, err
 		}
 
-		ask := decimal.NewFromFloat(kucoinSummary.Sell)
-		bid := decimal.NewFromFloat(kucoinSummary.Buy)
-		high := decimal.NewFromFloat(kucoinSummary.High)
-		low := decimal.NewFromFloat(kucoinSummary.Low)
-		last := decimal.NewFromFloat(kucoinSummary.LastDealPrice)
-		volume := decimal.NewFromFloat(kucoinSummary.VolValue)
-
-		ret = &environment.MarketSummary{
-			Last:   last,
-			Ask:    ask,
-			Bid:    bid,
-			High:   high,
-			Low:    low,
-			Volume: volume,
-		}
-
 		wrapper.summaries.Set(market, ret)
 		return ret, nil
 	}
 
+	ret, exists := wrapper.summaries.Get(market)
 	if !exists {
-		return nil, errors.New("summary not loaded")
+		// the feed did not load the summary yet, or it is stale because the feed dropped.
+		return wrapper.summaryFromREST(market)
 	}
 
 	return ret, nil
 }
 
+func (wrapper *KucoinWrapper) summaryFromREST(market *environment.Market) (*environment.MarketSummary, error) {
+	kucoinSummary, err := wrapper.api.GetSymbol(MarketNameFor(market, wrapper))
+	if err != nil {
+		return nil, err
+	}
+
+	ask := decimal.NewFromFloat(kucoinSummary.Sell)
+	bid := decimal.NewFromFloat(kucoinSummary.Buy)
+	high := decimal.NewFromFloat(kucoinSummary.High)
+	low := decimal.NewFromFloat(kucoinSummary.Low)
+	last := decimal.NewFromFloat(kucoinSummary.LastDealPrice)
+	volume := decimal.NewFromFloat(kucoinSummary.VolValue)
+
+	return &environment.MarketSummary{
+		Last:   last,
+		Ask:    ask,
+		Bid:    bid,
+		High:   high,
+		Low:    low,
+		Volume: volume,
+	}, nil
+}
+
 // GetBalance gets the balance of the user of the specified currency.
 func (wrapper *KucoinWrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
 	kucoinBalance, err := wrapper.api.GetCoinBalance(symbol)
@@ -221,6 +272,11 @@ func (wrapper *KucoinWrapper) GetBalance(symbol string) (*decimal.Decimal, error
 	return &ret, nil
 }
 
+// GetAccountSnapshot is not supported, as Kucoin only reports balances one coin at a time.
+func (wrapper *KucoinWrapper) GetAccountSnapshot() (*environment.AccountSnapshot, error) {
+	return nil, ErrAccountSnapshotNotSupported
+}
+
 // GetDepositAddress gets the deposit address for the specified coin on the exchange.
 func (wrapper *KucoinWrapper) GetDepositAddress(coinTicker string) (string, bool) {
 	addr, exists := wrapper.depositAddresses[coinTicker]
@@ -253,7 +309,16 @@ func (wrapper *KucoinWrapper) CalculateTradingFees(market *environment.Market, a
 
 // CalculateWithdrawFees calculates the withdrawal fees on a specified market.
 func (wrapper *KucoinWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) decimal.Decimal {
-	panic("Not Implemented")
+	kucoinCoin, err := wrapper.api.GetCoin(market.BaseCurrency)
+	if err != nil {
+		logrus.Warn("cannot quote kucoin withdrawal fees: ", err)
+		return decimal.Zero
+	}
+
+	minFee := decimal.NewFromFloat(kucoinCoin.WithdrawMinFee)
+	rateFee := amount.Mul(decimal.NewFromFloat(kucoinCoin.WithdrawFeeRate))
+
+	return decimal.Max(minFee, rateFee)
 }
 
 func (wrapper *KucoinWrapper) GetHistoricalTrades(market *environment.Market, start time.Time, end time.Time) (*environment.TradeBook, error) {
@@ -265,27 +330,62 @@ func (wrapper *KucoinWrapper) GetHistoricalCandles(market *environment.Market, s
 
 // GetCandles gets the candle data from the exchange.
 func (wrapper *KucoinWrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
-	panic("Not Implemented")
+	return nil, errors.New("candles of kucoin are not supported")
 }
 
-// FeedConnect connects to the feed of the exchange.
+// FeedConnect connects to the ticker feed of the exchange, which keeps the summaries of the markets updated until the
+// bot exits.
 func (wrapper *KucoinWrapper) FeedConnect(markets []*environment.Market) error {
-	panic("Not Implemented")
+	if wrapper.feed != nil {
+		return errors.New("feed of kucoin already connected")
+	}
+
+	feed := NewFeedSupervisor(wrapper.Name(), newKucoinFeed(wrapper), FeedSupervisorConfig{HeartbeatTimeout: kucoinHeartbeatTimeout}, wrapper.summaries)
+	if err := feed.Start(markets); err != nil {
+		return err
+	}
+	wrapper.feed = feed
+	wrapper.websocketOn = true
+	return nil
 }
 
-// subscribeFeeds subscribes to the Market Summary Feed service.
-func (wrapper *KucoinWrapper) subscribeFeeds(market *environment.Market) error {
-	panic("Not Implemented")
+// FeedHealth returns the health of the feed of the exchange, if connected.
+func (wrapper *KucoinWrapper) FeedHealth() (FeedHealth, bool) {
+	if wrapper.feed == nil {
+		return FeedHealth{}, false
+	}
+	return wrapper.feed.FeedHealth(), true
+}
+
+// FeedEventKinds returns the kinds of the events pushed by the feed of the exchange: the tickers, once connected.
+func (wrapper *KucoinWrapper) FeedEventKinds() environment.EventKinds {
+	if wrapper.feed == nil {
+		return environment.EventKinds{}
+	}
+	return environment.EventKinds{environment.TickerEvent: true}
+}
+
+// SubscribeEvents returns the events of the specified kinds and markets pushed by the feed of the exchange, until the
+// returned function is called.
+func (wrapper *KucoinWrapper) SubscribeEvents(markets []*environment.Market, kinds environment.EventKinds) (<-chan environment.Event, func()) {
+	return wrapper.events.SubscribeEvents(markets, kinds)
 }
 
 // Withdraw performs a withdraw operation from the exchange to a destination address.
-func (wrapper *KucoinWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) error {
+//
+//	NOTE: Kucoin does not return a reference for the withdrawal.
+func (wrapper *KucoinWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) (string, error) {
 	_, err := wrapper.api.CreateWithdrawalApply(coinTicker, destinationAddress, amount.InexactFloat64())
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return nil
+	return "", nil
+}
+
+// GetWithdrawStatus gets the status of a withdrawal previously made with Withdraw.
+func (wrapper *KucoinWrapper) GetWithdrawStatus(coinTicker string, withdrawalID string) (environment.TransferStatus, error) {
+	return environment.TransferPending, ErrWithdrawStatusNotSupported
 }
 
 func (wrapper *KucoinWrapper) IsHistoricalSimulation() bool {
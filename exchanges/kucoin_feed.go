@@ -0,0 +1,148 @@
+package exchanges
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fiore/kucoin-go/websocket"
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// kucoinHeartbeatTimeout is the heartbeat deadline of the kucoin feed, whose client pings the server about once a minute.
+const kucoinHeartbeatTimeout = 2 * time.Minute
+
+// kucoinFeed represents the ticker feed of kucoin, updating the summaries of the wrapper and publishing its tickers.
+//
+//	NOTE: kucoin opens a websocket for each subscription, their updates are merged so that the feed is read as one.
+type kucoinFeed struct {
+	wrapper *KucoinWrapper
+	mutex   *sync.Mutex
+	ws      *websocket.WebSocket
+	conns   []*websocket.Conn
+	updates chan kucoinUpdate
+	closed  chan struct{}
+}
+
+// kucoinUpdate represents an update received by the subscription of some markets.
+type kucoinUpdate struct {
+	markets []*environment.Market
+	update  interface{}
+}
+
+func newKucoinFeed(wrapper *KucoinWrapper) *kucoinFeed {
+	return &kucoinFeed{
+		wrapper: wrapper,
+		mutex:   &sync.Mutex{},
+	}
+}
+
+// Connect gets a new token for the websocket servers of kucoin.
+func (feed *kucoinFeed) Connect() error {
+	ws, err := websocket.NewWS()
+	if err != nil {
+		return err
+	}
+
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	feed.ws = ws
+	feed.conns = nil
+	feed.updates = make(chan kucoinUpdate, eventBufferSize)
+	feed.closed = make(chan struct{})
+	return nil
+}
+
+// Subscribe subscribes to the ticker of each market.
+func (feed *kucoinFeed) Subscribe(markets []*environment.Market) error {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	names, byName := feedMarkets(feed.wrapper, markets)
+	for _, name := range names {
+		conn, err := feed.ws.Subscribe(websocket.Tick, name)
+		if err != nil {
+			return fmt.Errorf("cannot subscribe to the kucoin ticker of %s: %w", name, err)
+		}
+		feed.conns = append(feed.conns, conn)
+		go forwardKucoinUpdates(conn, byName[name], feed.updates, feed.closed)
+	}
+	return nil
+}
+
+// forwardKucoinUpdates forwards the updates of a subscription to the feed until the connection is closed.
+func forwardKucoinUpdates(conn *websocket.Conn, markets []*environment.Market, updates chan<- kucoinUpdate, closed <-chan struct{}) {
+	for update := range conn.Updates() {
+		// once the feed is closed the updates are discarded, so that the client never blocks closing the connection.
+		select {
+		case updates <- kucoinUpdate{markets: markets, update: update}:
+		case <-closed:
+		}
+	}
+
+	select {
+	case updates <- kucoinUpdate{markets: markets, update: errors.New("kucoin ticker of " + conn.Symbol() + " closed")}:
+	case <-closed:
+	}
+}
+
+// Read blocks until the next update, applying tickers to the summaries and the events of the wrapper.
+func (feed *kucoinFeed) Read() error {
+	feed.mutex.Lock()
+	updates, closed := feed.updates, feed.closed
+	feed.mutex.Unlock()
+
+	select {
+	case update := <-updates:
+		return feed.apply(update)
+	case <-closed:
+		return errors.New("kucoin feed closed")
+	}
+}
+
+// apply applies an update to the summaries and the events of the wrapper, acks and pongs being heartbeats.
+func (feed *kucoinFeed) apply(update kucoinUpdate) error {
+	switch message := update.update.(type) {
+	case error:
+		return message
+	case *websocket.Market:
+		summary := &environment.MarketSummary{
+			Last:   decimal.NewFromFloat(message.LastDealPrice),
+			Ask:    decimal.NewFromFloat(message.Sell),
+			Bid:    decimal.NewFromFloat(message.Buy),
+			High:   decimal.NewFromFloat(message.High),
+			Low:    decimal.NewFromFloat(message.Low),
+			Volume: decimal.NewFromFloat(message.VolValue),
+		}
+		feedSummary(feed.wrapper, feed.wrapper.summaries, feed.wrapper.events, update.markets, summary)
+	}
+	return nil
+}
+
+// Close closes the websockets of the subscriptions, making any pending Read return.
+func (feed *kucoinFeed) Close() error {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	if feed.closed == nil {
+		return nil
+	}
+	select {
+	case <-feed.closed:
+		return nil
+	default:
+		close(feed.closed)
+	}
+
+	var err error
+	for _, conn := range feed.conns {
+		if closeErr := conn.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	feed.conns = nil
+	return err
+}
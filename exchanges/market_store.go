@@ -0,0 +1,497 @@
+package exchanges
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// storePartitions is the number of parsed partition files kept in memory by a MarketDataStore.
+const storePartitions = 16
+
+// timeRange represents the half open time range [Start, End).
+type timeRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// MarketDataStore persists the candles and trades fetched from the exchanges under a data directory, so that repeated
+// backtests run offline. Data is kept in append-only CSV files partitioned by time, under <exchange>/<market>/<series>,
+// along with the time ranges already fetched: only the missing ranges are requested to the exchange.
+//
+//	NOTE: the exchange is requested without holding the store, so that many simulators read it while one of them fetches.
+//	The fetches of a same series are made one at a time, so that a range is never fetched twice.
+type MarketDataStore struct {
+	mutex    *sync.Mutex
+	dir      string
+	coverage map[string][]timeRange                    // fetched ranges by series directory, loaded lazily.
+	fetching map[string]*sync.Mutex                    // lock of the fetches of each series directory.
+	candles  *Cache[string, *environment.CandleSeries] // parsed candle partitions by file path.
+	trades   *Cache[string, []environment.Trade]       // parsed trade partitions by file path.
+}
+
+// NewMarketDataStore opens the store in the specified directory, creating it if needed.
+func NewMarketDataStore(dir string) (*MarketDataStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &MarketDataStore{
+		mutex:    &sync.Mutex{},
+		dir:      dir,
+		coverage: make(map[string][]timeRange),
+		fetching: make(map[string]*sync.Mutex),
+		candles:  NewCache[string, *environment.CandleSeries](CacheConfig{MaxSize: storePartitions}),
+		trades:   NewCache[string, []environment.Trade](CacheConfig{MaxSize: storePartitions}),
+	}, nil
+}
+
+// Candles gets the candles of a market starting in [start, end], fetching from the exchange only the ranges not stored yet.
+func (store *MarketDataStore) Candles(wrapper ExchangeWrapper, market *environment.Market, start time.Time, end time.Time, interval int) ([]environment.CandleStick, error) {
+	series := store.seriesDir(wrapper.Name(), market, fmt.Sprintf("candles_%dm", interval))
+	requested := timeRange{Start: start, End: end.Add(time.Nanosecond)}
+
+	err := store.fetchMissing(series, requested, time.Duration(interval)*time.Minute, func(gap timeRange) (time.Time, error) {
+		fetched, err := wrapper.GetHistoricalCandles(market, gap.Start, gap.End, interval)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		store.mutex.Lock()
+		err = store.appendCandles(series, gap, fetched)
+		store.mutex.Unlock()
+
+		var last time.Time
+		for _, candle := range fetched {
+			if gap.contains(candle.CandleTime) && candle.CandleTime.After(last) {
+				last = candle.CandleTime
+			}
+		}
+		return last, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	ret := make([]environment.CandleStick, 0)
+	for _, partition := range monthPartitions(requested) {
+		candles, err := store.loadCandles(filepath.Join(series, partition))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, candles.Range(requested.Start, requested.End)...)
+	}
+	return ret, nil
+}
+
+// Trades gets the trades of a market in [start, end], fetching from the exchange only the ranges not stored yet.
+func (store *MarketDataStore) Trades(wrapper ExchangeWrapper, market *environment.Market, start time.Time, end time.Time) (*environment.TradeBook, error) {
+	series := store.seriesDir(wrapper.Name(), market, "trades")
+	requested := timeRange{Start: start, End: end.Add(time.Nanosecond)}
+
+	err := store.fetchMissing(series, requested, time.Nanosecond, func(gap timeRange) (time.Time, error) {
+		fetched, err := wrapper.GetHistoricalTrades(market, gap.Start, gap.End)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		store.mutex.Lock()
+		err = store.appendTrades(series, gap, fetched.Trades)
+		store.mutex.Unlock()
+
+		var last time.Time
+		for _, trade := range fetched.Trades {
+			if gap.contains(trade.Timestamp) && trade.Timestamp.After(last) {
+				last = trade.Timestamp
+			}
+		}
+		return last, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	ret := environment.NewTradeBook()
+	for _, partition := range dayPartitions(requested) {
+		trades, err := store.loadTrades(filepath.Join(series, partition), market.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, trade := range trades {
+			if requested.contains(trade.Timestamp) {
+				ret.Trades = append(ret.Trades, trade)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// fetchMissing fetches the parts of a range of a series not stored yet. fetch requests a gap to the exchange and stores
+// what it returned, returning the time of its last item within the gap, zero if there is none. The items of a series
+// are step apart.
+func (store *MarketDataStore) fetchMissing(series string, requested timeRange, step time.Duration, fetch func(gap timeRange) (time.Time, error)) error {
+	store.mutex.Lock()
+	lock, exists := store.fetching[series]
+	if !exists {
+		lock = &sync.Mutex{}
+		store.fetching[series] = lock
+	}
+	store.mutex.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	store.mutex.Lock()
+	missing, err := store.missing(series, requested)
+	store.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, gap := range missing {
+		// exchanges return truncated pages for long ranges, so the gap is covered up to the last item returned and the
+		// rest of it is requested again. Once the exchange returns nothing more, as it omits the times without data, the
+		// whole gap is covered.
+		for gap.Start.Before(gap.End) {
+			last, err := fetch(gap)
+			if err != nil {
+				return err
+			}
+
+			covered := gap.End
+			if !last.IsZero() && last.Add(step).Before(gap.End) {
+				covered = last.Add(step)
+			}
+
+			store.mutex.Lock()
+			err = store.cover(series, timeRange{Start: gap.Start, End: covered})
+			store.mutex.Unlock()
+			if err != nil {
+				return err
+			}
+			gap.Start = covered
+		}
+	}
+	return nil
+}
+
+// seriesDir returns the directory of a series of a market.
+func (store *MarketDataStore) seriesDir(exchange string, market *environment.Market, series string) string {
+	return filepath.Join(store.dir, storeFileName(exchange), storeFileName(market.Name), series)
+}
+
+// missing returns the parts of a range not fetched yet, never asking for the future.
+func (store *MarketDataStore) missing(series string, requested timeRange) ([]timeRange, error) {
+	covered, err := store.loadCoverage(series)
+	if err != nil {
+		return nil, err
+	}
+
+	if now := time.Now(); requested.End.After(now) {
+		requested.End = now
+	}
+
+	ret := make([]timeRange, 0)
+	cursor := requested.Start
+	for _, r := range covered {
+		if !r.End.After(cursor) {
+			continue
+		}
+		if !r.Start.Before(requested.End) {
+			break
+		}
+		if r.Start.After(cursor) {
+			ret = append(ret, timeRange{Start: cursor, End: r.Start})
+		}
+		cursor = r.End
+	}
+	if cursor.Before(requested.End) {
+		ret = append(ret, timeRange{Start: cursor, End: requested.End})
+	}
+	return ret, nil
+}
+
+// cover records a range as fetched, merging it with the touching ones.
+func (store *MarketDataStore) cover(series string, fetched timeRange) error {
+	covered := append(store.coverage[series], fetched)
+	sort.Slice(covered, func(i, j int) bool {
+		return covered[i].Start.Before(covered[j].Start)
+	})
+
+	merged := covered[:1]
+	for _, r := range covered[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start.After(last.End) {
+			merged = append(merged, r)
+			continue
+		}
+		if r.End.After(last.End) {
+			last.End = r.End
+		}
+	}
+	store.coverage[series] = merged
+
+	encoded, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(series, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomically(filepath.Join(series, "coverage.json"), encoded)
+}
+
+// loadCoverage gets the fetched ranges of a series, sorted and disjoint.
+func (store *MarketDataStore) loadCoverage(series string) ([]timeRange, error) {
+	if covered, loaded := store.coverage[series]; loaded {
+		return covered, nil
+	}
+
+	covered := make([]timeRange, 0)
+	content, err := os.ReadFile(filepath.Join(series, "coverage.json"))
+	if err == nil {
+		err = json.Unmarshal(content, &covered)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	store.coverage[series] = covered
+	return covered, nil
+}
+
+// appendCandles appends the fetched candles within a range to their partitions.
+func (store *MarketDataStore) appendCandles(series string, fetched timeRange, candles []environment.CandleStick) error {
+	rows := make(map[string][][]string)
+	for _, candle := range candles {
+		if !fetched.contains(candle.CandleTime) {
+			continue
+		}
+		partition := filepath.Join(series, candle.CandleTime.UTC().Format("2006-01")+".csv")
+		rows[partition] = append(rows[partition], []string{
+			strconv.FormatInt(candle.CandleTime.Unix(), 10),
+			candle.Open.String(),
+			candle.High.String(),
+			candle.Low.String(),
+			candle.Close.String(),
+			candle.Volume.String(),
+		})
+		if cached, isSet := store.candles.Get(partition); isSet {
+			cached.Insert(candle)
+		}
+	}
+	return appendRows(rows)
+}
+
+// appendTrades appends the fetched trades within a range to their partitions.
+func (store *MarketDataStore) appendTrades(series string, fetched timeRange, trades []environment.Trade) error {
+	rows := make(map[string][][]string)
+	for _, trade := range trades {
+		if !fetched.contains(trade.Timestamp) {
+			continue
+		}
+		partition := filepath.Join(series, trade.Timestamp.UTC().Format(time.DateOnly)+".csv")
+		rows[partition] = append(rows[partition], []string{
+			strconv.FormatInt(trade.Timestamp.UnixNano(), 10),
+			trade.TradeNumber,
+			trade.Side.String(),
+			trade.Price.String(),
+			trade.FillQuantity.String(),
+		})
+		// parsed partitions are dropped rather than patched, as trades must stay sorted.
+		store.trades.Delete(partition)
+	}
+	return appendRows(rows)
+}
+
+// loadCandles gets the candles of a partition, parsing its file if not in memory.
+func (store *MarketDataStore) loadCandles(partition string) (*environment.CandleSeries, error) {
+	if series, isSet := store.candles.Get(partition); isSet {
+		return series, nil
+	}
+
+	rows, err := readRows(partition, 6)
+	if err != nil {
+		return nil, err
+	}
+
+	series := environment.NewCandleSeries()
+	for _, row := range rows {
+		unix, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", partition, err)
+		}
+		values, err := parseDecimals(row[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", partition, err)
+		}
+		series.Insert(environment.CandleStick{
+			CandleTime: time.Unix(unix, 0).UTC(),
+			Open:       values[0],
+			High:       values[1],
+			Low:        values[2],
+			Close:      values[3],
+			Volume:     values[4],
+		})
+	}
+
+	store.candles.Set(partition, series)
+	return series, nil
+}
+
+// loadTrades gets the trades of a partition sorted by time, parsing its file if not in memory.
+func (store *MarketDataStore) loadTrades(partition string, market string) ([]environment.Trade, error) {
+	if trades, isSet := store.trades.Get(partition); isSet {
+		return trades, nil
+	}
+
+	rows, err := readRows(partition, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	trades := make([]environment.Trade, 0, len(rows))
+	for _, row := range rows {
+		nanos, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", partition, err)
+		}
+		side, err := environment.TradeSideFromString(row[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", partition, err)
+		}
+		values, err := parseDecimals(row[3:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", partition, err)
+		}
+		trades = append(trades, environment.Trade{
+			Price:        values[0],
+			AskQuantity:  values[1],
+			FillQuantity: values[1],
+			Market:       market,
+			Side:         side,
+			Status:       environment.Complete,
+			Type:         environment.MarketPrice,
+			TradeNumber:  row[1],
+			Timestamp:    time.Unix(0, nanos).UTC(),
+		})
+	}
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].Timestamp.Before(trades[j].Timestamp)
+	})
+
+	store.trades.Set(partition, trades)
+	return trades, nil
+}
+
+// contains checks whether a time is in the range.
+func (r timeRange) contains(t time.Time) bool {
+	return !t.Before(r.Start) && t.Before(r.End)
+}
+
+// monthPartitions returns the names of the monthly partitions overlapping a range.
+func monthPartitions(r timeRange) []string {
+	ret := make([]string, 0)
+	start := r.Start.UTC()
+	for month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC); month.Before(r.End); month = month.AddDate(0, 1, 0) {
+		ret = append(ret, month.Format("2006-01")+".csv")
+	}
+	return ret
+}
+
+// dayPartitions returns the names of the daily partitions overlapping a range.
+func dayPartitions(r timeRange) []string {
+	ret := make([]string, 0)
+	start := r.Start.UTC()
+	for day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC); day.Before(r.End); day = day.AddDate(0, 0, 1) {
+		ret = append(ret, day.Format(time.DateOnly)+".csv")
+	}
+	return ret
+}
+
+// storeFileName makes a name safe to be used as a file name.
+func storeFileName(name string) string {
+	return strings.NewReplacer("/", "-", "\\", "-", ":", "-").Replace(name)
+}
+
+// appendRows appends CSV rows to the files they are mapped to.
+func appendRows(rows map[string][][]string) error {
+	for path, fileRows := range rows {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		writer := csv.NewWriter(file)
+		writer.WriteAll(fileRows)
+		if err := writer.Error(); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRows reads the CSV rows of a file, a missing file has no rows and a truncated last row is ignored.
+func readRows(path string, fields int) ([][]string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	rows := make([][]string, 0)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(row) == fields {
+			rows = append(rows, row)
+		}
+	}
+}
+
+// parseDecimals parses many decimal values.
+func parseDecimals(values []string) ([]decimal.Decimal, error) {
+	ret := make([]decimal.Decimal, len(values))
+	for i, value := range values {
+		parsed, err := decimal.NewFromString(value)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = parsed
+	}
+	return ret, nil
+}
@@ -0,0 +1,175 @@
+package exchanges
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+)
+
+// pagedWrapper returns at most pageSize candles per request, like the exchanges truncating long ranges.
+type pagedWrapper struct {
+	ExchangeWrapper
+	pageSize int
+	requests int
+}
+
+func (wrapper *pagedWrapper) GetHistoricalCandles(market *environment.Market, start time.Time, end time.Time, interval int) ([]environment.CandleStick, error) {
+	wrapper.requests++
+	candles, err := wrapper.ExchangeWrapper.GetHistoricalCandles(market, start, end, interval)
+	if err != nil || len(candles) <= wrapper.pageSize {
+		return candles, err
+	}
+	return candles[:wrapper.pageSize], nil
+}
+
+// sparseWrapper returns no candles from a time on, like the exchanges omitting the times without trades.
+type sparseWrapper struct {
+	ExchangeWrapper
+	until    time.Time
+	requests int
+}
+
+func (wrapper *sparseWrapper) GetHistoricalCandles(market *environment.Market, start time.Time, end time.Time, interval int) ([]environment.CandleStick, error) {
+	wrapper.requests++
+	candles, err := wrapper.ExchangeWrapper.GetHistoricalCandles(market, start, end, interval)
+	ret := make([]environment.CandleStick, 0, len(candles))
+	for _, candle := range candles {
+		if candle.CandleTime.Before(wrapper.until) {
+			ret = append(ret, candle)
+		}
+	}
+	return ret, err
+}
+
+// blockingWrapper blocks its requests until released, telling when each of them is received.
+type blockingWrapper struct {
+	ExchangeWrapper
+	received chan string
+	release  chan struct{}
+}
+
+func (wrapper *blockingWrapper) GetHistoricalCandles(market *environment.Market, start time.Time, end time.Time, interval int) ([]environment.CandleStick, error) {
+	wrapper.received <- market.Name
+	<-wrapper.release
+	return wrapper.ExchangeWrapper.GetHistoricalCandles(market, start, end, interval)
+}
+
+func TestStoreCandlesFetchesTruncatedPages(t *testing.T) {
+	inner, market := ethSynthetic(nil)
+	wrapper := &pagedWrapper{ExchangeWrapper: inner, pageSize: 4}
+
+	dir := t.TempDir()
+	store, err := NewMarketDataStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	end := start.Add(9 * time.Hour)
+	candles, err := store.Candles(wrapper, market, start, end, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 10 {
+		t.Fatalf("got %d candles, want 10", len(candles))
+	}
+	for i, candle := range candles {
+		if want := start.Add(time.Duration(i) * time.Hour); !candle.CandleTime.Equal(want) {
+			t.Fatalf("candle %d starts at %s, want %s", i, candle.CandleTime, want)
+		}
+	}
+
+	var covered []timeRange
+	content, err := os.ReadFile(filepath.Join(dir, "synthetic", "ETH-USD", "candles_60m", "coverage.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(content, &covered); err != nil {
+		t.Fatal(err)
+	}
+	if len(covered) != 1 || !covered[0].Start.Equal(start) || covered[0].End.Before(end) {
+		t.Fatalf("covered %v, want a single range from %s past %s", covered, start, end)
+	}
+
+	requests := wrapper.requests
+	reopened, err := NewMarketDataStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := reopened.Candles(wrapper, market, start, end, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrapper.requests != requests || len(again) != len(candles) {
+		t.Fatalf("the stored range was requested again: %d requests, %d candles", wrapper.requests-requests, len(again))
+	}
+}
+
+func TestStoreCoversRangesWithoutData(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	end := start.Add(9 * time.Hour)
+	inner, market := ethSynthetic(nil)
+	wrapper := &sparseWrapper{ExchangeWrapper: inner, until: start.Add(5 * time.Hour)}
+
+	dir := t.TempDir()
+	store, err := NewMarketDataStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	candles, err := store.Candles(wrapper, market, start, end, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 5 {
+		t.Fatalf("got %d candles, want the 5 before the exchange has no data", len(candles))
+	}
+
+	requests := wrapper.requests
+	reopened, err := NewMarketDataStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Candles(wrapper, market, start, end, 60); err != nil {
+		t.Fatal(err)
+	}
+	if wrapper.requests != requests {
+		t.Fatalf("the range without data was requested %d more times", wrapper.requests-requests)
+	}
+}
+
+func TestStoreFetchesSeriesConcurrently(t *testing.T) {
+	wrapper := &blockingWrapper{ExchangeWrapper: NewSyntheticWrapper(syntheticConfig(1), nil), received: make(chan string, 8), release: make(chan struct{})}
+	markets := []*environment.Market{syntheticMarket("ETH-USD"), syntheticMarket("BTC-USD")}
+
+	store, err := NewMarketDataStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	errs := make(chan error, len(markets))
+	for _, market := range markets {
+		go func(market *environment.Market) {
+			_, err := store.Candles(wrapper, market, start, start.Add(time.Hour), 60)
+			errs <- err
+		}(market)
+	}
+
+	// both requests are received before any of them returns.
+	for range markets {
+		select {
+		case <-wrapper.received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the store waited for a request to return before sending the other one")
+		}
+	}
+	close(wrapper.release)
+	for range markets {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package exchanges
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// RecordingWrapper wraps another wrapper and records every call and its response to a cassette.
+type RecordingWrapper struct {
+	innerWrapper ExchangeWrapper
+	recorder     *CassetteRecorder
+}
+
+// NewRecordingWrapper creates a new recording wrapper around another wrapper.
+func NewRecordingWrapper(recordedWrapper ExchangeWrapper, recorder *CassetteRecorder) *RecordingWrapper {
+	return &RecordingWrapper{
+		innerWrapper: recordedWrapper,
+		recorder:     recorder,
+	}
+}
+
+// record writes a call to the cassette, failures are logged as they must not affect the recorded session.
+func (wrapper *RecordingWrapper) record(method string, args json.RawMessage, response interface{}, err error) {
+	entry := CassetteEntry{
+		Time:     time.Now(),
+		Exchange: wrapper.innerWrapper.Name(),
+		Method:   method,
+		Args:     args,
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		encoded, encodeErr := json.Marshal(response)
+		if encodeErr != nil {
+			logrus.Warn("cannot record response of "+method+": ", encodeErr)
+			return
+		}
+		entry.Response = encoded
+	}
+
+	if recordErr := wrapper.recorder.Record(entry); recordErr != nil {
+		logrus.Warn("cannot record call to "+method+": ", recordErr)
+	}
+}
+
+// Name returns the name of the recorded exchange.
+func (wrapper *RecordingWrapper) Name() string {
+	return wrapper.innerWrapper.Name()
+}
+
+// String returns a string representation of the recording wrapper.
+func (wrapper *RecordingWrapper) String() string {
+	return wrapper.innerWrapper.String() + "_recording"
+}
+
+func (wrapper *RecordingWrapper) IsHistoricalSimulation() bool {
+	return wrapper.innerWrapper.IsHistoricalSimulation()
+}
+
+// GetCandles gets the candle data from the exchange.
+func (wrapper *RecordingWrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
+	ret, err := wrapper.innerWrapper.GetCandles(market)
+	wrapper.record("GetCandles", cassetteArgs(market), ret, err)
+	return ret, err
+}
+
+// GetHistoricalCandles gets the candle data of a time range from the exchange.
+func (wrapper *RecordingWrapper) GetHistoricalCandles(market *environment.Market, start time.Time, end time.Time, interval int) ([]environment.CandleStick, error) {
+	ret, err := wrapper.innerWrapper.GetHistoricalCandles(market, start, end, interval)
+	wrapper.record("GetHistoricalCandles", cassetteArgs(market, start, end, interval), ret, err)
+	return ret, err
+}
+
+// GetMarkets gets all the markets info.
+func (wrapper *RecordingWrapper) GetMarkets() ([]*environment.Market, error) {
+	ret, err := wrapper.innerWrapper.GetMarkets()
+	wrapper.record("GetMarkets", cassetteArgs(), ret, err)
+	return ret, err
+}
+
+// GetMarketSummary gets the current market summary.
+func (wrapper *RecordingWrapper) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
+	ret, err := wrapper.innerWrapper.GetMarketSummary(market)
+	wrapper.record("GetMarketSummary", cassetteArgs(market), ret, err)
+	return ret, err
+}
+
+// GetTicker gets the updated ticker for a market.
+func (wrapper *RecordingWrapper) GetTicker(market *environment.Market) (*environment.Ticker, error) {
+	ret, err := wrapper.innerWrapper.GetTicker(market)
+	wrapper.record("GetTicker", cassetteArgs(market), ret, err)
+	return ret, err
+}
+
+// GetMarketSummaries gets the current summaries of many markets, in the same order.
+func (wrapper *RecordingWrapper) GetMarketSummaries(markets []*environment.Market) ([]*environment.MarketSummary, error) {
+	ret, err := wrapper.innerWrapper.GetMarketSummaries(markets)
+	wrapper.record("GetMarketSummaries", cassetteArgs(markets), ret, err)
+	return ret, err
+}
+
+// GetOrderBook gets the order(ASK + BID) book of a market.
+func (wrapper *RecordingWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
+	ret, err := wrapper.innerWrapper.GetOrderBook(market)
+	wrapper.record("GetOrderBook", cassetteArgs(market), ret, err)
+	return ret, err
+}
+
+// BuyLimit performs a limit buy action.
+func (wrapper *RecordingWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	ret, err := wrapper.innerWrapper.BuyLimit(market, amount, limit)
+	wrapper.record("BuyLimit", cassetteArgs(market, amount, limit), ret, err)
+	return ret, err
+}
+
+// SellLimit performs a limit sell action.
+func (wrapper *RecordingWrapper) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	ret, err := wrapper.innerWrapper.SellLimit(market, amount, limit)
+	wrapper.record("SellLimit", cassetteArgs(market, amount, limit), ret, err)
+	return ret, err
+}
+
+// BuyMarket performs a market buy action.
+func (wrapper *RecordingWrapper) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	ret, err := wrapper.innerWrapper.BuyMarket(market, amount)
+	wrapper.record("BuyMarket", cassetteArgs(market, amount), ret, err)
+	return ret, err
+}
+
+// SellMarket performs a market sell action.
+func (wrapper *RecordingWrapper) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	ret, err := wrapper.innerWrapper.SellMarket(market, amount)
+	wrapper.record("SellMarket", cassetteArgs(market, amount), ret, err)
+	return ret, err
+}
+
+// PlaceOrder places an order of any supported type and time in force.
+func (wrapper *RecordingWrapper) PlaceOrder(order environment.OrderRequest) (string, error) {
+	ret, err := wrapper.innerWrapper.PlaceOrder(order)
+	wrapper.record("PlaceOrder", cassetteArgs(order), ret, err)
+	return ret, err
+}
+
+// CancelOrder cancels an open order.
+func (wrapper *RecordingWrapper) CancelOrder(market *environment.Market, side environment.TradeSide, orderID string) error {
+	err := wrapper.innerWrapper.CancelOrder(market, side, orderID)
+	wrapper.record("CancelOrder", cassetteArgs(market, side, orderID), nil, err)
+	return err
+}
+
+// GetHistoricalTrades gets the trades of a market in a time range.
+func (wrapper *RecordingWrapper) GetHistoricalTrades(market *environment.Market, start time.Time, end time.Time) (*environment.TradeBook, error) {
+	ret, err := wrapper.innerWrapper.GetHistoricalTrades(market, start, end)
+	wrapper.record("GetHistoricalTrades", cassetteArgs(market, start, end), ret, err)
+	return ret, err
+}
+
+// GetAllTrades gets the trades of the user on the specified markets.
+func (wrapper *RecordingWrapper) GetAllTrades(markets []*environment.Market) (*environment.TradeBook, error) {
+	ret, err := wrapper.innerWrapper.GetAllTrades(markets)
+	wrapper.record("GetAllTrades", cassetteArgs(markets), ret, err)
+	return ret, err
+}
+
+// GetAllMarketTrades gets the trades of the user on a market.
+func (wrapper *RecordingWrapper) GetAllMarketTrades(market *environment.Market) (*environment.TradeBook, error) {
+	ret, err := wrapper.innerWrapper.GetAllMarketTrades(market)
+	wrapper.record("GetAllMarketTrades", cassetteArgs(market), ret, err)
+	return ret, err
+}
+
+// GetFilteredTrades gets the trades of the user on a market matching the specified filters.
+func (wrapper *RecordingWrapper) GetFilteredTrades(market *environment.Market, symbol string, tradeSide environment.TradeSide, tradeType environment.TradeType, tradeStatus environment.TradeStatus) (*environment.TradeBook, error) {
+	ret, err := wrapper.innerWrapper.GetFilteredTrades(market, symbol, tradeSide, tradeType, tradeStatus)
+	wrapper.record("GetFilteredTrades", cassetteArgs(market, symbol, tradeSide, tradeType, tradeStatus), ret, err)
+	return ret, err
+}
+
+// CalculateTradingFees calculates the trading fees for an order on a specified market.
+func (wrapper *RecordingWrapper) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderSide environment.TradeSide) decimal.Decimal {
+	ret := wrapper.innerWrapper.CalculateTradingFees(market, amount, limit, orderSide)
+	wrapper.record("CalculateTradingFees", cassetteArgs(market, amount, limit, orderSide), ret, nil)
+	return ret
+}
+
+// CalculateWithdrawFees calculates the withdrawal fees on a specified market.
+func (wrapper *RecordingWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) decimal.Decimal {
+	ret := wrapper.innerWrapper.CalculateWithdrawFees(market, amount)
+	wrapper.record("CalculateWithdrawFees", cassetteArgs(market, amount), ret, nil)
+	return ret
+}
+
+// GetBalance gets the balance of the user of the specified currency.
+func (wrapper *RecordingWrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
+	ret, err := wrapper.innerWrapper.GetBalance(symbol)
+	wrapper.record("GetBalance", cassetteArgs(symbol), ret, err)
+	return ret, err
+}
+
+// GetAccountSnapshot gets all the balances and open orders of the user at once.
+func (wrapper *RecordingWrapper) GetAccountSnapshot() (*environment.AccountSnapshot, error) {
+	ret, err := wrapper.innerWrapper.GetAccountSnapshot()
+	wrapper.record("GetAccountSnapshot", cassetteArgs(), ret, err)
+	return ret, err
+}
+
+// GetDepositAddress gets the deposit address for the specified coin on the exchange.
+func (wrapper *RecordingWrapper) GetDepositAddress(coinTicker string) (string, bool) {
+	return wrapper.innerWrapper.GetDepositAddress(coinTicker)
+}
+
+// FeedConnect connects to the feed of the exchange.
+func (wrapper *RecordingWrapper) FeedConnect(markets []*environment.Market) error {
+	return wrapper.innerWrapper.FeedConnect(markets)
+}
+
+// FeedHealth returns the health of the feed of the exchange, if connected.
+func (wrapper *RecordingWrapper) FeedHealth() (FeedHealth, bool) {
+	return FeedHealthOf(wrapper.innerWrapper)
+}
+
+// FeedEventKinds returns the kinds of the events pushed by the feed of the exchange.
+func (wrapper *RecordingWrapper) FeedEventKinds() environment.EventKinds {
+	return FeedEventKindsOf(wrapper.innerWrapper)
+}
+
+// SubscribeEvents returns the events of the specified kinds and markets pushed by the feed of the exchange.
+func (wrapper *RecordingWrapper) SubscribeEvents(markets []*environment.Market, kinds environment.EventKinds) (<-chan environment.Event, func()) {
+	return subscribeFeedEvents(wrapper.innerWrapper, markets, kinds)
+}
+
+// Withdraw performs a withdraw operation from the exchange to a destination address.
+func (wrapper *RecordingWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) (string, error) {
+	ret, err := wrapper.innerWrapper.Withdraw(destinationAddress, coinTicker, amount)
+	wrapper.record("Withdraw", cassetteArgs(destinationAddress, coinTicker, amount), ret, err)
+	return ret, err
+}
+
+// GetWithdrawStatus gets the status of a withdrawal previously made with Withdraw.
+func (wrapper *RecordingWrapper) GetWithdrawStatus(coinTicker string, withdrawalID string) (environment.TransferStatus, error) {
+	ret, err := wrapper.innerWrapper.GetWithdrawStatus(coinTicker, withdrawalID)
+	wrapper.record("GetWithdrawStatus", cassetteArgs(coinTicker, withdrawalID), ret, err)
+	return ret, err
+}
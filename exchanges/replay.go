@@ -0,0 +1,268 @@
+package exchanges
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// ReplayWrapper serves the calls recorded in a cassette back in order, without contacting the exchange.
+type ReplayWrapper struct {
+	name             string
+	cassette         *Cassette
+	depositAddresses map[string]string
+}
+
+// NewReplayWrapper creates a new wrapper replaying the calls recorded for the specified exchange.
+func NewReplayWrapper(exchangeName string, cassette *Cassette, depositAddresses map[string]string) *ReplayWrapper {
+	return &ReplayWrapper{
+		name:             exchangeName,
+		cassette:         cassette,
+		depositAddresses: depositAddresses,
+	}
+}
+
+// replay decodes the next recorded response of a call into response, returning the recorded error if any.
+func (wrapper *ReplayWrapper) replay(method string, args json.RawMessage, response interface{}) error {
+	entry, err := wrapper.cassette.Next(wrapper.name, method, args)
+	if err != nil {
+		return err
+	}
+	if entry.Error != "" {
+		return replayedError(entry.Error)
+	}
+	return json.Unmarshal(entry.Response, response)
+}
+
+// replayedError rebuilds a recorded error, restoring the package errors so that callers can still match them.
+func replayedError(message string) error {
+	for _, known := range []error{ErrWebsocketNotSupported, ErrWithdrawStatusNotSupported, ErrOrderNotSupported, ErrAccountSnapshotNotSupported, ErrReadOnlyExchange} {
+		if known.Error() == message {
+			return known
+		}
+	}
+	return errors.New(message)
+}
+
+// Name returns the name of the replayed exchange.
+func (wrapper *ReplayWrapper) Name() string {
+	return wrapper.name
+}
+
+// String returns a string representation of the replay wrapper.
+func (wrapper *ReplayWrapper) String() string {
+	return wrapper.name + "_replay"
+}
+
+func (wrapper *ReplayWrapper) IsHistoricalSimulation() bool {
+	return false
+}
+
+// GetCandles gets the recorded candle data.
+func (wrapper *ReplayWrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
+	var ret []environment.CandleStick
+	if err := wrapper.replay("GetCandles", cassetteArgs(market), &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetHistoricalCandles gets the recorded candle data of a time range.
+func (wrapper *ReplayWrapper) GetHistoricalCandles(market *environment.Market, start time.Time, end time.Time, interval int) ([]environment.CandleStick, error) {
+	var ret []environment.CandleStick
+	if err := wrapper.replay("GetHistoricalCandles", cassetteArgs(market, start, end, interval), &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetMarkets gets the recorded markets info.
+func (wrapper *ReplayWrapper) GetMarkets() ([]*environment.Market, error) {
+	var ret []*environment.Market
+	if err := wrapper.replay("GetMarkets", cassetteArgs(), &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetMarketSummary gets the recorded market summary.
+func (wrapper *ReplayWrapper) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
+	var ret environment.MarketSummary
+	if err := wrapper.replay("GetMarketSummary", cassetteArgs(market), &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetTicker gets the recorded ticker for a market.
+func (wrapper *ReplayWrapper) GetTicker(market *environment.Market) (*environment.Ticker, error) {
+	var ret environment.Ticker
+	if err := wrapper.replay("GetTicker", cassetteArgs(market), &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetMarketSummaries gets the recorded summaries of many markets.
+func (wrapper *ReplayWrapper) GetMarketSummaries(markets []*environment.Market) ([]*environment.MarketSummary, error) {
+	var ret []*environment.MarketSummary
+	if err := wrapper.replay("GetMarketSummaries", cassetteArgs(markets), &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetOrderBook gets the recorded order(ASK + BID) book of a market.
+func (wrapper *ReplayWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
+	var ret environment.OrderBook
+	if err := wrapper.replay("GetOrderBook", cassetteArgs(market), &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// BuyLimit replays a limit buy action.
+func (wrapper *ReplayWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	var ret string
+	err := wrapper.replay("BuyLimit", cassetteArgs(market, amount, limit), &ret)
+	return ret, err
+}
+
+// SellLimit replays a limit sell action.
+func (wrapper *ReplayWrapper) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	var ret string
+	err := wrapper.replay("SellLimit", cassetteArgs(market, amount, limit), &ret)
+	return ret, err
+}
+
+// BuyMarket replays a market buy action.
+func (wrapper *ReplayWrapper) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	var ret string
+	err := wrapper.replay("BuyMarket", cassetteArgs(market, amount), &ret)
+	return ret, err
+}
+
+// SellMarket replays a market sell action.
+func (wrapper *ReplayWrapper) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	var ret string
+	err := wrapper.replay("SellMarket", cassetteArgs(market, amount), &ret)
+	return ret, err
+}
+
+// PlaceOrder replays an order placement.
+func (wrapper *ReplayWrapper) PlaceOrder(order environment.OrderRequest) (string, error) {
+	var ret string
+	err := wrapper.replay("PlaceOrder", cassetteArgs(order), &ret)
+	return ret, err
+}
+
+// CancelOrder replays an order cancellation.
+func (wrapper *ReplayWrapper) CancelOrder(market *environment.Market, side environment.TradeSide, orderID string) error {
+	var ret interface{}
+	return wrapper.replay("CancelOrder", cassetteArgs(market, side, orderID), &ret)
+}
+
+// GetHistoricalTrades gets the recorded trades of a market in a time range.
+func (wrapper *ReplayWrapper) GetHistoricalTrades(market *environment.Market, start time.Time, end time.Time) (*environment.TradeBook, error) {
+	var ret environment.TradeBook
+	if err := wrapper.replay("GetHistoricalTrades", cassetteArgs(market, start, end), &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetAllTrades gets the recorded trades of the user on the specified markets.
+func (wrapper *ReplayWrapper) GetAllTrades(markets []*environment.Market) (*environment.TradeBook, error) {
+	var ret environment.TradeBook
+	if err := wrapper.replay("GetAllTrades", cassetteArgs(markets), &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetAllMarketTrades gets the recorded trades of the user on a market.
+func (wrapper *ReplayWrapper) GetAllMarketTrades(market *environment.Market) (*environment.TradeBook, error) {
+	var ret environment.TradeBook
+	if err := wrapper.replay("GetAllMarketTrades", cassetteArgs(market), &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetFilteredTrades gets the recorded trades of the user on a market matching the specified filters.
+func (wrapper *ReplayWrapper) GetFilteredTrades(market *environment.Market, symbol string, tradeSide environment.TradeSide, tradeType environment.TradeType, tradeStatus environment.TradeStatus) (*environment.TradeBook, error) {
+	var ret environment.TradeBook
+	if err := wrapper.replay("GetFilteredTrades", cassetteArgs(market, symbol, tradeSide, tradeType, tradeStatus), &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// CalculateTradingFees gets the recorded trading fees for an order on a specified market.
+func (wrapper *ReplayWrapper) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderSide environment.TradeSide) decimal.Decimal {
+	var ret decimal.Decimal
+	if err := wrapper.replay("CalculateTradingFees", cassetteArgs(market, amount, limit, orderSide), &ret); err != nil {
+		logrus.Warn("cannot replay trading fees: ", err)
+		return decimal.Zero
+	}
+	return ret
+}
+
+// CalculateWithdrawFees gets the recorded withdrawal fees on a specified market.
+func (wrapper *ReplayWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) decimal.Decimal {
+	var ret decimal.Decimal
+	if err := wrapper.replay("CalculateWithdrawFees", cassetteArgs(market, amount), &ret); err != nil {
+		logrus.Warn("cannot replay withdraw fees: ", err)
+		return decimal.Zero
+	}
+	return ret
+}
+
+// GetBalance gets the recorded balance of the user of the specified currency.
+func (wrapper *ReplayWrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
+	var ret decimal.Decimal
+	if err := wrapper.replay("GetBalance", cassetteArgs(symbol), &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetAccountSnapshot gets the recorded account snapshot.
+func (wrapper *ReplayWrapper) GetAccountSnapshot() (*environment.AccountSnapshot, error) {
+	var ret environment.AccountSnapshot
+	if err := wrapper.replay("GetAccountSnapshot", cassetteArgs(), &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetDepositAddress gets the deposit address for the specified coin on the exchange, if exists.
+func (wrapper *ReplayWrapper) GetDepositAddress(coinTicker string) (string, bool) {
+	addr, exists := wrapper.depositAddresses[coinTicker]
+	return addr, exists
+}
+
+// FeedConnect does nothing, as replayed data is served from the cassette.
+func (wrapper *ReplayWrapper) FeedConnect(markets []*environment.Market) error {
+	return nil
+}
+
+// Withdraw replays a withdraw operation.
+func (wrapper *ReplayWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) (string, error) {
+	var ret string
+	err := wrapper.replay("Withdraw", cassetteArgs(destinationAddress, coinTicker, amount), &ret)
+	return ret, err
+}
+
+// GetWithdrawStatus gets the recorded status of a withdrawal.
+func (wrapper *ReplayWrapper) GetWithdrawStatus(coinTicker string, withdrawalID string) (environment.TransferStatus, error) {
+	var ret environment.TransferStatus
+	if err := wrapper.replay("GetWithdrawStatus", cassetteArgs(coinTicker, withdrawalID), &ret); err != nil {
+		return environment.TransferPending, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,542 @@
+package exchanges
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// syntheticTradingFee is the fee rate charged on the orders simulated against synthetic data.
+const syntheticTradingFee = 0.0026
+
+// syntheticBookLevels is the number of price levels on each side of the synthetic orderbooks.
+const syntheticBookLevels = 5
+
+// syntheticStartDate is the date of the first candle when not configured.
+const syntheticStartDate = "2020-01-01"
+
+// minutesPerYear is the number of minutes of a year, the unit of the yearly process parameters.
+const minutesPerYear = 365 * 24 * 60
+
+// SyntheticWrapper serves market data generated by random processes, to run simulations and demos without any data.
+//
+// Each market follows a geometric brownian motion, a jump-diffusion or a mean reverting process, their returns being
+// correlated as configured. The markets may switch between regimes changing their drift and volatility, and scripted
+// scenarios shock their prices (e.g. a 50% crash or a stablecoin depeg). Candles are generated from the start date
+// onwards, only as far as requested, and the same seed always generates the same data.
+type SyntheticWrapper struct {
+	config           environment.SyntheticConfig
+	depositAddresses map[string]string
+	mutex            *sync.Mutex
+	period           time.Duration
+	start            time.Time
+	cholesky         [][]float64 // lower triangular factor of the correlation matrix of the markets.
+	scenarios        []syntheticScenario
+	random           *rand.Rand
+	next             time.Time                   // start of the next candle to generate.
+	logPrices        []float64                   // log price of each market at next, before the scenarios.
+	prices           []float64                   // price of each market at next, after the scenarios.
+	regime           int                         // index of the current regime, -1 if none are configured.
+	candles          []*environment.CandleSeries // generated candles of each market, in configuration order.
+	indexes          map[string]int              // index of each market by upper case name.
+}
+
+// syntheticScenario represents a scripted price shock, applied as a factor of the prices of its markets.
+type syntheticScenario struct {
+	start    time.Time
+	duration time.Duration
+	recovery time.Duration
+	change   float64
+	markets  map[int]bool // indexes of the markets shocked, all if empty.
+}
+
+// NewSyntheticWrapper creates a new wrapper generating the configured markets.
+//
+//	NOTE: it panics if the configuration is invalid, as no data could be generated.
+func NewSyntheticWrapper(config environment.SyntheticConfig, depositAddresses map[string]string) *SyntheticWrapper {
+	if config.StartDate == "" {
+		config.StartDate = syntheticStartDate
+	}
+	if config.Interval <= 0 {
+		config.Interval = 1
+	}
+	start, err := time.Parse(time.DateOnly, config.StartDate)
+	if err != nil {
+		panic("invalid synthetic start date " + config.StartDate)
+	}
+	if len(config.Markets) == 0 {
+		panic("no synthetic markets configured")
+	}
+
+	wrapper := &SyntheticWrapper{
+		config:           config,
+		depositAddresses: depositAddresses,
+		mutex:            &sync.Mutex{},
+		period:           time.Duration(config.Interval) * time.Minute,
+		start:            start,
+		random:           rand.New(rand.NewSource(config.Seed)),
+		next:             start,
+		logPrices:        make([]float64, len(config.Markets)),
+		prices:           make([]float64, len(config.Markets)),
+		regime:           -1,
+		candles:          make([]*environment.CandleSeries, len(config.Markets)),
+		indexes:          make(map[string]int, len(config.Markets)),
+	}
+	for i, market := range config.Markets {
+		if market.Price <= 0 {
+			panic(fmt.Sprintf("synthetic market %s needs a price > 0", market.Name))
+		}
+		switch market.Process {
+		case "", "gbm", "jump_diffusion", "mean_reverting":
+		default:
+			panic(fmt.Sprintf("unknown process %s of synthetic market %s: expected gbm, jump_diffusion or mean_reverting", market.Process, market.Name))
+		}
+		wrapper.indexes[strings.ToUpper(market.Name)] = i
+		wrapper.logPrices[i] = math.Log(market.Price)
+		wrapper.candles[i] = environment.NewCandleSeries()
+	}
+
+	if wrapper.cholesky, err = wrapper.correlations(); err != nil {
+		panic(err.Error())
+	}
+	if wrapper.scenarios, err = wrapper.parseScenarios(); err != nil {
+		panic(err.Error())
+	}
+	if len(config.Regimes) > 0 {
+		wrapper.regime = 0
+	}
+	for i := range wrapper.prices {
+		wrapper.prices[i] = math.Exp(wrapper.logPrices[i]) * wrapper.scenarioFactor(i, start)
+	}
+	return wrapper
+}
+
+// correlations returns the lower triangular Cholesky factor of the correlation matrix of the markets.
+func (wrapper *SyntheticWrapper) correlations() ([][]float64, error) {
+	size := len(wrapper.config.Markets)
+	matrix := make([][]float64, size)
+	for i := range matrix {
+		matrix[i] = make([]float64, size)
+		matrix[i][i] = 1
+	}
+	for _, correlation := range wrapper.config.Correlations {
+		if len(correlation.Markets) != 2 || correlation.Value < -1 || correlation.Value > 1 {
+			return nil, fmt.Errorf("invalid synthetic correlation %v: expected two markets and a value in [-1, 1]", correlation.Markets)
+		}
+		first, firstExists := wrapper.indexes[strings.ToUpper(correlation.Markets[0])]
+		second, secondExists := wrapper.indexes[strings.ToUpper(correlation.Markets[1])]
+		if !firstExists || !secondExists {
+			return nil, fmt.Errorf("invalid synthetic correlation %v: unknown market", correlation.Markets)
+		}
+		matrix[first][second], matrix[second][first] = correlation.Value, correlation.Value
+	}
+
+	ret := make([][]float64, size)
+	for i := range ret {
+		ret[i] = make([]float64, size)
+		for j := 0; j <= i; j++ {
+			sum := matrix[i][j]
+			for k := 0; k < j; k++ {
+				sum -= ret[i][k] * ret[j][k]
+			}
+			if i == j {
+				if sum <= 0 {
+					return nil, errors.New("synthetic correlations are not consistent with each other")
+				}
+				ret[i][i] = math.Sqrt(sum)
+			} else {
+				ret[i][j] = sum / ret[j][j]
+			}
+		}
+	}
+	return ret, nil
+}
+
+// parseScenarios parses the scripted scenarios of the configuration.
+func (wrapper *SyntheticWrapper) parseScenarios() ([]syntheticScenario, error) {
+	ret := make([]syntheticScenario, len(wrapper.config.Scenarios))
+	for i, config := range wrapper.config.Scenarios {
+		start, err := time.Parse(time.DateOnly, config.Date)
+		if err != nil {
+			if start, err = time.Parse(time.RFC3339, config.Date); err != nil {
+				return nil, fmt.Errorf("invalid date %s of synthetic scenario %s", config.Date, config.Name)
+			}
+		}
+		if config.Change <= -1 {
+			return nil, fmt.Errorf("synthetic scenario %s cannot change prices by %v", config.Name, config.Change)
+		}
+
+		scenario := syntheticScenario{
+			start:    start,
+			duration: time.Duration(config.Duration) * time.Minute,
+			recovery: time.Duration(config.Recovery) * time.Minute,
+			change:   config.Change,
+			markets:  make(map[int]bool, len(config.Markets)),
+		}
+		for _, name := range config.Markets {
+			index, exists := wrapper.indexes[strings.ToUpper(name)]
+			if !exists {
+				return nil, fmt.Errorf("unknown market %s of synthetic scenario %s", name, config.Name)
+			}
+			scenario.markets[index] = true
+		}
+		ret[i] = scenario
+	}
+	return ret, nil
+}
+
+// scenarioFactor returns the factor the scenarios apply to the price of a market at the specified time.
+func (wrapper *SyntheticWrapper) scenarioFactor(market int, at time.Time) float64 {
+	factor := 1.0
+	for _, scenario := range wrapper.scenarios {
+		if len(scenario.markets) > 0 && !scenario.markets[market] {
+			continue
+		}
+		factor *= 1 + scenario.change*scenario.progress(at)
+	}
+	return factor
+}
+
+// progress returns how much of its change the scenario applies at the specified time, from 0 to 1.
+func (scenario syntheticScenario) progress(at time.Time) float64 {
+	elapsed := at.Sub(scenario.start)
+	switch {
+	case elapsed < 0:
+		return 0
+	case elapsed < scenario.duration:
+		return float64(elapsed) / float64(scenario.duration)
+	case scenario.recovery == 0:
+		return 1
+	case elapsed < scenario.duration+scenario.recovery:
+		return 1 - float64(elapsed-scenario.duration)/float64(scenario.recovery)
+	default:
+		return 0
+	}
+}
+
+// generate generates the candles of every market up to the specified time.
+//
+//	NOTE: markets are always generated together and in order, so that the data never depends on the requests.
+func (wrapper *SyntheticWrapper) generate(until time.Time) {
+	dt := float64(wrapper.config.Interval) / minutesPerYear
+	shocks := make([]float64, len(wrapper.config.Markets))
+	for !wrapper.next.After(until) {
+		drift, volatilityScale := wrapper.switchRegime(dt)
+
+		for i := range shocks {
+			shocks[i] = wrapper.random.NormFloat64()
+		}
+		end := wrapper.next.Add(wrapper.period)
+		for i, market := range wrapper.config.Markets {
+			correlated := 0.0
+			for k := 0; k <= i; k++ {
+				correlated += wrapper.cholesky[i][k] * shocks[k]
+			}
+
+			volatility := market.Volatility * volatilityScale
+			change := (market.Drift+drift-volatility*volatility/2)*dt + volatility*math.Sqrt(dt)*correlated
+			switch market.Process {
+			case "jump_diffusion":
+				if wrapper.random.Float64() < market.JumpIntensity*dt {
+					change += market.JumpMean + market.JumpStdDev*wrapper.random.NormFloat64()
+				}
+			case "mean_reverting":
+				change += market.Reversion * (math.Log(market.Price) - wrapper.logPrices[i]) * dt
+			}
+			wrapper.logPrices[i] += change
+
+			open := wrapper.prices[i]
+			closePrice := math.Exp(wrapper.logPrices[i]) * wrapper.scenarioFactor(i, end)
+			wick := volatility * math.Sqrt(dt) / 2
+			high := math.Max(open, closePrice) * math.Exp(math.Abs(wrapper.random.NormFloat64())*wick)
+			low := math.Min(open, closePrice) * math.Exp(-math.Abs(wrapper.random.NormFloat64())*wick)
+			volume := market.Volume * math.Exp(wrapper.random.NormFloat64()/2-0.125)
+
+			wrapper.candles[i].Insert(environment.CandleStick{
+				Open:       decimal.NewFromFloat(open).Round(8),
+				High:       decimal.NewFromFloat(high).Round(8),
+				Low:        decimal.NewFromFloat(low).Round(8),
+				Close:      decimal.NewFromFloat(closePrice).Round(8),
+				Volume:     decimal.NewFromFloat(volume).Round(8),
+				CandleTime: wrapper.next,
+			})
+			wrapper.prices[i] = closePrice
+		}
+		wrapper.next = end
+	}
+}
+
+// switchRegime moves to another regime at random, returning the drift and volatility scale of the current one.
+func (wrapper *SyntheticWrapper) switchRegime(dt float64) (float64, float64) {
+	if wrapper.regime < 0 {
+		return 0, 1
+	}
+
+	regimes := wrapper.config.Regimes
+	if len(regimes) > 1 && regimes[wrapper.regime].Duration > 0 {
+		days := dt * 365
+		if wrapper.random.Float64() < days/regimes[wrapper.regime].Duration {
+			wrapper.regime = (wrapper.regime + 1 + wrapper.random.Intn(len(regimes)-1)) % len(regimes)
+		}
+	}
+
+	regime := regimes[wrapper.regime]
+	if regime.VolatilityScale <= 0 {
+		return regime.Drift, 1
+	}
+	return regime.Drift, regime.VolatilityScale
+}
+
+// series gets the candles of a market generated up to the specified time.
+func (wrapper *SyntheticWrapper) series(market *environment.Market, until time.Time) (*environment.CandleSeries, error) {
+	name := MarketNameFor(market, wrapper)
+	if name == "" {
+		name = market.Name
+	}
+	index, exists := wrapper.indexes[strings.ToUpper(name)]
+	if !exists {
+		return nil, errors.New("no synthetic process for market " + name)
+	}
+
+	wrapper.generate(until)
+	return wrapper.candles[index], nil
+}
+
+// last gets the last generated candle of a market, generating the first day if nothing was generated yet.
+func (wrapper *SyntheticWrapper) last(market *environment.Market) (environment.CandleStick, *environment.CandleSeries, error) {
+	series, err := wrapper.series(market, wrapper.start.Add(24*time.Hour-wrapper.period))
+	if err != nil {
+		return environment.CandleStick{}, nil, err
+	}
+	last, _ := series.Last()
+	return last, series, nil
+}
+
+// Name returns the name of the wrapped exchange.
+func (wrapper *SyntheticWrapper) Name() string {
+	return "synthetic"
+}
+
+// String returns a string representation of the synthetic wrapper.
+func (wrapper *SyntheticWrapper) String() string {
+	return fmt.Sprintf("synthetic(seed %d)", wrapper.config.Seed)
+}
+
+func (wrapper *SyntheticWrapper) IsHistoricalSimulation() bool {
+	return false
+}
+
+// GetMarkets gets the configured markets.
+func (wrapper *SyntheticWrapper) GetMarkets() ([]*environment.Market, error) {
+	markets := make([]*environment.Market, len(wrapper.config.Markets))
+	for i, market := range wrapper.config.Markets {
+		markets[i] = &environment.Market{Name: market.Name, ExchangeNames: map[string]string{wrapper.Name(): market.Name}}
+	}
+	return markets, nil
+}
+
+// GetCandles gets all the candles of a market generated so far, at the configured interval.
+func (wrapper *SyntheticWrapper) GetCandles(market *environment.Market) ([]environment.CandleStick, error) {
+	wrapper.mutex.Lock()
+	defer wrapper.mutex.Unlock()
+
+	_, series, err := wrapper.last(market)
+	if err != nil {
+		return nil, err
+	}
+	return series.Candles(), nil
+}
+
+// GetHistoricalCandles gets the candles of a market starting in [start, end], resampled to the specified interval in minutes.
+func (wrapper *SyntheticWrapper) GetHistoricalCandles(market *environment.Market, start time.Time, end time.Time, interval int) ([]environment.CandleStick, error) {
+	period := time.Duration(interval) * time.Minute
+	if period <= 0 {
+		return nil, fmt.Errorf("invalid candle interval %d", interval)
+	}
+	if wrapper.period > period {
+		return nil, fmt.Errorf("cannot resample %s candles of %s to %s", wrapper.period, market.Name, period)
+	}
+
+	wrapper.mutex.Lock()
+	defer wrapper.mutex.Unlock()
+
+	series, err := wrapper.series(market, end.Truncate(period).Add(period))
+	if err != nil {
+		return nil, err
+	}
+	return resampleCandles(series.Range(start.Truncate(period), end.Truncate(period).Add(period)), period), nil
+}
+
+// GetHistoricalTrades synthesizes the trades of a market in [start, end] from its candles.
+func (wrapper *SyntheticWrapper) GetHistoricalTrades(market *environment.Market, start time.Time, end time.Time) (*environment.TradeBook, error) {
+	wrapper.mutex.Lock()
+	defer wrapper.mutex.Unlock()
+
+	series, err := wrapper.series(market, end)
+	if err != nil {
+		return nil, err
+	}
+	return CandleTrades(market, series, wrapper.period, start, end), nil
+}
+
+// GetMarketSummary gets the summary of a market over the last 24 hours generated.
+func (wrapper *SyntheticWrapper) GetMarketSummary(market *environment.Market) (*environment.MarketSummary, error) {
+	wrapper.mutex.Lock()
+	defer wrapper.mutex.Unlock()
+
+	last, series, err := wrapper.last(market)
+	if err != nil {
+		return nil, err
+	}
+
+	day := mergeCandles(series.Range(last.CandleTime.Add(-24*time.Hour).Add(time.Nanosecond), last.CandleTime.Add(time.Nanosecond)))
+	return &environment.MarketSummary{
+		High:   day.High,
+		Low:    day.Low,
+		Volume: day.Volume,
+		Ask:    last.Close,
+		Bid:    last.Close,
+		Last:   last.Close,
+	}, nil
+}
+
+// GetTicker gets the ticker of a market at the last candle generated.
+func (wrapper *SyntheticWrapper) GetTicker(market *environment.Market) (*environment.Ticker, error) {
+	summary, err := wrapper.GetMarketSummary(market)
+	if err != nil {
+		return nil, err
+	}
+	return &environment.Ticker{Ask: summary.Ask, Bid: summary.Bid, Last: summary.Last}, nil
+}
+
+// GetMarketSummaries gets the summaries of many markets, in the same order.
+func (wrapper *SyntheticWrapper) GetMarketSummaries(markets []*environment.Market) ([]*environment.MarketSummary, error) {
+	ret := make([]*environment.MarketSummary, len(markets))
+	for i, market := range markets {
+		summary, err := wrapper.GetMarketSummary(market)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = summary
+	}
+	return ret, nil
+}
+
+// GetOrderBook gets an orderbook around the close of the last candle generated, spread by the configured basis points
+// and sharing the volume of the candle between its levels.
+func (wrapper *SyntheticWrapper) GetOrderBook(market *environment.Market) (*environment.OrderBook, error) {
+	wrapper.mutex.Lock()
+	defer wrapper.mutex.Unlock()
+
+	last, _, err := wrapper.last(market)
+	if err != nil {
+		return nil, err
+	}
+
+	halfSpread := decimal.NewFromFloat(wrapper.config.SpreadBps / 20_000)
+	quantity := last.Volume.Div(decimal.NewFromInt(syntheticBookLevels))
+	book := &environment.OrderBook{
+		Asks: make([]environment.Order, syntheticBookLevels),
+		Bids: make([]environment.Order, syntheticBookLevels),
+	}
+	for level := 0; level < syntheticBookLevels; level++ {
+		offset := halfSpread.Mul(decimal.NewFromInt(int64(2*level + 1)))
+		book.Asks[level] = environment.Order{Value: last.Close.Mul(decimal.NewFromInt(1).Add(offset)), Quantity: quantity, Timestamp: last.CandleTime}
+		book.Bids[level] = environment.Order{Value: last.Close.Mul(decimal.NewFromInt(1).Sub(offset)), Quantity: quantity, Timestamp: last.CandleTime}
+	}
+	book.Sort()
+	return book, nil
+}
+
+// BuyLimit is not supported, as synthetic data cannot be traded.
+func (wrapper *SyntheticWrapper) BuyLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return "", ErrReadOnlyExchange
+}
+
+// SellLimit is not supported, as synthetic data cannot be traded.
+func (wrapper *SyntheticWrapper) SellLimit(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal) (string, error) {
+	return "", ErrReadOnlyExchange
+}
+
+// BuyMarket is not supported, as synthetic data cannot be traded.
+func (wrapper *SyntheticWrapper) BuyMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return "", ErrReadOnlyExchange
+}
+
+// SellMarket is not supported, as synthetic data cannot be traded.
+func (wrapper *SyntheticWrapper) SellMarket(market *environment.Market, amount decimal.Decimal) (string, error) {
+	return "", ErrReadOnlyExchange
+}
+
+// PlaceOrder is not supported, as synthetic data cannot be traded.
+func (wrapper *SyntheticWrapper) PlaceOrder(order environment.OrderRequest) (string, error) {
+	return "", ErrReadOnlyExchange
+}
+
+// CancelOrder is not supported, as synthetic data cannot be traded.
+func (wrapper *SyntheticWrapper) CancelOrder(market *environment.Market, side environment.TradeSide, orderID string) error {
+	return ErrReadOnlyExchange
+}
+
+// GetAllTrades returns no trades, as synthetic data cannot be traded.
+func (wrapper *SyntheticWrapper) GetAllTrades(markets []*environment.Market) (*environment.TradeBook, error) {
+	return environment.NewTradeBook(), nil
+}
+
+// GetAllMarketTrades returns no trades, as synthetic data cannot be traded.
+func (wrapper *SyntheticWrapper) GetAllMarketTrades(market *environment.Market) (*environment.TradeBook, error) {
+	return environment.NewTradeBook(), nil
+}
+
+// GetFilteredTrades returns no trades, as synthetic data cannot be traded.
+func (wrapper *SyntheticWrapper) GetFilteredTrades(market *environment.Market, symbol string, tradeSide environment.TradeSide, tradeType environment.TradeType, tradeStatus environment.TradeStatus) (*environment.TradeBook, error) {
+	return environment.NewTradeBook(), nil
+}
+
+// CalculateTradingFees calculates the trading fees for an order, at a flat taker rate.
+func (wrapper *SyntheticWrapper) CalculateTradingFees(market *environment.Market, amount decimal.Decimal, limit decimal.Decimal, orderSide environment.TradeSide) decimal.Decimal {
+	return amount.Mul(limit).Mul(decimal.NewFromFloat(syntheticTradingFee))
+}
+
+// CalculateWithdrawFees returns no fees, as synthetic data cannot be withdrawn.
+func (wrapper *SyntheticWrapper) CalculateWithdrawFees(market *environment.Market, amount decimal.Decimal) decimal.Decimal {
+	return decimal.Zero
+}
+
+// GetBalance is not supported, as synthetic data holds no funds.
+func (wrapper *SyntheticWrapper) GetBalance(symbol string) (*decimal.Decimal, error) {
+	return nil, ErrReadOnlyExchange
+}
+
+// GetAccountSnapshot is not supported, as synthetic data holds no funds.
+func (wrapper *SyntheticWrapper) GetAccountSnapshot() (*environment.AccountSnapshot, error) {
+	return nil, ErrAccountSnapshotNotSupported
+}
+
+// GetDepositAddress gets the deposit address for the specified coin, if configured.
+func (wrapper *SyntheticWrapper) GetDepositAddress(coinTicker string) (string, bool) {
+	addr, exists := wrapper.depositAddresses[coinTicker]
+	return addr, exists
+}
+
+// FeedConnect is not supported, as synthetic data has no feed.
+func (wrapper *SyntheticWrapper) FeedConnect(markets []*environment.Market) error {
+	return ErrWebsocketNotSupported
+}
+
+// Withdraw is not supported, as synthetic data holds no funds.
+func (wrapper *SyntheticWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) (string, error) {
+	return "", ErrReadOnlyExchange
+}
+
+// GetWithdrawStatus is not supported, as synthetic data holds no funds.
+func (wrapper *SyntheticWrapper) GetWithdrawStatus(coinTicker string, withdrawalID string) (environment.TransferStatus, error) {
+	return environment.TransferFailed, ErrWithdrawStatusNotSupported
+}
@@ -0,0 +1,118 @@
+package exchanges
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// syntheticReturns returns the hourly log returns of the closes of a market over the first 60 days.
+func syntheticReturns(t *testing.T, wrapper *SyntheticWrapper, name string) []float64 {
+	t.Helper()
+	market := syntheticMarket(name)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	candles, err := wrapper.GetHistoricalCandles(market, start, start.AddDate(0, 0, 60), 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret := make([]float64, 0, len(candles))
+	for i := 1; i < len(candles); i++ {
+		ret = append(ret, math.Log(candles[i].Close.InexactFloat64()/candles[i-1].Close.InexactFloat64()))
+	}
+	return ret
+}
+
+// correlation returns the Pearson correlation of two samples of the same size.
+func correlation(x []float64, y []float64) float64 {
+	var meanX, meanY float64
+	for i := range x {
+		meanX += x[i] / float64(len(x))
+		meanY += y[i] / float64(len(y))
+	}
+	var covariance, varianceX, varianceY float64
+	for i := range x {
+		covariance += (x[i] - meanX) * (y[i] - meanY)
+		varianceX += (x[i] - meanX) * (x[i] - meanX)
+		varianceY += (y[i] - meanY) * (y[i] - meanY)
+	}
+	return covariance / math.Sqrt(varianceX*varianceY)
+}
+
+func TestSyntheticSeedIsReproducible(t *testing.T) {
+	first := syntheticReturns(t, NewSyntheticWrapper(syntheticConfig(3), nil), "ETH-USD")
+	again := syntheticReturns(t, NewSyntheticWrapper(syntheticConfig(3), nil), "ETH-USD")
+	other := syntheticReturns(t, NewSyntheticWrapper(syntheticConfig(4), nil), "ETH-USD")
+
+	if len(first) != 60*24 || len(again) != len(first) {
+		t.Fatalf("got %d and %d returns, want %d", len(first), len(again), 60*24)
+	}
+	for i := range first {
+		if first[i] != again[i] {
+			t.Fatalf("return %d is %f with the same seed, want %f", i, again[i], first[i])
+		}
+	}
+
+	differs := false
+	for i := range first {
+		differs = differs || first[i] != other[i]
+	}
+	if !differs {
+		t.Fatal("another seed generated the same returns")
+	}
+}
+
+func TestSyntheticReturnsAreCorrelated(t *testing.T) {
+	wrapper := NewSyntheticWrapper(syntheticConfig(3), nil)
+	btc := syntheticReturns(t, wrapper, "BTC-USD")
+	eth := syntheticReturns(t, wrapper, "ETH-USD")
+	sol := syntheticReturns(t, wrapper, "SOL-USD")
+
+	if got := correlation(btc, eth); math.Abs(got-0.8) > 0.05 {
+		t.Errorf("btc and eth returns are correlated by %.3f, want 0.8", got)
+	}
+	if got := correlation(btc, sol); math.Abs(got) > 0.1 {
+		t.Errorf("btc and sol returns are correlated by %.3f, want 0", got)
+	}
+}
+
+func TestSyntheticCandles(t *testing.T) {
+	wrapper := NewSyntheticWrapper(syntheticConfig(3), nil)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// the closes generated by seed 3, which must not change as long as the processes are unchanged.
+	tests := []struct {
+		name   string
+		open   string
+		closes []string
+	}{
+		{name: "BTC-USD", open: "40000", closes: []string{"39706.98206275", "39499.32295706", "39296.32750304"}},
+		{name: "ETH-USD", open: "2000", closes: []string{"1963.68439788", "1968.70061232", "1969.3689637"}},
+		{name: "SOL-USD", open: "100", closes: []string{"99.7618724", "99.55411296", "97.9105344"}},
+	}
+	for _, test := range tests {
+		candles, err := wrapper.GetHistoricalCandles(syntheticMarket(test.name), start, start.Add(2*time.Hour), 60)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(candles) != len(test.closes) {
+			t.Fatalf("%s: got %d candles, want %d", test.name, len(candles), len(test.closes))
+		}
+
+		open := decimal.RequireFromString(test.open)
+		for i, candle := range candles {
+			if !candle.CandleTime.Equal(start.Add(time.Duration(i) * time.Hour)) {
+				t.Errorf("%s: candle %d is at %s, want one candle per hour", test.name, i, candle.CandleTime)
+			}
+			if !candle.Open.Equal(open) || !candle.Close.Equal(decimal.RequireFromString(test.closes[i])) {
+				t.Errorf("%s: candle %d goes from %s to %s, want %s to %s", test.name, i, candle.Open, candle.Close, open, test.closes[i])
+			}
+			if candle.High.LessThan(decimal.Max(candle.Open, candle.Close)) || candle.Low.GreaterThan(decimal.Min(candle.Open, candle.Close)) || !candle.Volume.IsPositive() {
+				t.Errorf("%s: candle %d is inconsistent: %+v", test.name, i, candle)
+			}
+			open = candle.Close
+		}
+	}
+}
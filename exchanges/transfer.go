@@ -0,0 +1,369 @@
+package exchanges
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTransferPollInterval = 30 * time.Second
+	defaultTransferTimeout      = 2 * time.Hour
+)
+
+// depositReceiver is implemented by wrappers that must be credited explicitly when a transfer reaches them (e.g. the simulator).
+type depositReceiver interface {
+	ReceiveDeposit(coinTicker string, amount decimal.Decimal)
+}
+
+// TransferManager moves coins between the configured exchanges, sending them to the deposit address of the destination.
+//
+//	NOTE: a transfer is only allowed if its address is in the configured allowlist and it fits the daily limit of the coin.
+//	The transfers are recorded in the configured journal, so that the limit also counts the ones of previous runs.
+//
+//	NOTE: the exchanges are requested without holding the manager. The amount of a transfer is reserved from the daily
+//	limit while it is requested, so that concurrent transfers never exceed the limit together.
+type TransferManager struct {
+	mutex          *sync.Mutex
+	wrappers       map[string]ExchangeWrapper
+	config         environment.TransferConfig
+	transfers      []*environment.Transfer
+	reserved       map[string]decimal.Decimal // amounts of the transfers being requested, by coin.
+	balancesBefore map[string]decimal.Decimal // destination balances when each transfer was requested, used when the source cannot report the withdrawal status.
+}
+
+// transferJournal represents the transfers recorded by a TransferManager in its journal.
+type transferJournal struct {
+	Transfers      []*environment.Transfer    `json:"transfers"`
+	BalancesBefore map[string]decimal.Decimal `json:"balances_before"`
+}
+
+// NewTransferManager creates a new TransferManager for the specified wrappers, keyed by exchange name, loading the
+// transfers recorded in the journal of the configuration if any.
+func NewTransferManager(wrappers map[string]ExchangeWrapper, config environment.TransferConfig) (*TransferManager, error) {
+	tm := &TransferManager{
+		mutex:          &sync.Mutex{},
+		wrappers:       wrappers,
+		config:         config,
+		transfers:      make([]*environment.Transfer, 0),
+		reserved:       make(map[string]decimal.Decimal),
+		balancesBefore: make(map[string]decimal.Decimal),
+	}
+
+	if config.Journal == "" {
+		return tm, nil
+	}
+	content, err := os.ReadFile(config.Journal)
+	if errors.Is(err, os.ErrNotExist) {
+		return tm, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read transfer journal %s: %w", config.Journal, err)
+	}
+	var journal transferJournal
+	if err := json.Unmarshal(content, &journal); err != nil {
+		return nil, fmt.Errorf("cannot read transfer journal %s: %w", config.Journal, err)
+	}
+	tm.transfers = append(tm.transfers, journal.Transfers...)
+	for id, balance := range journal.BalancesBefore {
+		tm.balancesBefore[id] = balance
+	}
+	return tm, nil
+}
+
+// Transfer withdraws amount of a coin from an exchange to the deposit address of another exchange.
+func (tm *TransferManager) Transfer(coinTicker string, amount decimal.Decimal, from string, to string) (*environment.Transfer, error) {
+	if !amount.IsPositive() {
+		return nil, errors.New("transfer amount must be > 0")
+	}
+	if from == to {
+		return nil, errors.New("cannot transfer " + coinTicker + " to the same exchange " + from)
+	}
+
+	source, exists := tm.wrappers[from]
+	if !exists {
+		return nil, errors.New("source exchange " + from + " is not configured")
+	}
+	destination, exists := tm.wrappers[to]
+	if !exists {
+		return nil, errors.New("destination exchange " + to + " is not configured")
+	}
+
+	address, exists := destination.GetDepositAddress(coinTicker)
+	if !exists || address == "" {
+		return nil, fmt.Errorf("no %s deposit address configured for %s", coinTicker, to)
+	}
+	if !tm.isAllowed(coinTicker, address) {
+		return nil, fmt.Errorf("%s deposit address %s of %s is not in the transfer allowlist", coinTicker, address, to)
+	}
+
+	now := transferTime(source)
+	if err := tm.reserve(coinTicker, amount, now); err != nil {
+		return nil, err
+	}
+
+	withdrawalID, fee, destinationBalance, err := tm.withdraw(source, destination, coinTicker, amount, address, from)
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	// the reservation is replaced by the transfer, or released if the withdrawal failed.
+	tm.reserved[coinTicker] = tm.reserved[coinTicker].Sub(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	transferID, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	transfer := &environment.Transfer{
+		ID:           transferID.String(),
+		WithdrawalID: withdrawalID,
+		Coin:         coinTicker,
+		Amount:       amount,
+		Fee:          fee,
+		FromExchange: from,
+		ToExchange:   to,
+		Address:      address,
+		Status:       environment.TransferPending,
+		RequestedAt:  now,
+	}
+	if destinationBalance != nil {
+		tm.balancesBefore[transfer.ID] = *destinationBalance
+	}
+	tm.transfers = append(tm.transfers, transfer)
+	if err := tm.saveJournal(); err != nil {
+		logrus.Error("Cannot record transfer "+transfer.ID+" in the journal: ", err)
+	}
+
+	logrus.Info("Transfer requested " + transfer.String())
+	return transfer, nil
+}
+
+// reserve reserves an amount of a coin from its daily limit, failing if the limit would be exceeded.
+func (tm *TransferManager) reserve(coinTicker string, amount decimal.Decimal, now time.Time) error {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	limit, exists := tm.config.DailyLimits[coinTicker]
+	if !exists {
+		return errors.New("no daily transfer limit configured for " + coinTicker)
+	}
+	withdrawn := tm.withdrawnSince(coinTicker, now.Add(-24*time.Hour)).Add(tm.reserved[coinTicker])
+	if withdrawn.Add(amount).GreaterThan(limit) {
+		return fmt.Errorf("cannot transfer %s %s: %s already withdrawn in the last 24 hours, daily limit is %s",
+			amount.String(), coinTicker, withdrawn.String(), limit.String())
+	}
+	tm.reserved[coinTicker] = tm.reserved[coinTicker].Add(amount)
+	return nil
+}
+
+// withdraw checks the balance of the source and withdraws from it, returning the id of the withdrawal, its fee and the
+// balance of the destination before it, nil if unknown.
+func (tm *TransferManager) withdraw(source ExchangeWrapper, destination ExchangeWrapper, coinTicker string, amount decimal.Decimal, address string, from string) (string, decimal.Decimal, *decimal.Decimal, error) {
+	fee := source.CalculateWithdrawFees(&environment.Market{Name: coinTicker, BaseCurrency: coinTicker}, amount)
+	if fee.GreaterThanOrEqual(amount) {
+		return "", fee, nil, fmt.Errorf("cannot transfer %s %s: withdrawal fee is %s", amount.String(), coinTicker, fee.String())
+	}
+
+	balance, err := source.GetBalance(coinTicker)
+	if err != nil {
+		return "", fee, nil, err
+	}
+	if balance.LessThan(amount) {
+		return "", fee, nil, fmt.Errorf("cannot transfer: not enough %s balance on %s", coinTicker, from)
+	}
+
+	destinationBalance, err := destination.GetBalance(coinTicker)
+	if err != nil {
+		destinationBalance = nil
+	}
+
+	withdrawalID, err := source.Withdraw(address, coinTicker, amount)
+	return withdrawalID, fee, destinationBalance, err
+}
+
+// Update checks once the status of a pending transfer, crediting simulated destinations on completion.
+func (tm *TransferManager) Update(transfer *environment.Transfer) (environment.TransferStatus, error) {
+	tm.mutex.Lock()
+	status := transfer.Status
+	before, known := tm.balancesBefore[transfer.ID]
+	tm.mutex.Unlock()
+	if status != environment.TransferPending {
+		return status, nil
+	}
+
+	source := tm.wrappers[transfer.FromExchange]
+	destination := tm.wrappers[transfer.ToExchange]
+
+	status, err := source.GetWithdrawStatus(transfer.Coin, transfer.WithdrawalID)
+	if errors.Is(err, ErrWithdrawStatusNotSupported) {
+		status, err = statusFromDestination(transfer, destination, before, known)
+	}
+	if err != nil {
+		return environment.TransferPending, err
+	}
+	if status == environment.TransferPending {
+		return status, nil
+	}
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	// another update may have completed the transfer meanwhile, the deposit is only received once.
+	if transfer.Status != environment.TransferPending {
+		return transfer.Status, nil
+	}
+	transfer.Status = status
+	transfer.CompletedAt = transferTime(source)
+	delete(tm.balancesBefore, transfer.ID)
+
+	if status == environment.TransferComplete {
+		if receiver, ok := destination.(depositReceiver); ok {
+			receiver.ReceiveDeposit(transfer.Coin, transfer.Received())
+		}
+	}
+	if err := tm.saveJournal(); err != nil {
+		logrus.Error("Cannot record transfer "+transfer.ID+" in the journal: ", err)
+	}
+
+	logrus.Info("Transfer updated " + transfer.String())
+	return status, nil
+}
+
+// WaitForCompletion polls a transfer until it is no longer pending or the configured timeout expires, on the clock of
+// the exchanges.
+func (tm *TransferManager) WaitForCompletion(transfer *environment.Transfer) error {
+	pollInterval := defaultTransferPollInterval
+	if tm.config.PollInterval > 0 {
+		pollInterval = time.Duration(tm.config.PollInterval) * time.Second
+	}
+	timeout := defaultTransferTimeout
+	if tm.config.Timeout > 0 {
+		timeout = time.Duration(tm.config.Timeout) * time.Minute
+	}
+
+	clock := ClockOf(tm.wrappers[transfer.FromExchange], tm.wrappers[transfer.ToExchange])
+	deadline := clock.Now().Add(timeout)
+	for {
+		status, err := tm.Update(transfer)
+		if err != nil {
+			logrus.Warn("cannot update transfer "+transfer.ID+": ", err)
+		}
+
+		switch status {
+		case environment.TransferComplete:
+			return nil
+		case environment.TransferFailed:
+			return errors.New("transfer " + transfer.ID + " failed")
+		}
+
+		now := clock.Now()
+		if now.After(deadline) {
+			return errors.New("timed out waiting for transfer " + transfer.ID)
+		}
+		// a simulated clock does not move while sleeping, the transfer can only arrive once the simulator steps.
+		clock.Sleep(pollInterval)
+		if !clock.Now().After(now) {
+			return errors.New("transfer " + transfer.ID + " is still pending and the simulated time does not pass while waiting")
+		}
+	}
+}
+
+// Transfers returns a copy of all the transfers requested so far.
+func (tm *TransferManager) Transfers() []environment.Transfer {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	ret := make([]environment.Transfer, len(tm.transfers))
+	for i, transfer := range tm.transfers {
+		ret[i] = *transfer
+	}
+	return ret
+}
+
+// isAllowed checks whether the address is in the allowlist of the coin.
+func (tm *TransferManager) isAllowed(coinTicker string, address string) bool {
+	for _, allowed := range tm.config.Allowlist[coinTicker] {
+		if allowed == address {
+			return true
+		}
+	}
+	return false
+}
+
+// saveJournal records the transfers in the journal of the configuration, if any.
+func (tm *TransferManager) saveJournal() error {
+	if tm.config.Journal == "" {
+		return nil
+	}
+	content, err := json.Marshal(transferJournal{Transfers: tm.transfers, BalancesBefore: tm.balancesBefore})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(tm.config.Journal, content)
+}
+
+// writeFileAtomically writes the content to the specified file, replacing it at once so that a crash never leaves half
+// of it.
+func writeFileAtomically(path string, content []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// withdrawnSince sums the amounts of a coin withdrawn since the specified time, failed transfers excluded.
+func (tm *TransferManager) withdrawnSince(coinTicker string, since time.Time) decimal.Decimal {
+	total := decimal.Zero
+	for _, transfer := range tm.transfers {
+		if transfer.Coin != coinTicker || transfer.Status == environment.TransferFailed || transfer.RequestedAt.Before(since) {
+			continue
+		}
+		total = total.Add(transfer.Amount)
+	}
+	return total
+}
+
+// statusFromDestination considers a transfer complete once the destination balance grew by the expected amount since
+// it was requested, if known.
+func statusFromDestination(transfer *environment.Transfer, destination ExchangeWrapper, before decimal.Decimal, known bool) (environment.TransferStatus, error) {
+	if !known {
+		return environment.TransferPending, errors.New("cannot track transfer " + transfer.ID + ": destination balance unknown")
+	}
+
+	balance, err := destination.GetBalance(transfer.Coin)
+	if err != nil {
+		return environment.TransferPending, err
+	}
+
+	if balance.GreaterThanOrEqual(before.Add(transfer.Received())) {
+		return environment.TransferComplete, nil
+	}
+	return environment.TransferPending, nil
+}
+
+// transferTime gets the current time as seen by the wrapper, which is the simulated date for simulators.
+func transferTime(wrapper ExchangeWrapper) time.Time {
+	return ClockOf(wrapper).Now()
+}
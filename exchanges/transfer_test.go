@@ -0,0 +1,188 @@
+package exchanges
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// transferWrappers returns two simulated exchanges holding 10 eth each, with an eth deposit address.
+func transferWrappers() map[string]ExchangeWrapper {
+	simConfig := environment.SimulationConfig{
+		SimModeOn:       true,
+		SimFakeBalances: map[string]decimal.Decimal{"eth": decimal.NewFromInt(10)},
+	}
+	wrappers := make(map[string]ExchangeWrapper)
+	for _, name := range []string{"source", "destination"} {
+		inner, _ := ethSynthetic(map[string]string{"eth": name + "_wallet"})
+		wrappers[name] = NewExchangeWrapperSimulator(inner, simConfig)
+	}
+	return wrappers
+}
+
+// blockingWithdrawWrapper blocks its withdrawals until released, telling when each of them is received, and fails
+// them with err.
+type blockingWithdrawWrapper struct {
+	ExchangeWrapper
+	received chan struct{}
+	release  chan struct{}
+	err      error
+}
+
+func (wrapper *blockingWithdrawWrapper) Withdraw(destinationAddress string, coinTicker string, amount decimal.Decimal) (string, error) {
+	wrapper.received <- struct{}{}
+	<-wrapper.release
+	if wrapper.err != nil {
+		return "", wrapper.err
+	}
+	return wrapper.ExchangeWrapper.Withdraw(destinationAddress, coinTicker, amount)
+}
+
+func TestDailyLimitHoldsAcrossManagers(t *testing.T) {
+	config := environment.TransferConfig{
+		Allowlist:   map[string][]string{"eth": {"destination_wallet"}},
+		DailyLimits: map[string]decimal.Decimal{"eth": decimal.NewFromInt(5)},
+		Journal:     filepath.Join(t.TempDir(), "transfers.json"),
+	}
+
+	first, err := NewTransferManager(transferWrappers(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.Transfer("eth", decimal.NewFromInt(3), "source", "destination"); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := NewTransferManager(transferWrappers(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Transfers()) != 1 {
+		t.Fatalf("the journal holds %d transfers, want 1", len(second.Transfers()))
+	}
+	_, err = second.Transfer("eth", decimal.NewFromInt(3), "source", "destination")
+	if err == nil || !strings.Contains(err.Error(), "daily limit") {
+		t.Fatalf("a transfer over the daily limit was allowed: %v", err)
+	}
+	if _, err := second.Transfer("eth", decimal.NewFromInt(2), "source", "destination"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForCompletionOnSimulatedClock(t *testing.T) {
+	simConfig := environment.SimulationConfig{
+		SimModeOn:        true,
+		SimStartDate:     "2024-01-02",
+		SimEndDate:       "2024-01-03",
+		SimInterval:      60,
+		SimTransferDelay: 90,
+		SimFakeBalances:  map[string]decimal.Decimal{"eth": decimal.NewFromInt(10)},
+	}
+	inner, _ := ethSynthetic(map[string]string{"eth": "destination_wallet"})
+	source := NewExchangeWrapperSimulator(inner, simConfig)
+	wrappers := map[string]ExchangeWrapper{"source": source, "destination": NewExchangeWrapperSimulator(inner, simConfig)}
+
+	manager, err := NewTransferManager(wrappers, environment.TransferConfig{
+		Allowlist:   map[string][]string{"eth": {"destination_wallet"}},
+		DailyLimits: map[string]decimal.Decimal{"eth": decimal.NewFromInt(5)},
+		Journal:     filepath.Join(t.TempDir(), "transfers.json"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer, err := manager.Transfer("eth", decimal.NewFromInt(1), "source", "destination")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the simulated time does not pass while waiting, so the wait returns instead of polling forever.
+	if err := manager.WaitForCompletion(transfer); err == nil || !strings.Contains(err.Error(), "still pending") {
+		t.Fatalf("waiting on a pending simulated transfer returned %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := source.IncrementCurrDate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := manager.WaitForCompletion(transfer); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCorruptJournalIsAnError(t *testing.T) {
+	journal := filepath.Join(t.TempDir(), "transfers.json")
+	if err := os.WriteFile(journal, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := NewTransferManager(transferWrappers(), environment.TransferConfig{Journal: journal})
+	if err == nil || manager != nil {
+		t.Fatal("a corrupt journal was loaded")
+	}
+}
+
+func TestDailyLimitIsReservedWhileWithdrawing(t *testing.T) {
+	wrappers := transferWrappers()
+	source := &blockingWithdrawWrapper{ExchangeWrapper: wrappers["source"], received: make(chan struct{}, 1), release: make(chan struct{})}
+	wrappers["source"] = source
+	manager, err := NewTransferManager(wrappers, environment.TransferConfig{
+		Allowlist:   map[string][]string{"eth": {"destination_wallet"}},
+		DailyLimits: map[string]decimal.Decimal{"eth": decimal.NewFromInt(5)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := manager.Transfer("eth", decimal.NewFromInt(3), "source", "destination")
+		done <- err
+	}()
+	select {
+	case <-source.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the withdrawal was not requested")
+	}
+
+	// the first withdrawal is still pending, but its amount already counts against the limit.
+	_, err = manager.Transfer("eth", decimal.NewFromInt(3), "source", "destination")
+	if err == nil || !strings.Contains(err.Error(), "daily limit") {
+		t.Fatalf("a transfer over the reserved limit was allowed: %v", err)
+	}
+	close(source.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(manager.Transfers()) != 1 {
+		t.Fatalf("got %d transfers, want 1", len(manager.Transfers()))
+	}
+}
+
+func TestFailedWithdrawalReleasesTheDailyLimit(t *testing.T) {
+	wrappers := transferWrappers()
+	source := &blockingWithdrawWrapper{ExchangeWrapper: wrappers["source"], received: make(chan struct{}, 2), release: make(chan struct{}), err: errors.New("exchange unavailable")}
+	close(source.release)
+	wrappers["source"] = source
+	manager, err := NewTransferManager(wrappers, environment.TransferConfig{
+		Allowlist:   map[string][]string{"eth": {"destination_wallet"}},
+		DailyLimits: map[string]decimal.Decimal{"eth": decimal.NewFromInt(5)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := manager.Transfer("eth", decimal.NewFromInt(5), "source", "destination"); err == nil {
+		t.Fatal("the failed withdrawal was recorded as a transfer")
+	}
+	source.err = nil
+	if _, err := manager.Transfer("eth", decimal.NewFromInt(5), "source", "destination"); err != nil {
+		t.Fatalf("the failed withdrawal still counts against the daily limit: %v", err)
+	}
+}
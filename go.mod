@@ -3,6 +3,7 @@ module github.com/mcwarner5/BlockBot8000
 go 1.22.0
 
 require (
+	github.com/dgrr/fastws v1.0.4
 	github.com/fatih/structs v1.1.0
 	github.com/fiore/kucoin-go v0.0.0-20190107105632-5a814c26befa
 	github.com/gofrs/uuid v4.4.0+incompatible
@@ -18,7 +19,6 @@ require (
 
 require (
 	github.com/andybalholm/brotli v1.1.0 // indirect
-	github.com/dgrr/fastws v1.0.4 // indirect
 	github.com/fsnotify/fsnotify v1.7.0 // indirect
 	github.com/gobwas/httphead v0.0.0-20200921212729-da3d93bc3c58 // indirect
 	github.com/gobwas/pool v0.2.1 // indirect
@@ -24,6 +24,11 @@ import (
 	"github.com/mcwarner5/BlockBot8000/strategies"
 )
 
+// IntervalSpecSchema contains the fields of the specs of interval based strategies, read by NewIntervalStrategy.
+var IntervalSpecSchema = strategies.BaseSpecSchema.With(
+	strategies.SpecField{Name: "interval", Kind: strategies.SpecInt, Required: true, Example: 60, Description: "minutes between two updates"},
+)
+
 // IntervalStrategy is an interval based strategy.
 type IntervalStrategy struct {
 	strategies.StrategyModel
@@ -36,12 +41,8 @@ func (is IntervalStrategy) String() string {
 
 func (is IntervalStrategy) OnUpdate(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) (strategies.Strategy, error) {
 	//logrus.Info("OnUpdate " + is.String())
-	if wrappers[0].Name() == "simulator" {
-		return is, nil
-	}
-
 	var sleep_len = time.Duration(is.Interval) * time.Minute
-	time.Sleep(sleep_len)
+	exchanges.ClockOf(wrappers...).Sleep(sleep_len)
 	return is, nil
 }
 
@@ -22,6 +22,10 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+func init() {
+	strategies.Register("PullMarketData", NewPullMarketData, IntervalSpecSchema)
+}
+
 type PullMarketData struct {
 	IntervalStrategy
 	CandlesEnabled bool
@@ -16,11 +16,11 @@
 package intervalstrategies
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"sort"
-	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/julien040/go-ternary"
@@ -31,6 +31,17 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+func init() {
+	strat.Register("RebalancerStrategy", NewRebalancerStrategy, IntervalSpecSchema.With(
+		strat.SpecField{Name: "allowance_threshold", Kind: strat.SpecFloat, Required: true, Example: 0.25, Description: "drift of a coin from its ratio, relative to the ratio, which triggers a rebalance"},
+		strat.SpecField{Name: "market_cap_multiplier", Kind: strat.SpecFloat, Required: true, Example: 1.25, Description: "reserved for market cap weighting, currently unused"},
+		strat.SpecField{Name: "min_trade_size", Kind: strat.SpecFloat, Required: true, Example: 0.0075, Description: "smallest trade, as a fraction of the portfolio value"},
+		strat.SpecField{Name: "static_coin", Kind: strat.SpecString, Required: true, Example: "usdt", Description: "coin every market is quoted in"},
+		strat.SpecField{Name: "nuetral_coin", Kind: strat.SpecString, Required: true, Example: "eth", Description: "coin the performance is measured in"},
+		strat.SpecField{Name: "portfolio_ratio_percent", Kind: strat.SpecWeights, Required: true, Example: map[string]interface{}{"eth": 0.5, "usdt": 0.5}, Description: "share of the portfolio value of each coin, adding up to 1"},
+	))
+}
+
 // IntervalStrategy is an interval based strategy.
 type RebalancerStrategy struct {
 	IntervalStrategy
@@ -98,22 +109,29 @@ func (is RebalancerStrategy) Setup(wrappers []exchanges.ExchangeWrapper, markets
 	logrus.Info("RebalancerStrategy Setup")
 	coin_balance_info := make(map[string]*strat.CoinBalance)
 
+	// the portfolio is valued on the total balances, holds of open orders included, like UpdateCurrentBalances does.
+	coins := make([]string, 0, len(is.PortfolioDistribution))
+	for coin := range is.PortfolioDistribution {
+		coins = append(coins, coin)
+	}
+	snapshot, err := exchanges.AccountSnapshotFor(wrappers[0], coins)
+	if err != nil {
+		panic("rebalancer portfolio could not pull balances: " + err.Error())
+	}
+
 	for coin := range is.PortfolioDistribution {
 		coin_found := false
 		for _, market := range markets {
 			if coin == market.BaseCurrency {
 				coin_found = true
-				balance, err := wrappers[0].GetBalance(market.BaseCurrency)
-				if err != nil {
-					panic("rebalancer portfolio coin " + coin + " could not pull balance ")
-				}
+				balance := snapshot.Balance(market.BaseCurrency).Total
 
 				data, err := wrappers[0].GetMarketSummary(market)
 				if err != nil {
 					panic("rebalancer portfolio coin " + coin + " could not pull market data with market " + market.Name)
 				}
 
-				coin_balance_info[coin], err = strat.NewCoinBalance(coin, *balance, data, market)
+				coin_balance_info[coin], err = strat.NewCoinBalance(coin, balance, data, market)
 				if err != nil {
 					panic("rebalancer portfolio coin " + coin + " could not create a coin balance ")
 				}
@@ -126,15 +144,15 @@ func (is RebalancerStrategy) Setup(wrappers []exchanges.ExchangeWrapper, markets
 
 					new_trade := environment.Trade{
 						Price:        data.Last,
-						AskQuantity:  *balance,
-						FillQuantity: *balance,
+						AskQuantity:  balance,
+						FillQuantity: balance,
 						Fees:         decimal.Zero,
 						Market:       market.Name,
 						Side:         environment.Buy,
 						Status:       environment.Complete,
 						Type:         environment.MarketPrice,
 						TradeNumber:  orderFakeID.String(),
-						Timestamp:    time.Now(),
+						Timestamp:    exchanges.ClockOf(wrappers...).Now(),
 					}
 					err = wrappers[0].(*exchanges.ExchangeWrapperSimulator).AddTrade(market, new_trade)
 					if err != nil {
@@ -153,12 +171,7 @@ func (is RebalancerStrategy) Setup(wrappers []exchanges.ExchangeWrapper, markets
 		return is, err
 	}
 
-	currTime := time.Now()
-	if wrappers[0].IsHistoricalSimulation() {
-		sim_wrapper := wrappers[0].(*exchanges.ExchangeWrapperSimulator)
-		currTime = sim_wrapper.GetCurrDate()
-	}
-
+	currTime := exchanges.ClockOf(wrappers...).Now()
 	new_portfolio, err := strat.NewPortfolioAnalysis(is.NuetralCoin, currTime, initial_balances)
 
 	if err != nil {
@@ -182,12 +195,7 @@ func (is RebalancerStrategy) TearDown(wrappers []exchanges.ExchangeWrapper, mark
 	if err != nil {
 		return is, err
 	}
-	currTime := time.Now()
-	if wrappers[0].IsHistoricalSimulation() {
-		sim_wrapper := wrappers[0].(*exchanges.ExchangeWrapperSimulator)
-		currTime = sim_wrapper.GetCurrDate()
-	}
-
+	currTime := exchanges.ClockOf(wrappers...).Now()
 	is.Portfolio, err = is.Portfolio.SetCurrDate(currTime)
 	if err != nil {
 		return is, err
@@ -199,6 +207,52 @@ func (is RebalancerStrategy) TearDown(wrappers []exchanges.ExchangeWrapper, mark
 	return is, nil
 }
 
+// GetPortfolioAnalysis gets the analysis of the rebalanced portfolio, nil before the setup.
+func (is RebalancerStrategy) GetPortfolioAnalysis() *strat.PortfolioAnalysis {
+	return is.Portfolio
+}
+
+// Checkpoint saves the portfolio analysis of the strategy, to resume a simulation.
+func (is RebalancerStrategy) Checkpoint() (json.RawMessage, error) {
+	if is.Portfolio == nil {
+		return nil, errors.New("rebalancer portfolio is not set up")
+	}
+	return json.Marshal(is.Portfolio)
+}
+
+// Restore restores the portfolio analysis saved by Checkpoint, binding its balances to the markets by name.
+func (is RebalancerStrategy) Restore(state json.RawMessage, wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) (strat.Strategy, error) {
+	var portfolio strat.PortfolioAnalysis
+	if err := json.Unmarshal(state, &portfolio); err != nil {
+		return is, err
+	}
+	if portfolio.InitialBalances == nil || portfolio.CurrentBalances == nil {
+		return is, errors.New("rebalancer portfolio state has no balances")
+	}
+
+	for _, balances := range []*strat.PortfolioBalance{portfolio.InitialBalances, portfolio.CurrentBalances} {
+		for coin, balance := range balances.Balances {
+			if balance == nil || balance.Market == nil {
+				return is, errors.New("rebalancer portfolio state has no market for coin " + coin)
+			}
+			market_found := false
+			for _, market := range markets {
+				if market.Name == balance.Market.Name {
+					balance.Market = market
+					market_found = true
+					break
+				}
+			}
+			if !market_found {
+				return is, errors.New("rebalancer portfolio market " + balance.Market.Name + " was not found in market list")
+			}
+		}
+	}
+
+	is.Portfolio = &portfolio
+	return is, nil
+}
+
 func (is RebalancerStrategy) OnUpdate(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) (strat.Strategy, error) {
 
 	is, err := is.UpdateCurrentBalances(wrappers, markets)
@@ -349,7 +403,7 @@ func (is RebalancerStrategy) GetAvailiblePercentToSellByCoin(wrappers []exchange
 				}
 
 				for _, trade := range marketTades.Trades {
-					if trade.Status != environment.Complete {
+					if !trade.Status.IsFilled() {
 						continue
 					}
 
@@ -583,7 +637,7 @@ func (is RebalancerStrategy) UpdateStaticCoinBalance(wrappers []exchanges.Exchan
 		if market.BaseCurrency != is.StaticCoin {
 			continue
 		}
-		balance, err := wrappers[0].GetBalance(market.BaseCurrency)
+		snapshot, err := exchanges.AccountSnapshotFor(wrappers[0], []string{market.BaseCurrency})
 		if err != nil {
 			return is, err
 		}
@@ -591,7 +645,7 @@ func (is RebalancerStrategy) UpdateStaticCoinBalance(wrappers []exchanges.Exchan
 		if err != nil {
 			return is, err
 		}
-		coin_balnce, err := strat.NewCoinBalance(market.BaseCurrency, *balance, data, market)
+		coin_balnce, err := strat.NewCoinBalance(market.BaseCurrency, snapshot.Balance(market.BaseCurrency).Total, data, market)
 		if err != nil {
 			return is, err
 		}
@@ -604,40 +658,46 @@ func (is RebalancerStrategy) UpdateStaticCoinBalance(wrappers []exchanges.Exchan
 
 func (is RebalancerStrategy) UpdateCurrentBalances(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) (RebalancerStrategy, error) {
 
-	coin_balance_info := make(map[string]*strat.CoinBalance)
-
+	portfolio_markets := make([]*environment.Market, 0, len(is.PortfolioDistribution))
+	coins := make([]string, 0, len(is.PortfolioDistribution))
 	for coin := range is.PortfolioDistribution {
+		coin_found := false
 		for _, market := range markets {
 			if coin == market.BaseCurrency {
-				balance, err := wrappers[0].GetBalance(market.BaseCurrency)
-				if err != nil {
-					return is, err
-				}
-				data, err := wrappers[0].GetMarketSummary(market)
-				if err != nil {
-					return is, err
-				}
-				coin_balnce, err := strat.NewCoinBalance(market.BaseCurrency, *balance, data, market)
-				if err != nil {
-					return is, err
-				}
-
-				coin_balance_info[coin] = coin_balnce
-				continue
+				portfolio_markets = append(portfolio_markets, market)
+				coin_found = true
 			}
 		}
-		_, ok := coin_balance_info[coin]
-		if !ok {
+		if !coin_found {
 			return is, errors.New("market not found for coin " + coin)
 		}
+		coins = append(coins, coin)
+	}
+
+	snapshot, err := exchanges.AccountSnapshotFor(wrappers[0], coins)
+	if err != nil {
+		return is, err
+	}
+
+	summaries, err := wrappers[0].GetMarketSummaries(portfolio_markets)
+	if err != nil {
+		return is, err
 	}
 
-	var err error
-	is.Portfolio.CurrentBalances, err = strat.NewPortfolioBalance(is.StaticCoin, coin_balance_info)
+	is.Portfolio.CurrentBalances, err = strat.NewPortfolioBalanceFromSnapshot(is.StaticCoin, snapshot, portfolio_markets, summaries)
 	if err != nil {
 		return is, err
 	}
 
+	// deposits and withdrawals are not gains nor losses, the analysis keeps them apart.
+	if provider, ok := wrappers[0].(exchanges.CashFlowProvider); ok {
+		if flows := provider.CashFlows(); len(flows) > len(is.Portfolio.CashFlows) {
+			if err := is.Portfolio.AddCashFlows(flows[len(is.Portfolio.CashFlows):]...); err != nil {
+				return is, err
+			}
+		}
+	}
+
 	return is, nil
 }
 
@@ -5,15 +5,29 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/mcwarner5/BlockBot8000/environment"
 	"github.com/shopspring/decimal"
 )
 
+// PortfolioAnalyzer is implemented by the strategies analyzing the performance of their portfolio, to report on it.
+type PortfolioAnalyzer interface {
+	GetPortfolioAnalysis() *PortfolioAnalysis
+}
+
 type PortfolioAnalysis struct {
 	NuetralCoin     string
 	StartDate       time.Time
 	CurrentDate     time.Time
 	InitialBalances *PortfolioBalance
 	CurrentBalances *PortfolioBalance
+	CashFlows       []PortfolioCashFlow
+}
+
+// PortfolioCashFlow represents a deposit to the portfolio or a withdrawal from it, valued in the nuetral coin.
+type PortfolioCashFlow struct {
+	environment.CashFlow
+	NuetralValue   decimal.Decimal // Value of the cash flow, negative for withdrawals.
+	PortfolioValue decimal.Decimal // Value of the portfolio once the cash flow was received.
 }
 
 func (is PortfolioAnalysis) SetCurrDate(currDate time.Time) (*PortfolioAnalysis, error) {
@@ -24,9 +38,8 @@ func (is PortfolioAnalysis) SetCurrDate(currDate time.Time) (*PortfolioAnalysis,
 	return &is, nil
 }
 
+// CalcCurrAPR calculates the yearly time weighted return in nuetral coin, in percent.
 func (is PortfolioAnalysis) CalcCurrAPR() decimal.Decimal {
-	curr_diff, _ := is.GetCurrDiffInNuetralCoin(is.InitialBalances, is.CurrentBalances)
-	init_val, _ := is.InitialBalances.GetTotalValueInCoin(is.NuetralCoin)
 	diff_days := decimal.NewFromInt(1)
 	year := decimal.NewFromInt(365)
 	hundo := decimal.NewFromInt(100)
@@ -35,10 +48,80 @@ func (is PortfolioAnalysis) CalcCurrAPR() decimal.Decimal {
 		diff_days = decimal.NewFromFloat(is.CurrentDate.Sub(is.StartDate).Hours()).Div(decimal.NewFromInt(24))
 	}
 
-	apr := (curr_diff.Div(init_val)).Div(diff_days).Mul(year).Mul(hundo).Round(4)
+	growth := TimeWeightedReturn(is.valuePoints())
+	apr := growth.Div(diff_days).Mul(year).Mul(hundo).Round(4)
 	return apr
 }
 
+// CalcTimeWeightedReturn calculates the return in nuetral coin since the start, leaving out the cash flows, in percent.
+func (is PortfolioAnalysis) CalcTimeWeightedReturn() decimal.Decimal {
+	return TimeWeightedReturn(is.valuePoints()).Mul(decimal.NewFromInt(100)).Round(4)
+}
+
+// CalcMoneyWeightedReturn calculates the yearly internal rate of return in nuetral coin of the initial balance and of
+// the cash flows, in percent.
+func (is PortfolioAnalysis) CalcMoneyWeightedReturn() (decimal.Decimal, error) {
+	irr, err := MoneyWeightedReturn(is.valuePoints())
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return irr.Mul(decimal.NewFromInt(100)).Round(4), nil
+}
+
+// AddCashFlows records cash flows received by the portfolio, in order, valued at the prices of the current balances,
+// which must already hold them.
+func (is *PortfolioAnalysis) AddCashFlows(flows ...environment.CashFlow) error {
+	curr_total := is.CurrentBalances.GetTotal()
+	curr_val, err := is.CurrentBalances.GetTotalValueInCoin(is.NuetralCoin)
+	if err != nil {
+		return err
+	}
+
+	static_price := is.CurrentBalances.Balances[is.CurrentBalances.StaticCoin].MarketData.Last
+	added := make([]PortfolioCashFlow, len(flows))
+	for i, flow := range flows {
+		// coins out of the portfolio are not part of its value.
+		flow_value := decimal.Zero
+		if coin_balance, ok := is.CurrentBalances.Balances[flow.Coin]; ok {
+			flow_value = flow.Amount.Mul(coin_balance.MarketData.Last)
+			if flow.Coin != is.CurrentBalances.StaticCoin {
+				flow_value = flow_value.Mul(static_price)
+			}
+		}
+		added[i] = PortfolioCashFlow{CashFlow: flow, NuetralValue: flow_value.Mul(curr_val).Div(curr_total)}
+	}
+
+	// the current value holds all the flows, each flow was received before the later ones.
+	portfolio_val := curr_val
+	for i := len(added) - 1; i >= 0; i-- {
+		added[i].PortfolioValue = portfolio_val
+		portfolio_val = portfolio_val.Sub(added[i].NuetralValue)
+	}
+	is.CashFlows = append(is.CashFlows, added...)
+	return nil
+}
+
+// GetNetCashFlows gets the value in nuetral coin of the deposits minus the withdrawals since the start.
+func (is PortfolioAnalysis) GetNetCashFlows() decimal.Decimal {
+	net := decimal.Zero
+	for _, flow := range is.CashFlows {
+		net = net.Add(flow.NuetralValue)
+	}
+	return net
+}
+
+// valuePoints returns the values of the portfolio in nuetral coin at the start, at each cash flow and now.
+func (is PortfolioAnalysis) valuePoints() []ValuePoint {
+	init_val, _ := is.InitialBalances.GetTotalValueInCoin(is.NuetralCoin)
+	curr_val, _ := is.CurrentBalances.GetTotalValueInCoin(is.NuetralCoin)
+
+	points := []ValuePoint{{Time: is.StartDate, Value: init_val}}
+	for _, flow := range is.CashFlows {
+		points = append(points, ValuePoint{Time: flow.Time, Value: flow.PortfolioValue, Flow: flow.NuetralValue})
+	}
+	return append(points, ValuePoint{Time: is.CurrentDate, Value: curr_val})
+}
+
 func (is PortfolioAnalysis) String() string {
 	pa_string := fmt.Sprintln("Initial Balance:")
 	pa_string += is.InitialBalances.String()
@@ -73,6 +156,14 @@ func (is PortfolioAnalysis) String() string {
 	pa_string += fmt.Sprintf("Final difference in static coin: %s %s", gains.String(), is.CurrentBalances.StaticCoin) + "\n"
 
 	pa_string += fmt.Sprintf("Final APR in nuetral coin: %s%%", is.CalcCurrAPR().String()) + "\n"
+
+	if len(is.CashFlows) > 0 {
+		pa_string += fmt.Sprintf("Net cash flows in nuetral coin: %s %s", is.GetNetCashFlows().Round(5).String(), is.NuetralCoin) + "\n"
+		pa_string += fmt.Sprintf("Time weighted return in nuetral coin: %s%%", is.CalcTimeWeightedReturn().String()) + "\n"
+		if irr, err := is.CalcMoneyWeightedReturn(); err == nil {
+			pa_string += fmt.Sprintf("Money weighted return (IRR) in nuetral coin: %s%%", irr.String()) + "\n"
+		}
+	}
 	return pa_string
 }
 
@@ -108,13 +199,20 @@ func NewPortfolioAnalysis(nuetral_coin string, start_date time.Time, initial_bal
 	}, nil
 }
 
+// GetCurrDiffInValue gets the change of value between the balances, net of the cash flows received since the start.
 func (is *PortfolioAnalysis) GetCurrDiffInValue(start *PortfolioBalance, end *PortfolioBalance) (decimal.Decimal, error) {
 	init_val := start.GetTotal()
 	end_val := end.GetTotal()
 
-	return end_val.Sub(init_val), nil
+	net_flows := decimal.Zero
+	if end_neutral, err := end.GetTotalValueInCoin(is.NuetralCoin); err == nil && end_neutral.IsPositive() {
+		net_flows = is.GetNetCashFlows().Mul(end_val).Div(end_neutral)
+	}
+	return end_val.Sub(init_val).Sub(net_flows), nil
 }
 
+// GetCurrDiffInNuetralCoin gets the change of value in nuetral coin between the balances, net of the cash flows
+// received since the start.
 func (is *PortfolioAnalysis) GetCurrDiffInNuetralCoin(start *PortfolioBalance, end *PortfolioBalance) (decimal.Decimal, error) {
 	init_val, err := start.GetTotalValueInCoin(is.NuetralCoin)
 	if err != nil {
@@ -126,5 +224,5 @@ func (is *PortfolioAnalysis) GetCurrDiffInNuetralCoin(start *PortfolioBalance, e
 		return decimal.Decimal{}, err
 	}
 
-	return end_val.Sub(init_val), nil
+	return end_val.Sub(init_val).Sub(is.GetNetCashFlows()), nil
 }
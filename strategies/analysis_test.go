@@ -0,0 +1,56 @@
+package strategies
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/shopspring/decimal"
+)
+
+// usdPortfolio returns a portfolio holding only usd.
+func usdPortfolio(t *testing.T, amount int64) *PortfolioBalance {
+	t.Helper()
+	market := &environment.Market{Name: "usd-usd", BaseCurrency: "usd", MarketCurrency: "usd"}
+	balance, err := NewCoinBalance("usd", decimal.NewFromInt(amount), &environment.MarketSummary{Last: decimal.NewFromInt(1)}, market)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret, err := NewPortfolioBalance("usd", map[string]*CoinBalance{"usd": balance})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestAddCashFlowsOfOneUpdate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	received := start.AddDate(0, 1, 0)
+	analysis := &PortfolioAnalysis{
+		NuetralCoin:     "usd",
+		StartDate:       start,
+		CurrentDate:     received,
+		InitialBalances: usdPortfolio(t, 1000),
+		CurrentBalances: usdPortfolio(t, 1300), // the deposits were received without any gain.
+	}
+
+	err := analysis.AddCashFlows(
+		environment.CashFlow{Time: received, Coin: "usd", Amount: decimal.NewFromInt(100)},
+		environment.CashFlow{Time: received, Coin: "usd", Amount: decimal.NewFromInt(200)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []int64{1100, 1300} {
+		if got := analysis.CashFlows[i].PortfolioValue; !got.Equal(decimal.NewFromInt(want)) {
+			t.Errorf("the portfolio was worth %s once cash flow %d was received, want %d", got, i, want)
+		}
+	}
+	if net := analysis.GetNetCashFlows(); !net.Equal(decimal.NewFromInt(300)) {
+		t.Errorf("net cash flows are %s, want 300", net)
+	}
+	if twr := analysis.CalcTimeWeightedReturn(); !twr.IsZero() {
+		t.Errorf("time weighted return is %s%%, want 0", twr)
+	}
+}
@@ -3,6 +3,7 @@ package strategies
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/julien040/go-ternary"
@@ -37,14 +38,15 @@ func (is CoinPercentPair) String() string {
 	return strings.TrimSpace(ret)
 }
 
+// MapToSlice returns the pairs of the map sorted by key, so that strategies walking them behave the same on every run.
 func MapToSlice(in map[string]decimal.Decimal) []CoinPercentPair {
-	vec := make([]CoinPercentPair, len(in))
-	i := 0
+	vec := make([]CoinPercentPair, 0, len(in))
 	for k, v := range in {
-		vec[i].Key = k
-		vec[i].Value = v
-		i++
+		vec = append(vec, CoinPercentPair{Key: k, Value: v})
 	}
+	sort.Slice(vec, func(i, j int) bool {
+		return vec[i].Key < vec[j].Key
+	})
 	return vec
 }
 
@@ -104,6 +106,28 @@ func NewPortfolioBalance(static_coin string, balances map[string]*CoinBalance) (
 
 }
 
+// NewPortfolioBalanceFromSnapshot creates a PortfolioBalance of the base coins of the markets from a single account snapshot,
+// market_data holding the summary of each market in the same order.
+func NewPortfolioBalanceFromSnapshot(static_coin string, snapshot *environment.AccountSnapshot, markets []*environment.Market, market_data []*environment.MarketSummary) (*PortfolioBalance, error) {
+	if snapshot == nil {
+		return nil, errors.New("cannot create PortfolioBalance from nil account snapshot")
+	}
+	if len(markets) != len(market_data) {
+		return nil, errors.New("cannot create PortfolioBalance: market data does not match markets")
+	}
+
+	balances := make(map[string]*CoinBalance, len(markets))
+	for i, market := range markets {
+		coin_balance, err := NewCoinBalance(market.BaseCurrency, snapshot.Balance(market.BaseCurrency).Total, market_data[i], market)
+		if err != nil {
+			return nil, err
+		}
+		balances[market.BaseCurrency] = coin_balance
+	}
+
+	return NewPortfolioBalance(static_coin, balances)
+}
+
 func (is PortfolioBalance) String() string {
 	total_str := is.GetTotal().Round(4).String()
 	pb_string := fmt.Sprintln("***	Portfolio Balance, Total: " + total_str + " ***")
@@ -0,0 +1,117 @@
+package strategies
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/mcwarner5/BlockBot8000/exchanges"
+)
+
+// Checkpointer is implemented by the strategies whose state can be saved and restored, to resume simulations. The
+// strategies not implementing it are set up again on resume.
+type Checkpointer interface {
+	Checkpoint() (json.RawMessage, error)
+	Restore(state json.RawMessage, wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) (Strategy, error)
+}
+
+// SimulationCheckpoint represents the state of a simulation at the end of a step, from which it can be resumed.
+type SimulationCheckpoint struct {
+	Time       time.Time                   `json:"time"`
+	Exchanges  []*exchanges.SimulatorState `json:"exchanges"`  // State of each simulated wrapper, in wrapper order.
+	Strategies []json.RawMessage           `json:"strategies"` // State of the strategy of each tactic, null if it has none.
+}
+
+// Checkpoint saves the state of the simulated wrappers and of the strategies of the tactics, to resume the simulation
+// with SimulateFrom. It is meant to be called by a StepFunc.
+func Checkpoint(wrappers []exchanges.ExchangeWrapper, tactics []SimulatedTactic) (*SimulationCheckpoint, error) {
+	checkpoint := &SimulationCheckpoint{
+		Time:       exchanges.ClockOf(wrappers...).Now(),
+		Strategies: make([]json.RawMessage, len(tactics)),
+	}
+
+	markets := tacticMarkets(tactics)
+	for _, wrapper := range wrappers {
+		if checkpointer, ok := wrapper.(exchanges.Checkpointer); ok {
+			state, err := checkpointer.Checkpoint(markets)
+			if err != nil {
+				return nil, err
+			}
+			checkpoint.Exchanges = append(checkpoint.Exchanges, state)
+		}
+	}
+
+	for i, tactic := range tactics {
+		if checkpointer, ok := tactic.Strategy.(Checkpointer); ok {
+			state, err := checkpointer.Checkpoint()
+			if err != nil {
+				return nil, fmt.Errorf("cannot save strategy %s: %w", tactic.Strategy.GetName(), err)
+			}
+			checkpoint.Strategies[i] = state
+		}
+	}
+	return checkpoint, nil
+}
+
+// restore restores the state of the simulated wrappers and of the strategies saved by Checkpoint.
+func restore(checkpoint *SimulationCheckpoint, wrappers []exchanges.ExchangeWrapper, tactics []SimulatedTactic) error {
+	if len(checkpoint.Strategies) != len(tactics) {
+		return fmt.Errorf("the checkpoint has %d strategies, the simulation has %d", len(checkpoint.Strategies), len(tactics))
+	}
+
+	markets := tacticMarkets(tactics)
+	restored := 0
+	for _, wrapper := range wrappers {
+		checkpointer, ok := wrapper.(exchanges.Checkpointer)
+		if !ok {
+			continue
+		}
+		if restored == len(checkpoint.Exchanges) {
+			return errors.New("the checkpoint has fewer simulated exchanges than the simulation")
+		}
+		if err := checkpointer.Restore(checkpoint.Exchanges[restored], markets); err != nil {
+			return err
+		}
+		restored++
+	}
+	if restored != len(checkpoint.Exchanges) {
+		return errors.New("the checkpoint has more simulated exchanges than the simulation")
+	}
+
+	for i := range tactics {
+		t := &tactics[i]
+		checkpointer, ok := t.Strategy.(Checkpointer)
+		if !ok || checkpoint.Strategies[i] == nil {
+			strategy, err := t.Strategy.Setup(t.Wrappers, t.Markets)
+			if err != nil {
+				t.Strategy.OnError(err)
+			}
+			t.Strategy = strategy
+			continue
+		}
+
+		strategy, err := checkpointer.Restore(checkpoint.Strategies[i], t.Wrappers, t.Markets)
+		if err != nil {
+			return fmt.Errorf("cannot restore strategy %s: %w", t.Strategy.GetName(), err)
+		}
+		t.Strategy = strategy
+	}
+	return nil
+}
+
+// tacticMarkets returns the markets of the tactics, once per name.
+func tacticMarkets(tactics []SimulatedTactic) []*environment.Market {
+	var ret []*environment.Market
+	seen := make(map[string]bool)
+	for _, tactic := range tactics {
+		for _, market := range tactic.Markets {
+			if !seen[market.Name] {
+				seen[market.Name] = true
+				ret = append(ret, market)
+			}
+		}
+	}
+	return ret
+}
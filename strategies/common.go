@@ -119,7 +119,14 @@ func MatchWithMarkets(strategyName string, markets []*environment.Market) error
 	return nil
 }
 
+// Apply runs a strategy: event driven strategies are called back with events by ApplyEvents, the others are updated
+// in a loop until they fail.
 func Apply(wrappers []exchanges.ExchangeWrapper, strategy Strategy, markets []*environment.Market) {
+	if IsEventDriven(strategy) {
+		ApplyEvents(wrappers, strategy, markets)
+		return
+	}
+
 	var err error
 
 	strategy, err = strategy.Setup(wrappers, markets)
@@ -128,13 +135,17 @@ func Apply(wrappers []exchanges.ExchangeWrapper, strategy Strategy, markets []*e
 	}
 
 	for err == nil {
+		for _, health := range UnhealthyFeeds(wrappers) {
+			logrus.Warnf("feed of %s is down, using REST data: %s", health.Exchange, health.LastError)
+		}
+
 		strategy, err = strategy.OnUpdate(wrappers, markets)
 		if err != nil {
 			strategy.OnError(err)
 		}
 		for _, wrapper := range wrappers {
-			if wrapper.Name() == "simulator" {
-				err = wrapper.(*exchanges.ExchangeWrapperSimulator).IncrementCurrDate()
+			if stepper, ok := wrapper.(exchanges.Stepper); ok {
+				err = stepper.IncrementCurrDate()
 				if err != nil {
 					strategy.OnError(err)
 				}
@@ -150,15 +161,62 @@ func Apply(wrappers []exchanges.ExchangeWrapper, strategy Strategy, markets []*e
 
 }
 
-// ApplyAllStrategies applies all matched strategies concurrently.
+// ApplyAllStrategies applies all matched strategies concurrently, or in lockstep when replaying history. Like in the
+// simulations, each strategy trades on its own sub-accounts of the simulated exchanges.
 func ApplyAllStrategies(wrappers []exchanges.ExchangeWrapper) {
+	for _, wrapper := range wrappers {
+		if wrapper.IsHistoricalSimulation() {
+			if _, err := Simulate(wrappers, appliedTactics, nil); err != nil {
+				logrus.Error(err)
+			}
+			return
+		}
+	}
+
+	// the sub-accounts are created before any strategy runs, as they are registered on the shared simulator.
+	tactics := make([]SimulatedTactic, len(appliedTactics))
+	for i, t := range appliedTactics {
+		tactics[i] = NewSimulatedTactic(wrappers, t)
+	}
+
 	var wg sync.WaitGroup
-	wg.Add(len(appliedTactics))
-	for _, t := range appliedTactics {
-		go func(wrappers []exchanges.ExchangeWrapper, t Tactic, wg *sync.WaitGroup) {
+	wg.Add(len(tactics))
+	for _, t := range tactics {
+		go func(t SimulatedTactic, wg *sync.WaitGroup) {
 			defer wg.Done()
-			t.Execute(wrappers)
-		}(wrappers, t, &wg)
+			t.Execute(t.Wrappers)
+		}(t, &wg)
 	}
 	wg.Wait()
 }
+
+// ConnectFeeds connects the feeds of the wrappers to the markets the matched tactics trade on them, the wrappers whose
+// feed cannot connect keep using their REST API.
+func ConnectFeeds(wrappers []exchanges.ExchangeWrapper) {
+	for _, wrapper := range wrappers {
+		var markets []*environment.Market
+		for _, t := range appliedTactics {
+			for _, market := range t.Markets {
+				if _, exists := market.ExchangeNames[wrapper.Name()]; exists {
+					markets = append(markets, market)
+				}
+			}
+		}
+
+		if err := wrapper.FeedConnect(markets); err != nil {
+			logrus.Warn("Cannot connect feed of "+wrapper.Name()+", using REST data: ", err)
+		}
+	}
+}
+
+// UnhealthyFeeds returns the health of the supervised feeds of the wrappers which are currently disconnected.
+func UnhealthyFeeds(wrappers []exchanges.ExchangeWrapper) []exchanges.FeedHealth {
+	var ret []exchanges.FeedHealth
+	for _, wrapper := range wrappers {
+		health, supervised := exchanges.FeedHealthOf(wrapper)
+		if supervised && !health.Connected {
+			ret = append(ret, health)
+		}
+	}
+	return ret
+}
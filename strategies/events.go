@@ -0,0 +1,212 @@
+package strategies
+
+import (
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/mcwarner5/BlockBot8000/exchanges"
+)
+
+// EventPollInterval is how often the events of the wrappers without feed are polled when running live.
+var EventPollInterval = time.Minute
+
+// CandleCloseHandler is implemented by the strategies reacting to the close of the candles of their markets.
+type CandleCloseHandler interface {
+	OnCandleClose(wrappers []exchanges.ExchangeWrapper, market *environment.Market, candle environment.CandleStick) (Strategy, error)
+}
+
+// TickerHandler is implemented by the strategies reacting to the changes of the tickers of their markets.
+type TickerHandler interface {
+	OnTicker(wrappers []exchanges.ExchangeWrapper, market *environment.Market, ticker environment.Ticker) (Strategy, error)
+}
+
+// OrderBookHandler is implemented by the strategies reacting to the changes of the order books of their markets.
+type OrderBookHandler interface {
+	OnOrderBook(wrappers []exchanges.ExchangeWrapper, market *environment.Market, book environment.OrderBook) (Strategy, error)
+}
+
+// OrderUpdateHandler is implemented by the strategies reacting to the fills and status changes of the orders of the
+// account on their markets.
+type OrderUpdateHandler interface {
+	OnOrderUpdate(wrappers []exchanges.ExchangeWrapper, market *environment.Market, order environment.Trade) (Strategy, error)
+}
+
+// TimerHandler is implemented by the strategies called back at a regular interval. The timer fires at the multiples of
+// the interval since the Unix epoch, so that it fires at the same times live and in backtests.
+type TimerHandler interface {
+	TimerInterval() time.Duration
+	OnTimer(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market, now time.Time) (Strategy, error)
+}
+
+// EventKindsOf returns the kinds of the events the strategy handles.
+func EventKindsOf(strategy Strategy) environment.EventKinds {
+	ret := make(environment.EventKinds)
+	if _, ok := strategy.(CandleCloseHandler); ok {
+		ret[environment.CandleCloseEvent] = true
+	}
+	if _, ok := strategy.(TickerHandler); ok {
+		ret[environment.TickerEvent] = true
+	}
+	if _, ok := strategy.(OrderBookHandler); ok {
+		ret[environment.OrderBookEvent] = true
+	}
+	if _, ok := strategy.(OrderUpdateHandler); ok {
+		ret[environment.OrderUpdateEvent] = true
+	}
+	if timer, ok := strategy.(TimerHandler); ok && timer.TimerInterval() > 0 {
+		ret[environment.TimerEvent] = true
+	}
+	return ret
+}
+
+// IsEventDriven checks whether the strategy handles events, in which case it is driven by them instead of OnUpdate.
+func IsEventDriven(strategy Strategy) bool {
+	return len(EventKindsOf(strategy)) > 0
+}
+
+// Dispatch calls the handler of the strategy for the event, returning the updated strategy.
+func Dispatch(strategy Strategy, wrappers []exchanges.ExchangeWrapper, markets []*environment.Market, event environment.Event) (Strategy, error) {
+	switch event.Kind {
+	case environment.CandleCloseEvent:
+		if handler, ok := strategy.(CandleCloseHandler); ok && event.Candle != nil {
+			return handler.OnCandleClose(wrappers, event.Market, *event.Candle)
+		}
+	case environment.TickerEvent:
+		if handler, ok := strategy.(TickerHandler); ok && event.Ticker != nil {
+			return handler.OnTicker(wrappers, event.Market, *event.Ticker)
+		}
+	case environment.OrderBookEvent:
+		if handler, ok := strategy.(OrderBookHandler); ok && event.OrderBook != nil {
+			return handler.OnOrderBook(wrappers, event.Market, *event.OrderBook)
+		}
+	case environment.OrderUpdateEvent:
+		if handler, ok := strategy.(OrderUpdateHandler); ok && event.Order != nil {
+			return handler.OnOrderUpdate(wrappers, event.Market, *event.Order)
+		}
+	case environment.TimerEvent:
+		if handler, ok := strategy.(TimerHandler); ok {
+			return handler.OnTimer(wrappers, markets, event.Time)
+		}
+	}
+	return strategy, nil
+}
+
+// nextTimer returns the first time the timer of the interval fires after the specified time.
+func nextTimer(after time.Time, interval time.Duration) time.Time {
+	return after.Truncate(interval).Add(interval)
+}
+
+// ApplyEvents runs an event driven strategy live: it is set up, then called back with the events of the wrappers and
+// its timer until the events end, and finally torn down.
+func ApplyEvents(wrappers []exchanges.ExchangeWrapper, strategy Strategy, markets []*environment.Market) {
+	var err error
+	strategy, err = strategy.Setup(wrappers, markets)
+	if err != nil {
+		strategy.OnError(err)
+	}
+
+	kinds := EventKindsOf(strategy)
+	feedKinds := make(environment.EventKinds, len(kinds))
+	for kind := range kinds {
+		feedKinds[kind] = kind != environment.TimerEvent
+	}
+
+	// the events of every wrapper are merged, the loop ends once they all ended.
+	events := make(chan environment.Event)
+	sources := make(chan struct{}, len(wrappers))
+	var stops []func()
+	for _, wrapper := range wrappers {
+		wrapperEvents, stop := exchanges.EventsOf(wrapper, markets, feedKinds, EventPollInterval)
+		stops = append(stops, stop)
+		go func(wrapperEvents <-chan environment.Event) {
+			for event := range wrapperEvents {
+				events <- event
+			}
+			sources <- struct{}{}
+		}(wrapperEvents)
+	}
+	defer func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}()
+
+	clock := exchanges.ClockOf(wrappers...)
+	var timer <-chan time.Time
+	var interval time.Duration
+	if handler, ok := strategy.(TimerHandler); ok && kinds.Has(environment.TimerEvent) {
+		interval = handler.TimerInterval()
+		now := clock.Now()
+		timer = clock.After(nextTimer(now, interval).Sub(now))
+	}
+
+	for running := len(wrappers); running > 0 || timer != nil; {
+		event := environment.Event{Kind: environment.TimerEvent}
+		select {
+		case event = <-events:
+		case <-sources:
+			running--
+			continue
+		case event.Time = <-timer:
+			timer = clock.After(nextTimer(event.Time, interval).Sub(clock.Now()))
+		}
+
+		strategy, err = Dispatch(strategy, wrappers, markets, event)
+		if err != nil {
+			strategy.OnError(err)
+		}
+	}
+
+	strategy, err = strategy.TearDown(wrappers, markets)
+	if err != nil {
+		strategy.OnError(err)
+	}
+}
+
+// simulatedEvents makes the events of an event driven tactic at each step of a simulation, from its simulated wrappers
+// and the simulated clock.
+type simulatedEvents struct {
+	kinds    environment.EventKinds
+	pollers  []*exchanges.EventPoller
+	interval time.Duration // interval of the timer, 0 if the strategy has none.
+	last     time.Time     // time of the previous step.
+}
+
+// newSimulatedEvents prepares the events of the tactic, recording the current state of its wrappers so that only what
+// happens from the next step on makes events.
+func newSimulatedEvents(t *SimulatedTactic, now time.Time) *simulatedEvents {
+	events := &simulatedEvents{kinds: EventKindsOf(t.Strategy), last: now}
+	if handler, ok := t.Strategy.(TimerHandler); ok {
+		events.interval = handler.TimerInterval()
+	}
+	for _, wrapper := range t.Wrappers {
+		if !wrapper.IsHistoricalSimulation() {
+			continue
+		}
+		poller := exchanges.NewEventPoller(wrapper, 0)
+		poller.Prime(t.Markets, events.kinds)
+		events.pollers = append(events.pollers, poller)
+	}
+	return events
+}
+
+// step dispatches the events which happened since the previous step to the strategy of the tactic: the order updates,
+// candle closes, tickers and order books of its wrappers, then its timer if it fired meanwhile.
+func (events *simulatedEvents) step(t *SimulatedTactic, now time.Time) {
+	var pending []environment.Event
+	for _, poller := range events.pollers {
+		pending = append(pending, poller.Poll(t.Markets, events.kinds)...)
+	}
+	if events.kinds.Has(environment.TimerEvent) && events.interval > 0 && !nextTimer(events.last, events.interval).After(now) {
+		pending = append(pending, environment.Event{Kind: environment.TimerEvent, Time: now})
+	}
+	events.last = now
+
+	for _, event := range pending {
+		strategy, err := Dispatch(t.Strategy, t.Wrappers, t.Markets, event)
+		if err != nil {
+			strategy.OnError(err)
+		}
+		t.Strategy = strategy
+	}
+}
@@ -0,0 +1,203 @@
+package strategies
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+)
+
+// Factory creates a strategy from its configuration, its spec having been validated against the schema of its type.
+type Factory func(environment.StrategyConfig) Strategy
+
+// SpecKind represents the type of the value of a spec field.
+type SpecKind int16
+
+const (
+	SpecString  SpecKind = iota // Text, e.g. a coin.
+	SpecInt                     // Whole number.
+	SpecFloat                   // Decimal number, written with a dot even when whole (e.g. 1.0).
+	SpecBool                    // true or false.
+	SpecWeights                 // Map of coins to decimal numbers.
+)
+
+func (kind SpecKind) String() string {
+	return [...]string{"string", "int", "float", "bool", "weights"}[kind]
+}
+
+func (kind SpecKind) EnumIndex() int {
+	return int(kind)
+}
+
+// SpecField represents a field of the spec of a strategy type.
+type SpecField struct {
+	Name        string
+	Kind        SpecKind
+	Required    bool
+	Example     interface{} // Value of the field in templates, of the Go type the kind is decoded to.
+	Description string
+}
+
+// SpecSchema represents the fields of the spec of a strategy type.
+type SpecSchema []SpecField
+
+// BaseSpecSchema contains the fields every strategy spec has, read by NewBaseStrategy.
+var BaseSpecSchema = SpecSchema{
+	{Name: "name", Kind: SpecString, Required: true, Example: "MyStrategy", Description: "unique name of the strategy"},
+}
+
+// With returns a copy of the schema extended with the fields.
+func (schema SpecSchema) With(fields ...SpecField) SpecSchema {
+	ret := make(SpecSchema, 0, len(schema)+len(fields))
+	return append(append(ret, schema...), fields...)
+}
+
+// registration represents a strategy type of the registry.
+type registration struct {
+	factory Factory
+	schema  SpecSchema
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = make(map[string]registration) //mapped type name -> registration
+)
+
+// Register makes a strategy type available to the strategy: field of the configurations, created by the factory once
+// the spec is validated against the schema. It is meant to be called from the init function of the package defining
+// the strategy, and panics if the type is registered twice or the factory is nil.
+func Register(typeName string, factory Factory, specSchema SpecSchema) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if factory == nil {
+		panic("strategies: Register factory of " + typeName + " is nil")
+	}
+	if _, exists := registry[typeName]; exists {
+		panic("strategies: Register called twice for " + typeName)
+	}
+	registry[typeName] = registration{factory: factory, schema: specSchema}
+}
+
+// RegisteredTypes returns the names of the registered strategy types, sorted.
+func RegisteredTypes() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	ret := make([]string, 0, len(registry))
+	for typeName := range registry {
+		ret = append(ret, typeName)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// SchemaOf returns the spec schema of a registered strategy type.
+func SchemaOf(typeName string) (SpecSchema, error) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	registered, exists := registry[typeName]
+	if !exists {
+		return nil, unknownTypeError(typeName)
+	}
+	return registered.schema, nil
+}
+
+// Validate checks the configuration against the schema of its strategy type, without creating the strategy.
+func Validate(config environment.StrategyConfig) error {
+	schema, err := SchemaOf(config.Strategy)
+	if err != nil {
+		return err
+	}
+	return schema.Validate(config.Spec)
+}
+
+// New creates the strategy of the configuration with the factory of its type, once its spec is validated.
+func New(config environment.StrategyConfig) (Strategy, error) {
+	registryMutex.RLock()
+	registered, exists := registry[config.Strategy]
+	registryMutex.RUnlock()
+
+	if !exists {
+		return nil, unknownTypeError(config.Strategy)
+	}
+	if err := registered.schema.Validate(config.Spec); err != nil {
+		return nil, err
+	}
+	return registered.factory(config), nil
+}
+
+func unknownTypeError(typeName string) error {
+	return fmt.Errorf("unknown strategy %q, registered strategies are %s", typeName, strings.Join(RegisteredTypes(), ", "))
+}
+
+// Validate checks that the spec has every required field, no unknown one, and values of the kind of their field.
+func (schema SpecSchema) Validate(spec map[string]interface{}) error {
+	var errs []error
+	known := make(map[string]bool, len(schema))
+	for _, field := range schema {
+		known[field.Name] = true
+		value, exists := spec[field.Name]
+		if !exists || value == nil {
+			if field.Required {
+				errs = append(errs, fmt.Errorf("spec field %s is required", field.Name))
+			}
+			continue
+		}
+		if err := field.check(value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	var unknown []string
+	for name := range spec {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		errs = append(errs, fmt.Errorf("unknown spec field %s", name))
+	}
+	return errors.Join(errs...)
+}
+
+// check checks that the value is of the kind of the field, as decoded from the configuration file.
+func (field SpecField) check(value interface{}) error {
+	valid := false
+	switch field.Kind {
+	case SpecString:
+		_, valid = value.(string)
+	case SpecInt:
+		_, valid = value.(int)
+	case SpecFloat:
+		_, valid = value.(float64)
+	case SpecBool:
+		_, valid = value.(bool)
+	case SpecWeights:
+		weights, isMap := value.(map[string]interface{})
+		valid = isMap
+		for coin, weight := range weights {
+			if _, isFloat := weight.(float64); !isFloat {
+				return fmt.Errorf("spec field %s.%s must be a float, got %v", field.Name, coin, weight)
+			}
+		}
+	}
+	if !valid {
+		return fmt.Errorf("spec field %s must be a %s, got %v", field.Name, field.Kind, value)
+	}
+	return nil
+}
+
+// Template returns a spec holding the example value of every field of the schema.
+func (schema SpecSchema) Template() map[string]interface{} {
+	ret := make(map[string]interface{}, len(schema))
+	for _, field := range schema {
+		ret[field.Name] = field.Example
+	}
+	return ret
+}
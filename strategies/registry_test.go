@@ -0,0 +1,144 @@
+package strategies
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+)
+
+// registryTestSchema is the schema of the strategy types registered by the tests.
+var registryTestSchema = BaseSpecSchema.With(
+	SpecField{Name: "interval", Kind: SpecInt, Required: true, Example: 60},
+	SpecField{Name: "threshold", Kind: SpecFloat, Example: 0.05},
+	SpecField{Name: "weights", Kind: SpecWeights, Example: map[string]interface{}{"btc": 1.0}},
+)
+
+// newRegistryTestStrategy creates a strategy named by the spec of the configuration.
+func newRegistryTestStrategy(config environment.StrategyConfig) Strategy {
+	return &stepLogStrategy{name: config.Spec["name"].(string)}
+}
+
+// panics returns whether the function panics.
+func panics(function func()) (ret bool) {
+	defer func() {
+		ret = recover() != nil
+	}()
+	function()
+	return false
+}
+
+func TestRegister(t *testing.T) {
+	Register("RegistryTestStrategy", newRegistryTestStrategy, registryTestSchema)
+
+	if !panics(func() { Register("RegistryTestStrategy", newRegistryTestStrategy, registryTestSchema) }) {
+		t.Error("registered a strategy type twice")
+	}
+	if !panics(func() { Register("RegistryTestNilStrategy", nil, registryTestSchema) }) {
+		t.Error("registered a strategy type without factory")
+	}
+
+	types := RegisteredTypes()
+	found := false
+	for i, typeName := range types {
+		found = found || typeName == "RegistryTestStrategy"
+		if typeName == "RegistryTestNilStrategy" {
+			t.Error("the strategy type without factory is registered")
+		}
+		if i > 0 && types[i-1] >= typeName {
+			t.Errorf("registered types %v are not sorted", types)
+		}
+	}
+	if !found {
+		t.Errorf("registered types %v miss RegistryTestStrategy", types)
+	}
+
+	schema, err := SchemaOf("RegistryTestStrategy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema) != 4 || schema[0].Name != "name" || schema[3].Name != "weights" {
+		t.Errorf("got schema %v, want the base fields followed by the registered ones", schema)
+	}
+	if err := schema.Validate(schema.Template()); err != nil {
+		t.Errorf("the template of the schema is not valid: %s", err)
+	}
+}
+
+func TestNewStrategy(t *testing.T) {
+	Register("RegistryTestNewStrategy", newRegistryTestStrategy, registryTestSchema)
+
+	tests := []struct {
+		name     string
+		strategy string
+		spec     map[string]interface{}
+		wantErr  []string // parts of the expected error, none if the strategy is created.
+	}{
+		{
+			name:     "valid spec",
+			strategy: "RegistryTestNewStrategy",
+			spec:     map[string]interface{}{"name": "mine", "interval": 60, "threshold": 0.1, "weights": map[string]interface{}{"btc": 0.5, "eth": 0.5}},
+		},
+		{
+			name:     "optional fields omitted",
+			strategy: "RegistryTestNewStrategy",
+			spec:     map[string]interface{}{"name": "mine", "interval": 60},
+		},
+		{
+			name:     "unknown strategy",
+			strategy: "RegistryTestMissingStrategy",
+			spec:     map[string]interface{}{"name": "mine", "interval": 60},
+			wantErr:  []string{`unknown strategy "RegistryTestMissingStrategy"`, "RegistryTestNewStrategy"},
+		},
+		{
+			name:     "missing required fields",
+			strategy: "RegistryTestNewStrategy",
+			spec:     map[string]interface{}{},
+			wantErr:  []string{"spec field name is required", "spec field interval is required"},
+		},
+		{
+			name:     "wrong kinds",
+			strategy: "RegistryTestNewStrategy",
+			spec:     map[string]interface{}{"name": "mine", "interval": 1.5, "threshold": 1},
+			wantErr:  []string{"spec field interval must be a int, got 1.5", "spec field threshold must be a float, got 1"},
+		},
+		{
+			name:     "weight of the wrong kind",
+			strategy: "RegistryTestNewStrategy",
+			spec:     map[string]interface{}{"name": "mine", "interval": 60, "weights": map[string]interface{}{"btc": "half"}},
+			wantErr:  []string{"spec field weights.btc must be a float, got half"},
+		},
+		{
+			name:     "unknown fields",
+			strategy: "RegistryTestNewStrategy",
+			spec:     map[string]interface{}{"name": "mine", "interval": 60, "intervall": 30},
+			wantErr:  []string{"unknown spec field intervall"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := environment.StrategyConfig{Strategy: test.strategy, Spec: test.spec}
+			strategy, err := New(config)
+			validateErr := Validate(config)
+
+			if len(test.wantErr) == 0 {
+				if err != nil || validateErr != nil {
+					t.Fatalf("got errors %v, %v", err, validateErr)
+				}
+				if strategy.GetName() != "mine" {
+					t.Errorf("created strategy %s, want mine", strategy.GetName())
+				}
+				return
+			}
+			if err == nil || validateErr == nil {
+				t.Fatalf("got errors %v, %v, want %v", err, validateErr, test.wantErr)
+			}
+			for _, part := range test.wantErr {
+				if !strings.Contains(err.Error(), part) || !strings.Contains(validateErr.Error(), part) {
+					t.Errorf("got errors %q, %q, want %q", err, validateErr, part)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package strategies
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ValuePoint represents the value of a portfolio at a time, along with the cash flow it received since the previous
+// point (negative for withdrawals), which is part of the value.
+type ValuePoint struct {
+	Time  time.Time
+	Value decimal.Decimal
+	Flow  decimal.Decimal
+}
+
+// TimeWeightedReturn returns the growth of the portfolio over the points as a fraction, chaining the returns between the
+// cash flows so that deposits and withdrawals are not counted as gains or losses.
+func TimeWeightedReturn(points []ValuePoint) decimal.Decimal {
+	growth := decimal.NewFromInt(1)
+	for i := 1; i < len(points); i++ {
+		previous := points[i-1].Value
+		if !previous.IsPositive() {
+			continue
+		}
+		growth = growth.Mul(points[i].Value.Sub(points[i].Flow).Div(previous))
+	}
+	return growth.Sub(decimal.NewFromInt(1))
+}
+
+// MoneyWeightedReturn returns the yearly internal rate of return of the portfolio over the points as a fraction: the rate
+// at which the initial value and the cash flows grow into the final value.
+func MoneyWeightedReturn(points []ValuePoint) (decimal.Decimal, error) {
+	if len(points) < 2 {
+		return decimal.Zero, errors.New("the money weighted return needs at least two values")
+	}
+	first, last := points[0], points[len(points)-1]
+	if !last.Time.After(first.Time) {
+		return decimal.Zero, errors.New("the money weighted return needs values at different times")
+	}
+
+	// value of every flow at the end of the period for a yearly rate, the final value being the sum at the right rate.
+	years := func(at time.Time) float64 {
+		return last.Time.Sub(at).Hours() / 24 / 365
+	}
+	surplus := func(rate float64) float64 {
+		ret := last.Value.InexactFloat64() - first.Value.InexactFloat64()*math.Pow(1+rate, years(first.Time))
+		for _, point := range points[1:] {
+			ret -= point.Flow.InexactFloat64() * math.Pow(1+rate, years(point.Time))
+		}
+		return ret
+	}
+
+	// the surplus decreases with the rate as long as more is invested than withdrawn, bisect its root.
+	low, high := -0.9999, 1.0
+	for surplus(high) > 0 && high < 1e9 {
+		high *= 10
+	}
+	if surplus(low) < 0 || surplus(high) > 0 {
+		return decimal.Zero, errors.New("the money weighted return has no solution for these cash flows")
+	}
+	for i := 0; i < 200 && high-low > 1e-10; i++ {
+		mid := (low + high) / 2
+		if surplus(mid) > 0 {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return decimal.NewFromFloat((low + high) / 2), nil
+}
@@ -0,0 +1,81 @@
+package strategies
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// points builds value points 365 days apart from pairs of value and flow.
+func points(pairs ...float64) []ValuePoint {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ret := make([]ValuePoint, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		ret = append(ret, ValuePoint{
+			Time:  start.Add(time.Duration(i/2) * 365 * 24 * time.Hour),
+			Value: decimal.NewFromFloat(pairs[i]),
+			Flow:  decimal.NewFromFloat(pairs[i+1]),
+		})
+	}
+	return ret
+}
+
+func TestTimeWeightedReturn(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []ValuePoint
+		want   float64
+	}{
+		{name: "single value", points: points(100, 0), want: 0},
+		{name: "growth", points: points(100, 0, 110, 0, 121, 0), want: 0.21},
+		{name: "deposit is not a gain", points: points(100, 0, 210, 100, 231, 0), want: 0.21},
+		{name: "withdrawal is not a loss", points: points(100, 0, 60, -50, 66, 0), want: 0.21},
+		{name: "loss", points: points(100, 0, 80, 0), want: -0.2},
+		{name: "empty portfolio left out", points: points(0, 0, 100, 100, 110, 0), want: 0.1},
+	}
+	for _, test := range tests {
+		if got := TimeWeightedReturn(test.points).InexactFloat64(); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s: time weighted return is %f, want %f", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMoneyWeightedReturn(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []ValuePoint
+		want   float64
+	}{
+		{name: "growth", points: points(100, 0, 110, 0), want: 0.1},
+		{name: "two years", points: points(100, 0, 110, 0, 121, 0), want: 0.1},
+		// the deposit grows by 10% for a year: 100 * 1.1^2 + 100 * 1.1 = 231.
+		{name: "deposit", points: points(100, 0, 210, 100, 231, 0), want: 0.1},
+		{name: "loss", points: points(100, 0, 50, 0), want: -0.5},
+	}
+	for _, test := range tests {
+		got, err := MoneyWeightedReturn(test.points)
+		if err != nil {
+			t.Errorf("%s: returned error %v", test.name, err)
+			continue
+		}
+		if math.Abs(got.InexactFloat64()-test.want) > 1e-4 {
+			t.Errorf("%s: money weighted return is %s, want %f", test.name, got, test.want)
+		}
+	}
+
+	errs := []struct {
+		name   string
+		points []ValuePoint
+	}{
+		{name: "single value", points: points(100, 0)},
+		{name: "same times", points: []ValuePoint{points(100, 0)[0], points(110, 0)[0]}},
+		{name: "everything lost", points: points(100, 0, 0, 0)},
+	}
+	for _, test := range errs {
+		if _, err := MoneyWeightedReturn(test.points); err == nil {
+			t.Errorf("%s: returned no error", test.name)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package strategies
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/exchanges"
+	"github.com/sirupsen/logrus"
+)
+
+// SimulatedTactic represents a tactic running on its own sub-accounts of the simulated exchanges.
+type SimulatedTactic struct {
+	Tactic
+	Wrappers []exchanges.ExchangeWrapper
+}
+
+// NewSimulatedTactic binds a tactic to new sub-accounts of the simulated wrappers, the other wrappers are shared.
+func NewSimulatedTactic(wrappers []exchanges.ExchangeWrapper, tactic Tactic) SimulatedTactic {
+	accounts := make([]exchanges.ExchangeWrapper, len(wrappers))
+	for i, wrapper := range wrappers {
+		accounts[i] = wrapper
+		if provider, ok := wrapper.(exchanges.SubAccountProvider); ok {
+			accounts[i] = provider.SubAccount()
+		}
+	}
+	return SimulatedTactic{Tactic: tactic, Wrappers: accounts}
+}
+
+// StepFunc is called at each step of a simulation, once all the tactics were updated.
+type StepFunc func(now time.Time, tactics []SimulatedTactic)
+
+// Simulate runs the tactics in lockstep on the simulated time: at each step every tactic is updated in order, onStep is
+// called if not nil, then each simulated clock is advanced once. Event driven tactics are updated with the events which
+// happened since the previous step instead of OnUpdate. Each tactic trades on its own sub-accounts, the tactics
+// with their final strategies are returned once the end of the simulation is reached.
+func Simulate(wrappers []exchanges.ExchangeWrapper, tactics []Tactic, onStep StepFunc) ([]SimulatedTactic, error) {
+	return SimulateFrom(wrappers, tactics, nil, onStep)
+}
+
+// SimulateFrom runs the tactics like Simulate, resuming from the step saved by the checkpoint if not nil: the state of
+// the wrappers and strategies is restored instead of setting them up, and the simulation goes on with the next step.
+func SimulateFrom(wrappers []exchanges.ExchangeWrapper, tactics []Tactic, checkpoint *SimulationCheckpoint, onStep StepFunc) ([]SimulatedTactic, error) {
+	var steppers []exchanges.Stepper
+	for _, wrapper := range wrappers {
+		if stepper, ok := wrapper.(exchanges.Stepper); ok {
+			steppers = append(steppers, stepper)
+		}
+	}
+	if len(steppers) == 0 {
+		return nil, errors.New("cannot simulate without a simulated exchange")
+	}
+
+	simulated := make([]SimulatedTactic, len(tactics))
+	for i, tactic := range tactics {
+		simulated[i] = NewSimulatedTactic(wrappers, tactic)
+	}
+
+	ended := false
+	clock := exchanges.ClockOf(wrappers...)
+	events := make([]*simulatedEvents, len(simulated)) // events of the event driven tactics, nil for the others.
+	if checkpoint != nil {
+		if err := restore(checkpoint, wrappers, simulated); err != nil {
+			return nil, err
+		}
+		startEvents(simulated, events, clock.Now())
+		// the checkpoint was saved once its step was over, the simulation resumes with the next one.
+		if err := step(steppers); err != nil {
+			logrus.Info(err)
+			ended = true
+		}
+	} else {
+		for i := range simulated {
+			t := &simulated[i]
+			strategy, err := t.Strategy.Setup(t.Wrappers, t.Markets)
+			if err != nil {
+				t.Strategy.OnError(err)
+			}
+			t.Strategy = strategy
+		}
+		startEvents(simulated, events, clock.Now())
+	}
+
+	for !ended {
+		now := clock.Now()
+		for i := range simulated {
+			t := &simulated[i]
+			if events[i] != nil {
+				events[i].step(t, now)
+				continue
+			}
+			strategy, err := t.Strategy.OnUpdate(t.Wrappers, t.Markets)
+			if err != nil {
+				t.Strategy.OnError(err)
+			}
+			t.Strategy = strategy
+		}
+		if onStep != nil {
+			onStep(now, simulated)
+		}
+
+		if err := step(steppers); err != nil {
+			logrus.Info(err)
+			break
+		}
+	}
+
+	for i := range simulated {
+		t := &simulated[i]
+		strategy, err := t.Strategy.TearDown(t.Wrappers, t.Markets)
+		if err != nil {
+			t.Strategy.OnError(err)
+		}
+		t.Strategy = strategy
+	}
+
+	return simulated, nil
+}
+
+// startEvents prepares the events of the event driven tactics, which are driven by them instead of OnUpdate.
+func startEvents(simulated []SimulatedTactic, events []*simulatedEvents, now time.Time) {
+	for i := range simulated {
+		if IsEventDriven(simulated[i].Strategy) {
+			events[i] = newSimulatedEvents(&simulated[i], now)
+		}
+	}
+}
+
+// step advances each simulated clock once, stopping at the first one reaching the end of its simulation.
+func step(steppers []exchanges.Stepper) error {
+	for _, stepper := range steppers {
+		if err := stepper.IncrementCurrDate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
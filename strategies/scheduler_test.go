@@ -0,0 +1,122 @@
+package strategies
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mcwarner5/BlockBot8000/environment"
+	"github.com/mcwarner5/BlockBot8000/exchanges"
+	"github.com/shopspring/decimal"
+)
+
+// stepLogStrategy logs each of its calls with the simulated time, buying on each update if it has an amount to buy.
+type stepLogStrategy struct {
+	name  string
+	buy   decimal.Decimal
+	log   *[]string
+	error error // first error of the strategy, if any.
+}
+
+func (strategy *stepLogStrategy) GetName() string {
+	return strategy.name
+}
+
+func (strategy *stepLogStrategy) record(call string, wrappers []exchanges.ExchangeWrapper) {
+	*strategy.log = append(*strategy.log, fmt.Sprintf("%s %s %s", strategy.name, call, exchanges.ClockOf(wrappers...).Now().Format("01-02 15:04")))
+}
+
+func (strategy *stepLogStrategy) Setup(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) (Strategy, error) {
+	strategy.record("setup", wrappers)
+	return strategy, nil
+}
+
+func (strategy *stepLogStrategy) TearDown(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) (Strategy, error) {
+	strategy.record("teardown", wrappers)
+	return strategy, nil
+}
+
+func (strategy *stepLogStrategy) OnUpdate(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) (Strategy, error) {
+	strategy.record("update", wrappers)
+	if strategy.buy.IsPositive() {
+		if _, err := wrappers[0].BuyMarket(markets[0], strategy.buy); err != nil {
+			return strategy, err
+		}
+	}
+	return strategy, nil
+}
+
+func (strategy *stepLogStrategy) OnError(err error) {
+	if strategy.error == nil {
+		strategy.error = err
+	}
+}
+
+func TestSimulateRunsTacticsInLockstep(t *testing.T) {
+	inner := exchanges.NewSyntheticWrapper(environment.SyntheticConfig{
+		Seed:      1,
+		StartDate: "2024-01-01",
+		Interval:  60,
+		Markets:   []environment.SyntheticMarketConfig{{Name: "ETH-USD", Price: 2000, Volatility: 0.5, Volume: 10}},
+	}, nil)
+	wrapper := exchanges.NewExchangeWrapperSimulator(inner, environment.SimulationConfig{
+		SimModeOn:       true,
+		SimStartDate:    "2024-01-01",
+		SimEndDate:      "2024-01-02",
+		SimInterval:     60,
+		SimFakeBalances: map[string]decimal.Decimal{"eth": decimal.Zero, "usd": decimal.NewFromInt(100000)},
+		SimFillModel:    environment.FillModelConfig{Model: "candle"},
+	})
+	market := &environment.Market{Name: "ETH-USD", BaseCurrency: "eth", MarketCurrency: "usd", ExchangeNames: map[string]string{"synthetic": "ETH-USD"}}
+
+	var log []string
+	buyer := &stepLogStrategy{name: "buyer", buy: decimal.RequireFromString("0.1"), log: &log}
+	holder := &stepLogStrategy{name: "holder", log: &log}
+	tactics := []Tactic{{Markets: []*environment.Market{market}, Strategy: buyer}, {Markets: []*environment.Market{market}, Strategy: holder}}
+
+	simulated, err := Simulate([]exchanges.ExchangeWrapper{wrapper}, tactics, func(now time.Time, tactics []SimulatedTactic) {
+		log = append(log, "step "+now.Format("01-02 15:04"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buyer.error != nil || holder.error != nil {
+		t.Fatalf("the tactics failed: %v, %v", buyer.error, holder.error)
+	}
+
+	// the simulation steps through every hour of its dates, its end included, and stops on the last one.
+	want := []string{"buyer setup 01-01 00:00", "holder setup 01-01 00:00"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for hour := 0; hour <= 24; hour++ {
+		now := start.Add(time.Duration(hour) * time.Hour).Format("01-02 15:04")
+		want = append(want, "buyer update "+now, "holder update "+now, "step "+now)
+	}
+	want = append(want, "buyer teardown 01-02 00:00", "holder teardown 01-02 00:00")
+	if len(log) != len(want) {
+		t.Fatalf("got calls %v, want %v", log, want)
+	}
+	for i := range want {
+		if log[i] != want[i] {
+			t.Fatalf("call %d is %q, want %q: got %v", i, log[i], want[i], log)
+		}
+	}
+
+	// each tactic trades on its own sub-account of the simulated exchange.
+	if len(simulated) != 2 || simulated[0].Wrappers[0] == simulated[1].Wrappers[0] {
+		t.Fatal("the tactics share their accounts")
+	}
+	bought, err := simulated[0].Wrappers[0].GetBalance("eth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bought.Equal(decimal.RequireFromString("2.5")) {
+		t.Errorf("the buyer holds %s eth, want 2.5", bought)
+	}
+	held, err := simulated[1].Wrappers[0].GetBalance("eth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !held.IsZero() {
+		t.Errorf("the holder holds %s eth bought by the buyer", held)
+	}
+}
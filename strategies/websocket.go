@@ -5,16 +5,16 @@ import (
 	"github.com/mcwarner5/BlockBot8000/exchanges"
 )
 
-// WebsocketStrategy polls data from a websocket in real-time.
+// WebsocketStrategy runs an event driven strategy on the events of the websocket feeds of the wrappers.
 //
-//	NOTE: The update function must be handled in the websocket strategy-model.
+//	NOTE: the wrappers without feed are polled instead, see ApplyEvents.
 type WebsocketStrategy struct {
-	Model StrategyModel
+	Model Strategy
 }
 
 // Name returns the name of the strategy.
 func (wss WebsocketStrategy) Name() string {
-	return wss.Model.Name
+	return wss.Model.GetName()
 }
 
 // String returns a string representation of the object.
@@ -22,36 +22,7 @@ func (wss WebsocketStrategy) String() string {
 	return wss.Name()
 }
 
-// Apply executes Cyclically the On Update, basing on provided interval.
+// Apply calls back the strategy with the events of the wrappers until they end.
 func (wss WebsocketStrategy) Apply(wrappers []exchanges.ExchangeWrapper, markets []*environment.Market) {
-	/*var err error
-
-	hasSetupFunc := wss.Model.Setup != nil
-	hasTearDownFunc := wss.Model.TearDown != nil
-	hasUpdateFunc := wss.Model.OnUpdate != nil
-	hasErrorFunc := wss.Model.OnError != nil
-
-	if hasSetupFunc {
-		err = wss.Model.Setup(wrappers, markets)
-		if err != nil && hasErrorFunc {
-			wss.Model.OnError(err)
-		}
-	}
-
-	// update is handled by the developer externally, here we just checked for existence.
-	if !hasUpdateFunc {
-		_err := errors.New("OnUpdate func cannot be empty")
-		if hasErrorFunc {
-			wss.Model.OnError(_err)
-		} else {
-			panic(_err)
-		}
-	}
-
-	if hasTearDownFunc {
-		err = wss.Model.TearDown(wrappers, markets)
-		if err != nil && hasErrorFunc {
-			wss.Model.OnError(err)
-		}
-	}*/
+	ApplyEvents(wrappers, wss.Model, markets)
 }